@@ -1,25 +1,61 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/rs/zerolog"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/access"
+	"github.com/tuncerburak97/muhtar/internal/admin"
+	"github.com/tuncerburak97/muhtar/internal/alert"
+	"github.com/tuncerburak97/muhtar/internal/anomaly"
+	"github.com/tuncerburak97/muhtar/internal/bench"
+	"github.com/tuncerburak97/muhtar/internal/chaos"
 	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/credentials"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
+	"github.com/tuncerburak97/muhtar/internal/forwarded"
+	"github.com/tuncerburak97/muhtar/internal/grpcproxy"
+	"github.com/tuncerburak97/muhtar/internal/health"
+	"github.com/tuncerburak97/muhtar/internal/inspector"
+	"github.com/tuncerburak97/muhtar/internal/listener"
+	"github.com/tuncerburak97/muhtar/internal/logger"
+	"github.com/tuncerburak97/muhtar/internal/logquery"
 	"github.com/tuncerburak97/muhtar/internal/metrics"
+	"github.com/tuncerburak97/muhtar/internal/openapi"
+	"github.com/tuncerburak97/muhtar/internal/pipeline"
 	"github.com/tuncerburak97/muhtar/internal/proxy"
+	"github.com/tuncerburak97/muhtar/internal/qos"
 	"github.com/tuncerburak97/muhtar/internal/ratelimit"
 	"github.com/tuncerburak97/muhtar/internal/repository"
+	"github.com/tuncerburak97/muhtar/internal/rollup"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
+	"github.com/tuncerburak97/muhtar/internal/service"
+	"github.com/tuncerburak97/muhtar/internal/shadow"
+	"github.com/tuncerburak97/muhtar/internal/slo"
+	"github.com/tuncerburak97/muhtar/internal/stats"
+	"github.com/tuncerburak97/muhtar/internal/tenant"
 	"github.com/tuncerburak97/muhtar/internal/transform"
+	"github.com/tuncerburak97/muhtar/internal/usage"
 )
 
 func main() {
+	// Dispatch sub-commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			os.Exit(bench.Run(os.Args[2:]))
+		case "test-transforms":
+			os.Exit(transform.RunTestTransforms(os.Args[2:]))
+		}
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "config/config.yaml", "path to config file")
 	flag.Parse()
@@ -31,25 +67,60 @@ func main() {
 	}
 
 	// Configure logging
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	if cfg.Log.Format == "json" {
-		log.Logger = log.Output(os.Stdout)
+	if err := logger.Init(&cfg.Log); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure logging")
 	}
-	level, err := zerolog.ParseLevel(cfg.Log.Level)
+
+	correlation, err := logger.NewCorrelation(&cfg.Correlation)
 	if err != nil {
-		log.Warn().Err(err).Msg("Invalid log level, defaulting to info")
-		level = zerolog.InfoLevel
+		log.Fatal().Err(err).Msg("Invalid correlation id configuration")
+	}
+
+	// Report gateway failures to Sentry
+	if cfg.Sentry.Enabled {
+		if err := sentry.Init(&cfg.Sentry); err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize Sentry")
+		}
 	}
-	zerolog.SetGlobalLevel(level)
 
 	// Initialize metrics collector
 	metricsCollector := metrics.GetMetricsCollector("muhtar", "muhtar_proxy")
+	access.SetMetrics(metricsCollector)
 
-	// Initialize repository
-	repo, err := repository.NewRepository(cfg.DB)
+	// Initialize repository with health monitoring
+	backend, err := repository.NewRepository(cfg.DB)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize repository")
 	}
+	if cfg.DB.AutoMigrate {
+		if err := backend.Migrate(log.Logger.WithContext(context.Background())); err != nil {
+			log.Fatal().Err(err).Msg("Failed to migrate repository schema")
+		}
+	}
+	repo := repository.NewMonitor(cfg.DB.Health, backend, func() (repository.LogRepository, error) {
+		return repository.NewRepository(cfg.DB)
+	})
+
+	// Log queries go to the read replica when configured, keeping analytical
+	// queries away from the write path
+	reader := repo
+	var replica *repository.Monitor
+	if cfg.DB.Replica.Enabled {
+		replicaBackend, err := repository.NewReadRepository(cfg.DB)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize read replica")
+		}
+		replica = repository.NewMonitor(cfg.DB.Health, replicaBackend, func() (repository.LogRepository, error) {
+			return repository.NewReadRepository(cfg.DB)
+		})
+		reader = replica
+	}
+
+	// Initialize asynchronous log persistence
+	logService, err := service.NewLoggerService(repo, metricsCollector, cfg.Log.Persistence)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize log persistence")
+	}
 
 	// Initialize rate limiter if enabled
 	var rateLimiter *ratelimit.Service
@@ -69,46 +140,337 @@ func main() {
 		if err != nil {
 			log.Fatal().Err(err).Msg("Failed to create rate limit store")
 		}
-		rateLimiter = ratelimit.NewService(&cfg.RateLimit, store)
+		rateLimiter, err = ratelimit.NewService(&cfg.RateLimit, store)
 		if err != nil {
 			log.Fatal().Err(err).Msg("Failed to initialize rate limiter")
 		}
 	}
 
+	// Initialize rate limit violation events
+	var rateLimitEvents *ratelimit.EventRecorder
+	if rateLimiter != nil && cfg.RateLimit.Events.Enabled {
+		rateLimitEvents = ratelimit.NewEventRecorder(&cfg.RateLimit.Events, repo, reader)
+	}
+
 	// Initialize transform engine
 	transformEngine, err := transform.NewEngine(cfg.Proxy.Transform)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize transform engine")
 	}
 
+	// Initialize routing script
+	var router *transform.Router
+	if cfg.Proxy.Routing.Script != "" {
+		router, err = transform.NewRouter(&cfg.Proxy.Routing)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize routing script")
+		}
+	}
+
+	// Initialize upstream credentials, rotated from secret manager files
+	var upstreamCredentials *credentials.Manager
+	if cfg.Proxy.UpstreamAuth.Enabled {
+		upstreamCredentials, err = credentials.NewManager(&cfg.Proxy.UpstreamAuth,
+			credentials.WithAudit(logService),
+			credentials.WithMetrics(metricsCollector),
+		)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize upstream credentials")
+		}
+	}
+
+	// Initialize chaos injector
+	chaosInjector, err := chaos.NewInjector(cfg.Chaos)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize chaos injector")
+	}
+
+	// Initialize traffic rollups
+	var rollups *rollup.Aggregator
+	if cfg.DB.Rollup.Enabled {
+		rollups = rollup.NewAggregator(&cfg.DB.Rollup, repo, reader)
+	}
+
+	// Initialize traffic mirror
+	var mirror *shadow.Mirror
+	if cfg.Proxy.Mirror.Enabled {
+		mirror, err = shadow.NewMirror(&cfg.Proxy.Mirror, metricsCollector)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize traffic mirror")
+		}
+	}
+
+	// Initialize live traffic inspector
+	var trafficInspector *inspector.Inspector
+	if cfg.Inspector.Enabled {
+		trafficInspector = inspector.New(&cfg.Inspector)
+	}
+
+	// Initialize tenant registry
+	var tenants *tenant.Registry
+	if cfg.Tenancy.Enabled {
+		tenants, err = tenant.NewRegistry(&cfg.Tenancy)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize tenants")
+		}
+	}
+
+	// Load tenants onboarded and limit overrides set through the admin API
+	var provisioner *tenant.Provisioner
+	var tenantLimits *tenant.LimitManager
+	if tenants != nil {
+		provisioner = tenant.NewProvisioner(tenants, repo, cfg.Tenancy.LimitRefresh)
+		tenantLimits = tenant.NewLimitManager(tenants, repo, cfg.Tenancy.LimitRefresh)
+	}
+
+	// Initialize feature flags, targeting the tenant once it is identified
+	var flagProvider *featureflag.MemoryProvider
+	var flags *featureflag.Client
+	if cfg.Flags.Enabled {
+		flagProvider, err = featureflag.NewMemoryProvider(cfg.Flags.Flags)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize feature flags")
+		}
+		flags = featureflag.NewClient(flagProvider, &cfg.Flags,
+			featureflag.WithMetrics(metricsCollector),
+			featureflag.WithAttributes(func(c *fiber.Ctx) map[string]interface{} {
+				if t := tenant.FromContext(c); t != nil {
+					return map[string]interface{}{"tenant": t.ID}
+				}
+				return nil
+			}),
+		)
+	}
+
+	// Initialize tenant usage metering
+	var usageMeter *usage.Meter
+	if tenants != nil && cfg.Tenancy.Usage.Enabled {
+		usageMeter = usage.NewMeter(&cfg.Tenancy.Usage, repo, reader)
+	}
+
+	// Initialize SLO tracking
+	var sloMonitor *slo.Monitor
+	if cfg.SLO.Enabled {
+		sloMonitor = slo.NewMonitor(&cfg.SLO)
+	}
+
+	// Initialize priority admission
+	var scheduler *qos.Scheduler
+	if cfg.QoS.Enabled {
+		scheduler, err = qos.NewScheduler(&cfg.QoS, metricsCollector)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize priority classes")
+		}
+	}
+
+	// Initialize traffic alerting
+	var alerts *alert.Manager
+	if cfg.Alerting.Enabled {
+		alerts, err = alert.NewManager(&cfg.Alerting)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize alerting")
+		}
+	}
+
+	// Initialize traffic baselines
+	var anomalies *anomaly.Detector
+	if cfg.Anomaly.Enabled {
+		anomalies = anomaly.NewDetector(&cfg.Anomaly, metricsCollector, alerts)
+	}
+
+	// Initialize top endpoints statistics
+	var topStats *stats.Tracker
+	if cfg.Stats.Enabled {
+		topStats = stats.NewTracker(&cfg.Stats)
+	}
+
+	var forwardedHeaders *forwarded.Headers
+	if cfg.Proxy.Forwarded.Enabled {
+		forwardedHeaders, err = forwarded.New(cfg.Proxy.Forwarded)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize forwarded headers")
+		}
+	}
+
 	// Create Fiber app
-	app := fiber.New(fiber.Config{
+	fiberConfig := fiber.Config{
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
-	})
+		// Bodies over the limit are handed to the proxy unread, to be piped
+		StreamRequestBody: proxy.StreamsRequests(&cfg.Proxy),
+	}
+	if forwardedHeaders != nil {
+		// Always set by the forwarded middleware to the resolved client
+		fiberConfig.ProxyHeader = forwarded.HeaderRealIP
+	}
+	app := fiber.New(fiberConfig)
 
-	// Add rate limiting middleware if enabled
-	if rateLimiter != nil {
-		app.Use(ratelimit.Middleware(rateLimiter))
+	// Turn panics, e.g. in transforms, into 500 responses reported to Sentry
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, e interface{}) {
+			log.Error().Interface("panic", e).Str("path", c.Path()).Msg("Recovered from panic")
+			sentry.CapturePanic(c, e)
+		},
+	}))
+	if forwardedHeaders != nil {
+		app.Use(forwardedHeaders.Handler)
+	}
+
+	// QUIC listener, announced to TCP clients through Alt-Svc
+	var http3Server *listener.HTTP3
+	if cfg.Server.HTTP3.Enabled {
+		http3Server, err = listener.NewHTTP3(&cfg.Server, app)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize HTTP/3 listener")
+		}
+		app.Use(http3Server.Advertise)
 	}
 
 	// Initialize and set up proxy handler
-	proxyHandler, err := proxy.NewProxyHandler(&cfg.Proxy, &log.Logger, repo, metricsCollector, transformEngine)
+	proxyOpts := []proxy.Option{
+		proxy.WithChaos(chaosInjector),
+		proxy.WithMirror(mirror),
+		proxy.WithInspector(trafficInspector),
+		proxy.WithRollups(rollups),
+		proxy.WithUsage(usageMeter),
+		proxy.WithSLO(sloMonitor),
+		proxy.WithRouter(router),
+		proxy.WithFlags(flags),
+		proxy.WithCredentials(upstreamCredentials),
+		proxy.WithForwarded(forwardedHeaders),
+	}
+	if alerts != nil {
+		// Health check transitions feed the upstream_unhealthy alert rule
+		proxyOpts = append(proxyOpts, proxy.WithUpstreamReporter(alerts))
+	}
+	proxyHandler, err := proxy.NewProxyHandler(&cfg.Proxy, &log.Logger, logService, metricsCollector, transformEngine, proxyOpts...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize proxy handler")
 	}
 
+	// Mount health probes before the proxy catch-all route
+	probes := health.NewHandler(cfg.DB.Health.Timeout)
+	probes.Register("repository", repo.Check)
+	probes.Mount(app)
+
+	// Mount admin API before the proxy catch-all route
+	if cfg.Admin.Enabled {
+		adminServer, err := admin.NewServer(app, &cfg.Admin)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize admin API")
+		}
+		adminServer.Register(
+			repo,
+			logService,
+			chaosInjector,
+			proxyHandler.DryRun(),
+			proxyHandler.Maintenance(),
+			proxyHandler,
+			openapi.NewHandler(reader),
+			logquery.NewHandler(reader, cfg.Tenancy.Enabled && cfg.Tenancy.LogIsolation),
+			metricsCollector,
+		)
+		if mirror != nil {
+			adminServer.Register(mirror)
+		}
+		if trafficInspector != nil {
+			adminServer.Register(trafficInspector)
+		}
+		if rollups != nil {
+			adminServer.Register(rollups)
+		}
+		if tenantLimits != nil {
+			adminServer.Register(provisioner, tenantLimits)
+		}
+		if usageMeter != nil {
+			adminServer.Register(usageMeter)
+		}
+		if sloMonitor != nil {
+			adminServer.Register(sloMonitor)
+		}
+		if scheduler != nil {
+			adminServer.Register(scheduler)
+		}
+		if alerts != nil {
+			adminServer.Register(alerts)
+		}
+		if anomalies != nil {
+			adminServer.Register(anomalies)
+		}
+		if topStats != nil {
+			adminServer.Register(topStats)
+		}
+		if rateLimitEvents != nil {
+			adminServer.Register(rateLimitEvents)
+		}
+		if flagProvider != nil {
+			adminServer.Register(flagProvider)
+		}
+		if upstreamCredentials != nil {
+			adminServer.Register(upstreamCredentials)
+		}
+	}
+
+	// Proxied traffic only: probes and the admin API are matched first and
+	// never reach the pipeline stages
+	stages := pipeline.New(&cfg.Pipeline)
+	register := func(name string, s pipeline.Stage) {
+		if err := stages.Register(name, s); err != nil {
+			log.Fatal().Err(err).Msg("Failed to register pipeline stage")
+		}
+	}
+	register(pipeline.StageCorrelation, correlation.Stage(log.Logger))
+	if alerts != nil {
+		register(pipeline.StageAlerts, alerts.Stage)
+	}
+	if anomalies != nil {
+		register(pipeline.StageAnomalies, anomalies.Stage)
+	}
+	if topStats != nil {
+		register(pipeline.StageStats, topStats.Stage)
+	}
+	if tenants != nil {
+		register(pipeline.StageTenant, tenants.Stage)
+	}
+	if rateLimiter != nil {
+		register(pipeline.StageRateLimit, ratelimit.Stage(rateLimiter, ratelimit.WithEvents(rateLimitEvents)))
+	}
+	if scheduler != nil {
+		register(pipeline.StageQoS, scheduler.Stage)
+	}
+
 	// Set up routes
-	app.All("/*", proxyHandler.Handle)
+	app.All("/*", stages.Handler(proxyHandler.Handle, cfg.Proxy.Routes, proxyHandler.MatchRoute))
+
+	// Start the gRPC listener, HTTP/2 is served apart from fiber
+	var grpcServer *grpcproxy.Server
+	if cfg.Proxy.GRPC.Enabled {
+		var grpcOpts []grpcproxy.Option
+		if rateLimiter != nil {
+			grpcOpts = append(grpcOpts, grpcproxy.WithRateLimiter(rateLimiter))
+		}
+		grpcServer, err = grpcproxy.NewServer(&cfg.Proxy.GRPC, logService, metricsCollector, grpcOpts...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize gRPC proxy")
+		}
+		grpcServer.Start()
+	}
 
 	// Start server
+	ln, err := listener.Listen(&cfg.Server)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open listener")
+	}
 	go func() {
-		addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-		if err := app.Listen(addr); err != nil {
+		if err := app.Listener(ln); err != nil {
 			log.Fatal().Err(err).Msg("Failed to start server")
 		}
 	}()
+	if http3Server != nil {
+		http3Server.Start()
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -116,18 +478,59 @@ func main() {
 	<-quit
 
 	log.Info().Msg("Shutting down server...")
+	if http3Server != nil {
+		if err := http3Server.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close HTTP/3 listener")
+		}
+	}
 	if err := app.Shutdown(); err != nil {
 		log.Fatal().Err(err).Msg("Failed to shutdown server")
 	}
 
 	// Close resources
+	if grpcServer != nil {
+		grpcServer.Close()
+	}
+	proxyHandler.Close()
+	if rollups != nil {
+		rollups.Close()
+	}
+	if usageMeter != nil {
+		usageMeter.Close()
+	}
+	if tenantLimits != nil {
+		tenantLimits.Close()
+		provisioner.Close()
+	}
+	if sloMonitor != nil {
+		sloMonitor.Close()
+	}
+	if anomalies != nil {
+		anomalies.Close()
+	}
+	if alerts != nil {
+		alerts.Close()
+	}
+	if rateLimitEvents != nil {
+		rateLimitEvents.Close()
+	}
+	if upstreamCredentials != nil {
+		upstreamCredentials.Close()
+	}
+	logService.Shutdown()
 	if err := repo.Close(); err != nil {
 		log.Error().Err(err).Msg("Failed to close repository")
 	}
+	if replica != nil {
+		if err := replica.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close read replica")
+		}
+	}
 
 	if rateLimiter != nil {
 		if err := rateLimiter.Close(); err != nil {
 			log.Error().Err(err).Msg("Failed to close rate limiter")
 		}
 	}
+	sentry.Close()
 }
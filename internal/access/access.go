@@ -0,0 +1,90 @@
+package access
+
+import (
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// Decision outcomes
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Modules taking access decisions
+const (
+	ModuleJWT       = "jwt"
+	ModuleAPIKey    = "api_key"
+	ModuleTenant    = "tenant"
+	ModuleAdminAuth = "admin_auth"
+	ModuleAdminRBAC = "admin_rbac"
+)
+
+const decisionsKey = "muhtar.access.decisions"
+
+// Decision is one allow or deny verdict taken on a request. Rule names the
+// check that decided and must have a bounded set of values, it labels the
+// metrics; request specific details go into Reason.
+type Decision struct {
+	Module   string `json:"module"`
+	Decision string `json:"decision"`
+	Rule     string `json:"rule"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+var (
+	mu        sync.RWMutex
+	collector *metrics.MetricsCollector
+)
+
+// SetMetrics counts the decisions recorded from now on in m
+func SetMetrics(m *metrics.MetricsCollector) {
+	mu.Lock()
+	collector = m
+	mu.Unlock()
+}
+
+// Record logs the decision with the request logger, counts it and keeps it
+// for the request log. Denials are logged at warn level, allows at debug.
+func Record(c *fiber.Ctx, d Decision) {
+	decisions, _ := c.Locals(decisionsKey).([]Decision)
+	c.Locals(decisionsKey, append(decisions, d))
+
+	logger := zerolog.Ctx(c.UserContext())
+	event := logger.Debug()
+	if d.Decision == Deny {
+		event = logger.Warn()
+	}
+	event.Str("module", d.Module).
+		Str("decision", d.Decision).
+		Str("rule", d.Rule).
+		Str("reason", d.Reason).
+		Str("client_ip", c.IP()).
+		Msg("Access decision")
+
+	mu.RLock()
+	m := collector
+	mu.RUnlock()
+	if m != nil {
+		m.IncAccessDecision(d.Module, d.Decision, d.Rule)
+	}
+}
+
+// Allowed records an allow decision
+func Allowed(c *fiber.Ctx, module, rule, reason string) {
+	Record(c, Decision{Module: module, Decision: Allow, Rule: rule, Reason: reason})
+}
+
+// Denied records a deny decision
+func Denied(c *fiber.Ctx, module, rule, reason string) {
+	Record(c, Decision{Module: module, Decision: Deny, Rule: rule, Reason: reason})
+}
+
+// FromContext returns the decisions recorded on the request so far
+func FromContext(c *fiber.Ctx) []Decision {
+	decisions, _ := c.Locals(decisionsKey).([]Decision)
+	return decisions
+}
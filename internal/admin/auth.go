@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/access"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// ErrNoCredentials is returned by authenticators that do not recognise the
+// presented credentials, letting the next one try
+var ErrNoCredentials = errors.New("no matching credentials")
+
+// placeholderPrefix marks the example tokens, which must be replaced
+const placeholderPrefix = "CHANGE_ME"
+
+// Authenticator resolves the caller of an admin request from its bearer token
+type Authenticator interface {
+	Authenticate(token string) (*Principal, error)
+}
+
+type staticCredential struct {
+	token     []byte
+	principal *Principal
+}
+
+// staticAuthenticator checks tokens from the configuration
+type staticAuthenticator struct {
+	credentials []staticCredential
+}
+
+func newStaticAuthenticator(cfg *config.AdminConfig) (*staticAuthenticator, error) {
+	a := &staticAuthenticator{}
+	if strings.HasPrefix(cfg.Token, placeholderPrefix) {
+		return nil, fmt.Errorf("admin token is a placeholder, set a secret value")
+	}
+	if cfg.Token != "" {
+		a.credentials = append(a.credentials, staticCredential{
+			token:     []byte(cfg.Token),
+			principal: &Principal{Name: "admin", Role: RoleAdmin},
+		})
+	}
+	for i, t := range cfg.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("admin token %d has no value", i)
+		}
+		if strings.HasPrefix(t.Token, placeholderPrefix) {
+			return nil, fmt.Errorf("admin token %d is a placeholder, set a secret value", i)
+		}
+		role, err := ParseRole(t.Role)
+		if err != nil {
+			return nil, err
+		}
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("token-%d", i)
+		}
+		a.credentials = append(a.credentials, staticCredential{
+			token:     []byte(t.Token),
+			principal: &Principal{Name: name, Role: role, Tenant: t.Tenant},
+		})
+	}
+	return a, nil
+}
+
+func (a *staticAuthenticator) Authenticate(token string) (*Principal, error) {
+	for _, cred := range a.credentials {
+		if subtle.ConstantTimeCompare([]byte(token), cred.token) == 1 {
+			return cred.principal, nil
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// authenticate resolves the caller with the configured authenticators and
+// enforces the role based access rules
+func (s *Server) authenticate(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		access.Denied(c, access.ModuleAdminAuth, "token", "missing admin token")
+		return fiber.NewError(fiber.StatusUnauthorized, "missing admin token")
+	}
+
+	var principal *Principal
+	for _, a := range s.authenticators {
+		p, err := a.Authenticate(token)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			access.Denied(c, access.ModuleAdminAuth, "token", err.Error())
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		principal = p
+		break
+	}
+	if principal == nil {
+		access.Denied(c, access.ModuleAdminAuth, "token", "invalid admin token")
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid admin token")
+	}
+	access.Allowed(c, access.ModuleAdminAuth, "token", principal.Name)
+
+	if err := s.authorize(c, principal); err != nil {
+		return err
+	}
+	c.Locals(principalKey, principal)
+	return c.Next()
+}
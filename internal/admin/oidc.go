@@ -0,0 +1,249 @@
+package admin
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+const (
+	defaultRoleClaim = "roles"
+	// Minimum delay between key refreshes triggered by unknown key IDs
+	jwksRefreshInterval = time.Minute
+)
+
+// oidcAuthenticator verifies RS256 ID or access tokens issued by an OIDC
+// provider and maps their claims to a principal
+type oidcAuthenticator struct {
+	config  config.AdminOIDCConfig
+	client  *http.Client
+	jwksURI string
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	refreshed time.Time
+}
+
+func newOIDCAuthenticator(cfg config.AdminOIDCConfig) (*oidcAuthenticator, error) {
+	if cfg.Issuer == "" {
+		return nil, fmt.Errorf("oidc issuer is required")
+	}
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = defaultRoleClaim
+	}
+	a := &oidcAuthenticator{
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	url := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := a.getJSON(url, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to read oidc discovery: %v", err)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery has no jwks_uri")
+	}
+	a.jwksURI = discovery.JWKSURI
+
+	if err := a.refreshKeys(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *oidcAuthenticator) getJSON(url string, v interface{}) error {
+	resp, err := a.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (a *oidcAuthenticator) refreshKeys() error {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := a.getJSON(a.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to read oidc keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.refreshed = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+// key returns the signing key with the given ID, refreshing the key set once
+// per interval so rotated keys are picked up
+func (a *oidcAuthenticator) key(kid string) (*rsa.PublicKey, error) {
+	a.mu.RLock()
+	key, ok := a.keys[kid]
+	stale := time.Since(a.refreshed) > jwksRefreshInterval
+	a.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if stale {
+		if err := a.refreshKeys(); err != nil {
+			return nil, err
+		}
+		a.mu.RLock()
+		key, ok = a.keys[kid]
+		a.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %s", kid)
+}
+
+func (a *oidcAuthenticator) Authenticate(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrNoCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrNoCredentials
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %s", header.Alg)
+	}
+
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+	if err := a.validate(claims); err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Role: highestRole(claims[a.config.RoleClaim])}
+	if principal.Role == RoleNone {
+		return nil, fmt.Errorf("token grants no admin role")
+	}
+	principal.Name, _ = claims["sub"].(string)
+	if a.config.TenantClaim != "" {
+		principal.Tenant, _ = claims[a.config.TenantClaim].(string)
+	}
+	return principal, nil
+}
+
+func (a *oidcAuthenticator) validate(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+		return fmt.Errorf("unexpected token issuer")
+	}
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); !ok || now >= exp {
+		return fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return fmt.Errorf("token not yet valid")
+	}
+	if a.config.Audience == "" {
+		return nil
+	}
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud == a.config.Audience {
+			return nil
+		}
+	case []interface{}:
+		for _, v := range aud {
+			if v == a.config.Audience {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unexpected token audience")
+}
+
+// highestRole returns the most privileged known role of a claim holding a
+// role name or a list of them
+func highestRole(claim interface{}) Role {
+	var names []interface{}
+	switch v := claim.(type) {
+	case string:
+		names = []interface{}{v}
+	case []interface{}:
+		names = v
+	}
+
+	best := RoleNone
+	for _, n := range names {
+		name, _ := n.(string)
+		if role, err := ParseRole(name); err == nil && role > best {
+			best = role
+		}
+	}
+	return best
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
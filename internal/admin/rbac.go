@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/access"
+)
+
+// Role is the access level of an admin API caller
+type Role int
+
+// Roles in increasing order of privilege
+const (
+	RoleNone Role = iota
+	// RoleViewer reads status and aggregated data
+	RoleViewer
+	// RoleOperator also reads traffic contents and changes runtime state
+	RoleOperator
+	// RoleAdmin may do everything, including fault injection and tenant limits
+	RoleAdmin
+)
+
+// ParseRole converts a configured role name
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(name) {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return RoleNone, fmt.Errorf("unknown admin role: %s", name)
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// Principal is an authenticated admin API caller
+type Principal struct {
+	Name string
+	Role Role
+	// Tenant restricts the caller to the resources of one tenant
+	Tenant string
+}
+
+const principalKey = "muhtar.admin.principal"
+
+// PrincipalFromContext returns the caller of an admin request, or nil when
+// authentication is disabled
+func PrincipalFromContext(c *fiber.Ctx) *Principal {
+	p, _ := c.Locals(principalKey).(*Principal)
+	return p
+}
+
+// routePolicy overrides the default roles of the endpoints under a prefix
+type routePolicy struct {
+	prefix string
+	read   Role
+	write  Role
+}
+
+// Reads need the viewer role and writes the operator role unless a policy
+// below says otherwise
+var routePolicies = []routePolicy{
+	// Raw traffic, including bodies
+	{prefix: "/logs", read: RoleOperator, write: RoleOperator},
+	{prefix: "/inspect", read: RoleOperator, write: RoleOperator},
+	{prefix: "/shadow/samples", read: RoleOperator, write: RoleOperator},
+	// Fault injection and customer plans
+	{prefix: "/chaos", read: RoleViewer, write: RoleAdmin},
+	{prefix: "/tenants", read: RoleViewer, write: RoleAdmin},
+}
+
+// requiredRole returns the role needed for the request. path is relative to
+// the admin prefix.
+func requiredRole(method, path string) Role {
+	write := method != fiber.MethodGet && method != fiber.MethodHead
+	for _, p := range routePolicies {
+		if path == p.prefix || strings.HasPrefix(path, p.prefix+"/") {
+			if write {
+				return p.write
+			}
+			return p.read
+		}
+	}
+	if write {
+		return RoleOperator
+	}
+	return RoleViewer
+}
+
+// tenantRoutes are the endpoints open to tenant scoped principals besides
+// /tenants/:id ones. Each filters its data by the tenant query parameter,
+// which is set to the principal's tenant before the handler runs.
+var tenantRoutes = []string{
+	"/logs",
+	"/openapi",
+	"/usage/export",
+	"/ratelimit/violations",
+	"/ratelimit/violations/summary",
+}
+
+// requestTenant returns the tenant of a /tenants/:id path, "" for other
+// paths. route is the lower cased path used to match endpoints.
+func requestTenant(path, route string) string {
+	if !strings.HasPrefix(route, "/tenants/") || route == "/tenants/limits" {
+		return ""
+	}
+	id, _, _ := strings.Cut(path[len("/tenants/"):], "/")
+	return id
+}
+
+// inTenantScope reports whether a tenant scoped principal may make the
+// request. Endpoints are denied unless they filter by tenant, so an endpoint
+// added later is not open to other tenants' principals by default.
+func inTenantScope(c *fiber.Ctx, path, route, tenant string) bool {
+	if slices.Contains(tenantRoutes, route) {
+		if t := c.Query("tenant"); t != "" && t != tenant {
+			return false
+		}
+		// The handlers filter by the parameter, it must not be left out
+		c.Request().URI().QueryArgs().Set("tenant", tenant)
+		return true
+	}
+	return requestTenant(path, route) == tenant
+}
+
+// authorize checks the role of the principal and keeps tenant scoped
+// principals to the endpoints of their tenant
+func (s *Server) authorize(c *fiber.Ctx, p *Principal) error {
+	path := strings.TrimPrefix(c.Path(), s.prefix)
+	// Routing ignores case and trailing slashes, so do the checks
+	path = strings.TrimSuffix(path, "/")
+	route := strings.ToLower(path)
+	if route == "/health" {
+		return nil
+	}
+	need := requiredRole(c.Method(), route)
+	if p.Role < need {
+		access.Denied(c, access.ModuleAdminRBAC, "role", fmt.Sprintf("%s is %s, %s role required", p.Name, p.Role, need))
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("%s role required", need))
+	}
+	if p.Tenant != "" && !inTenantScope(c, path, route, p.Tenant) {
+		access.Denied(c, access.ModuleAdminRBAC, "tenant_scope", fmt.Sprintf("%s is limited to tenant %s", p.Name, p.Tenant))
+		return fiber.NewError(fiber.StatusForbidden, "access limited to tenant "+p.Tenant)
+	}
+	access.Allowed(c, access.ModuleAdminRBAC, "role", fmt.Sprintf("%s is %s, %s role required", p.Name, p.Role, need))
+	return nil
+}
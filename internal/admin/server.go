@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+const defaultPrefix = "/admin"
+
+// Server exposes the runtime control plane of the gateway
+type Server struct {
+	config         *config.AdminConfig
+	prefix         string
+	router         fiber.Router
+	authenticators []Authenticator
+}
+
+// NewServer mounts the admin API on the given app. It must be called before
+// the proxy catch-all route is registered. It fails without a token or OIDC,
+// and on the placeholder tokens of the example configuration.
+func NewServer(app *fiber.App, cfg *config.AdminConfig) (*Server, error) {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	s := &Server{config: cfg, prefix: prefix}
+
+	static, err := newStaticAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(static.credentials) > 0 {
+		s.authenticators = append(s.authenticators, static)
+	}
+	if cfg.OIDC.Enabled {
+		oidc, err := newOIDCAuthenticator(cfg.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		s.authenticators = append(s.authenticators, oidc)
+	}
+	if len(s.authenticators) == 0 {
+		return nil, fmt.Errorf("admin API has no token or OIDC configured")
+	}
+
+	s.router = app.Group(prefix, s.authenticate)
+	s.router.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+	return s, nil
+}
+
+// Router returns the router modules use to register their admin endpoints
+func (s *Server) Router() fiber.Router {
+	return s.router
+}
+
+// Registrar is implemented by modules exposing admin endpoints
+type Registrar interface {
+	RegisterAdminRoutes(r fiber.Router)
+}
+
+// Register mounts the admin endpoints of the given modules
+func (s *Server) Register(modules ...Registrar) {
+	for _, m := range modules {
+		m.RegisterAdminRoutes(s.router)
+	}
+}
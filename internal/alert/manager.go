@@ -0,0 +1,369 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/proxy"
+)
+
+// Rule types
+const (
+	RuleErrorRate         = "error_rate"
+	RuleLatency           = "latency"
+	RuleUpstreamUnhealthy = "upstream_unhealthy"
+	RuleRateLimited       = "rate_limited"
+)
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert is the payload sent to webhook channels
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Type      string    `json:"type"`
+	Severity  string    `json:"severity"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type rule struct {
+	config   config.AlertRule
+	window   *window
+	channels []*channel
+}
+
+// state is the last evaluation of a rule or reported condition
+type state struct {
+	alert    Alert
+	notified time.Time
+}
+
+// Manager evaluates alert rules on the proxied traffic and notifies the
+// configured channels when they start or stop firing
+type Manager struct {
+	config   *config.AlertingConfig
+	rules    []*rule
+	channels []*channel
+
+	mu        sync.Mutex
+	states    map[string]*state
+	unhealthy map[string]bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewManager validates the rules and starts evaluating them
+func NewManager(cfg *config.AlertingConfig) (*Manager, error) {
+	m := &Manager{
+		config:    cfg,
+		states:    make(map[string]*state),
+		unhealthy: make(map[string]bool),
+		done:      make(chan struct{}),
+	}
+
+	byName := make(map[string]*channel, len(cfg.Channels))
+	for _, cc := range cfg.Channels {
+		ch, err := newChannel(cc)
+		if err != nil {
+			return nil, err
+		}
+		m.channels = append(m.channels, ch)
+		byName[cc.Name] = ch
+	}
+
+	for _, rc := range cfg.Rules {
+		switch rc.Type {
+		case RuleErrorRate, RuleLatency, RuleUpstreamUnhealthy, RuleRateLimited:
+		default:
+			return nil, fmt.Errorf("alert rule %s: unknown type %s", rc.Name, rc.Type)
+		}
+		if rc.Window <= 0 {
+			rc.Window = 5 * time.Minute
+		}
+		if rc.Percentile <= 0 || rc.Percentile >= 1 {
+			rc.Percentile = 0.99
+		}
+		if rc.Type == RuleUpstreamUnhealthy && rc.Threshold <= 0 {
+			rc.Threshold = 0.5
+		}
+		if rc.Severity == "" {
+			rc.Severity = "warning"
+		}
+		r := &rule{config: rc, window: newWindow(rc.Window), channels: m.channels}
+		if len(rc.Channels) > 0 {
+			r.channels = nil
+			for _, name := range rc.Channels {
+				ch, ok := byName[name]
+				if !ok {
+					return nil, fmt.Errorf("alert rule %s uses undefined channel %s", rc.Name, name)
+				}
+				r.channels = append(r.channels, ch)
+			}
+		}
+		m.rules = append(m.rules, r)
+	}
+
+	m.wg.Add(1)
+	go m.run()
+	return m, nil
+}
+
+// Observe records one proxied exchange against the matching rules
+func (m *Manager) Observe(path string, status int, unreachable bool, duration time.Duration) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rules {
+		if !strings.HasPrefix(path, r.config.PathPrefix) {
+			continue
+		}
+		b := r.window.bucket(now)
+		b.total++
+		if status >= 500 {
+			b.failed++
+		}
+		if unreachable {
+			b.unreachable++
+		}
+		if status == fiber.StatusTooManyRequests {
+			b.limited++
+			continue
+		}
+		b.add(duration)
+	}
+}
+
+// ReportUpstream marks an upstream healthy or unhealthy, feeding the
+// upstream_unhealthy rules
+func (m *Manager) ReportUpstream(target string, healthy bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if healthy {
+		delete(m.unhealthy, target)
+	} else {
+		m.unhealthy[target] = true
+	}
+}
+
+// Report raises or resolves a condition detected outside the rules, e.g. by
+// the anomaly detector. The condition is sent to every channel.
+func (m *Manager) Report(name, kind, severity string, firing bool, value float64, message string) {
+	m.mu.Lock()
+	alert := m.transition(name, Alert{
+		Rule:     name,
+		Type:     kind,
+		Severity: severity,
+		Value:    value,
+		Message:  message,
+	}, firing, time.Now())
+	m.mu.Unlock()
+
+	if alert != nil {
+		m.dispatch(*alert, m.channels)
+	}
+}
+
+func (m *Manager) run() {
+	defer m.wg.Done()
+
+	interval := m.config.EvaluationInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.evaluate()
+		}
+	}
+}
+
+// check evaluates one rule over its window. Callers must hold the lock.
+func (m *Manager) check(r *rule, now time.Time) (bool, float64, string) {
+	rc := r.config
+	c := r.window.sum(now, rc.Window)
+	enough := c.total > 0 && c.total >= rc.MinRequests
+
+	switch rc.Type {
+	case RuleErrorRate:
+		if !enough {
+			return false, 0, ""
+		}
+		rate := float64(c.failed) / float64(c.total)
+		return rate > rc.Threshold, rate,
+			fmt.Sprintf("%.1f%% of %d requests failed over %s", rate*100, c.total, rc.Window)
+	case RuleLatency:
+		if !enough {
+			return false, 0, ""
+		}
+		p := c.percentile(rc.Percentile)
+		return p > rc.Latency, float64(p) / float64(time.Millisecond),
+			fmt.Sprintf("p%g latency is %s over %s, threshold %s", rc.Percentile*100, p, rc.Window, rc.Latency)
+	case RuleRateLimited:
+		return float64(c.limited) > rc.Threshold, float64(c.limited),
+			fmt.Sprintf("%d requests rate limited over %s", c.limited, rc.Window)
+	case RuleUpstreamUnhealthy:
+		if len(m.unhealthy) > 0 {
+			targets := make([]string, 0, len(m.unhealthy))
+			for t := range m.unhealthy {
+				targets = append(targets, t)
+			}
+			sort.Strings(targets)
+			return true, float64(len(targets)), "unhealthy upstreams: " + strings.Join(targets, ", ")
+		}
+		if !enough {
+			return false, 0, ""
+		}
+		rate := float64(c.unreachable) / float64(c.total)
+		return rate >= rc.Threshold, rate,
+			fmt.Sprintf("upstream unreachable for %.1f%% of %d requests over %s", rate*100, c.total, rc.Window)
+	}
+	return false, 0, ""
+}
+
+// transition updates the state of a condition and returns the alert to send,
+// nil when nothing changed. Callers must hold the lock.
+func (m *Manager) transition(key string, a Alert, firing bool, now time.Time) *Alert {
+	s, ok := m.states[key]
+	wasFiring := ok && s.alert.Status == StatusFiring
+	if !firing && !wasFiring {
+		return nil
+	}
+	if !ok {
+		s = &state{}
+		m.states[key] = s
+	}
+
+	a.Timestamp = now
+	a.Status = StatusResolved
+	if firing {
+		a.Status = StatusFiring
+	}
+	if !firing && a.Message == "" {
+		a.Message = s.alert.Message
+	}
+	s.alert = a
+
+	repeat := m.config.RepeatInterval > 0 && now.Sub(s.notified) >= m.config.RepeatInterval
+	if firing == wasFiring && !repeat {
+		return nil
+	}
+	s.notified = now
+	return &a
+}
+
+func (m *Manager) evaluate() {
+	now := time.Now()
+	type pending struct {
+		alert    Alert
+		channels []*channel
+	}
+	var notifications []pending
+
+	m.mu.Lock()
+	for _, r := range m.rules {
+		firing, value, message := m.check(r, now)
+		alert := m.transition(r.config.Name, Alert{
+			Rule:      r.config.Name,
+			Type:      r.config.Type,
+			Severity:  r.config.Severity,
+			Message:   message,
+			Value:     value,
+			Threshold: r.config.Threshold,
+		}, firing, now)
+		if alert != nil {
+			notifications = append(notifications, pending{*alert, r.channels})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, n := range notifications {
+		m.dispatch(n.alert, n.channels)
+	}
+}
+
+func (m *Manager) dispatch(a Alert, channels []*channel) {
+	log.Warn().
+		Str("rule", a.Rule).
+		Str("type", a.Type).
+		Str("severity", a.Severity).
+		Str("status", a.Status).
+		Float64("value", a.Value).
+		Msg(a.Message)
+	for _, ch := range channels {
+		go ch.send(a)
+	}
+}
+
+// Middleware observes every proxied exchange, including requests rejected
+// by the rate limiter. It must run before the tenant and rate limit
+// middlewares.
+func (m *Manager) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return m.Stage(c, c.Next)
+	}
+}
+
+// Stage is the pipeline form of Middleware
+func (m *Manager) Stage(c *fiber.Ctx, next func() error) error {
+	start := time.Now()
+	path := c.Path()
+	err := next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+	}
+	m.Observe(path, status, proxy.UpstreamFailed(c), time.Since(start))
+	return err
+}
+
+// RegisterAdminRoutes mounts the alert status endpoint
+func (m *Manager) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/alerts", m.handleStatus)
+}
+
+func (m *Manager) handleStatus(c *fiber.Ctx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(m.states))
+	for _, s := range m.states {
+		alerts = append(alerts, s.alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Rule < alerts[j].Rule
+	})
+	return c.JSON(fiber.Map{"alerts": alerts})
+}
+
+// Close stops the evaluation job
+func (m *Manager) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
@@ -0,0 +1,80 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Channel types
+const (
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+)
+
+type channel struct {
+	config config.AlertChannel
+	client *http.Client
+}
+
+func newChannel(cfg config.AlertChannel) (*channel, error) {
+	switch cfg.Type {
+	case "":
+		cfg.Type = ChannelWebhook
+	case ChannelWebhook, ChannelSlack:
+	default:
+		return nil, fmt.Errorf("alert channel %s: unknown type %s", cfg.Name, cfg.Type)
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("alert channel %s has no url", cfg.Name)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &channel{config: cfg, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// payload formats the alert for the channel type
+func (c *channel) payload(a Alert) ([]byte, error) {
+	if c.config.Type != ChannelSlack {
+		return json.Marshal(a)
+	}
+	icon := ":rotating_light:"
+	if a.Status == StatusResolved {
+		icon = ":white_check_mark:"
+	}
+	text := fmt.Sprintf("%s *[%s] %s* (%s)\n%s", icon, strings.ToUpper(a.Status), a.Rule, a.Severity, a.Message)
+	return json.Marshal(map[string]string{"text": text})
+}
+
+func (c *channel) send(a Alert) {
+	body, err := c.payload(a)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Str("channel", c.config.Name).Msg("Failed to create alert request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Error().Err(err).Str("channel", c.config.Name).Msg("Failed to send alert")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Error().Int("status_code", resp.StatusCode).Str("channel", c.config.Name).Msg("Alert channel rejected alert")
+	}
+}
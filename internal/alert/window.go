@@ -0,0 +1,88 @@
+package alert
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// maxSamples bounds the latency samples kept per minute
+const maxSamples = 256
+
+// counts is the traffic of one minute
+type counts struct {
+	minute      time.Time
+	total       int64
+	failed      int64
+	unreachable int64
+	limited     int64
+	seen        int64
+	samples     []time.Duration
+}
+
+// add records a latency sample, keeping a uniform reservoir once full
+func (c *counts) add(d time.Duration) {
+	c.seen++
+	if len(c.samples) < maxSamples {
+		c.samples = append(c.samples, d)
+		return
+	}
+	if i := rand.Int63n(c.seen); i < maxSamples {
+		c.samples[i] = d
+	}
+}
+
+// window is a ring of per-minute counts covering the longest rule window
+type window struct {
+	buckets []counts
+}
+
+func newWindow(size time.Duration) *window {
+	n := int(size / time.Minute)
+	if n < 1 {
+		n = 1
+	}
+	return &window{buckets: make([]counts, n)}
+}
+
+func (w *window) bucket(now time.Time) *counts {
+	minute := now.Truncate(time.Minute)
+	b := &w.buckets[int(minute.Unix()/60)%len(w.buckets)]
+	if !b.minute.Equal(minute) {
+		*b = counts{minute: minute}
+	}
+	return b
+}
+
+// sum adds up the minutes of the last d
+func (w *window) sum(now time.Time, d time.Duration) counts {
+	var total counts
+	from := now.Truncate(time.Minute).Add(-d)
+	for _, b := range w.buckets {
+		if b.minute.After(from) && !b.minute.After(now) {
+			total.total += b.total
+			total.failed += b.failed
+			total.unreachable += b.unreachable
+			total.limited += b.limited
+			total.samples = append(total.samples, b.samples...)
+		}
+	}
+	return total
+}
+
+// percentile returns the p-th latency of the samples
+func (c counts) percentile(p float64) time.Duration {
+	if len(c.samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), c.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,282 @@
+package anomaly
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/alert"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// Signals compared against their baseline
+const (
+	SignalRate   = "rate"
+	SignalErrors = "error_rate"
+)
+
+// otherRoute collects the traffic of routes beyond the tracking limit
+const otherRoute = "other"
+
+// baseline is an exponentially weighted mean and variance of a signal
+type baseline struct {
+	mean     float64
+	variance float64
+}
+
+// score returns how many standard deviations x lies above the baseline.
+// floor keeps a flat baseline from turning noise into anomalies.
+func (b *baseline) score(x, floor float64) float64 {
+	stddev := math.Max(math.Sqrt(b.variance), floor)
+	return (x - b.mean) / stddev
+}
+
+func (b *baseline) update(x, alpha float64) {
+	diff := x - b.mean
+	incr := alpha * diff
+	b.mean += incr
+	b.variance = (1 - alpha) * (b.variance + diff*incr)
+}
+
+type route struct {
+	requests int64
+	errors   int64
+
+	observations int
+	rate         baseline
+	errorRate    baseline
+
+	lastRate      float64
+	lastErrorRate float64
+	scores        map[string]float64
+	anomalous     map[string]bool
+}
+
+// Detector keeps rolling baselines of request rate and error rate per route
+// and flags observations deviating from them
+type Detector struct {
+	config  config.AnomalyConfig
+	metrics *metrics.MetricsCollector
+	alerts  *alert.Manager
+
+	mu     sync.Mutex
+	routes map[string]*route
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDetector starts the observation job. alerts may be nil.
+func NewDetector(cfg *config.AnomalyConfig, metrics *metrics.MetricsCollector, alerts *alert.Manager) *Detector {
+	c := *cfg
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	if c.Alpha <= 0 || c.Alpha >= 1 {
+		c.Alpha = 0.1
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 3
+	}
+	if c.WarmUp <= 0 {
+		c.WarmUp = 10
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.Depth <= 0 {
+		c.Depth = 2
+	}
+	if c.MaxRoutes <= 0 {
+		c.MaxRoutes = 500
+	}
+
+	d := &Detector{
+		config:  c,
+		metrics: metrics,
+		alerts:  alerts,
+		routes:  make(map[string]*route),
+		done:    make(chan struct{}),
+	}
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+// routeKey keeps the first Depth segments of the path
+func (d *Detector) routeKey(path string) string {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", d.config.Depth+1)
+	if len(segments) > d.config.Depth {
+		segments = segments[:d.config.Depth]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Observe records one exchange of the route serving path
+func (d *Detector) Observe(path string, failed bool) {
+	key := d.routeKey(path)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, ok := d.routes[key]
+	if !ok {
+		if len(d.routes) >= d.config.MaxRoutes {
+			key = otherRoute
+			r = d.routes[key]
+		}
+		if r == nil {
+			r = &route{scores: make(map[string]float64), anomalous: make(map[string]bool)}
+			d.routes[key] = r
+		}
+	}
+	r.requests++
+	if failed {
+		r.errors++
+	}
+}
+
+func (d *Detector) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.evaluate()
+		}
+	}
+}
+
+type finding struct {
+	route   string
+	signal  string
+	firing  bool
+	score   float64
+	message string
+}
+
+func (d *Detector) evaluate() {
+	var findings []finding
+
+	d.mu.Lock()
+	for key, r := range d.routes {
+		rate := float64(r.requests) / d.config.Interval.Seconds()
+		errorRate := 0.0
+		if r.requests > 0 {
+			errorRate = float64(r.errors) / float64(r.requests)
+		}
+		judged := r.observations >= d.config.WarmUp && r.requests >= d.config.MinRequests
+
+		signals := []struct {
+			name  string
+			value float64
+			base  *baseline
+			floor float64
+		}{
+			{SignalRate, rate, &r.rate, math.Max(1/d.config.Interval.Seconds(), 0.1*r.rate.mean)},
+			{SignalErrors, errorRate, &r.errorRate, 0.02},
+		}
+		for _, s := range signals {
+			score := s.base.score(s.value, s.floor)
+			firing := judged && score >= d.config.Threshold
+			r.scores[s.name] = score
+			if d.metrics != nil {
+				d.metrics.ObserveAnomalyScore(key, s.name, score)
+			}
+			if firing != r.anomalous[s.name] {
+				r.anomalous[s.name] = firing
+				findings = append(findings, finding{
+					route:  key,
+					signal: s.name,
+					firing: firing,
+					score:  score,
+					message: fmt.Sprintf("%s of %s is %.3f against a baseline of %.3f (%.1f standard deviations)",
+						s.name, key, s.value, s.base.mean, score),
+				})
+			}
+			if r.observations == 0 {
+				s.base.mean = s.value
+			} else {
+				s.base.update(s.value, d.config.Alpha)
+			}
+		}
+
+		r.lastRate, r.lastErrorRate = rate, errorRate
+		r.requests, r.errors = 0, 0
+		r.observations++
+	}
+	d.mu.Unlock()
+
+	for _, f := range findings {
+		if d.alerts != nil {
+			d.alerts.Report("anomaly "+f.signal+" "+f.route, "anomaly", "warning", f.firing, f.score, f.message)
+		}
+	}
+}
+
+// RegisterAdminRoutes mounts the baseline status endpoint
+func (d *Detector) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/anomalies", d.handleStatus)
+}
+
+func (d *Detector) handleStatus(c *fiber.Ctx) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	routes := make([]fiber.Map, 0, len(d.routes))
+	for key, r := range d.routes {
+		routes = append(routes, fiber.Map{
+			"route":               key,
+			"observations":        r.observations,
+			"rate":                r.lastRate,
+			"rate_baseline":       r.rate.mean,
+			"error_rate":          r.lastErrorRate,
+			"error_rate_baseline": r.errorRate.mean,
+			"scores":              r.scores,
+			"anomalous":           r.anomalous,
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i]["route"].(string) < routes[j]["route"].(string)
+	})
+	return c.JSON(fiber.Map{"routes": routes})
+}
+
+// Middleware observes every proxied exchange, including rejected ones
+func (d *Detector) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return d.Stage(c, c.Next)
+	}
+}
+
+// Stage is the pipeline form of Middleware
+func (d *Detector) Stage(c *fiber.Ctx, next func() error) error {
+	path := c.Path()
+	err := next()
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+	}
+	d.Observe(path, status >= 500)
+	return err
+}
+
+// Close stops the observation job
+func (d *Detector) Close() {
+	close(d.done)
+	d.wg.Wait()
+}
@@ -0,0 +1,312 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/model"
+)
+
+// Options configures a load generation run
+type Options struct {
+	Target      string
+	Method      string
+	Path        string
+	Traffic     string
+	Concurrency int
+	Requests    int
+	Duration    time.Duration
+	Rate        int
+	Timeout     time.Duration
+	Headers     headerFlags
+	ExpectLimit int
+	Tolerance   float64
+}
+
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ",") }
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+// shape is a request template replayed by the workers
+type shape struct {
+	method  string
+	path    string
+	headers map[string][]string
+	body    []byte
+}
+
+type sample struct {
+	latency time.Duration
+	status  int
+	limited bool
+	err     error
+}
+
+// Report summarizes a load generation run
+type Report struct {
+	Total      int
+	Errors     int
+	Limited    int
+	Elapsed    time.Duration
+	StatusCode map[int]int
+	Latencies  []time.Duration
+}
+
+// Run parses the bench sub-command arguments, generates load and prints a
+// report. It returns the process exit code.
+func Run(args []string) int {
+	opts := Options{}
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.StringVar(&opts.Target, "target", "http://localhost:8080", "proxy or upstream base URL")
+	fs.StringVar(&opts.Method, "method", http.MethodGet, "request method when no traffic file is given")
+	fs.StringVar(&opts.Path, "path", "/", "request path when no traffic file is given")
+	fs.StringVar(&opts.Traffic, "traffic", "", "JSON lines file of logged requests to replay")
+	fs.IntVar(&opts.Concurrency, "c", 10, "number of concurrent workers")
+	fs.IntVar(&opts.Requests, "n", 1000, "total number of requests (ignored when -d is set)")
+	fs.DurationVar(&opts.Duration, "d", 0, "run for a fixed duration instead of -n requests")
+	fs.IntVar(&opts.Rate, "rate", 0, "target requests per second (0 = unthrottled)")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "per-request timeout")
+	fs.Var(&opts.Headers, "H", "extra request header (Name: value), repeatable")
+	fs.IntVar(&opts.ExpectLimit, "expect-limit", 0, "expected number of accepted requests before rate limiting kicks in")
+	fs.Float64Var(&opts.Tolerance, "tolerance", 0.1, "allowed relative deviation for -expect-limit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	shapes, err := loadShapes(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load traffic: %v\n", err)
+		return 1
+	}
+
+	report := Execute(opts, shapes)
+	report.Print(os.Stdout)
+
+	if opts.ExpectLimit > 0 {
+		return report.verifyLimit(os.Stdout, opts.ExpectLimit, opts.Tolerance)
+	}
+	return 0
+}
+
+func loadShapes(opts Options) ([]shape, error) {
+	extra := make(map[string][]string)
+	for _, h := range opts.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q", h)
+		}
+		name = strings.TrimSpace(name)
+		extra[name] = append(extra[name], strings.TrimSpace(value))
+	}
+
+	if opts.Traffic == "" {
+		return []shape{{method: opts.Method, path: opts.Path, headers: extra}}, nil
+	}
+
+	f, err := os.Open(opts.Traffic)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var shapes []shape
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry model.Log
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid log entry: %v", err)
+		}
+		if entry.ProcessType != "" && entry.ProcessType != model.ProcessTypeRequest {
+			continue
+		}
+		headers := make(map[string][]string, len(entry.Headers)+len(extra))
+		for k, v := range entry.Headers {
+			headers[k] = v
+		}
+		for k, v := range extra {
+			headers[k] = v
+		}
+		shapes = append(shapes, shape{
+			method:  entry.Method,
+			path:    entry.Path,
+			headers: headers,
+			body:    entry.Body,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(shapes) == 0 {
+		return nil, fmt.Errorf("no request entries found in %s", opts.Traffic)
+	}
+	return shapes, nil
+}
+
+// Execute generates load according to the options and collects the samples
+func Execute(opts Options, shapes []shape) *Report {
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: opts.Concurrency,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var throttle <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	var deadline time.Time
+	if opts.Duration > 0 {
+		deadline = time.Now().Add(opts.Duration)
+	}
+
+	var issued int64
+	samples := make(chan sample, opts.Concurrency*2)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if deadline.IsZero() {
+					if atomic.AddInt64(&issued, 1) > int64(opts.Requests) {
+						return
+					}
+				} else if time.Now().After(deadline) {
+					return
+				}
+				if throttle != nil {
+					<-throttle
+				}
+				samples <- send(client, opts.Target, shapes[rand.Intn(len(shapes))])
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	report := &Report{StatusCode: make(map[int]int)}
+	for s := range samples {
+		report.Total++
+		if s.err != nil {
+			report.Errors++
+			continue
+		}
+		if s.limited {
+			report.Limited++
+		}
+		report.StatusCode[s.status]++
+		report.Latencies = append(report.Latencies, s.latency)
+	}
+	report.Elapsed = time.Since(start)
+	return report
+}
+
+func send(client *http.Client, target string, s shape) sample {
+	req, err := http.NewRequest(s.method, strings.TrimRight(target, "/")+s.path, bytes.NewReader(s.body))
+	if err != nil {
+		return sample{err: err}
+	}
+	for k, values := range s.headers {
+		req.Header.Del(k)
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return sample{err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return sample{
+		latency: time.Since(start),
+		status:  resp.StatusCode,
+		limited: resp.StatusCode == http.StatusTooManyRequests,
+	}
+}
+
+// Percentile returns the p-th percentile (0-100) of the recorded latencies
+func (r *Report) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	idx := int(float64(len(r.Latencies)-1) * p / 100)
+	return r.Latencies[idx]
+}
+
+// Print writes a human readable summary of the run
+func (r *Report) Print(w io.Writer) {
+	sort.Slice(r.Latencies, func(i, j int) bool { return r.Latencies[i] < r.Latencies[j] })
+
+	fmt.Fprintf(w, "Requests:      %d (%d errors)\n", r.Total, r.Errors)
+	fmt.Fprintf(w, "Elapsed:       %s\n", r.Elapsed.Round(time.Millisecond))
+	if r.Elapsed > 0 {
+		fmt.Fprintf(w, "Throughput:    %.1f req/s\n", float64(r.Total)/r.Elapsed.Seconds())
+	}
+	fmt.Fprintf(w, "Rate limited:  %d\n", r.Limited)
+	fmt.Fprintln(w, "Latency:")
+	for _, p := range []float64{50, 90, 95, 99} {
+		fmt.Fprintf(w, "  p%-4v %s\n", p, r.Percentile(p))
+	}
+	if n := len(r.Latencies); n > 0 {
+		fmt.Fprintf(w, "  max   %s\n", r.Latencies[n-1])
+	}
+
+	codes := make([]int, 0, len(r.StatusCode))
+	for code := range r.StatusCode {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	fmt.Fprintln(w, "Status codes:")
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %d: %d\n", code, r.StatusCode[code])
+	}
+}
+
+func (r *Report) verifyLimit(w io.Writer, expected int, tolerance float64) int {
+	accepted := r.Total - r.Errors - r.Limited
+	deviation := float64(accepted-expected) / float64(expected)
+	if deviation < 0 {
+		deviation = -deviation
+	}
+
+	if deviation > tolerance {
+		fmt.Fprintf(w, "Rate limit check FAILED: %d requests accepted, expected %d (±%.0f%%)\n", accepted, expected, tolerance*100)
+		return 1
+	}
+	fmt.Fprintf(w, "Rate limit check passed: %d requests accepted, expected %d\n", accepted, expected)
+	return 0
+}
@@ -0,0 +1,178 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Settings configures a circuit breaker
+type Settings struct {
+	// Consecutive failures that open the breaker
+	FailureThreshold int
+	// Time spent open before probing again
+	RecoveryTimeout time.Duration
+	// Successful probes needed in half-open state to close the breaker
+	HalfOpenRequests int
+	// Called on every state transition
+	OnStateChange func(name string, from, to State)
+}
+
+// Breaker is a consecutive-failure circuit breaker
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+}
+
+// New creates a new circuit breaker in closed state
+func New(name string, settings Settings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 5
+	}
+	if settings.RecoveryTimeout <= 0 {
+		settings.RecoveryTimeout = 30 * time.Second
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+	return &Breaker{name: name, settings: settings}
+}
+
+// Name returns the name of the breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Allow reports whether a call may proceed. In half-open state only a limited
+// number of probe calls are let through.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.settings.RecoveryTimeout {
+			return false
+		}
+		b.transition(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= b.settings.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+		return true
+	}
+	return true
+}
+
+// Success records a successful call
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		b.successes++
+		if b.successes >= b.settings.HalfOpenRequests {
+			b.transition(StateClosed)
+		}
+	case StateClosed:
+		b.failures = 0
+	}
+}
+
+// Failure records a failed call
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		b.transition(StateOpen)
+	case StateClosed:
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.transition(StateOpen)
+		}
+	}
+}
+
+// Ignore releases a call that neither failed nor succeeded, e.g. one the
+// caller abandoned, so it does not hold a half-open probe slot
+func (b *Breaker) Ignore() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// State returns the current state, moving from open to half-open once the
+// recovery timeout elapsed
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.settings.RecoveryTimeout {
+		b.transition(StateHalfOpen)
+	}
+	return b.state
+}
+
+// RetryAfter returns how long until an open breaker starts probing again
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return 0
+	}
+	remaining := b.settings.RecoveryTimeout - time.Since(b.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func (b *Breaker) transition(to State) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.failures = 0
+	b.successes = 0
+	b.probes = 0
+	if to == StateOpen {
+		b.openedAt = time.Now()
+	}
+	if b.settings.OnStateChange != nil {
+		go b.settings.OnStateChange(b.name, from, to)
+	}
+}
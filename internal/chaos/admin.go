@@ -0,0 +1,121 @@
+package chaos
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+type routeRequest struct {
+	Path    string `json:"path"`
+	Method  string `json:"method"`
+	Profile string `json:"profile"`
+}
+
+type profileStatus struct {
+	Enabled     bool    `json:"enabled"`
+	ErrorRatio  float64 `json:"error_ratio"`
+	ErrorStatus int     `json:"error_status"`
+	ResetRatio  float64 `json:"reset_ratio"`
+	LatencyRate float64 `json:"latency_ratio"`
+	Bandwidth   int     `json:"bandwidth"`
+}
+
+// RegisterAdminRoutes mounts the chaos control endpoints
+func (i *Injector) RegisterAdminRoutes(r fiber.Router) {
+	g := r.Group("/chaos")
+	g.Get("/", i.handleStatus)
+	g.Post("/enable", i.handleToggle(true))
+	g.Post("/disable", i.handleToggle(false))
+	g.Post("/profiles/:name/enable", i.handleProfileToggle(true))
+	g.Post("/profiles/:name/disable", i.handleProfileToggle(false))
+	g.Post("/routes", i.handleAttach)
+	g.Delete("/routes", i.handleDetach)
+}
+
+func (i *Injector) handleStatus(c *fiber.Ctx) error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	profiles := make(map[string]profileStatus, len(i.profiles))
+	for name, p := range i.profiles {
+		profiles[name] = profileStatus{
+			Enabled:     p.enabled,
+			ErrorRatio:  p.ErrorRatio,
+			ErrorStatus: p.ErrorStatus,
+			ResetRatio:  p.ResetRatio,
+			LatencyRate: p.Latency.Ratio,
+			Bandwidth:   p.Bandwidth,
+		}
+	}
+
+	routes := make([]routeRequest, 0, len(i.routes))
+	for _, route := range i.routes {
+		routes = append(routes, routeRequest{Path: route.Path, Method: route.Method, Profile: route.Profile})
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":  i.enabled,
+		"profiles": profiles,
+		"routes":   routes,
+	})
+}
+
+func (i *Injector) handleToggle(enabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		i.mu.Lock()
+		i.enabled = enabled
+		i.mu.Unlock()
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (i *Injector) handleProfileToggle(enabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		p, ok := i.profiles[c.Params("name")]
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "unknown chaos profile")
+		}
+		p.enabled = enabled
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (i *Injector) handleAttach(c *fiber.Ctx) error {
+	var req routeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if req.Path == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "path is required")
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.profiles[req.Profile]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "unknown chaos profile")
+	}
+	i.routes = append(i.routes, config.ChaosRoute{Path: req.Path, Method: req.Method, Profile: req.Profile})
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+func (i *Injector) handleDetach(c *fiber.Ctx) error {
+	path := c.Query("path")
+	method := c.Query("method")
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	routes := i.routes[:0]
+	for _, route := range i.routes {
+		if route.Path == path && (method == "" || route.Method == method) {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	i.routes = routes
+	return c.SendStatus(fiber.StatusNoContent)
+}
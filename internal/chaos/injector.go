@@ -0,0 +1,217 @@
+package chaos
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Fault describes the faults rolled for a single request
+type Fault struct {
+	Profile   string
+	Delay     time.Duration
+	Status    int  // Non-zero when the request must be aborted with this status
+	Reset     bool // Whether the client connection must be reset
+	Bandwidth int  // Response throughput cap in bytes per second
+}
+
+// Injector applies chaos profiles to matching routes
+type Injector struct {
+	mu       sync.RWMutex
+	enabled  bool
+	profiles map[string]*profile
+	routes   []config.ChaosRoute
+}
+
+type profile struct {
+	config.ChaosProfile
+	enabled bool
+}
+
+// NewInjector creates a new fault injector
+func NewInjector(cfg config.ChaosConfig) (*Injector, error) {
+	i := &Injector{
+		enabled:  cfg.Enabled,
+		profiles: make(map[string]*profile),
+	}
+
+	for name, p := range cfg.Profiles {
+		if err := validateProfile(p); err != nil {
+			return nil, fmt.Errorf("invalid chaos profile %s: %v", name, err)
+		}
+		i.profiles[name] = &profile{ChaosProfile: p, enabled: true}
+	}
+
+	for _, route := range cfg.Routes {
+		if _, ok := i.profiles[route.Profile]; !ok {
+			return nil, fmt.Errorf("chaos route %s references unknown profile %s", route.Path, route.Profile)
+		}
+		i.routes = append(i.routes, route)
+	}
+
+	return i, nil
+}
+
+func validateProfile(p config.ChaosProfile) error {
+	for _, ratio := range []float64{p.Latency.Ratio, p.ErrorRatio, p.ResetRatio} {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("ratio %v out of range [0,1]", ratio)
+		}
+	}
+	switch p.Latency.Distribution {
+	case "", "fixed", "uniform", "normal":
+	default:
+		return fmt.Errorf("unknown latency distribution: %s", p.Latency.Distribution)
+	}
+	return nil
+}
+
+// Evaluate rolls the faults for a request. It returns nil when chaos is
+// disabled or no enabled profile is attached to the route.
+func (i *Injector) Evaluate(method, path string) *Fault {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if !i.enabled {
+		return nil
+	}
+
+	for _, route := range i.routes {
+		if route.Method != "" && route.Method != "*" && route.Method != method {
+			continue
+		}
+		if !pathMatch(route.Path, path) {
+			continue
+		}
+		p := i.profiles[route.Profile]
+		if p == nil || !p.enabled {
+			continue
+		}
+		return p.roll(route.Profile)
+	}
+	return nil
+}
+
+func (p *profile) roll(name string) *Fault {
+	fault := &Fault{Profile: name, Bandwidth: p.Bandwidth}
+
+	if p.Latency.Ratio > 0 && rand.Float64() < p.Latency.Ratio {
+		fault.Delay = p.delay()
+	}
+	if p.ResetRatio > 0 && rand.Float64() < p.ResetRatio {
+		fault.Reset = true
+		return fault
+	}
+	if p.ErrorRatio > 0 && rand.Float64() < p.ErrorRatio {
+		fault.Status = p.ErrorStatus
+		if fault.Status == 0 {
+			fault.Status = fiber.StatusServiceUnavailable
+		}
+	}
+	return fault
+}
+
+func (p *profile) delay() time.Duration {
+	var d time.Duration
+	switch p.Latency.Distribution {
+	case "uniform":
+		d = p.Latency.Min
+		if spread := p.Latency.Max - p.Latency.Min; spread > 0 {
+			d += time.Duration(rand.Int63n(int64(spread)))
+		}
+	case "normal":
+		d = p.Latency.Mean + time.Duration(rand.NormFloat64()*float64(p.Latency.StdDev))
+	default:
+		d = p.Latency.Min
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// Inject applies the request-side faults. It returns true when the request
+// was answered (or the connection dropped) and must not be proxied.
+func Inject(c *fiber.Ctx, fault *Fault) (bool, error) {
+	if fault.Delay > 0 {
+		time.Sleep(fault.Delay)
+	}
+
+	if fault.Reset {
+		if tcpConn, ok := c.Context().Conn().(*net.TCPConn); ok {
+			tcpConn.SetLinger(0)
+		}
+		c.Context().SetConnectionClose()
+		return true, c.Context().Conn().Close()
+	}
+
+	if fault.Status != 0 {
+		c.Set("X-Chaos-Profile", fault.Profile)
+		return true, c.Status(fault.Status).SendString("chaos fault injected")
+	}
+	return false, nil
+}
+
+// Throttle sends the body to the client at no more than bytesPerSec
+func Throttle(c *fiber.Ctx, body []byte, bytesPerSec int) error {
+	const tick = 100 * time.Millisecond
+	chunk := bytesPerSec / int(time.Second/tick)
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for len(body) > 0 {
+			n := chunk
+			if n > len(body) {
+				n = len(body)
+			}
+			if _, err := w.Write(body[:n]); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			body = body[n:]
+			if len(body) > 0 {
+				time.Sleep(tick)
+			}
+		}
+	})
+	return nil
+}
+
+func pathMatch(pattern, path string) bool {
+	if pattern == path || pattern == "*" || pattern == "/*" {
+		return true
+	}
+
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+
+	if len(patternParts) != len(pathParts) {
+		return false
+	}
+
+	for i := range patternParts {
+		if patternParts[i] == "*" {
+			continue
+		}
+		if patternParts[i] != pathParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -8,38 +8,589 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `mapstructure:"server"`
-	Proxy     ProxyConfig     `mapstructure:"proxy"`
-	Log       LogConfig       `mapstructure:"log"`
-	DB        DBConfig        `mapstructure:"db"`
-	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Proxy       ProxyConfig       `mapstructure:"proxy"`
+	Log         LogConfig         `mapstructure:"log"`
+	DB          DBConfig          `mapstructure:"db"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	Chaos       ChaosConfig       `mapstructure:"chaos"`
+	Inspector   InspectorConfig   `mapstructure:"inspector"`
+	Tenancy     TenancyConfig     `mapstructure:"tenancy"`
+	SLO         SLOConfig         `mapstructure:"slo"`
+	QoS         QoSConfig         `mapstructure:"qos"`
+	Alerting    AlertingConfig    `mapstructure:"alerting"`
+	Anomaly     AnomalyConfig     `mapstructure:"anomaly"`
+	Stats       StatsConfig       `mapstructure:"stats"`
+	Sentry      SentryConfig      `mapstructure:"sentry"`
+	Correlation CorrelationConfig `mapstructure:"correlation"`
+	Pipeline    PipelineConfig    `mapstructure:"pipeline"`
+	Flags       FlagsConfig       `mapstructure:"feature_flags"`
 }
 
 type ServerConfig struct {
-	Port         int           `mapstructure:"port"`
-	Host         string        `mapstructure:"host"`
-	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout time.Duration `mapstructure:"write_timeout"`
-	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	Port         int             `mapstructure:"port"`
+	Host         string          `mapstructure:"host"`
+	ReadTimeout  time.Duration   `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration   `mapstructure:"write_timeout"`
+	IdleTimeout  time.Duration   `mapstructure:"idle_timeout"`
+	TLS          ServerTLSConfig `mapstructure:"tls"`
+	HTTP3        HTTP3Config     `mapstructure:"http3"`
+
+	ProxyProtocol ProxyProtocolConfig `mapstructure:"proxy_protocol"`
+}
+
+// ProxyProtocolConfig represents the PROXY protocol v1 and v2 headers load
+// balancers in front of the server send with the client address
+type ProxyProtocolConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	TrustedProxies    []string      `mapstructure:"trusted_proxies"`     // IPs or CIDRs allowed to send a header, empty trusts every peer
+	Required          bool          `mapstructure:"required"`            // Reject connections of trusted proxies without a header
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"` // Defaults to 10s
+}
+
+// HTTP3Config represents the QUIC listener served next to the TCP one. It
+// shares the certificate of tls, HTTP/3 has no plaintext form.
+type HTTP3Config struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Port    int           `mapstructure:"port"`    // UDP port, defaults to the server port
+	MaxAge  time.Duration `mapstructure:"max_age"` // Alt-Svc lifetime announced on TCP responses, defaults to 24h
+}
+
+// ServerTLSConfig represents the TLS of the listener, enabled when cert_file
+// is set, and the verification of client certificates
+type ServerTLSConfig struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"` // CAs client certificates are verified against
+	ClientAuth   string `mapstructure:"client_auth"`    // none, optional or require, defaults to require with a client CA
 }
 
 type ProxyConfig struct {
-	Target                string          `mapstructure:"target"`
-	Timeout               time.Duration   `mapstructure:"timeout"`
-	MaxIdleConns          int             `mapstructure:"max_idle_conns"`
-	IdleConnTimeout       time.Duration   `mapstructure:"idle_conn_timeout"`
-	TLSTimeout            time.Duration   `mapstructure:"tls_timeout"`
-	ResponseHeaderTimeout time.Duration   `mapstructure:"response_header_timeout"`
-	ExpectContinueTimeout time.Duration   `mapstructure:"expect_continue_timeout"`
-	MaxConnsPerHost       int             `mapstructure:"max_conns_per_host"`
-	RetryCount            int             `mapstructure:"retry_count"`
-	RetryWaitTime         time.Duration   `mapstructure:"retry_wait_time"`
-	Transform             TransformConfig `mapstructure:"transform"`
+	Target                string                `mapstructure:"target"`
+	Timeout               time.Duration         `mapstructure:"timeout"`
+	MaxIdleConns          int                   `mapstructure:"max_idle_conns"`
+	IdleConnTimeout       time.Duration         `mapstructure:"idle_conn_timeout"`
+	TLSTimeout            time.Duration         `mapstructure:"tls_timeout"`
+	ResponseHeaderTimeout time.Duration         `mapstructure:"response_header_timeout"`
+	ExpectContinueTimeout time.Duration         `mapstructure:"expect_continue_timeout"`
+	MaxConnsPerHost       int                   `mapstructure:"max_conns_per_host"`
+	RetryCount            int                   `mapstructure:"retry_count"`     // Retries of idempotent requests failing transiently
+	RetryWaitTime         time.Duration         `mapstructure:"retry_wait_time"` // First backoff, doubled per retry, defaults to 100ms
+	RetryAttemptTimeout   time.Duration         `mapstructure:"retry_attempt_timeout"`
+	BodyReadTimeout       time.Duration         `mapstructure:"body_read_timeout"` // Reading the response body once headers arrived
+	Transform             TransformConfig       `mapstructure:"transform"`
+	Routing               RoutingConfig         `mapstructure:"routing"`
+	DryRun                DryRunConfig          `mapstructure:"dry_run"`
+	Maintenance           MaintenanceConfig     `mapstructure:"maintenance"`
+	Mirror                MirrorConfig          `mapstructure:"mirror"`
+	ErrorPages            ErrorPagesConfig      `mapstructure:"error_pages"`
+	TimeoutBudget         TimeoutBudgetConfig   `mapstructure:"timeout_budget"`
+	SlowClient            SlowClientConfig      `mapstructure:"slow_client"`
+	ContentEncoding       ContentEncodingConfig `mapstructure:"content_encoding"`
+	Compression           CompressionConfig     `mapstructure:"compression"`
+	Forwarded             ForwardedConfig       `mapstructure:"forwarded"`
+	UpstreamAuth          UpstreamAuthConfig    `mapstructure:"upstream_auth"`
+	Breaker               UpstreamBreakerConfig `mapstructure:"breaker"`
+	// Per-route policies, the first route matching a request applies
+	Routes []RouteConfig `mapstructure:"routes"`
+	// Cancel the upstream request as soon as the client disconnects
+	CancelOnDisconnect bool `mapstructure:"cancel_on_disconnect"`
+	// Media types of responses flushed to the client as they arrive instead
+	// of buffered, defaults to text/event-stream
+	StreamContentTypes []string   `mapstructure:"stream_content_types"`
+	GRPC               GRPCConfig `mapstructure:"grpc"`
+	// Request and response bodies of at least this many bytes, or of unknown
+	// length, are piped end-to-end instead of buffered, 0 disables
+	StreamThreshold int64 `mapstructure:"stream_threshold"`
+	// TLS settings of single upstream hosts, replacing upstream_auth.tls for
+	// them
+	TargetTLS []TargetTLSConfig `mapstructure:"target_tls"`
+	// Connection pools of single upstream hosts, replacing the proxy wide
+	// settings for them
+	TargetPools []TargetPoolConfig `mapstructure:"target_pools"`
+	// HTTP version spoken to the upstreams
+	HTTP2 UpstreamHTTP2Config `mapstructure:"http2"`
+}
+
+// UpstreamHTTP2Config represents the use of HTTP/2 to upstreams and the
+// settings of its multiplexed connections
+type UpstreamHTTP2Config struct {
+	// http1 (default), http2 when TLS negotiates it, or h2c to also speak
+	// HTTP/2 without TLS to http:// targets, which must support it
+	Mode            string        `mapstructure:"mode"`
+	ReadIdleTimeout time.Duration `mapstructure:"read_idle_timeout"` // Pings a connection without frames for this long, 0 disables
+	PingTimeout     time.Duration `mapstructure:"ping_timeout"`      // Closes a connection not answering the ping, defaults to 15s
+	// Queue requests once the stream limit of the upstream is reached
+	// instead of opening another connection
+	StrictMaxConcurrentStreams bool   `mapstructure:"strict_max_concurrent_streams"`
+	MaxReadFrameSize           uint32 `mapstructure:"max_read_frame_size"` // Largest frame accepted, defaults to 16KB
+}
+
+// GRPCConfig represents the gRPC listener. gRPC needs HTTP/2, so calls are
+// served apart from the HTTP listener and logged without their messages.
+type GRPCConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Address  string `mapstructure:"address"`   // e.g. :9090
+	Target   string `mapstructure:"target"`    // http:// for h2c upstreams, https:// for TLS
+	CertFile string `mapstructure:"cert_file"` // Serves TLS when set, h2c otherwise
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// UpstreamBreakerConfig represents the circuit breakers of the upstreams, one
+// per target host. 5xx answers and transport errors count as failures.
+type UpstreamBreakerConfig struct {
+	BreakerConfig `mapstructure:",squash"`
+	Status        int `mapstructure:"status"` // Answered while open, defaults to 503
+}
+
+// ContentEncodingConfig represents how compressed upstream responses are
+// handled. Enabled, gzip, deflate and br bodies are decoded before transforms
+// and logging and encoded again as the client accepts.
+type ContentEncodingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// CompressionConfig represents the compression of responses the upstream
+// sent uncompressed, negotiated with the client's Accept-Encoding
+type CompressionConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	MinSize      int      `mapstructure:"min_size"`      // Smaller bodies are sent as is, defaults to 1KB
+	ContentTypes []string `mapstructure:"content_types"` // Media types compressed, type/* allowed, defaults to text and common text formats
+	Encodings    []string `mapstructure:"encodings"`     // Codings offered in order of preference, defaults to br and gzip
+}
+
+// ForwardedConfig represents the X-Forwarded-* headers sent upstream and the
+// proxies trusted to report the client in front of them
+type ForwardedConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // IPs or CIDRs whose forwarding headers are believed
+}
+
+// UpstreamAuthConfig represents the credentials presented to the upstream.
+// Secrets are read from files kept current by a secret manager, e.g. a Vault
+// agent or a mounted Kubernetes secret, and swapped when they rotate.
+type UpstreamAuthConfig struct {
+	Enabled bool                 `mapstructure:"enabled"`
+	Refresh time.Duration        `mapstructure:"refresh"` // How often secret files are checked, defaults to 30s
+	HMAC    UpstreamHMACConfig   `mapstructure:"hmac"`
+	OAuth2  UpstreamOAuth2Config `mapstructure:"oauth2"`
+	TLS     UpstreamTLSConfig    `mapstructure:"tls"`
+}
+
+// TargetTLSConfig represents the TLS settings of the connections to one
+// upstream host. Files are read at startup, unlike upstream_auth.tls they
+// are not rotated.
+type TargetTLSConfig struct {
+	// As in target URLs, e.g. orders.internal:8443. Without a port, any
+	// port of the host matches.
+	Host               string `mapstructure:"host"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"` // Client certificate for mTLS
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`          // SNI and verified name, defaults to the host
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Development only
+}
+
+// TargetPoolConfig represents the connection pool of one upstream host.
+// Unset limits keep the proxy wide ones.
+type TargetPoolConfig struct {
+	Host                string        `mapstructure:"host"` // As in target_tls
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	DialTimeout         time.Duration `mapstructure:"dial_timeout"`   // 0 waits for the OS
+	KeepAlive           time.Duration `mapstructure:"keep_alive"`     // TCP keep-alive interval, defaults to 15s, negative disables
+	ProxyProtocol       int           `mapstructure:"proxy_protocol"` // PROXY protocol version sent with the client address, 1 or 2, 0 disables
+}
+
+// UpstreamHMACConfig represents the HMAC-SHA256 request signature, enabled
+// when key_file is set
+type UpstreamHMACConfig struct {
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// UpstreamOAuth2Config represents the OAuth2 client credentials grant whose
+// access token is sent as a bearer token, enabled when token_url is set
+type UpstreamOAuth2Config struct {
+	TokenURL         string        `mapstructure:"token_url"`
+	ClientIDFile     string        `mapstructure:"client_id_file"`
+	ClientSecretFile string        `mapstructure:"client_secret_file"`
+	Scopes           []string      `mapstructure:"scopes"`
+	Timeout          time.Duration `mapstructure:"timeout"` // Token request timeout, defaults to 10s
+}
+
+// UpstreamTLSConfig represents the client certificate presented to the
+// upstream, enabled when cert_file is set, and the CAs trusted to verify it
+type UpstreamTLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	CAFile   string `mapstructure:"ca_file"` // Empty trusts the system roots
+}
+
+// RouteConfig represents the policies applied to the requests of a route
+type RouteConfig struct {
+	Name    string   `mapstructure:"name"`
+	Path    string   `mapstructure:"path"`    // Pattern, * matches a segment and a trailing /* any suffix
+	Methods []string `mapstructure:"methods"` // Empty matches every method
+	// Upstream base URL of the route, replacing proxy.target and tenant
+	// targets so one instance fronts several services
+	Target string `mapstructure:"target"`
+	// Replicas of the route upstream, balanced per request instead of target
+	Targets []string `mapstructure:"targets"`
+	// round_robin, least_connections or consistent_hash, defaults to
+	// round_robin. consistent_hash maps the sticky key, the client IP by
+	// default, onto a ring so pool changes move few keys.
+	Balancer string `mapstructure:"balancer"`
+	// Weighted targets, e.g. a canary, instead of target and targets
+	Split    []SplitTarget  `mapstructure:"split"`
+	Redirect RedirectConfig `mapstructure:"redirect"`
+	Rewrite  RewriteConfig  `mapstructure:"rewrite"`
+	Query    QueryConfig    `mapstructure:"query"`
+	Status   StatusConfig   `mapstructure:"status"`
+	// Pipeline stage order for the route, overriding pipeline.stages and
+	// pipeline.disable
+	Stages        []string       `mapstructure:"stages"`
+	DisableStages []string       `mapstructure:"disable_stages"` // Pipeline stages skipped for the route
+	Protobuf      ProtobufConfig `mapstructure:"protobuf"`
+	// Feature flag gating the route, evaluated per request before tenant
+	// identification. A route whose flag is off does not match.
+	Flag string `mapstructure:"flag"`
+	// Fans the request out to several upstreams and merges their responses
+	// instead of proxying it to the target
+	Compose ComposeConfig `mapstructure:"compose"`
+	// Active probes taking unhealthy targets out of rotation
+	HealthCheck HealthCheckConfig `mapstructure:"health_check"`
+	// Passive ejection of targets failing consecutive requests
+	OutlierDetection OutlierConfig `mapstructure:"outlier_detection"`
+	// Upstream timeouts of the route, overriding the proxy ones
+	Timeouts RouteTimeoutsConfig `mapstructure:"timeouts"`
+	// Pipe request and response bodies end-to-end instead of buffering them,
+	// e.g. for uploads and downloads. Bodies are then not logged and
+	// responses not transformed.
+	Stream bool `mapstructure:"stream"`
+	// Request conditions on top of path and methods, e.g. to send beta
+	// traffic to an alternate target
+	Match RouteMatchConfig `mapstructure:"match"`
+	// Session affinity of balanced targets, a client keeps its replica
+	Sticky StickyConfig `mapstructure:"sticky"`
+	// Backups of the route target, taking the requests it fails
+	Failover FailoverConfig `mapstructure:"failover"`
+	// Forward the Host header of the client instead of the target host, for
+	// upstreams serving several virtual hosts
+	PreserveHost bool `mapstructure:"preserve_host"`
+	// Extra requests to other replicas when the first is slow to answer
+	Hedge HedgeConfig `mapstructure:"hedge"`
+	// Cap of the route requests in flight, protecting a slow upstream
+	Bulkhead BulkheadConfig `mapstructure:"bulkhead"`
+	// Source of the replicas of the route, refreshed instead of listed in
+	// targets
+	Discovery DiscoveryConfig `mapstructure:"discovery"`
+	// Window over which a target back in rotation, after failed probes, an
+	// ejection or discovery, ramps up from 10% to its full traffic share
+	SlowStart time.Duration `mapstructure:"slow_start"`
+	// Canned response answering the route without an upstream, e.g. to stub
+	// an endpoint not released yet
+	Mock MockConfig `mapstructure:"mock"`
+	// A/B test assigning clients to variants, each sent to its own target or
+	// told its variant through a header
+	Experiment ExperimentConfig `mapstructure:"experiment"`
+}
+
+// HedgeConfig represents the hedging of the idempotent requests of a
+// balanced route. Once delay passed without an answer the request is also
+// sent to another replica, the first answer is used.
+type HedgeConfig struct {
+	Delay time.Duration `mapstructure:"delay"` // Enables hedging
+	Max   int           `mapstructure:"max"`   // Hedged requests per request, defaults to 1
+}
+
+// MockConfig represents the canned response of a mock route. The body
+// template receives .Method, .Path, .Query, .Header and .Body of the request.
+type MockConfig struct {
+	Enabled    bool              `mapstructure:"enabled"`
+	StatusCode int               `mapstructure:"status_code"` // Defaults to 200
+	Headers    map[string]string `mapstructure:"headers"`     // Content-Type defaults to application/json
+	Body       string            `mapstructure:"body"`        // text/template, the json function quotes a value
+	BodyFile   string            `mapstructure:"body_file"`   // Read instead of body when set
+	Delay      time.Duration     `mapstructure:"delay"`       // Simulated upstream latency
+}
+
+// ExperimentConfig represents an A/B test of a route. A client is assigned
+// a variant by weight on its first request and kept in it by a cookie.
+type ExperimentConfig struct {
+	Name           string              `mapstructure:"name"`            // Enables the experiment, labels metrics and logs
+	Cookie         string              `mapstructure:"cookie"`          // Defaults to muhtar_exp_<name>
+	CookieTTL      time.Duration       `mapstructure:"cookie_ttl"`      // Defaults to 30 days
+	Header         string              `mapstructure:"header"`          // Sent upstream with the variant, defaults to X-Experiment-Variant
+	OverrideHeader string              `mapstructure:"override_header"` // Request header forcing a variant, e.g. for QA
+	Variants       []ExperimentVariant `mapstructure:"variants"`
+}
+
+// ExperimentVariant represents one arm of an experiment
+type ExperimentVariant struct {
+	Name   string `mapstructure:"name"`
+	Weight int    `mapstructure:"weight"`
+	Target string `mapstructure:"target"` // Empty keeps the route target
+}
+
+// DiscoveryConfig represents how the replicas of a route are found. The
+// set is refreshed on an interval, so scaling behind the name needs no
+// restart.
+type DiscoveryConfig struct {
+	Type     string        `mapstructure:"type"`     // dns (A/AAAA records), srv, kubernetes or consul, empty disables
+	Name     string        `mapstructure:"name"`     // Host name, SRV name such as _http._tcp.orders.internal, or service name
+	Port     int           `mapstructure:"port"`     // Port of the targets, defaults to the scheme's for dns and the discovered one otherwise
+	Scheme   string        `mapstructure:"scheme"`   // Of the targets, defaults to http
+	Interval time.Duration `mapstructure:"interval"` // Between refreshes, defaults to 30s
+	// kubernetes: API server, defaults to the in-cluster one. consul: agent,
+	// defaults to http://127.0.0.1:8500.
+	Address    string `mapstructure:"address"`
+	Token      string `mapstructure:"token"`      // kubernetes: defaults to the pod service account token
+	CAFile     string `mapstructure:"ca_file"`    // kubernetes: defaults to the pod service account CA
+	Namespace  string `mapstructure:"namespace"`  // kubernetes: defaults to the pod namespace
+	PortName   string `mapstructure:"port_name"`  // kubernetes: endpoint port used, defaults to the first
+	Tag        string `mapstructure:"tag"`        // consul: instances carrying the tag only
+	Datacenter string `mapstructure:"datacenter"` // consul: defaults to the agent's
+}
+
+// BulkheadConfig represents the requests of a route proxied at once.
+// Requests over the cap wait for a slot and are answered 503 with
+// Retry-After when the queue is full or the wait times out.
+type BulkheadConfig struct {
+	MaxInFlight  int           `mapstructure:"max_in_flight"` // Enables the bulkhead
+	MaxQueue     int           `mapstructure:"max_queue"`     // Requests waiting for a slot, 0 rejects at once
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"` // Longest wait for a slot, defaults to 1s
+}
+
+// FailoverConfig represents the backup targets of a route. Requests go to
+// the next backup when the target is unhealthy, unreachable or answers one
+// of the failover statuses.
+type FailoverConfig struct {
+	Backups []string `mapstructure:"backups"` // Tried in order
+	Status  []int    `mapstructure:"status"`  // Defaults to 502, 503 and 504
+}
+
+// StickyConfig represents how the session of a request is identified to
+// pin it to a replica
+type StickyConfig struct {
+	Source string `mapstructure:"source"` // cookie, header or ip, empty disables affinity
+	Name   string `mapstructure:"name"`   // Cookie or header hashed
+}
+
+// RouteMatchConfig represents request conditions a route requires, all of
+// them must hold. An empty value only requires the header or parameter to
+// be present.
+type RouteMatchConfig struct {
+	Headers map[string]string `mapstructure:"headers"`
+	Query   map[string]string `mapstructure:"query"` // Parameter names are lower-case
+}
+
+// RouteTimeoutsConfig represents the upstream timeouts of a route, 0 keeps
+// the proxy value
+type RouteTimeoutsConfig struct {
+	Upstream       time.Duration `mapstructure:"upstream"`        // Whole upstream call, overrides proxy.timeout
+	ResponseHeader time.Duration `mapstructure:"response_header"` // Overrides proxy.response_header_timeout
+	BodyRead       time.Duration `mapstructure:"body_read"`       // Overrides proxy.body_read_timeout
+}
+
+// SplitTarget represents a weighted target of a route. Weights are relative
+// and can be changed at runtime through the admin API.
+type SplitTarget struct {
+	Name       string `mapstructure:"name"`
+	Target     string `mapstructure:"target"`
+	Weight     int    `mapstructure:"weight"`
+	WeightFlag string `mapstructure:"weight_flag"` // Numeric feature flag overriding the weight per request
+}
+
+// HealthCheckConfig represents the active health check of the route targets,
+// enabled when path is set. 2xx and 3xx answers pass.
+type HealthCheckConfig struct {
+	Path               string        `mapstructure:"path"`
+	Interval           time.Duration `mapstructure:"interval"`            // Defaults to 10s
+	Timeout            time.Duration `mapstructure:"timeout"`             // Per probe, defaults to 2s
+	HealthyThreshold   int           `mapstructure:"healthy_threshold"`   // Passed probes restoring a target, defaults to 2
+	UnhealthyThreshold int           `mapstructure:"unhealthy_threshold"` // Failed probes removing a target, defaults to 3
+}
+
+// OutlierConfig represents the ejection of balanced or split targets whose
+// requests fail, enabled when consecutive_failures is set. 5xx answers and
+// transport errors, timeouts included, count as failures.
+type OutlierConfig struct {
+	ConsecutiveFailures int           `mapstructure:"consecutive_failures"`
+	Cooldown            time.Duration `mapstructure:"cooldown"`            // Ejection time, defaults to 30s
+	MaxEjectedPercent   int           `mapstructure:"max_ejected_percent"` // Of the targets, defaults to 50
+}
+
+// ComposeConfig represents a composite route, enabled when upstreams are set
+type ComposeConfig struct {
+	Upstreams []ComposeUpstream `mapstructure:"upstreams"`
+	// keyed returns {"<name>": body}, merge deep merges the JSON objects in
+	// upstream order, template renders template. Defaults to keyed.
+	Merge       string        `mapstructure:"merge"`
+	Template    string        `mapstructure:"template"`     // Go text/template, the data maps names to status, body and error
+	ContentType string        `mapstructure:"content_type"` // Of the merged response, defaults to application/json
+	Timeout     time.Duration `mapstructure:"timeout"`      // Per upstream call, defaults to the proxy timeout
+}
+
+// ComposeUpstream represents one call of a composite route
+type ComposeUpstream struct {
+	Name     string `mapstructure:"name"`
+	URL      string `mapstructure:"url"`      // Base URL, the path is appended
+	Path     string `mapstructure:"path"`     // Defaults to the request path, the query is always forwarded
+	Method   string `mapstructure:"method"`   // Defaults to the request method
+	Required bool   `mapstructure:"required"` // A failed required call fails the request, others merge as null
+}
+
+// ProtobufConfig represents the messages of a route carried as binary
+// protobuf or gRPC, decoded to JSON for logs and transform scripts
+type ProtobufConfig struct {
+	// FileDescriptorSet files, protoc --descriptor_set_out --include_imports
+	Descriptors []string `mapstructure:"descriptors"`
+	Request     string   `mapstructure:"request"`  // Fully qualified request message, e.g. acme.orders.v1.CreateOrderRequest
+	Response    string   `mapstructure:"response"` // Fully qualified response message
+}
+
+// StatusConfig represents how upstream status codes are mapped to the codes
+// returned to clients
+type StatusConfig struct {
+	Map    map[int]int `mapstructure:"map"`    // Upstream code to client code, e.g. 500: 502
+	Header string      `mapstructure:"header"` // Carries the upstream code of mapped responses, empty omits it
+}
+
+// QueryConfig represents the query parameter rules of a route, applied in
+// field order
+type QueryConfig struct {
+	Remove   []string          `mapstructure:"remove"`   // Names to drop, a trailing * matches a prefix (utm_*)
+	Rename   map[string]string `mapstructure:"rename"`   // Old name to new name
+	Set      map[string]string `mapstructure:"set"`      // Replaces any value the client sent
+	Add      map[string]string `mapstructure:"add"`      // Appended next to the client's values
+	Defaults map[string]string `mapstructure:"defaults"` // Used only when the client sent none
+}
+
+// RewriteConfig represents how the path of a route is rewritten before it is
+// forwarded. Steps run in field order.
+type RewriteConfig struct {
+	StripPrefix string `mapstructure:"strip_prefix"` // e.g. /api/v1 turns /api/v1/users into /users
+	Regex       string `mapstructure:"regex"`        // Applied to the path after the prefix is stripped
+	Replacement string `mapstructure:"replacement"`  // Regex replacement, $1 refers to the first capture group
+	AddPrefix   string `mapstructure:"add_prefix"`
+}
+
+// RedirectConfig represents how upstream 3xx responses are handled
+type RedirectConfig struct {
+	Policy  string `mapstructure:"policy"`   // pass (default), follow or rewrite
+	MaxHops int    `mapstructure:"max_hops"` // follow: redirects followed before passing the response on, defaults to 5
+	// rewrite: scheme and host replacing internal ones in Location, defaults
+	// to those of the incoming request
+	PublicURL string `mapstructure:"public_url"`
+	// rewrite: hosts treated as internal besides the upstream's own
+	InternalHosts []string `mapstructure:"internal_hosts"`
+}
+
+// MirrorConfig represents the configuration for shadow traffic
+type MirrorConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Target  string        `mapstructure:"target"`  // Shadow upstream receiving a copy of the traffic
+	Ratio   float64       `mapstructure:"ratio"`   // Share of requests mirrored (0-1), defaults to 1
+	Timeout time.Duration `mapstructure:"timeout"` // Shadow request timeout
+	Compare struct {
+		Enabled       bool     `mapstructure:"enabled"`
+		IgnoreHeaders []string `mapstructure:"ignore_headers"` // Headers excluded from the comparison
+		IgnoreFields  []string `mapstructure:"ignore_fields"`  // Dot separated JSON body paths, * matches any key
+		SampleSize    int      `mapstructure:"sample_size"`    // Number of mismatch samples retained
+	} `mapstructure:"compare"`
+}
+
+// DryRunConfig represents the stub returned instead of calling the upstream
+type DryRunConfig struct {
+	Enabled    bool              `mapstructure:"enabled"`
+	Paths      []string          `mapstructure:"paths"`       // Route paths (supports wildcards), empty for all
+	StatusCode int               `mapstructure:"status_code"` // Defaults to 200
+	Headers    map[string]string `mapstructure:"headers"`
+	Body       string            `mapstructure:"body"`
+}
+
+// MaintenanceConfig represents the static response answering requests
+// instead of proxying them while maintenance mode is on. The body template
+// receives .Status, .Route, .Method, .Path, .TraceID and .Until.
+type MaintenanceConfig struct {
+	Enabled    bool              `mapstructure:"enabled"`
+	Routes     []string          `mapstructure:"routes"`      // Route names, empty for all requests
+	StatusCode int               `mapstructure:"status_code"` // Defaults to 503
+	RetryAfter time.Duration     `mapstructure:"retry_after"`
+	Headers    map[string]string `mapstructure:"headers"`
+	Body       string            `mapstructure:"body"` // text/template, the json function quotes a value
+}
+
+// ErrorPagesConfig represents the responses returned when the upstream
+// cannot answer. Templates receive .Status, .Code, .Title, .Message,
+// .TraceID, .Method, .Path and .Timestamp.
+type ErrorPagesConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	JSON     string `mapstructure:"json"`      // text/template, the json function quotes a value
+	HTML     string `mapstructure:"html"`      // html/template
+	HTMLFile string `mapstructure:"html_file"` // Read instead of html when set
+}
+
+// TimeoutBudgetConfig represents how the remaining request deadline is
+// forwarded to the upstream
+type TimeoutBudgetConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Header  string `mapstructure:"header"` // Defaults to X-Request-Timeout-Ms
+	Format  string `mapstructure:"format"` // ms (milliseconds) or grpc (e.g. 250m), defaults to ms
+}
+
+// SlowClientConfig represents the deadlines bounding how long a client may
+// take to read a response
+type SlowClientConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"` // Longest time to send one response, 0 for no limit
+	MinRate      int           `mapstructure:"min_rate"`      // Bytes per second a client must read at, 0 for no limit
+	Grace        time.Duration `mapstructure:"grace"`         // Extra time allowed per chunk, defaults to 1s
+	ChunkSize    int           `mapstructure:"chunk_size"`    // Bytes written per deadline, defaults to 16KB
 }
 
 type LogConfig struct {
-	Level  string `mapstructure:"level"`
-	Format string `mapstructure:"format"`
+	Level       string               `mapstructure:"level"`
+	Format      string               `mapstructure:"format"`
+	Backend     string               `mapstructure:"backend"` // zerolog, zap or silent, defaults to zerolog
+	Persistence LogPersistenceConfig `mapstructure:"persistence"`
+}
+
+// LogPersistenceConfig represents how traffic logs are written to the repository
+type LogPersistenceConfig struct {
+	Workers      int                `mapstructure:"workers"`       // Concurrent repository writers
+	BufferSize   int                `mapstructure:"buffer_size"`   // Queued logs waiting for a writer
+	WriteTimeout time.Duration      `mapstructure:"write_timeout"` // Per write timeout, slow writes count as failures
+	FallbackSize int                `mapstructure:"fallback_size"` // Logs kept while the repository breaker is open
+	Breaker      BreakerConfig      `mapstructure:"breaker"`
+	Spill        SpillConfig        `mapstructure:"spill"`
+	Backpressure BackpressureConfig `mapstructure:"backpressure"`
+}
+
+// BackpressureConfig represents what happens when the log queue is full
+type BackpressureConfig struct {
+	Policy        string        `mapstructure:"policy"`         // fallback, block, drop_oldest, drop_newest or sample
+	MaxWait       time.Duration `mapstructure:"max_wait"`       // Longest a request waits for queue space with the block policy
+	SampleRate    float64       `mapstructure:"sample_rate"`    // Share of logs kept while sampling down
+	HighWatermark float64       `mapstructure:"high_watermark"` // Queue fill ratio at which sampling starts
+}
+
+// SpillConfig represents the on-disk overflow for logs that do not fit in memory
+type SpillConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Dir         string `mapstructure:"dir"`
+	SegmentSize int64  `mapstructure:"segment_size"` // Bytes per segment file
+	MaxSize     int64  `mapstructure:"max_size"`     // Total bytes kept on disk
+}
+
+// BreakerConfig represents circuit breaker settings
+type BreakerConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	FailureThreshold int           `mapstructure:"failure_threshold"`  // Consecutive failures that open the breaker
+	RecoveryTimeout  time.Duration `mapstructure:"recovery_timeout"`   // Time spent open before probing
+	HalfOpenRequests int           `mapstructure:"half_open_requests"` // Successful probes needed to close
 }
 
 type DBConfig struct {
@@ -53,7 +604,47 @@ type DBConfig struct {
 		MaxConns  int `mapstructure:"max_conns"`
 		MinConns  int `mapstructure:"min_conns"`
 		BatchSize int `mapstructure:"batch_size"`
+		// Minimum batch size written with COPY FROM (postgres only)
+		CopyThreshold int `mapstructure:"copy_threshold"`
 	} `mapstructure:"pool"`
+	Health DBHealthConfig `mapstructure:"health"`
+	// Apply pending schema migrations on startup
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+	// Read replica used by log query endpoints
+	Replica DBReplicaConfig `mapstructure:"replica"`
+	// Per-minute traffic rollups
+	Rollup RollupConfig `mapstructure:"rollup"`
+}
+
+// DBReplicaConfig represents read-only connection settings. Empty fields
+// fall back to the primary connection settings.
+type DBReplicaConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database"`
+	MaxConns int    `mapstructure:"max_conns"`
+	MinConns int    `mapstructure:"min_conns"`
+}
+
+// RollupConfig represents the per-minute traffic aggregation job
+type RollupConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	MaxSamples    int           `mapstructure:"max_samples"` // Latency samples kept per route and minute
+}
+
+// DBHealthConfig represents the repository health check and reconnect policy
+type DBHealthConfig struct {
+	Interval         time.Duration `mapstructure:"interval"`          // Ping interval, defaults to 10s
+	Timeout          time.Duration `mapstructure:"timeout"`           // Ping timeout, defaults to 2s
+	FailureThreshold int           `mapstructure:"failure_threshold"` // Consecutive failures before reconnecting
+	Backoff          struct {
+		Initial time.Duration `mapstructure:"initial"`
+		Max     time.Duration `mapstructure:"max"`
+	} `mapstructure:"backoff"`
 }
 
 type RateLimitConfig struct {
@@ -63,6 +654,10 @@ type RateLimitConfig struct {
 		Requests int           `mapstructure:"requests"` // Number of requests
 		Window   time.Duration `mapstructure:"window"`   // Time window
 		Burst    int           `mapstructure:"burst"`    // Burst size
+		// fixed_window, leaky_bucket or gcra, defaults to fixed_window
+		Algorithm string `mapstructure:"algorithm"`
+		// Time based overrides, the first active one applies
+		Schedules []RateLimitSchedule `mapstructure:"schedules"`
 	} `mapstructure:"global"`
 
 	// Per IP rate limits
@@ -72,11 +667,49 @@ type RateLimitConfig struct {
 		Window    time.Duration `mapstructure:"window"`
 		Burst     int           `mapstructure:"burst"`
 		WhiteList []string      `mapstructure:"whitelist"` // IP whitelist
+		Algorithm string        `mapstructure:"algorithm"` // As in global
+		// Time based overrides, the first active one applies
+		Schedules []RateLimitSchedule `mapstructure:"schedules"`
 	} `mapstructure:"per_ip"`
 
+	// Per API key rate limits
+	PerKey struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Header  string `mapstructure:"header"` // Header carrying the API key, defaults to X-API-Key
+		Query   string `mapstructure:"query"`  // Query parameter read when the header is missing
+		// Limit of keys not listed, 0 leaves them to the other limits
+		Requests int           `mapstructure:"requests"`
+		Window   time.Duration `mapstructure:"window"`
+		Burst    int           `mapstructure:"burst"`
+		Keys     []APIKeyLimit `mapstructure:"keys"`
+	} `mapstructure:"per_key"`
+
+	// Per bearer token claim rate limits, e.g. per user behind shared IPs
+	PerClaim struct {
+		Enabled bool         `mapstructure:"enabled"`
+		Secret  string       `mapstructure:"secret"` // HS256 secret, empty trusts tokens validated in front of muhtar
+		Claims  []ClaimLimit `mapstructure:"claims"`
+	} `mapstructure:"per_claim"`
+
 	// Per Route rate limits
 	Routes []RouteLimit `mapstructure:"routes"`
 
+	// Daily and monthly request quotas of API keys read as in per_key
+	Quota struct {
+		Enabled  bool   `mapstructure:"enabled"`
+		Timezone string `mapstructure:"timezone"` // IANA zone of the day and month boundaries, defaults to UTC
+		Daily    int    `mapstructure:"daily"`    // Keys without their own quota, 0 unlimited
+		Monthly  int    `mapstructure:"monthly"`
+	} `mapstructure:"quota"`
+
+	// Caps of the requests in flight at once, e.g. for expensive endpoints
+	Concurrency struct {
+		Enabled bool               `mapstructure:"enabled"`
+		PerIP   int                `mapstructure:"per_ip"`  // 0 disables
+		PerKey  int                `mapstructure:"per_key"` // Per API key read as in per_key, 0 disables
+		Routes  []ConcurrencyLimit `mapstructure:"routes"`  // First match applies, shared by all clients
+	} `mapstructure:"concurrency"`
+
 	// Token bucket configuration
 	TokenBucket struct {
 		Enabled      bool          `mapstructure:"enabled"`
@@ -110,6 +743,44 @@ type RateLimitConfig struct {
 			Timeout  time.Duration `mapstructure:"timeout"`
 		} `mapstructure:"redis"`
 	} `mapstructure:"storage"`
+
+	// Violation events stored in the log repository
+	Events RateLimitEventsConfig `mapstructure:"events"`
+}
+
+// APIKeyLimit represents the limit of one API key
+type APIKeyLimit struct {
+	Key      string        `mapstructure:"key"`
+	Name     string        `mapstructure:"name"` // Names the key in counters and events instead of its hash
+	Requests int           `mapstructure:"requests"`
+	Window   time.Duration `mapstructure:"window"` // Defaults to the per_key window
+	Burst    int           `mapstructure:"burst"`
+	// Quotas replacing the defaults of rate_limit.quota for the key
+	DailyQuota   int `mapstructure:"daily_quota"`
+	MonthlyQuota int `mapstructure:"monthly_quota"`
+}
+
+// ConcurrencyLimit represents the in-flight cap of a route
+type ConcurrencyLimit struct {
+	Path        string `mapstructure:"path"`   // As in routes
+	Method      string `mapstructure:"method"` // HTTP method or *
+	MaxInFlight int    `mapstructure:"max_in_flight"`
+}
+
+// ClaimLimit represents the limit of each value of a bearer token claim
+type ClaimLimit struct {
+	Claim    string        `mapstructure:"claim"` // e.g. sub or tenant_id
+	Requests int           `mapstructure:"requests"`
+	Window   time.Duration `mapstructure:"window"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+// RateLimitEventsConfig configures the persistence of rate limited requests
+type RateLimitEventsConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	BufferSize    int           `mapstructure:"buffer_size"`    // Pending events, further ones are dropped. Defaults to 1000
+	BatchSize     int           `mapstructure:"batch_size"`     // Defaults to 100
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // Defaults to 5s
 }
 
 type RouteLimit struct {
@@ -120,6 +791,25 @@ type RouteLimit struct {
 	Burst    int           `mapstructure:"burst"`    // Burst size
 	Group    string        `mapstructure:"group"`    // Route group for shared limits
 	Priority int           `mapstructure:"priority"` // Priority for overlapping rules
+	// Requests counted per request of the route in every limit, e.g. 10 for
+	// search. Defaults to 1.
+	Cost int `mapstructure:"cost"`
+	// fixed_window, leaky_bucket or gcra, defaults to fixed_window
+	Algorithm string `mapstructure:"algorithm"`
+	// Time based overrides, the first active one applies
+	Schedules []RateLimitSchedule `mapstructure:"schedules"`
+}
+
+// RateLimitSchedule overrides the limit of a rule during the minutes its cron
+// expression selects, e.g. stricter limits during business hours
+type RateLimitSchedule struct {
+	Name     string        `mapstructure:"name"`
+	Cron     string        `mapstructure:"cron"`     // minute hour day-of-month month day-of-week, e.g. "* 9-17 * * 1-5"
+	Timezone string        `mapstructure:"timezone"` // IANA zone of the expression, defaults to the local zone
+	Freeze   bool          `mapstructure:"freeze"`   // Reject every request, e.g. during a maintenance window
+	Requests int           `mapstructure:"requests"`
+	Window   time.Duration `mapstructure:"window"` // Defaults to the window of the rule
+	Burst    int           `mapstructure:"burst"`
 }
 
 // TransformConfig represents the configuration for request/response transformations
@@ -128,6 +818,24 @@ type TransformConfig struct {
 	ScriptsDir string `mapstructure:"scripts_dir"`
 	// Service mappings
 	Services map[string]ServiceTransform `mapstructure:"services"`
+	// Script isolation and resource limits, always enabled for tenant scripts
+	Sandbox SandboxConfig `mapstructure:"sandbox"`
+}
+
+// RoutingConfig represents the script choosing the upstream of each request,
+// e.g. by body field, customer segment or percentage
+type RoutingConfig struct {
+	Script    string            `mapstructure:"script"`    // Path of the routing script, empty disables script routing
+	Upstreams map[string]string `mapstructure:"upstreams"` // Names the script may return, mapped to base URLs
+	Sandbox   SandboxConfig     `mapstructure:"sandbox"`   // Pool and limits, routing scripts always run sandboxed
+}
+
+// SandboxConfig represents the VM pool and limits transform scripts run with
+type SandboxConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PoolSize     int           `mapstructure:"pool_size"`      // VMs running scripts concurrently, defaults to 4
+	Timeout      time.Duration `mapstructure:"timeout"`        // Script run time before it is interrupted, defaults to 100ms
+	MaxCallStack int           `mapstructure:"max_call_stack"` // Nested calls allowed, defaults to 256
 }
 
 // ServiceTransform represents transformation rules for a specific service
@@ -136,6 +844,278 @@ type ServiceTransform struct {
 	URL string `mapstructure:"url"`
 	// Service name for script directory
 	ServiceName string `mapstructure:"service_name"`
+	// Large request bodies are transformed by request_stream.js piece by
+	// piece while they are forwarded
+	StreamRequest StreamConfig `mapstructure:"stream_request"`
+	// Large response bodies are transformed by response_stream.js, e.g. to
+	// rewrite URLs in big HTML or JSON payloads
+	StreamResponse StreamConfig `mapstructure:"stream_response"`
+	// Feature flag gating the transforms of the service, evaluated per
+	// request. Empty always transforms.
+	Flag string `mapstructure:"flag"`
+}
+
+// StreamConfig represents when and how a body is transformed as a stream
+// instead of in memory
+type StreamConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Threshold int64  `mapstructure:"threshold"`  // Bodies of at least this many bytes, or of unknown length, are streamed
+	Mode      string `mapstructure:"mode"`       // chunk (default) or ndjson
+	ChunkSize int    `mapstructure:"chunk_size"` // Chunk mode, defaults to 32KB
+}
+
+// AdminConfig represents the configuration for the admin API
+type AdminConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Prefix  string `mapstructure:"prefix"` // Mount path, defaults to /admin
+	Token   string `mapstructure:"token"`  // Bearer token granting the admin role
+	// Additional static tokens, each bound to a role and optionally a tenant
+	Tokens []AdminToken    `mapstructure:"tokens"`
+	OIDC   AdminOIDCConfig `mapstructure:"oidc"`
+}
+
+// AdminToken represents a static admin API credential
+type AdminToken struct {
+	Name   string `mapstructure:"name"` // Shown in audit logs
+	Token  string `mapstructure:"token"`
+	Role   string `mapstructure:"role"`   // viewer, operator or admin
+	Tenant string `mapstructure:"tenant"` // Restricts the token to the endpoints of one tenant
+}
+
+// AdminOIDCConfig represents admin API authentication with OIDC bearer tokens
+type AdminOIDCConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Issuer      string `mapstructure:"issuer"`       // Discovery is read from <issuer>/.well-known/openid-configuration
+	Audience    string `mapstructure:"audience"`     // Required aud claim, empty skips the check
+	RoleClaim   string `mapstructure:"role_claim"`   // Claim holding the role or list of roles, defaults to roles
+	TenantClaim string `mapstructure:"tenant_claim"` // Claim restricting the caller to a tenant, empty disables scoping
+}
+
+// InspectorConfig represents the configuration for the live traffic inspector
+type InspectorConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxSessions   int           `mapstructure:"max_sessions"`   // Concurrent inspector connections
+	MaxDuration   time.Duration `mapstructure:"max_duration"`   // Session lifetime before forced disconnect
+	MaxMessages   int           `mapstructure:"max_messages"`   // Snapshots sent before forced disconnect
+	MaxBodySize   int           `mapstructure:"max_body_size"`  // Bytes of each body included in snapshots
+	RedactHeaders []string      `mapstructure:"redact_headers"` // Header values replaced in snapshots
+	RedactFields  []string      `mapstructure:"redact_fields"`  // JSON body fields replaced in snapshots
+}
+
+// ChaosConfig represents the configuration for fault injection
+type ChaosConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Named fault profiles
+	Profiles map[string]ChaosProfile `mapstructure:"profiles"`
+	// Profile attachments
+	Routes []ChaosRoute `mapstructure:"routes"`
+}
+
+// ChaosProfile describes the faults injected for a matching request
+type ChaosProfile struct {
+	Latency struct {
+		Ratio        float64       `mapstructure:"ratio"`        // Share of requests delayed (0-1)
+		Distribution string        `mapstructure:"distribution"` // fixed, uniform or normal
+		Min          time.Duration `mapstructure:"min"`
+		Max          time.Duration `mapstructure:"max"`
+		Mean         time.Duration `mapstructure:"mean"`
+		StdDev       time.Duration `mapstructure:"stddev"`
+	} `mapstructure:"latency"`
+	ErrorRatio  float64 `mapstructure:"error_ratio"`  // Share of requests answered with ErrorStatus
+	ErrorStatus int     `mapstructure:"error_status"` // Defaults to 503
+	ResetRatio  float64 `mapstructure:"reset_ratio"`  // Share of connections reset
+	Bandwidth   int     `mapstructure:"bandwidth"`    // Response throughput cap in bytes per second
+}
+
+// ChaosRoute attaches a chaos profile to a route
+type ChaosRoute struct {
+	Path    string `mapstructure:"path"`   // Route path (supports wildcards)
+	Method  string `mapstructure:"method"` // HTTP method, * for any
+	Profile string `mapstructure:"profile"`
+}
+
+// SLOConfig represents service level objective tracking and burn rate alerts
+type SLOConfig struct {
+	Enabled            bool           `mapstructure:"enabled"`
+	EvaluationInterval time.Duration  `mapstructure:"evaluation_interval"` // Defaults to 1m
+	Webhook            WebhookConfig  `mapstructure:"webhook"`
+	Objectives         []SLOObjective `mapstructure:"objectives"`
+	// Multiwindow burn rate alerts, defaults to 14.4x over 1h/5m and 6x over 6h/30m
+	Alerts []BurnRateAlert `mapstructure:"alerts"`
+}
+
+// SLOObjective represents the objectives of the traffic matching a tenant
+// and route. Empty selectors match everything.
+type SLOObjective struct {
+	Name         string        `mapstructure:"name"`
+	Tenant       string        `mapstructure:"tenant"`
+	Method       string        `mapstructure:"method"`
+	PathPrefix   string        `mapstructure:"path_prefix"`
+	Availability float64       `mapstructure:"availability"`      // Share of requests without a 5xx, e.g. 0.999
+	Latency      time.Duration `mapstructure:"latency"`           // Threshold of a fast request
+	LatencyRatio float64       `mapstructure:"latency_objective"` // Share of requests under the threshold, e.g. 0.99
+}
+
+// BurnRateAlert fires when the error budget burns faster than Factor over
+// both the long and the short window
+type BurnRateAlert struct {
+	Severity    string        `mapstructure:"severity"`
+	LongWindow  time.Duration `mapstructure:"long_window"`
+	ShortWindow time.Duration `mapstructure:"short_window"`
+	Factor      float64       `mapstructure:"factor"`
+}
+
+// WebhookConfig represents an HTTP endpoint receiving JSON notifications
+type WebhookConfig struct {
+	URL     string            `mapstructure:"url"`
+	Timeout time.Duration     `mapstructure:"timeout"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// QoSConfig represents the priority classes admitting proxied requests
+// under a concurrency cap
+type QoSConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxConcurrent int           `mapstructure:"max_concurrent"` // Requests proxied at once
+	QueueTimeout  time.Duration `mapstructure:"queue_timeout"`  // Longest wait for a slot, defaults to 1s
+	Default       string        `mapstructure:"default"`        // Class of requests no rule matches, defaults to the last class
+	// Highest priority first
+	Classes []PriorityClass `mapstructure:"classes"`
+	// The first matching rule assigns the class
+	Rules []PriorityRule `mapstructure:"rules"`
+}
+
+// PriorityClass represents a tier of traffic. Lower classes are capped to a
+// share of the capacity so higher classes always find free slots.
+type PriorityClass struct {
+	Name     string  `mapstructure:"name"`
+	MaxShare float64 `mapstructure:"max_share"` // Share of max_concurrent the class may use, 0 for all
+	MaxQueue int     `mapstructure:"max_queue"` // Requests waiting for a slot, 0 sheds at once
+}
+
+// PriorityRule assigns a class to matching requests. Empty selectors match
+// everything.
+type PriorityRule struct {
+	Class      string `mapstructure:"class"`
+	Method     string `mapstructure:"method"`
+	PathPrefix string `mapstructure:"path_prefix"`
+	Header     string `mapstructure:"header"`
+	Value      string `mapstructure:"value"` // Header value, empty matches any value
+	Tenant     string `mapstructure:"tenant"`
+	Plan       string `mapstructure:"plan"` // Plan of the resolved tenant
+}
+
+// AlertingConfig represents threshold rules on proxied traffic notifying
+// webhook and Slack channels
+type AlertingConfig struct {
+	Enabled            bool           `mapstructure:"enabled"`
+	EvaluationInterval time.Duration  `mapstructure:"evaluation_interval"` // Defaults to 30s
+	RepeatInterval     time.Duration  `mapstructure:"repeat_interval"`     // Notify again while firing, 0 only on change
+	Channels           []AlertChannel `mapstructure:"channels"`
+	Rules              []AlertRule    `mapstructure:"rules"`
+}
+
+// AlertChannel represents a destination of alert notifications
+type AlertChannel struct {
+	Name          string `mapstructure:"name"`
+	Type          string `mapstructure:"type"` // webhook (JSON alert) or slack (incoming webhook)
+	WebhookConfig `mapstructure:",squash"`
+}
+
+// AlertRule represents a condition on the traffic of a path prefix
+type AlertRule struct {
+	Name        string        `mapstructure:"name"`
+	Type        string        `mapstructure:"type"` // error_rate, latency, upstream_unhealthy or rate_limited
+	Severity    string        `mapstructure:"severity"`
+	PathPrefix  string        `mapstructure:"path_prefix"`
+	Window      time.Duration `mapstructure:"window"`       // Defaults to 5m
+	Threshold   float64       `mapstructure:"threshold"`    // Error or failure share, or rejected requests for rate_limited
+	Latency     time.Duration `mapstructure:"latency"`      // latency: fires when the percentile exceeds it
+	Percentile  float64       `mapstructure:"percentile"`   // latency: defaults to 0.99
+	MinRequests int64         `mapstructure:"min_requests"` // Traffic needed before ratios are evaluated
+	Channels    []string      `mapstructure:"channels"`     // Empty notifies every channel
+}
+
+// AnomalyConfig represents the rolling per-route baselines of request rate
+// and error rate that flag sudden deviations
+type AnomalyConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Interval    time.Duration `mapstructure:"interval"`     // Length of one observation, defaults to 1m
+	Alpha       float64       `mapstructure:"alpha"`        // Baseline smoothing factor (0-1), defaults to 0.1
+	Threshold   float64       `mapstructure:"threshold"`    // Standard deviations from the baseline, defaults to 3
+	WarmUp      int           `mapstructure:"warm_up"`      // Observations before a route is judged, defaults to 10
+	MinRequests int64         `mapstructure:"min_requests"` // Requests per observation needed to judge, defaults to 20
+	Depth       int           `mapstructure:"depth"`        // Path segments forming a route, defaults to 2
+	MaxRoutes   int           `mapstructure:"max_routes"`   // Routes tracked, defaults to 500
+}
+
+// StatsConfig represents the in-memory per-path aggregates behind the
+// top endpoints statistics
+type StatsConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Retention time.Duration `mapstructure:"retention"` // Longest selectable window, defaults to 1h
+	MaxPaths  int           `mapstructure:"max_paths"` // Paths tracked per minute, defaults to 1000
+}
+
+// PipelineConfig represents the order of the stages run before the proxy:
+// correlation, alerts, anomalies, stats, tenant, ratelimit and qos
+type PipelineConfig struct {
+	Stages  []string `mapstructure:"stages"`  // Stage order, empty keeps the default order
+	Disable []string `mapstructure:"disable"` // Stages skipped for every route
+}
+
+// FlagsConfig represents the feature flags evaluated per request against the
+// method, path, ip, header.<name> and tenant attributes
+type FlagsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Attribute fractional rollouts hash on, the tenant or else the client IP
+	// when empty
+	TargetingKey string `mapstructure:"targeting_key"`
+	// Flag names are lower case, as are variant names
+	Flags map[string]FlagConfig `mapstructure:"flags"`
+}
+
+// FlagConfig represents a flag: targeting rules are tried in order, then the
+// rollout, then the default variant
+type FlagConfig struct {
+	Disabled       bool                   `mapstructure:"disabled"` // Disabled flags evaluate to the caller default
+	Variants       map[string]interface{} `mapstructure:"variants"` // Variant name to value, bool, string or number
+	DefaultVariant string                 `mapstructure:"default_variant"`
+	Targeting      []FlagRule             `mapstructure:"targeting"`
+	Rollout        []FlagSplit            `mapstructure:"rollout"` // Weighted split on the targeting key
+}
+
+// FlagRule selects a variant when an attribute has one of the listed values
+type FlagRule struct {
+	Attribute string   `mapstructure:"attribute"` // e.g. tenant or header.x-beta
+	In        []string `mapstructure:"in"`
+	Variant   string   `mapstructure:"variant"`
+}
+
+// FlagSplit is the share of a variant in a rollout
+type FlagSplit struct {
+	Variant string `mapstructure:"variant"`
+	Weight  int    `mapstructure:"weight"`
+}
+
+// CorrelationConfig represents how the ID correlating the logs of a request
+// is read, generated and emitted
+type CorrelationConfig struct {
+	RequestHeader  string `mapstructure:"request_header"`  // Read from the client and forwarded upstream, defaults to X-Request-ID
+	ResponseHeader string `mapstructure:"response_header"` // Echoed to the client, defaults to request_header
+	Format         string `mapstructure:"format"`          // uuid4, uuid7, ulid or snowflake, defaults to uuid4
+	TrustIncoming  bool   `mapstructure:"trust_incoming"`  // Reuse the client ID instead of generating one
+	NodeID         int    `mapstructure:"node_id"`         // Snowflake node, 0-1023, unique per instance
+}
+
+// SentryConfig represents the reporting of gateway failures to Sentry
+type SentryConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	DSN         string        `mapstructure:"dsn"`
+	Environment string        `mapstructure:"environment"`
+	Release     string        `mapstructure:"release"`
+	SampleRate  float64       `mapstructure:"sample_rate"` // Share of failures reported (0-1), 0 reports all
+	Timeout     time.Duration `mapstructure:"timeout"`     // Defaults to 5s
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -157,3 +1137,77 @@ func LoadConfig(configPath string) (*Config, error) {
 
 	return &config, nil
 }
+
+// TenancyConfig represents the shared gateway setup where every tenant gets
+// its own upstream, limits, transforms and logging policy
+type TenancyConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Header  string `mapstructure:"header"`  // Header carrying the tenant ID, defaults to X-Tenant-ID
+	Default string `mapstructure:"default"` // Tenant used when none is identified, empty rejects the request
+	// Strategies tried in order, the first one naming a known tenant wins.
+	// Defaults to the header strategy.
+	Identify []TenantIdentifier      `mapstructure:"identify"`
+	Tenants  map[string]TenantConfig `mapstructure:"tenants"`
+	Plans    map[string]PlanConfig   `mapstructure:"plans"` // Named bundles assigned with a tenant's plan field
+	Usage    UsageConfig             `mapstructure:"usage"`
+	// Require a tenant filter on every log query, so one tenant's traffic is
+	// never returned alongside another's
+	LogIsolation bool `mapstructure:"log_isolation"`
+	// How often tenants and limit overrides created through the admin API are
+	// reloaded from the repository, defaults to 30s
+	LimitRefresh time.Duration `mapstructure:"limit_refresh"`
+}
+
+// UsageConfig represents the hourly per-tenant usage metering used for billing
+type UsageConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // Defaults to 1m
+}
+
+// TenantIdentifier represents one way of identifying the tenant of a request
+type TenantIdentifier struct {
+	Type   string `mapstructure:"type"`   // header, subdomain, host, path_prefix, jwt_claim or api_key
+	Header string `mapstructure:"header"` // header, api_key: header to read
+	Domain string `mapstructure:"domain"` // subdomain: base domain, e.g. api.example.com
+	Strip  bool   `mapstructure:"strip"`  // path_prefix: remove the tenant segment before proxying
+	Claim  string `mapstructure:"claim"`  // jwt_claim: claim holding the tenant ID
+	Secret string `mapstructure:"secret"` // jwt_claim: HS256 secret, empty skips signature verification
+}
+
+// TenantConfig represents the settings of a single tenant. Empty fields fall
+// back to the global configuration.
+type TenantConfig struct {
+	Target      string            `mapstructure:"target"`
+	Plan        string            `mapstructure:"plan"` // Fills the limits below that are left empty
+	RateLimit   TenantRateLimit   `mapstructure:"rate_limit"`
+	MaxBodySize int               `mapstructure:"max_body_size"` // Largest accepted request body in bytes, 0 is unlimited
+	CacheTTL    time.Duration     `mapstructure:"cache_ttl"`     // Max-age announced on cacheable responses, 0 keeps the default
+	Transform   TransformConfig   `mapstructure:"transform"`
+	Log         TenantLogConfig   `mapstructure:"log"`
+	Metadata    map[string]string `mapstructure:"metadata"` // Free form labels, e.g. owning team
+	APIKeys     []string          `mapstructure:"api_keys"` // Keys identifying the tenant with the api_key strategy
+	Hosts       []string          `mapstructure:"hosts"`    // Host names identifying the tenant with the host strategy
+}
+
+// PlanConfig represents a named tier bundling the limits and features shared
+// by many similar tenants
+type PlanConfig struct {
+	RateLimit   TenantRateLimit `mapstructure:"rate_limit"`
+	MaxBodySize int             `mapstructure:"max_body_size"`
+	CacheTTL    time.Duration   `mapstructure:"cache_ttl"`
+}
+
+// TenantRateLimit represents the request budget shared by all clients of a tenant
+type TenantRateLimit struct {
+	Requests   int           `mapstructure:"requests"`
+	Window     time.Duration `mapstructure:"window"`
+	Burst      int           `mapstructure:"burst"`
+	DailyQuota int           `mapstructure:"daily_quota"` // Requests per 24 hours, 0 disables the quota
+}
+
+// TenantLogConfig represents which traffic of a tenant is persisted
+type TenantLogConfig struct {
+	Disabled      bool    `mapstructure:"disabled"`
+	SampleRate    float64 `mapstructure:"sample_rate"`    // Share of exchanges logged (0-1), 0 logs all
+	ExcludeBodies bool    `mapstructure:"exclude_bodies"` // Drop request and response bodies from logs
+}
@@ -0,0 +1,43 @@
+package credentials
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type credentialStatus struct {
+	Name        string    `json:"name"`
+	Fingerprint string    `json:"fingerprint"`
+	LoadedAt    time.Time `json:"loaded_at"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// RegisterAdminRoutes mounts the upstream credential endpoints
+func (m *Manager) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/credentials", m.handleStatus)
+	r.Post("/credentials/reload", m.handleReload)
+}
+
+func (m *Manager) handleStatus(c *fiber.Ctx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := make([]credentialStatus, 0, len(m.watched))
+	for _, w := range m.watched {
+		status = append(status, credentialStatus{
+			Name:        w.name,
+			Fingerprint: w.fingerprint,
+			LoadedAt:    w.rotatedAt,
+			LastError:   w.lastError,
+		})
+	}
+	return c.JSON(status)
+}
+
+// handleReload checks for rotations right away, e.g. from a secret manager
+// hook, instead of waiting for the next refresh
+func (m *Manager) handleReload(c *fiber.Ctx) error {
+	m.Reload()
+	return m.handleStatus(c)
+}
@@ -0,0 +1,263 @@
+package credentials
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
+	"github.com/tuncerburak97/muhtar/internal/service"
+)
+
+// Rotation results
+const (
+	ResultRotated = "rotated"
+	ResultFailed  = "failed"
+)
+
+// credential is a secret read from one or more files. load parses the file
+// contents and swaps the credential in use, keeping it when they are invalid.
+type credential interface {
+	files() []string
+	load(contents [][]byte) error
+}
+
+// watched tracks the files of a credential
+type watched struct {
+	name   string
+	cred   credential
+	digest string // Of the file contents last loaded or rejected
+
+	fingerprint string
+	rotatedAt   time.Time
+	lastError   string
+}
+
+// Manager holds the credentials presented to the upstream and swaps them
+// when their files change. Requests in flight keep the credentials they
+// started with.
+type Manager struct {
+	interval time.Duration
+	logSvc   *service.LoggerService
+	metrics  *metrics.MetricsCollector
+
+	hmac   *hmacSigner
+	oauth2 *tokenSource
+	tls    *clientTLS
+
+	mu      sync.Mutex
+	watched []*watched
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Option configures optional Manager behavior
+type Option func(*Manager)
+
+// WithAudit writes rotation events to the log repository as audit logs
+func WithAudit(logSvc *service.LoggerService) Option {
+	return func(m *Manager) {
+		m.logSvc = logSvc
+	}
+}
+
+// WithMetrics counts rotations per credential and result
+func WithMetrics(mc *metrics.MetricsCollector) Option {
+	return func(m *Manager) {
+		m.metrics = mc
+	}
+}
+
+// NewManager loads the configured credentials and starts watching their
+// files. Credentials that cannot be loaded at startup are an error.
+func NewManager(cfg *config.UpstreamAuthConfig, opts ...Option) (*Manager, error) {
+	interval := cfg.Refresh
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	m := &Manager{
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if cfg.HMAC.KeyFile != "" {
+		m.hmac = &hmacSigner{keyFile: cfg.HMAC.KeyFile}
+		m.watched = append(m.watched, &watched{name: "hmac", cred: m.hmac})
+	}
+	if cfg.OAuth2.TokenURL != "" {
+		m.oauth2 = newTokenSource(cfg.OAuth2)
+		m.watched = append(m.watched, &watched{name: "oauth2", cred: m.oauth2})
+	}
+	if cfg.TLS.CertFile != "" {
+		m.tls = &clientTLS{config: cfg.TLS}
+		m.watched = append(m.watched, &watched{name: "tls", cred: m.tls})
+	}
+
+	for _, w := range m.watched {
+		if _, err := m.check(w); err != nil {
+			return nil, fmt.Errorf("failed to load %s upstream credentials: %v", w.name, err)
+		}
+	}
+
+	m.wg.Add(1)
+	go m.run()
+	return m, nil
+}
+
+func (m *Manager) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.Reload()
+		}
+	}
+}
+
+// Reload checks every credential for a rotation
+func (m *Manager) Reload() {
+	for _, w := range m.watched {
+		rotated, err := m.check(w)
+		switch {
+		case err != nil:
+			log.Error().Err(err).Str("credential", w.name).Msg("Rejected rotated upstream credentials, keeping the current ones")
+			sentry.CaptureError(err, map[string]string{"component": "credentials", "credential": w.name})
+			m.audit(w, ResultFailed, err)
+		case rotated:
+			log.Info().Str("credential", w.name).Str("fingerprint", w.fingerprint).Msg("Rotated upstream credentials")
+			m.audit(w, ResultRotated, nil)
+		}
+	}
+}
+
+// check loads the files of a credential when their contents changed since
+// the last check. Contents rejected once are not retried until they change
+// again, a secret manager writing several files is seen mid-rotation at worst
+// once.
+func (m *Manager) check(w *watched) (bool, error) {
+	paths := w.cred.files()
+	contents := make([][]byte, len(paths))
+	h := sha256.New()
+	for i, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		contents[i] = b
+		h.Write(b)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if digest == w.digest {
+		return false, nil
+	}
+	w.digest = digest
+	if err := w.cred.load(contents); err != nil {
+		w.lastError = err.Error()
+		return false, err
+	}
+	initial := w.fingerprint == ""
+	w.fingerprint = digest[:16]
+	w.rotatedAt = time.Now()
+	w.lastError = ""
+	return !initial, nil
+}
+
+// audit records a rotation event in the log repository
+func (m *Manager) audit(w *watched, result string, err error) {
+	if m.metrics != nil {
+		m.metrics.IncCredentialRotation(w.name, result)
+	}
+	if m.logSvc == nil {
+		return
+	}
+
+	entry := &model.Log{
+		ID:          uuid.New().String(),
+		ProcessType: model.ProcessTypeAudit,
+		Timestamp:   time.Now(),
+		Metadata: map[string]interface{}{
+			"event":       "upstream_credential_rotation",
+			"credential":  w.name,
+			"result":      result,
+			"fingerprint": w.fingerprint,
+		},
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := m.logSvc.LogRequest(entry); err != nil {
+		log.Error().Err(err).Msg("Failed to write credential rotation audit log")
+	}
+}
+
+// RoundTripper returns next authenticating every request with the current
+// HMAC signature and OAuth2 bearer token
+func (m *Manager) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if m.hmac == nil && m.oauth2 == nil {
+		return next
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// RoundTrippers must not modify the caller's request
+		req = req.Clone(req.Context())
+		if m.oauth2 != nil {
+			token, err := m.oauth2.token(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("failed to obtain upstream access token: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if m.hmac != nil {
+			if err := m.hmac.sign(req); err != nil {
+				return nil, fmt.Errorf("failed to sign upstream request: %v", err)
+			}
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// ConfigureTransport presents the current client certificate on the new
+// connections of t. Idle connections are closed on rotation, so the next
+// requests handshake with the new certificate while requests in flight
+// complete on their connection.
+func (m *Manager) ConfigureTransport(t *http.Transport) {
+	if m.tls == nil {
+		return
+	}
+	t.TLSClientConfig = m.tls.clientConfig()
+	m.tls.onRotate(t.CloseIdleConnections)
+}
+
+// Close stops watching the credential files
+func (m *Manager) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,114 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// tokenExpiryMargin renews tokens before the upstream would reject them
+const tokenExpiryMargin = 30 * time.Second
+
+type clientCredentials struct {
+	id, secret string
+}
+
+// tokenSource fetches access tokens with the client credentials grant. The
+// token is cached until it expires or the credentials rotate.
+type tokenSource struct {
+	config config.UpstreamOAuth2Config
+	client *http.Client
+
+	mu          sync.Mutex
+	credentials clientCredentials
+	accessToken string
+	expiry      time.Time
+}
+
+func newTokenSource(cfg config.UpstreamOAuth2Config) *tokenSource {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &tokenSource{
+		config: cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *tokenSource) files() []string {
+	return []string{s.config.ClientIDFile, s.config.ClientSecretFile}
+}
+
+func (s *tokenSource) load(contents [][]byte) error {
+	id := strings.TrimSpace(string(contents[0]))
+	secret := strings.TrimSpace(string(contents[1]))
+	if id == "" || secret == "" {
+		return fmt.Errorf("empty client id or secret")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials = clientCredentials{id: id, secret: secret}
+	// The token of the old credentials may be revoked along with them
+	s.accessToken = ""
+	return nil
+}
+
+// token returns the cached access token, fetching a new one when needed.
+// Concurrent requests wait for a single fetch.
+func (s *tokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiry) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.credentials.id), url.QueryEscape(s.credentials.secret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("token response without access_token")
+	}
+
+	s.accessToken = body.AccessToken
+	s.expiry = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - tokenExpiryMargin)
+	if body.ExpiresIn == 0 {
+		// No expiry given, renew on the next rotation or after an hour
+		s.expiry = time.Now().Add(time.Hour)
+	}
+	return s.accessToken, nil
+}
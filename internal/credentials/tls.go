@@ -0,0 +1,99 @@
+package credentials
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+type tlsMaterial struct {
+	cert *tls.Certificate
+	pool *x509.CertPool // nil trusts the system roots
+}
+
+// clientTLS holds the client certificate and trusted CAs of upstream mTLS
+type clientTLS struct {
+	config  config.UpstreamTLSConfig
+	current atomic.Pointer[tlsMaterial]
+
+	mu        sync.Mutex
+	callbacks []func()
+}
+
+func (t *clientTLS) files() []string {
+	files := []string{t.config.CertFile, t.config.KeyFile}
+	if t.config.CAFile != "" {
+		files = append(files, t.config.CAFile)
+	}
+	return files
+}
+
+func (t *clientTLS) load(contents [][]byte) error {
+	cert, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return fmt.Errorf("invalid client certificate: %v", err)
+	}
+	material := &tlsMaterial{cert: &cert}
+	if len(contents) > 2 {
+		material.pool = x509.NewCertPool()
+		if !material.pool.AppendCertsFromPEM(contents[2]) {
+			return fmt.Errorf("no CA certificate found in %s", t.config.CAFile)
+		}
+	}
+
+	rotated := t.current.Swap(material) != nil
+	if rotated {
+		t.mu.Lock()
+		callbacks := t.callbacks
+		t.mu.Unlock()
+		for _, fn := range callbacks {
+			fn()
+		}
+	}
+	return nil
+}
+
+// onRotate registers fn to be called after each rotation
+func (t *clientTLS) onRotate(fn func()) {
+	t.mu.Lock()
+	t.callbacks = append(t.callbacks, fn)
+	t.mu.Unlock()
+}
+
+// clientConfig returns a TLS configuration reading the current material on
+// every handshake
+func (t *clientTLS) clientConfig() *tls.Config {
+	cfg := &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return t.current.Load().cert, nil
+		},
+	}
+	if t.config.CAFile == "" {
+		return cfg
+	}
+
+	// RootCAs cannot change once set, the chain is verified against the
+	// current pool instead of by the default verification. Upstreams
+	// addressed by IP have no server name, only their chain is verified.
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("upstream presented no certificate")
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         t.current.Load().pool,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return cfg
+}
@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// consulResolver reads the instances of a service passing their Consul
+// health checks from the agent
+type consulResolver struct {
+	config config.DiscoveryConfig
+	health string
+	client *http.Client
+}
+
+// serviceEntry is the part of a Consul health API entry read
+type serviceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// newConsul defaults to the local agent
+func newConsul(cfg config.DiscoveryConfig) *consulResolver {
+	address := cfg.Address
+	if address == "" {
+		address = "http://127.0.0.1:8500"
+	}
+	query := url.Values{"passing": {"true"}}
+	if cfg.Tag != "" {
+		query.Set("tag", cfg.Tag)
+	}
+	if cfg.Datacenter != "" {
+		query.Set("dc", cfg.Datacenter)
+	}
+	return &consulResolver{
+		config: cfg,
+		health: strings.TrimSuffix(address, "/") + "/v1/health/service/" + url.PathEscape(cfg.Name) + "?" + query.Encode(),
+		client: &http.Client{},
+	}
+}
+
+func (c *consulResolver) Resolve(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.health, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul answered %d for service %s", resp.StatusCode, c.config.Name)
+	}
+	var entries []serviceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid consul services: %v", err)
+	}
+
+	targets := make([]string, 0, len(entries))
+	for _, e := range entries {
+		// Services registered without an address use the one of their node
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		port := e.Service.Port
+		if c.config.Port != 0 {
+			port = c.config.Port
+		}
+		targets = append(targets, c.config.Scheme+"://"+net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	return targets, nil
+}
@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Discovery types
+const (
+	TypeDNS        = "dns"
+	TypeSRV        = "srv"
+	TypeKubernetes = "kubernetes"
+	TypeConsul     = "consul"
+)
+
+// Resolver returns the current targets of a service as base URLs
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// New creates the resolver of cfg
+func New(cfg config.DiscoveryConfig) (Resolver, error) {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.Scheme != "http" && cfg.Scheme != "https" {
+		return nil, fmt.Errorf("invalid discovery scheme %s", cfg.Scheme)
+	}
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("%s discovery needs a name", cfg.Type)
+	}
+	switch cfg.Type {
+	case TypeDNS, TypeSRV:
+		return &dnsResolver{config: cfg, resolver: net.DefaultResolver}, nil
+	case TypeKubernetes:
+		return newKubernetes(cfg)
+	case TypeConsul:
+		return newConsul(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown discovery type %s", cfg.Type)
+}
+
+// dnsResolver resolves the addresses of a host name, or the hosts and ports
+// of SRV records
+type dnsResolver struct {
+	config   config.DiscoveryConfig
+	resolver *net.Resolver
+}
+
+func (d *dnsResolver) Resolve(ctx context.Context) ([]string, error) {
+	var targets []string
+	if d.config.Type == TypeSRV {
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", d.config.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			targets = append(targets, d.config.Scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+		}
+	} else {
+		addrs, err := d.resolver.LookupHost(ctx, d.config.Name)
+		if err != nil {
+			return nil, err
+		}
+		port := d.config.Port
+		if port == 0 {
+			port = 80
+			if d.config.Scheme == "https" {
+				port = 443
+			}
+		}
+		for _, addr := range addrs {
+			targets = append(targets, d.config.Scheme+"://"+net.JoinHostPort(addr, strconv.Itoa(port)))
+		}
+	}
+	return targets, nil
+}
+
+// Watcher refreshes the targets of a route on an interval
+type Watcher struct {
+	route    string
+	resolver Resolver
+	interval time.Duration
+	update   func([]string)
+	last     []string
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Watch resolves the targets once, then every interval, passing each set
+// that changed to update. A failed resolution keeps the last targets.
+func Watch(route string, r Resolver, interval time.Duration, update func([]string)) *Watcher {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	w := &Watcher{route: route, resolver: r, interval: interval, update: update, done: make(chan struct{})}
+	w.refresh()
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.refresh()
+		}
+	}
+}
+
+func (w *Watcher) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+	defer cancel()
+	targets, err := w.resolver.Resolve(ctx)
+	if err != nil {
+		log.Warn().Err(err).Str("route", w.route).Msg("Failed to discover upstream targets, keeping the last ones")
+		return
+	}
+	if len(targets) == 0 {
+		log.Warn().Str("route", w.route).Msg("No upstream target discovered, keeping the last ones")
+		return
+	}
+	// Sources list targets in any order
+	slices.Sort(targets)
+	targets = slices.Compact(targets)
+	if slices.Equal(targets, w.last) {
+		return
+	}
+	w.last = targets
+	log.Info().Str("route", w.route).Strs("targets", targets).Msg("Upstream targets discovered")
+	w.update(targets)
+}
+
+// Close stops the refreshes
+func (w *Watcher) Close() {
+	close(w.done)
+	w.wg.Wait()
+}
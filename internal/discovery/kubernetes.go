@@ -0,0 +1,144 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Files of the service account mounted in pods
+const (
+	serviceAccountDir   = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	serviceAccountToken = serviceAccountDir + "token"
+	serviceAccountCA    = serviceAccountDir + "ca.crt"
+	serviceAccountNS    = serviceAccountDir + "namespace"
+)
+
+// kubernetesResolver reads the ready addresses of the Endpoints of a
+// service from the API server
+type kubernetesResolver struct {
+	config    config.DiscoveryConfig
+	endpoints string
+	tokenFile string
+	client    *http.Client
+}
+
+// endpoints is the part of a Kubernetes Endpoints object read
+type endpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+// newKubernetes defaults to the API server and service account of the pod
+// the proxy runs in
+func newKubernetes(cfg config.DiscoveryConfig) (*kubernetesResolver, error) {
+	k := &kubernetesResolver{config: cfg}
+	address := cfg.Address
+	if address == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("kubernetes discovery needs an address outside a cluster")
+		}
+		address = "https://" + net.JoinHostPort(host, port)
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = "default"
+		if b, err := os.ReadFile(serviceAccountNS); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+	k.endpoints = strings.TrimSuffix(address, "/") + "/api/v1/namespaces/" + url.PathEscape(namespace) + "/endpoints/" + url.PathEscape(cfg.Name)
+	if cfg.Token == "" {
+		k.tokenFile = serviceAccountToken
+	}
+
+	caFile := cfg.CAFile
+	if caFile == "" && cfg.Address == "" {
+		caFile = serviceAccountCA
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kubernetes CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in kubernetes CA %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	k.client = &http.Client{Transport: transport}
+	return k, nil
+}
+
+func (k *kubernetesResolver) Resolve(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.endpoints, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The token is read on every call, the kubelet rotates it
+	token := k.config.Token
+	if k.tokenFile != "" {
+		b, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %v", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes API answered %d for endpoints %s", resp.StatusCode, k.config.Name)
+	}
+	var ep endpoints
+	if err := json.NewDecoder(resp.Body).Decode(&ep); err != nil {
+		return nil, fmt.Errorf("invalid endpoints: %v", err)
+	}
+
+	var targets []string
+	for _, subset := range ep.Subsets {
+		port := 0
+		for _, p := range subset.Ports {
+			if k.config.PortName == "" || p.Name == k.config.PortName {
+				port = p.Port
+				break
+			}
+		}
+		if k.config.Port != 0 {
+			port = k.config.Port
+		}
+		if port == 0 {
+			continue
+		}
+		// Only ready addresses, those not ready are listed apart
+		for _, a := range subset.Addresses {
+			targets = append(targets, k.config.Scheme+"://"+net.JoinHostPort(a.IP, strconv.Itoa(port)))
+		}
+	}
+	return targets, nil
+}
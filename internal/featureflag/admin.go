@@ -0,0 +1,86 @@
+package featureflag
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+type flagStatus struct {
+	Enabled        bool                   `json:"enabled"`
+	Variants       map[string]interface{} `json:"variants"`
+	DefaultVariant string                 `json:"default_variant"`
+	Targeting      []config.FlagRule      `json:"targeting"`
+	Rollout        []config.FlagSplit     `json:"rollout"`
+}
+
+type defaultRequest struct {
+	Variant string `json:"variant"`
+}
+
+type rolloutRequest struct {
+	Rollout []config.FlagSplit `json:"rollout"`
+}
+
+// RegisterAdminRoutes mounts the feature flag endpoints
+func (p *MemoryProvider) RegisterAdminRoutes(r fiber.Router) {
+	g := r.Group("/flags")
+	g.Get("/", p.handleList)
+	g.Post("/:name/enable", p.handleToggle(false))
+	g.Post("/:name/disable", p.handleToggle(true))
+	g.Put("/:name/default", p.handleDefault)
+	g.Put("/:name/rollout", p.handleRollout)
+}
+
+func (p *MemoryProvider) handleList(c *fiber.Ctx) error {
+	flags := p.Flags()
+	status := make(map[string]flagStatus, len(flags))
+	for name, f := range flags {
+		status[name] = flagStatus{
+			Enabled:        !f.Disabled,
+			Variants:       f.Variants,
+			DefaultVariant: f.DefaultVariant,
+			Targeting:      f.Targeting,
+			Rollout:        f.Rollout,
+		}
+	}
+	return c.JSON(status)
+}
+
+func (p *MemoryProvider) handleToggle(disabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := p.SetDisabled(c.Params("name"), disabled); err != nil {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (p *MemoryProvider) handleDefault(c *fiber.Ctx) error {
+	var req defaultRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err := p.SetDefaultVariant(c.Params("name"), req.Variant); err != nil {
+		return fiber.NewError(updateStatus(p, c.Params("name")), err.Error())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (p *MemoryProvider) handleRollout(c *fiber.Ctx) error {
+	var req rolloutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err := p.SetRollout(c.Params("name"), req.Rollout); err != nil {
+		return fiber.NewError(updateStatus(p, c.Params("name")), err.Error())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// updateStatus tells an unknown flag from an invalid update
+func updateStatus(p *MemoryProvider, name string) int {
+	if _, ok := p.Flags()[name]; !ok {
+		return fiber.StatusNotFound
+	}
+	return fiber.StatusBadRequest
+}
@@ -0,0 +1,214 @@
+package featureflag
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+const evaluatorKey = "feature_flags"
+
+// AttributeFunc adds attributes of a request to its evaluation context, e.g.
+// the tenant resolved by the tenant stage
+type AttributeFunc func(c *fiber.Ctx) map[string]interface{}
+
+// Client evaluates flags against the attributes of proxied requests
+type Client struct {
+	provider     Provider
+	targetingKey string
+	attributes   []AttributeFunc
+	metrics      *metrics.MetricsCollector
+}
+
+// Option configures optional Client behavior
+type Option func(*Client)
+
+// WithAttributes adds request attributes to every evaluation context
+func WithAttributes(fn AttributeFunc) Option {
+	return func(cl *Client) {
+		cl.attributes = append(cl.attributes, fn)
+	}
+}
+
+// WithMetrics counts evaluations per flag, variant and reason
+func WithMetrics(m *metrics.MetricsCollector) Option {
+	return func(cl *Client) {
+		cl.metrics = m
+	}
+}
+
+// NewClient creates a client resolving flags through provider
+func NewClient(provider Provider, cfg *config.FlagsConfig, opts ...Option) *Client {
+	cl := &Client{
+		provider:     provider,
+		targetingKey: cfg.TargetingKey,
+	}
+	for _, opt := range opts {
+		opt(cl)
+	}
+	return cl
+}
+
+// Evaluator evaluates flags for one request. A flag is resolved once per
+// request, the route, routing script and transforms all see the same value.
+// A nil Evaluator returns the defaults.
+type Evaluator struct {
+	client *Client
+	c      *fiber.Ctx
+
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// ForRequest returns the evaluator of a request, nil when the client is nil
+func (cl *Client) ForRequest(c *fiber.Ctx) *Evaluator {
+	if cl == nil {
+		return nil
+	}
+	if e, ok := c.Locals(evaluatorKey).(*Evaluator); ok {
+		return e
+	}
+	e := &Evaluator{client: cl, c: c, values: make(map[string]interface{})}
+	c.Locals(evaluatorKey, e)
+	return e
+}
+
+// evaluationContext is built when a flag is first evaluated, attributes
+// added by later stages only apply to flags evaluated after them
+func (e *Evaluator) evaluationContext() FlattenedContext {
+	c := e.c
+	evalCtx := FlattenedContext{
+		"method": c.Method(),
+		"path":   c.Path(),
+		"ip":     c.IP(),
+	}
+	for k, v := range c.GetReqHeaders() {
+		if len(v) > 0 {
+			evalCtx["header."+strings.ToLower(k)] = v[0]
+		}
+	}
+	for _, fn := range e.client.attributes {
+		for k, v := range fn(c) {
+			evalCtx[k] = v
+		}
+	}
+
+	key := e.client.targetingKey
+	if key == "" {
+		key = "ip"
+		if tenant, _ := evalCtx["tenant"].(string); tenant != "" {
+			key = "tenant"
+		}
+	}
+	if v, ok := evalCtx[key].(string); ok {
+		evalCtx[TargetingKey] = v
+	}
+	return evalCtx
+}
+
+// evaluate returns the cached value of a flag, resolving it on first use
+func (e *Evaluator) evaluate(flag string, resolve func(ctx context.Context, evalCtx FlattenedContext) (interface{}, ProviderResolutionDetail)) interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if v, ok := e.values[flag]; ok {
+		return v
+	}
+	ctx := e.c.UserContext()
+	v, detail := resolve(ctx, e.evaluationContext())
+	if detail.ErrorCode != "" {
+		zerolog.Ctx(ctx).Warn().
+			Str("flag", flag).
+			Str("error_code", string(detail.ErrorCode)).
+			Msg(detail.ErrorMessage)
+	}
+	if e.client.metrics != nil {
+		e.client.metrics.IncFlagEvaluation(flag, detail.Variant, string(detail.Reason))
+	}
+	e.values[flag] = v
+	return v
+}
+
+// Boolean returns the value of a boolean flag, def when it does not resolve
+func (e *Evaluator) Boolean(flag string, def bool) bool {
+	if e == nil {
+		return def
+	}
+	v := e.evaluate(flag, func(ctx context.Context, evalCtx FlattenedContext) (interface{}, ProviderResolutionDetail) {
+		r := e.client.provider.BooleanEvaluation(ctx, flag, def, evalCtx)
+		return r.Value, r.ProviderResolutionDetail
+	})
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return def
+}
+
+// String returns the value of a string flag, def when it does not resolve
+func (e *Evaluator) String(flag string, def string) string {
+	if e == nil {
+		return def
+	}
+	v := e.evaluate(flag, func(ctx context.Context, evalCtx FlattenedContext) (interface{}, ProviderResolutionDetail) {
+		r := e.client.provider.StringEvaluation(ctx, flag, def, evalCtx)
+		return r.Value, r.ProviderResolutionDetail
+	})
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return def
+}
+
+// Float returns the value of a numeric flag, def when it does not resolve,
+// e.g. a canary percentage
+func (e *Evaluator) Float(flag string, def float64) float64 {
+	if e == nil {
+		return def
+	}
+	v := e.evaluate(flag, func(ctx context.Context, evalCtx FlattenedContext) (interface{}, ProviderResolutionDetail) {
+		r := e.client.provider.FloatEvaluation(ctx, flag, def, evalCtx)
+		return r.Value, r.ProviderResolutionDetail
+	})
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return def
+}
+
+// Value evaluates a flag of the type of def: a string, a number or else a
+// boolean. Scripts read flags through it.
+func (e *Evaluator) Value(flag string, def interface{}) interface{} {
+	switch d := def.(type) {
+	case string:
+		return e.String(flag, d)
+	case int64:
+		return e.Float(flag, float64(d))
+	case float64:
+		return e.Float(flag, d)
+	case bool:
+		return e.Boolean(flag, d)
+	}
+	return e.Boolean(flag, false)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the evaluator of a request, for the
+// transforms run with it
+func NewContext(ctx context.Context, e *Evaluator) context.Context {
+	if e == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, e)
+}
+
+// FromContext returns the evaluator carried by ctx, nil when there is none
+func FromContext(ctx context.Context) *Evaluator {
+	e, _ := ctx.Value(contextKey{}).(*Evaluator)
+	return e
+}
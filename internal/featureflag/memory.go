@@ -0,0 +1,276 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// MemoryProvider resolves the flags of the configuration. Their state,
+// default variant and rollout can be changed at runtime through the admin
+// API, without a configuration change.
+type MemoryProvider struct {
+	mu    sync.RWMutex
+	flags map[string]config.FlagConfig
+}
+
+// NewMemoryProvider validates the configured flags
+func NewMemoryProvider(flags map[string]config.FlagConfig) (*MemoryProvider, error) {
+	p := &MemoryProvider{flags: make(map[string]config.FlagConfig, len(flags))}
+	for name, f := range flags {
+		if err := validateFlag(f); err != nil {
+			return nil, fmt.Errorf("invalid feature flag %s: %v", name, err)
+		}
+		p.flags[name] = f
+	}
+	return p, nil
+}
+
+func validateFlag(f config.FlagConfig) error {
+	if len(f.Variants) == 0 {
+		return fmt.Errorf("no variants")
+	}
+	if f.DefaultVariant != "" {
+		if err := validVariant(f, f.DefaultVariant); err != nil {
+			return err
+		}
+	}
+	for _, rule := range f.Targeting {
+		if rule.Attribute == "" {
+			return fmt.Errorf("targeting rule without attribute")
+		}
+		if err := validVariant(f, rule.Variant); err != nil {
+			return err
+		}
+	}
+	return validRollout(f, f.Rollout)
+}
+
+func validVariant(f config.FlagConfig, variant string) error {
+	if _, ok := f.Variants[variant]; !ok {
+		return fmt.Errorf("unknown variant %q", variant)
+	}
+	return nil
+}
+
+func validRollout(f config.FlagConfig, rollout []config.FlagSplit) error {
+	for _, split := range rollout {
+		if err := validVariant(f, split.Variant); err != nil {
+			return err
+		}
+		if split.Weight < 0 {
+			return fmt.Errorf("negative weight for variant %s", split.Variant)
+		}
+	}
+	return nil
+}
+
+// Metadata describes the provider
+func (p *MemoryProvider) Metadata() Metadata {
+	return Metadata{Name: "memory"}
+}
+
+// resolve returns the variant selected for evalCtx and its value, a nil
+// value when the caller default applies
+func (p *MemoryProvider) resolve(name string, evalCtx FlattenedContext) (interface{}, ProviderResolutionDetail) {
+	p.mu.RLock()
+	f, ok := p.flags[name]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, ProviderResolutionDetail{
+			Reason:       ReasonError,
+			ErrorCode:    ErrorFlagNotFound,
+			ErrorMessage: fmt.Sprintf("flag %s not found", name),
+		}
+	}
+	if f.Disabled {
+		return nil, ProviderResolutionDetail{Reason: ReasonDisabled}
+	}
+
+	for _, rule := range f.Targeting {
+		v, ok := evalCtx[rule.Attribute]
+		if !ok {
+			continue
+		}
+		value := fmt.Sprint(v)
+		for _, candidate := range rule.In {
+			if candidate == value {
+				return f.Variants[rule.Variant], ProviderResolutionDetail{Variant: rule.Variant, Reason: ReasonTargetingMatch}
+			}
+		}
+	}
+
+	if key, _ := evalCtx[TargetingKey].(string); key != "" {
+		if variant := split(name, key, f.Rollout); variant != "" {
+			return f.Variants[variant], ProviderResolutionDetail{Variant: variant, Reason: ReasonSplit}
+		}
+	}
+
+	if f.DefaultVariant == "" {
+		return nil, ProviderResolutionDetail{Reason: ReasonDefault}
+	}
+	return f.Variants[f.DefaultVariant], ProviderResolutionDetail{Variant: f.DefaultVariant, Reason: ReasonStatic}
+}
+
+// split picks the rollout variant of a targeting key. The bucket depends on
+// the flag too, so subjects do not land in the same share of every rollout.
+func split(flag, key string, rollout []config.FlagSplit) string {
+	total := 0
+	for _, s := range rollout {
+		total += s.Weight
+	}
+	if total == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(flag + "/" + key))
+	bucket := int(h.Sum32() % uint32(total))
+	for _, s := range rollout {
+		if bucket < s.Weight {
+			return s.Variant
+		}
+		bucket -= s.Weight
+	}
+	return ""
+}
+
+func mismatch(flag string, detail ProviderResolutionDetail, want string) ProviderResolutionDetail {
+	return ProviderResolutionDetail{
+		Variant:      detail.Variant,
+		Reason:       ReasonError,
+		ErrorCode:    ErrorTypeMismatch,
+		ErrorMessage: fmt.Sprintf("variant %s of flag %s is not a %s", detail.Variant, flag, want),
+	}
+}
+
+// BooleanEvaluation resolves a boolean flag
+func (p *MemoryProvider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx FlattenedContext) BoolResolutionDetail {
+	v, detail := p.resolve(flag, evalCtx)
+	if v == nil {
+		return BoolResolutionDetail{Value: defaultValue, ProviderResolutionDetail: detail}
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return BoolResolutionDetail{Value: defaultValue, ProviderResolutionDetail: mismatch(flag, detail, "bool")}
+	}
+	return BoolResolutionDetail{Value: b, ProviderResolutionDetail: detail}
+}
+
+// StringEvaluation resolves a string flag
+func (p *MemoryProvider) StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx FlattenedContext) StringResolutionDetail {
+	v, detail := p.resolve(flag, evalCtx)
+	if v == nil {
+		return StringResolutionDetail{Value: defaultValue, ProviderResolutionDetail: detail}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return StringResolutionDetail{Value: defaultValue, ProviderResolutionDetail: mismatch(flag, detail, "string")}
+	}
+	return StringResolutionDetail{Value: s, ProviderResolutionDetail: detail}
+}
+
+// FloatEvaluation resolves a numeric flag
+func (p *MemoryProvider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx FlattenedContext) FloatResolutionDetail {
+	v, detail := p.resolve(flag, evalCtx)
+	if v == nil {
+		return FloatResolutionDetail{Value: defaultValue, ProviderResolutionDetail: detail}
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return FloatResolutionDetail{Value: defaultValue, ProviderResolutionDetail: mismatch(flag, detail, "number")}
+	}
+	return FloatResolutionDetail{Value: f, ProviderResolutionDetail: detail}
+}
+
+// IntEvaluation resolves an integer flag
+func (p *MemoryProvider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx FlattenedContext) IntResolutionDetail {
+	v, detail := p.resolve(flag, evalCtx)
+	if v == nil {
+		return IntResolutionDetail{Value: defaultValue, ProviderResolutionDetail: detail}
+	}
+	f, ok := toFloat(v)
+	if !ok || f != math.Trunc(f) {
+		return IntResolutionDetail{Value: defaultValue, ProviderResolutionDetail: mismatch(flag, detail, "integer")}
+	}
+	return IntResolutionDetail{Value: int64(f), ProviderResolutionDetail: detail}
+}
+
+// toFloat converts the numbers decoded from the configuration
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// Flags returns a snapshot of the flags
+func (p *MemoryProvider) Flags() map[string]config.FlagConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	flags := make(map[string]config.FlagConfig, len(p.flags))
+	for name, f := range p.flags {
+		flags[name] = f
+	}
+	return flags
+}
+
+// update applies fn to a copy of a flag and stores it when it stays valid.
+// Evaluations in flight keep the previous copy.
+func (p *MemoryProvider) update(name string, fn func(f *config.FlagConfig) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.flags[name]
+	if !ok {
+		return fmt.Errorf("flag %s not found", name)
+	}
+	if err := fn(&f); err != nil {
+		return err
+	}
+	p.flags[name] = f
+	return nil
+}
+
+// SetDisabled turns a flag off or back on
+func (p *MemoryProvider) SetDisabled(name string, disabled bool) error {
+	return p.update(name, func(f *config.FlagConfig) error {
+		f.Disabled = disabled
+		return nil
+	})
+}
+
+// SetDefaultVariant changes the variant served when no rule or rollout
+// applies
+func (p *MemoryProvider) SetDefaultVariant(name, variant string) error {
+	return p.update(name, func(f *config.FlagConfig) error {
+		if err := validVariant(*f, variant); err != nil {
+			return err
+		}
+		f.DefaultVariant = variant
+		return nil
+	})
+}
+
+// SetRollout replaces the weighted split of a flag, e.g. to widen a gradual
+// rollout
+func (p *MemoryProvider) SetRollout(name string, rollout []config.FlagSplit) error {
+	return p.update(name, func(f *config.FlagConfig) error {
+		if err := validRollout(*f, rollout); err != nil {
+			return err
+		}
+		f.Rollout = append([]config.FlagSplit(nil), rollout...)
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+package featureflag
+
+import "context"
+
+// The provider contract follows the OpenFeature specification: an OpenFeature
+// provider, e.g. flagd or LaunchDarkly, plugs in through a thin adapter
+// converting the resolution details.
+
+// TargetingKey is the evaluation context attribute identifying the subject of
+// an evaluation, fractional rollouts hash on it
+const TargetingKey = "targetingKey"
+
+// FlattenedContext holds the attributes a flag is evaluated against
+type FlattenedContext map[string]interface{}
+
+// Reason explains how a value was resolved
+type Reason string
+
+// Resolution reasons
+const (
+	ReasonStatic         Reason = "STATIC"
+	ReasonDefault        Reason = "DEFAULT"
+	ReasonTargetingMatch Reason = "TARGETING_MATCH"
+	ReasonSplit          Reason = "SPLIT"
+	ReasonDisabled       Reason = "DISABLED"
+	ReasonError          Reason = "ERROR"
+)
+
+// ErrorCode classifies a failed resolution
+type ErrorCode string
+
+// Resolution error codes
+const (
+	ErrorFlagNotFound ErrorCode = "FLAG_NOT_FOUND"
+	ErrorTypeMismatch ErrorCode = "TYPE_MISMATCH"
+	ErrorGeneral      ErrorCode = "GENERAL"
+)
+
+// ProviderResolutionDetail describes a resolution. A failed resolution
+// carries an error code and returns the default value.
+type ProviderResolutionDetail struct {
+	Variant      string
+	Reason       Reason
+	ErrorCode    ErrorCode
+	ErrorMessage string
+}
+
+// BoolResolutionDetail is the result of a boolean evaluation
+type BoolResolutionDetail struct {
+	Value bool
+	ProviderResolutionDetail
+}
+
+// StringResolutionDetail is the result of a string evaluation
+type StringResolutionDetail struct {
+	Value string
+	ProviderResolutionDetail
+}
+
+// FloatResolutionDetail is the result of a float evaluation
+type FloatResolutionDetail struct {
+	Value float64
+	ProviderResolutionDetail
+}
+
+// IntResolutionDetail is the result of an integer evaluation
+type IntResolutionDetail struct {
+	Value int64
+	ProviderResolutionDetail
+}
+
+// Metadata describes a provider
+type Metadata struct {
+	Name string
+}
+
+// Provider resolves flag values. Providers are called concurrently.
+type Provider interface {
+	Metadata() Metadata
+	BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx FlattenedContext) BoolResolutionDetail
+	StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx FlattenedContext) StringResolutionDetail
+	FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx FlattenedContext) FloatResolutionDetail
+	IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx FlattenedContext) IntResolutionDetail
+}
@@ -0,0 +1,122 @@
+package forwarded
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Forwarding headers
+const (
+	HeaderForwardedFor   = "X-Forwarded-For"
+	HeaderForwardedProto = "X-Forwarded-Proto"
+	HeaderForwardedHost  = "X-Forwarded-Host"
+	HeaderRealIP         = "X-Real-IP"
+)
+
+// Headers resolves the client behind trusted proxies and sets the
+// X-Forwarded-* headers of upstream requests
+type Headers struct {
+	trusted []*net.IPNet
+}
+
+// New creates the forwarded header handling of cfg
+func New(cfg config.ForwardedConfig) (*Headers, error) {
+	h := &Headers{}
+	for _, entry := range cfg.TrustedProxies {
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %v", entry, err)
+		}
+		h.trusted = append(h.trusted, network)
+	}
+	return h, nil
+}
+
+func (h *Headers) trusts(ip net.IP) bool {
+	for _, network := range h.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler resolves the client IP and stores it in X-Real-IP, replacing any
+// value sent by the client. The server reads c.IP() from that header, so
+// rate limits, access rules and logs all see the resolved client.
+func (h *Headers) Handler(c *fiber.Ctx) error {
+	c.Request().Header.Set(HeaderRealIP, h.clientIP(c))
+	return c.Next()
+}
+
+// clientIP walks X-Forwarded-For from the right, skipping trusted proxies,
+// and returns the first address not trusted. A chain of trusted proxies
+// only yields its leftmost address.
+func (h *Headers) clientIP(c *fiber.Ctx) string {
+	peer := c.Context().RemoteIP()
+	if !h.trusts(peer) {
+		return peer.String()
+	}
+	hops := strings.Split(c.Get(HeaderForwardedFor), ",")
+	if len(hops) == 1 && strings.TrimSpace(hops[0]) == "" {
+		// A single trusted proxy may report the client in X-Real-IP only
+		if ip := net.ParseIP(strings.TrimSpace(c.Get(HeaderRealIP))); ip != nil {
+			return ip.String()
+		}
+		return peer.String()
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !h.trusts(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// Apply sets the forwarding headers of req, sent upstream for c.
+// X-Forwarded-For gets the peer appended, protocol and host reported by a
+// trusted proxy are kept, and set from the connection otherwise.
+func (h *Headers) Apply(c *fiber.Ctx, req *http.Request) {
+	peer := c.Context().RemoteIP()
+	trusted := h.trusts(peer)
+
+	if prior := c.Get(HeaderForwardedFor); prior != "" {
+		req.Header.Set(HeaderForwardedFor, prior+", "+peer.String())
+	} else {
+		req.Header.Set(HeaderForwardedFor, peer.String())
+	}
+	req.Header.Set(HeaderRealIP, c.Get(HeaderRealIP))
+
+	proto := "http"
+	if c.Context().IsTLS() {
+		proto = "https"
+	}
+	if v := c.Get(HeaderForwardedProto); trusted && v != "" {
+		proto = v
+	}
+	req.Header.Set(HeaderForwardedProto, proto)
+
+	host := string(c.Request().Host())
+	if v := c.Get(HeaderForwardedHost); trusted && v != "" {
+		host = v
+	}
+	req.Header.Set(HeaderForwardedHost, host)
+}
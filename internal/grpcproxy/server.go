@@ -0,0 +1,258 @@
+package grpcproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/ratelimit"
+	"github.com/tuncerburak97/muhtar/internal/service"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// gRPC status codes answered by the proxy itself
+const (
+	codeResourceExhausted = 8
+	codeUnavailable       = 14
+)
+
+// Server proxies gRPC traffic. gRPC needs HTTP/2, which the fiber listener
+// does not speak, so calls are served on their own listener, cleartext
+// (h2c) or TLS, and forwarded to an HTTP/2 upstream frame by frame.
+type Server struct {
+	config  *config.GRPCConfig
+	logSvc  *service.LoggerService
+	metrics *metrics.MetricsCollector
+	limiter *ratelimit.Service
+	proxy   *httputil.ReverseProxy
+	server  *http.Server
+}
+
+// Option configures optional Server components
+type Option func(*Server)
+
+// WithRateLimiter counts gRPC calls against the route, IP and global limits
+func WithRateLimiter(l *ratelimit.Service) Option {
+	return func(s *Server) {
+		s.limiter = l
+	}
+}
+
+// NewServer creates a gRPC proxy for the configured upstream
+func NewServer(cfg *config.GRPCConfig, logSvc *service.LoggerService, metrics *metrics.MetricsCollector, opts ...Option) (*Server, error) {
+	target, err := url.Parse(cfg.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid grpc target %s", cfg.Target)
+	}
+
+	s := &Server{config: cfg, logSvc: logSvc, metrics: metrics}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.proxy = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+		},
+		Transport: newTransport(target.Scheme == "http"),
+		// Stream messages as they arrive, gRPC streams never end on their own
+		FlushInterval: -1,
+		ErrorHandler:  s.upstreamError,
+	}
+
+	var handler http.Handler = http.HandlerFunc(s.handle)
+	if cfg.CertFile == "" {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	s.server = &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// newTransport returns the HTTP/2 upstream transport, over cleartext for
+// h2c upstreams
+func newTransport(cleartext bool) http.RoundTripper {
+	if !cleartext {
+		return &http2.Transport{}
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// Start serves gRPC calls until Close
+func (s *Server) Start() {
+	go func() {
+		var err error
+		if s.config.CertFile != "" {
+			err = s.server.ListenAndServeTLS(s.config.CertFile, s.config.KeyFile)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Str("address", s.config.Address).Msg("gRPC proxy stopped")
+		}
+	}()
+	log.Info().Str("address", s.config.Address).Str("target", s.config.Target).Msg("gRPC proxy listening")
+}
+
+// Close stops accepting calls and waits for the running ones
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to shut down gRPC proxy")
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	start := time.Now()
+	traceID := uuid.New().String()
+	clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	if s.limiter != nil {
+		result, err := s.limiter.AllowCall(r.Context(), clientIP, r.Method, r.URL.Path)
+		if err != nil {
+			log.Error().Err(err).Str("trace_id", traceID).Msg("Rate limit check failed")
+		} else if result.Limited {
+			writeStatus(w, codeResourceExhausted, "rate limit exceeded")
+			s.observe(r, http.StatusOK, codeResourceExhausted, start)
+			return
+		}
+	}
+
+	s.logCall(&model.Log{
+		ID:          uuid.New().String(),
+		TraceID:     traceID,
+		ProcessType: model.ProcessTypeRequest,
+		Timestamp:   start,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		URL:         s.config.Target + r.URL.Path,
+		Headers:     metadata(r.Header),
+		ClientIP:    clientIP,
+		UserAgent:   r.UserAgent(),
+	})
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.proxy.ServeHTTP(rec, r)
+
+	// Trailers are in the header map once the stream ended, trailers-only
+	// answers carry the status in the headers
+	code, _ := strconv.Atoi(trailer(rec.Header(), "Grpc-Status"))
+	duration := time.Since(start)
+	respLog := &model.Log{
+		ID:           uuid.New().String(),
+		TraceID:      traceID,
+		ProcessType:  model.ProcessTypeResponse,
+		Timestamp:    start,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		URL:          s.config.Target + r.URL.Path,
+		Headers:      metadata(rec.Header()),
+		ClientIP:     clientIP,
+		UserAgent:    r.UserAgent(),
+		StatusCode:   rec.status,
+		ResponseTime: duration,
+		Metadata:     map[string]interface{}{"grpc_status": code},
+	}
+	if msg := trailer(rec.Header(), "Grpc-Message"); msg != "" {
+		respLog.Metadata["grpc_message"] = msg
+	}
+	s.logCall(respLog)
+	s.observe(r, rec.status, code, start)
+}
+
+// upstreamError answers a call the upstream could not take
+func (s *Server) upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Str("path", r.URL.Path).Msg("Failed to proxy gRPC call")
+	writeStatus(w, codeUnavailable, "upstream unavailable")
+}
+
+func (s *Server) logCall(l *model.Log) {
+	if err := s.logSvc.LogRequest(l); err != nil {
+		log.Error().Err(err).Str("trace_id", l.TraceID).Msg("Failed to log gRPC call")
+	}
+}
+
+func (s *Server) observe(r *http.Request, status, code int, start time.Time) {
+	label := strconv.Itoa(status)
+	s.metrics.ObserveRequestDuration(r.Method, r.URL.Path, label, "", time.Since(start))
+	s.metrics.IncRequestCounter(r.Method, r.URL.Path, label, "")
+	log.Info().Str("path", r.URL.Path).Int("grpc_status", code).Dur("duration", time.Since(start)).Msg("gRPC call completed")
+}
+
+// writeStatus ends a call with a gRPC status, as a trailers-only answer
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
+
+// trailer returns a trailer copied to the header map, announced or not
+func trailer(h http.Header, key string) string {
+	if v := h.Get(key); v != "" {
+		return v
+	}
+	return h.Get(http.TrailerPrefix + key)
+}
+
+// metadata returns the gRPC metadata of a header map. Messages are framed
+// binary and never logged.
+func metadata(h http.Header) model.Headers {
+	md := make(model.Headers, len(h))
+	for k, v := range h {
+		if len(v) > 0 {
+			md[strings.ToLower(k)] = append([]string(nil), v...)
+		}
+	}
+	return md
+}
+
+// statusRecorder keeps the status of the proxied answer. It must stay
+// flushable, messages are flushed one by one.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
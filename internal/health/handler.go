@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Check reports an error when a dependency is not ready to serve traffic
+type Check func(ctx context.Context) error
+
+// Handler serves the liveness and readiness probes
+type Handler struct {
+	mu      sync.RWMutex
+	names   []string
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// NewHandler creates a new probe handler
+func NewHandler(timeout time.Duration) *Handler {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Handler{
+		checks:  make(map[string]Check),
+		timeout: timeout,
+	}
+}
+
+// Register adds a named readiness check
+func (h *Handler) Register(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.checks[name]; !exists {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Mount registers /live and /ready on the app. It must be called before the
+// proxy catch-all route is registered.
+func (h *Handler) Mount(app *fiber.App) {
+	app.Get("/live", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "alive"})
+	})
+	app.Get("/ready", h.handleReady)
+}
+
+func (h *Handler) handleReady(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ready := true
+	results := make(map[string]string, len(h.checks))
+	for _, name := range h.names {
+		if err := h.checks[name](ctx); err != nil {
+			ready = false
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	status := "ready"
+	code := fiber.StatusOK
+	if !ready {
+		status = "not_ready"
+		code = fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(fiber.Map{
+		"status": status,
+		"checks": results,
+	})
+}
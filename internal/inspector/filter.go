@@ -0,0 +1,130 @@
+package inspector
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Filter is a conjunction of clauses a snapshot must satisfy. Clauses are
+// whitespace separated and have the form <field><op><value>, e.g.
+//
+//	method=POST path^=/api/v1 status>=500 header.X-Tenant=acme
+//
+// Supported operators are =, !=, ^= (prefix), ~= (contains), >, >=, <, <=.
+// Supported fields are method, path, status, client_ip, duration_ms and
+// header.<Name> (request header).
+type Filter struct {
+	clauses []clause
+}
+
+type clause struct {
+	field string
+	op    string
+	value string
+}
+
+var operators = []string{"!=", ">=", "<=", "^=", "~=", "=", ">", "<"}
+
+// ParseFilter parses a filter expression. An empty expression matches all.
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{}
+	for _, token := range strings.Fields(expr) {
+		c, err := parseClause(token)
+		if err != nil {
+			return nil, err
+		}
+		f.clauses = append(f.clauses, c)
+	}
+	return f, nil
+}
+
+func parseClause(token string) (clause, error) {
+	for _, op := range operators {
+		idx := strings.Index(token, op)
+		if idx <= 0 {
+			continue
+		}
+		c := clause{field: token[:idx], op: op, value: token[idx+len(op):]}
+		switch {
+		case c.field == "method", c.field == "path", c.field == "client_ip", strings.HasPrefix(c.field, "header."):
+		case c.field == "status", c.field == "duration_ms":
+			if _, err := strconv.ParseFloat(c.value, 64); err != nil {
+				return clause{}, fmt.Errorf("field %s requires a numeric value", c.field)
+			}
+		default:
+			return clause{}, fmt.Errorf("unknown filter field: %s", c.field)
+		}
+		return c, nil
+	}
+	return clause{}, fmt.Errorf("invalid filter clause: %s", token)
+}
+
+// Match reports whether the snapshot satisfies every clause
+func (f *Filter) Match(s *Snapshot) bool {
+	for _, c := range f.clauses {
+		if !c.match(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c clause) match(s *Snapshot) bool {
+	switch {
+	case c.field == "method":
+		return compareString(s.Method, c.op, c.value, true)
+	case c.field == "path":
+		return compareString(s.Path, c.op, c.value, false)
+	case c.field == "client_ip":
+		return compareString(s.ClientIP, c.op, c.value, false)
+	case strings.HasPrefix(c.field, "header."):
+		name := strings.TrimPrefix(c.field, "header.")
+		return compareString(http.Header(s.RequestHeaders).Get(name), c.op, c.value, false)
+	case c.field == "status":
+		return compareNumber(float64(s.StatusCode), c.op, c.value)
+	case c.field == "duration_ms":
+		return compareNumber(s.DurationMs, c.op, c.value)
+	}
+	return false
+}
+
+func compareString(actual, op, expected string, foldCase bool) bool {
+	if foldCase {
+		actual, expected = strings.ToUpper(actual), strings.ToUpper(expected)
+	}
+	switch op {
+	case "=":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case "^=":
+		return strings.HasPrefix(actual, expected)
+	case "~=":
+		return strings.Contains(actual, expected)
+	}
+	return false
+}
+
+func compareNumber(actual float64, op, raw string) bool {
+	expected, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "=":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package inspector
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+const (
+	redacted           = "[REDACTED]"
+	sessionBufferSize  = 64
+	maxDroppedMessages = 256
+)
+
+// Snapshot is a detailed view of a proxied exchange streamed to inspectors
+type Snapshot struct {
+	TraceID         string              `json:"trace_id"`
+	Timestamp       time.Time           `json:"timestamp"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	URL             string              `json:"url"`
+	ClientIP        string              `json:"client_ip"`
+	StatusCode      int                 `json:"status_code"`
+	DurationMs      float64             `json:"duration_ms"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	RequestBody     string              `json:"request_body,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+}
+
+// Inspector fans out traffic snapshots to connected admin sessions
+type Inspector struct {
+	config        *config.InspectorConfig
+	redactHeaders map[string]bool
+	redactFields  map[string]bool
+
+	mu       sync.RWMutex
+	sessions map[*session]struct{}
+	active   int32
+}
+
+type session struct {
+	filter  *Filter
+	out     chan *Snapshot
+	dropped int32
+}
+
+// New creates a new traffic inspector
+func New(cfg *config.InspectorConfig) *Inspector {
+	i := &Inspector{
+		config:        cfg,
+		redactHeaders: make(map[string]bool),
+		redactFields:  make(map[string]bool),
+		sessions:      make(map[*session]struct{}),
+	}
+	for _, h := range cfg.RedactHeaders {
+		i.redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range cfg.RedactFields {
+		i.redactFields[strings.ToLower(f)] = true
+	}
+	return i
+}
+
+// Active reports whether any session is connected, so the proxy can skip
+// building snapshots when nobody is watching
+func (i *Inspector) Active() bool {
+	return atomic.LoadInt32(&i.active) > 0
+}
+
+// Publish redacts the snapshot and delivers it to every matching session.
+// Slow sessions lose messages instead of blocking the proxy.
+func (i *Inspector) Publish(s *Snapshot) {
+	if !i.Active() {
+		return
+	}
+	i.redact(s)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for sess := range i.sessions {
+		if !sess.filter.Match(s) {
+			continue
+		}
+		select {
+		case sess.out <- s:
+		default:
+			atomic.AddInt32(&sess.dropped, 1)
+		}
+	}
+}
+
+func (i *Inspector) redact(s *Snapshot) {
+	for _, headers := range []map[string][]string{s.RequestHeaders, s.ResponseHeaders} {
+		for k := range headers {
+			if i.redactHeaders[http.CanonicalHeaderKey(k)] {
+				headers[k] = []string{redacted}
+			}
+		}
+	}
+	s.RequestBody = i.redactBody(s.RequestBody)
+	s.ResponseBody = i.redactBody(s.ResponseBody)
+}
+
+func (i *Inspector) redactBody(body string) string {
+	if len(i.redactFields) > 0 && body != "" {
+		var v interface{}
+		if err := json.Unmarshal([]byte(body), &v); err == nil {
+			if raw, err := json.Marshal(i.redactValue(v)); err == nil {
+				body = string(raw)
+			}
+		}
+	}
+	if max := i.config.MaxBodySize; max > 0 && len(body) > max {
+		body = body[:max] + "...(truncated)"
+	}
+	return body
+}
+
+func (i *Inspector) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if i.redactFields[strings.ToLower(k)] {
+				val[k] = redacted
+			} else {
+				val[k] = i.redactValue(child)
+			}
+		}
+	case []interface{}:
+		for idx := range val {
+			val[idx] = i.redactValue(val[idx])
+		}
+	}
+	return v
+}
+
+// RegisterAdminRoutes mounts the websocket inspector endpoint
+func (i *Inspector) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/inspect", i.upgrade, websocket.New(i.serve))
+}
+
+func (i *Inspector) upgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	if _, err := ParseFilter(c.Query("filter")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if max := i.config.MaxSessions; max > 0 && int(atomic.LoadInt32(&i.active)) >= max {
+		return fiber.NewError(fiber.StatusTooManyRequests, "too many inspector sessions")
+	}
+	return c.Next()
+}
+
+func (i *Inspector) serve(conn *websocket.Conn) {
+	filter, _ := ParseFilter(conn.Query("filter"))
+	sess := &session{filter: filter, out: make(chan *Snapshot, sessionBufferSize)}
+
+	i.mu.Lock()
+	i.sessions[sess] = struct{}{}
+	atomic.AddInt32(&i.active, 1)
+	i.mu.Unlock()
+
+	defer func() {
+		i.mu.Lock()
+		delete(i.sessions, sess)
+		atomic.AddInt32(&i.active, -1)
+		i.mu.Unlock()
+		conn.Close()
+	}()
+
+	log.Info().Str("remote", conn.RemoteAddr().String()).Str("filter", conn.Query("filter")).Msg("Inspector session started")
+
+	// Detect client side closes
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var deadline <-chan time.Time
+	if i.config.MaxDuration > 0 {
+		timer := time.NewTimer(i.config.MaxDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	sent := 0
+	for {
+		select {
+		case <-closed:
+			return
+		case <-deadline:
+			i.closeWith(conn, "session duration limit reached")
+			return
+		case s := <-sess.out:
+			if err := conn.WriteJSON(s); err != nil {
+				return
+			}
+			sent++
+			if max := i.config.MaxMessages; max > 0 && sent >= max {
+				i.closeWith(conn, "session message limit reached")
+				return
+			}
+			if atomic.LoadInt32(&sess.dropped) > maxDroppedMessages {
+				i.closeWith(conn, "session too slow")
+				return
+			}
+		}
+	}
+}
+
+func (i *Inspector) closeWith(conn *websocket.Conn, reason string) {
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
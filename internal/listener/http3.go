@@ -0,0 +1,70 @@
+package listener
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// HTTP3 serves the app over QUIC next to the TCP listener. Requests reach the
+// same handlers, with their bodies buffered in both directions, and client
+// certificates are verified at the handshake but not exposed to the proxy.
+type HTTP3 struct {
+	server *http3.Server
+	altSvc string
+}
+
+// NewHTTP3 creates the QUIC listener of app
+func NewHTTP3(cfg *config.ServerConfig, app *fiber.App) (*HTTP3, error) {
+	if cfg.TLS.CertFile == "" {
+		return nil, fmt.Errorf("http3 needs a server certificate")
+	}
+	tlsConfig, err := TLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	port := cfg.HTTP3.Port
+	if port == 0 {
+		port = cfg.Port
+	}
+	maxAge := cfg.HTTP3.MaxAge
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	return &HTTP3{
+		server: &http3.Server{
+			Addr:        fmt.Sprintf("%s:%d", cfg.Host, port),
+			TLSConfig:   tlsConfig,
+			Handler:     adaptor.FiberApp(app),
+			IdleTimeout: cfg.IdleTimeout,
+		},
+		altSvc: fmt.Sprintf(`h3=":%d"; ma=%d`, port, int(maxAge.Seconds())),
+	}, nil
+}
+
+// Start serves QUIC in the background
+func (s *HTTP3) Start() {
+	go func() {
+		log.Info().Str("addr", s.server.Addr).Msg("Starting HTTP/3 listener")
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("Failed to start HTTP/3 listener")
+		}
+	}()
+}
+
+// Advertise announces the QUIC listener to clients of the TCP one
+func (s *HTTP3) Advertise(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderAltSvc, s.altSvc)
+	return c.Next()
+}
+
+// Close stops the listener, cutting off the requests in progress
+func (s *HTTP3) Close() error {
+	return s.server.Close()
+}
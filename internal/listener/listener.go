@@ -0,0 +1,116 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pires/go-proxyproto"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Client certificate policies
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Listen opens the listener of the server, reading PROXY protocol headers
+// when enabled and serving TLS when a certificate is configured
+func Listen(cfg *config.ServerConfig) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		var err error
+		if tlsConfig, err = TLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Host, cfg.Port))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ProxyProtocol.Enabled {
+		// The header comes before the TLS handshake
+		if ln, err = proxyProtocol(ln, cfg.ProxyProtocol); err != nil {
+			return nil, err
+		}
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// proxyProtocol wraps ln to take the client address of each connection from
+// its PROXY protocol header. Only trusted proxies may send one, an empty list
+// trusts every peer.
+func proxyProtocol(ln net.Listener, cfg config.ProxyProtocolConfig) (net.Listener, error) {
+	trusted := proxyproto.PolicyFunc(func(net.Addr) (proxyproto.Policy, error) { return proxyproto.USE, nil })
+	if len(cfg.TrustedProxies) > 0 {
+		policy, err := proxyproto.LaxWhiteListPolicy(cfg.TrustedProxies)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("invalid proxy protocol trusted proxies: %v", err)
+		}
+		trusted = policy
+	}
+	policy := trusted
+	if cfg.Required {
+		policy = func(upstream net.Addr) (proxyproto.Policy, error) {
+			p, err := trusted(upstream)
+			if p == proxyproto.USE {
+				p = proxyproto.REQUIRE
+			}
+			return p, err
+		}
+	}
+	return &proxyproto.Listener{Listener: ln, Policy: policy, ReadHeaderTimeout: cfg.ReadHeaderTimeout}, nil
+}
+
+// TLSConfig returns the TLS configuration of the listener. Client
+// certificates are verified against the client CAs during the handshake, a
+// client failing verification never reaches the proxy.
+func TLSConfig(cfg config.ServerTLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	policy := cfg.ClientAuth
+	if policy == "" {
+		policy = ClientAuthNone
+		if cfg.ClientCAFile != "" {
+			policy = ClientAuthRequire
+		}
+	}
+	switch policy {
+	case ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth policy %s", policy)
+	}
+	if cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %s needs a client CA file", policy)
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate found in %s", cfg.ClientCAFile)
+	}
+	return tlsConfig, nil
+}
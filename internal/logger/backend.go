@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// Backend receives the log events of the gateway. Modules log through
+// zerolog, Writer converts their events for the backend.
+type Backend interface {
+	Log(level zerolog.Level, msg string, fields map[string]interface{})
+}
+
+// Writer adapts a Backend to a zerolog output
+func Writer(backend Backend) zerolog.LevelWriter {
+	return &backendWriter{backend: backend}
+}
+
+type backendWriter struct {
+	backend Backend
+}
+
+func (w *backendWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel decodes one zerolog event. The level and message become
+// arguments, every other field is passed on, timestamps included.
+func (w *backendWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	fields := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return 0, fmt.Errorf("cannot decode log event: %v", err)
+	}
+	for k, v := range fields {
+		if n, ok := v.(json.Number); ok {
+			fields[k] = number(n)
+		}
+	}
+	msg, _ := fields[zerolog.MessageFieldName].(string)
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.LevelFieldName)
+	w.backend.Log(level, msg, fields)
+	return len(p), nil
+}
+
+// number keeps integers exact, decoding into interface{} would turn them into
+// float64
+func number(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+type silentBackend struct{}
+
+// SilentBackend discards every event, e.g. in tests
+func SilentBackend() Backend {
+	return silentBackend{}
+}
+
+func (silentBackend) Log(zerolog.Level, string, map[string]interface{}) {}
@@ -0,0 +1,181 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Correlation ID formats
+const (
+	FormatUUID4     = "uuid4"
+	FormatUUID7     = "uuid7"
+	FormatULID      = "ulid"
+	FormatSnowflake = "snowflake"
+)
+
+// DefaultCorrelationHeader carries the correlation ID unless configured
+// otherwise
+const DefaultCorrelationHeader = "X-Request-ID"
+
+// maxIncomingID bounds trusted incoming IDs, they end up in every log line
+const maxIncomingID = 128
+
+// Correlation reads or generates the ID correlating the logs of a request
+// and echoes it to the upstream and the client
+type Correlation struct {
+	config   config.CorrelationConfig
+	generate func() string
+}
+
+// NewCorrelation validates the ID format and headers
+func NewCorrelation(cfg *config.CorrelationConfig) (*Correlation, error) {
+	co := &Correlation{config: *cfg}
+	if co.config.RequestHeader == "" {
+		co.config.RequestHeader = DefaultCorrelationHeader
+	}
+	if co.config.ResponseHeader == "" {
+		co.config.ResponseHeader = co.config.RequestHeader
+	}
+
+	switch cfg.Format {
+	case "", FormatUUID4:
+		co.generate = func() string { return uuid.New().String() }
+	case FormatUUID7:
+		co.generate = func() string { return uuid.Must(uuid.NewV7()).String() }
+	case FormatULID:
+		co.generate = newULID
+	case FormatSnowflake:
+		if cfg.NodeID < 0 || cfg.NodeID > maxSnowflakeNode {
+			return nil, fmt.Errorf("snowflake node_id must be between 0 and %d", maxSnowflakeNode)
+		}
+		co.generate = newSnowflake(int64(cfg.NodeID)).next
+	default:
+		return nil, fmt.Errorf("unknown correlation id format %s", cfg.Format)
+	}
+	return co, nil
+}
+
+// ID returns the trusted incoming ID of the request, or a new one
+func (co *Correlation) ID(c *fiber.Ctx) string {
+	if co.config.TrustIncoming {
+		if id := c.Get(co.config.RequestHeader); validIncomingID(id) {
+			return id
+		}
+	}
+	return co.generate()
+}
+
+// validIncomingID accepts printable ASCII IDs, keeping clients from injecting
+// line breaks or oversized values into the logs
+func validIncomingID(id string) bool {
+	if id == "" || len(id) > maxIncomingID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware attaches a request logger derived from base, carrying the
+// correlation ID. The ID replaces the request header forwarded upstream and
+// is set on the response.
+func (co *Correlation) Middleware(base zerolog.Logger) fiber.Handler {
+	stage := co.Stage(base)
+	return func(c *fiber.Ctx) error {
+		return stage(c, c.Next)
+	}
+}
+
+// Stage creates the pipeline form of Middleware
+func (co *Correlation) Stage(base zerolog.Logger) func(c *fiber.Ctx, next func() error) error {
+	return func(c *fiber.Ctx, next func() error) error {
+		id := co.ID(c)
+		New(c, base, id)
+		c.Request().Header.Set(co.config.RequestHeader, id)
+
+		err := next()
+		// Set last, the upstream response headers are copied before
+		c.Set(co.config.ResponseHeader, id)
+		return err
+	}
+}
+
+// crockford is the ULID alphabet
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: a 48 bit millisecond timestamp followed by 80
+// random bits, in Crockford base32
+func newULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	// 128 bits are encoded in 26 characters, the first holding 3 bits
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+const (
+	// snowflakeEpoch is 2024-01-01T00:00:00Z in milliseconds
+	snowflakeEpoch   = 1704067200000
+	maxSnowflakeNode = 1<<10 - 1
+	maxSnowflakeSeq  = 1<<12 - 1
+)
+
+// snowflake generates 63 bit IDs: milliseconds since snowflakeEpoch, a 10 bit
+// node and a 12 bit sequence
+type snowflake struct {
+	node int64
+
+	mu   sync.Mutex
+	last int64
+	seq  int64
+}
+
+func newSnowflake(node int64) *snowflake {
+	return &snowflake{node: node}
+}
+
+func (s *snowflake) next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixMilli() - snowflakeEpoch
+	if now < s.last {
+		// The clock moved backwards, keep the IDs increasing
+		now = s.last
+	}
+	if now == s.last {
+		s.seq = (s.seq + 1) & maxSnowflakeSeq
+		if s.seq == 0 {
+			// Sequence exhausted, wait for the next millisecond
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixMilli() - snowflakeEpoch
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = now
+	return strconv.FormatInt(now<<22|s.node<<12|s.seq, 10)
+}
@@ -1,23 +1,55 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
 )
 
-var log zerolog.Logger
+// Backends selectable in the log configuration
+const (
+	BackendZerolog = "zerolog"
+	BackendZap     = "zap"
+	BackendSilent  = "silent"
+)
 
-func Init(level string) {
-	logLevel, err := zerolog.ParseLevel(level)
+// Init configures the global logger used by every module from cfg
+func Init(cfg *config.LogConfig) error {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	level, err := zerolog.ParseLevel(cfg.Level)
 	if err != nil {
-		logLevel = zerolog.InfoLevel
+		log.Warn().Err(err).Msg("Invalid log level, defaulting to info")
+		level = zerolog.InfoLevel
 	}
+	zerolog.SetGlobalLevel(level)
+	// Modules log through zerolog.Ctx, which falls back to the global logger
+	// outside of requests
+	zerolog.DefaultContextLogger = &log.Logger
 
-	zerolog.SetGlobalLevel(logLevel)
-	log = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	switch cfg.Backend {
+	case "", BackendZerolog:
+		if cfg.Format == "json" {
+			log.Logger = log.Output(os.Stdout)
+		}
+	case BackendZap:
+		backend, err := NewZapBackend(cfg.Format)
+		if err != nil {
+			return err
+		}
+		SetBackend(backend)
+	case BackendSilent:
+		log.Logger = zerolog.Nop()
+	default:
+		return fmt.Errorf("unknown log backend %s", cfg.Backend)
+	}
+	return nil
 }
 
-func GetLogger() *zerolog.Logger {
-	return &log
+// SetBackend sends the logs of every module to backend. Embedders use it to
+// plug their own logger.
+func SetBackend(backend Backend) {
+	log.Logger = zerolog.New(Writer(backend)).With().Timestamp().Logger()
 }
@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	loggerKey  = "muhtar.logger"
+	traceIDKey = "muhtar.trace_id"
+)
+
+// New attaches a logger derived from base to the request, carrying the trace
+// ID, the method and the path. The logger is also stored in the user context,
+// where zerolog.Ctx finds it.
+func New(c *fiber.Ctx, base zerolog.Logger, traceID string) *zerolog.Logger {
+	l := base.With().
+		Str("trace_id", traceID).
+		Str("method", c.Method()).
+		Str("path", c.Path()).
+		Logger()
+	c.Locals(traceIDKey, traceID)
+	attach(c, &l)
+	return &l
+}
+
+func attach(c *fiber.Ctx, l *zerolog.Logger) {
+	c.Locals(loggerKey, l)
+	c.SetUserContext(l.WithContext(c.UserContext()))
+}
+
+// FromCtx returns the request logger, nil when none was attached
+func FromCtx(c *fiber.Ctx) *zerolog.Logger {
+	l, _ := c.Locals(loggerKey).(*zerolog.Logger)
+	return l
+}
+
+// TraceID returns the trace ID of the request logger
+func TraceID(c *fiber.Ctx) string {
+	id, _ := c.Locals(traceIDKey).(string)
+	return id
+}
+
+// With adds a field to the request logger, e.g. the tenant once resolved
+func With(c *fiber.Ctx, key, value string) {
+	l := FromCtx(c)
+	if l == nil {
+		return
+	}
+	updated := l.With().Str(key, value).Logger()
+	attach(c, &updated)
+}
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"sort"
+
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type zapBackend struct {
+	logger *zap.Logger
+}
+
+// NewZapBackend creates a backend writing through zap's production logger.
+// format is json or console. Levels are filtered by zerolog before events
+// reach zap.
+func NewZapBackend(format string) (Backend, error) {
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	cfg.OutputPaths = []string{"stdout"}
+	cfg.DisableCaller = true
+	cfg.DisableStacktrace = true
+	// The zerolog timestamp is passed as a field
+	cfg.EncoderConfig.TimeKey = ""
+	if format != "json" {
+		cfg.Encoding = "console"
+	}
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+	return ZapBackend(logger), nil
+}
+
+// ZapBackend wraps an existing zap logger
+func ZapBackend(logger *zap.Logger) Backend {
+	return &zapBackend{logger: logger}
+}
+
+func (b *zapBackend) Log(level zerolog.Level, msg string, fields map[string]interface{}) {
+	// zerolog exits or panics itself after fatal and panic events
+	zapLevel := zapcore.ErrorLevel
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		zapLevel = zapcore.DebugLevel
+	case zerolog.InfoLevel, zerolog.NoLevel:
+		zapLevel = zapcore.InfoLevel
+	case zerolog.WarnLevel:
+		zapLevel = zapcore.WarnLevel
+	}
+	ce := b.logger.Check(zapLevel, msg)
+	if ce == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	zapFields := make([]zap.Field, 0, len(keys))
+	for _, k := range keys {
+		zapFields = append(zapFields, zap.Any(k, fields[k]))
+	}
+	ce.Write(zapFields...)
+}
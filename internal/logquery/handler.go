@@ -0,0 +1,65 @@
+package logquery
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+)
+
+// Handler serves stored traffic logs to the admin API
+type Handler struct {
+	repo          repository.LogRepository
+	requireTenant bool
+}
+
+// NewHandler creates a new log query handler. repo should be the read
+// replica when one is configured. With requireTenant set, queries must name
+// the tenant whose logs they read.
+func NewHandler(repo repository.LogRepository, requireTenant bool) *Handler {
+	return &Handler{repo: repo, requireTenant: requireTenant}
+}
+
+// RegisterAdminRoutes mounts the log query endpoint
+func (h *Handler) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/logs", h.handleQuery)
+}
+
+func (h *Handler) handleQuery(c *fiber.Ctx) error {
+	filter := model.LogFilter{
+		TenantID:    c.Query("tenant"),
+		TraceID:     c.Query("trace_id"),
+		ProcessType: model.ProcessType(c.Query("process_type")),
+		Method:      c.Query("method"),
+		PathPrefix:  c.Query("path_prefix"),
+		StatusCode:  c.QueryInt("status_code"),
+		Limit:       c.QueryInt("limit"),
+		Offset:      c.QueryInt("offset"),
+	}
+
+	if h.requireTenant && filter.TenantID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "tenant is required")
+	}
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid from timestamp")
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid to timestamp")
+		}
+	}
+
+	logs, err := h.repo.FindLogs(c.Context(), filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"count": len(logs),
+		"logs":  logs,
+	})
+}
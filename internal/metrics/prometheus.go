@@ -26,15 +26,37 @@ func GetMetricsCollector(namespace, appName string) *MetricsCollector {
 }
 
 type MetricsCollector struct {
-	AppName         string
-	RequestDuration *prometheus.HistogramVec
-	RequestCounter  *prometheus.CounterVec
-	ResponseSize    *prometheus.HistogramVec
-	ErrorCounter    *prometheus.CounterVec
-	ActiveRequests  prometheus.Gauge
-	bufferChan      chan metricEvent
-	done            chan struct{}
-	QueueSize       *prometheus.GaugeVec
+	AppName             string
+	RequestDuration     *prometheus.HistogramVec
+	RequestCounter      *prometheus.CounterVec
+	ResponseSize        *prometheus.HistogramVec
+	ErrorCounter        *prometheus.CounterVec
+	ActiveRequests      prometheus.Gauge
+	bufferChan          chan metricEvent
+	done                chan struct{}
+	QueueSize           *prometheus.GaugeVec
+	ShadowCompare       *prometheus.CounterVec
+	BreakerState        *prometheus.GaugeVec
+	DroppedLogs         *prometheus.CounterVec
+	Backpressure        *prometheus.CounterVec
+	LoadShed            *prometheus.CounterVec
+	SlowClients         *prometheus.CounterVec
+	Anomalies           *prometheus.GaugeVec
+	AccessDecisions     *prometheus.CounterVec
+	FlagEvaluations     *prometheus.CounterVec
+	CredentialRotations *prometheus.CounterVec
+	SplitRequests       *prometheus.CounterVec
+	UpstreamHealth      *prometheus.GaugeVec
+	DiscoveredTargets   *prometheus.GaugeVec
+	UpstreamConnections *prometheus.GaugeVec
+	OutlierEjections    *prometheus.CounterVec
+	Retries             *prometheus.CounterVec
+	Failovers           *prometheus.CounterVec
+	Compressed          *prometheus.CounterVec
+	Hedges              *prometheus.CounterVec
+	BulkheadRejected    *prometheus.CounterVec
+	ExperimentRequests  *prometheus.CounterVec
+	CompressionSaved    *prometheus.CounterVec
 }
 
 type metricEvent struct {
@@ -61,7 +83,7 @@ func NewMetricsCollector(namespace, appName string) *MetricsCollector {
 				Help:      "Request duration in seconds",
 				Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
 			},
-			[]string{"app", "method", "path", "status"},
+			[]string{"app", "method", "path", "status", "tenant"},
 		),
 
 		RequestCounter: promauto.NewCounterVec(
@@ -70,7 +92,7 @@ func NewMetricsCollector(namespace, appName string) *MetricsCollector {
 				Name:      "requests_total",
 				Help:      "Total number of requests",
 			},
-			[]string{"app", "method", "path", "status"},
+			[]string{"app", "method", "path", "status", "tenant"},
 		),
 
 		ResponseSize: promauto.NewHistogramVec(
@@ -80,7 +102,7 @@ func NewMetricsCollector(namespace, appName string) *MetricsCollector {
 				Help:      "Response size in bytes",
 				Buckets:   []float64{100, 1000, 10000, 100000, 1000000},
 			},
-			[]string{"app", "method", "path", "status"},
+			[]string{"app", "method", "path", "status", "tenant"},
 		),
 
 		ErrorCounter: promauto.NewCounterVec(
@@ -112,6 +134,182 @@ func NewMetricsCollector(namespace, appName string) *MetricsCollector {
 			},
 			[]string{"app", "type", "queue"},
 		),
+		ShadowCompare: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "shadow_comparisons_total",
+				Help:      "Total number of primary/shadow response comparisons",
+			},
+			[]string{"app", "result", "reason"},
+		),
+		BreakerState: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "breaker_state",
+				Help:      "Circuit breaker state (0 closed, 1 half-open, 2 open)",
+			},
+			[]string{"app", "breaker"},
+		),
+		DroppedLogs: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "dropped_logs_total",
+				Help:      "Total number of traffic logs that could not be persisted",
+			},
+			[]string{"app", "reason"},
+		),
+		Backpressure: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "log_backpressure_total",
+				Help:      "Total number of backpressure actions taken on a full log queue",
+			},
+			[]string{"app", "action"},
+		),
+		LoadShed: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "load_shed_total",
+				Help:      "Total number of requests rejected by priority admission",
+			},
+			[]string{"app", "class", "reason"},
+		),
+		SlowClients: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "slow_client_aborts_total",
+				Help:      "Total number of responses aborted because the client read too slowly",
+			},
+			[]string{"app"},
+		),
+		Anomalies: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "traffic_anomaly_score",
+				Help:      "Standard deviations between the last observation of a route and its baseline",
+			},
+			[]string{"app", "route", "signal"},
+		),
+		AccessDecisions: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "access_decisions_total",
+				Help:      "Total number of allow/deny decisions taken by the auth and access control modules",
+			},
+			[]string{"app", "module", "decision", "rule"},
+		),
+		FlagEvaluations: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "feature_flag_evaluations_total",
+				Help:      "Total number of feature flag evaluations by resolved variant and reason",
+			},
+			[]string{"app", "flag", "variant", "reason"},
+		),
+		CredentialRotations: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "upstream_credential_rotations_total",
+				Help:      "Total number of upstream credential rotations applied or rejected",
+			},
+			[]string{"app", "credential", "result"},
+		),
+		SplitRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "split_requests_total",
+				Help:      "Total number of requests sent to each weighted target of a split route",
+			},
+			[]string{"app", "route", "target"},
+		),
+		UpstreamHealth: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "upstream_healthy",
+				Help:      "Health of actively checked upstream targets (1 in rotation, 0 removed)",
+			},
+			[]string{"app", "route", "target"},
+		),
+		DiscoveredTargets: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "upstream_discovered_targets",
+				Help:      "Number of upstream targets last discovered for a route",
+			},
+			[]string{"app", "route"},
+		),
+		UpstreamConnections: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "upstream_connections",
+				Help:      "Upstream connections per target address, open and idle in the pool",
+			},
+			[]string{"app", "target", "state"},
+		),
+		OutlierEjections: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "outlier_ejections_total",
+				Help:      "Total number of upstream targets ejected after consecutive failures",
+			},
+			[]string{"app", "route", "target"},
+		),
+		Retries: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "upstream_retries_total",
+				Help:      "Total number of upstream requests retried by failure reason",
+			},
+			[]string{"app", "route", "reason"},
+		),
+		Failovers: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "upstream_failovers_total",
+				Help:      "Total number of requests sent to a backup target after the previous one failed",
+			},
+			[]string{"app", "route", "target"},
+		),
+		Hedges: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "upstream_hedged_requests_total",
+				Help:      "Total number of extra requests sent to another replica after the hedge delay",
+			},
+			[]string{"app", "route"},
+		),
+		BulkheadRejected: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "bulkhead_rejected_requests_total",
+				Help:      "Total number of requests rejected by the bulkhead of their route",
+			},
+			[]string{"app", "route", "reason"},
+		),
+		ExperimentRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "experiment_requests_total",
+				Help:      "Total number of requests per A/B test variant",
+			},
+			[]string{"app", "experiment", "variant"},
+		),
+		Compressed: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "responses_compressed_total",
+				Help:      "Total number of responses compressed by the proxy by encoding",
+			},
+			[]string{"app", "encoding"},
+		),
+		CompressionSaved: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "compression_saved_bytes_total",
+				Help:      "Total number of response bytes saved by compression by encoding",
+			},
+			[]string{"app", "encoding"},
+		),
 	}
 
 	m.startCollector()
@@ -160,6 +358,7 @@ func (m *MetricsCollector) ObserveRequest(method, path, status, target string, d
 		"method": method,
 		"path":   path,
 		"status": status,
+		"tenant": "",
 	}
 
 	m.bufferChan <- metricEvent{
@@ -194,6 +393,7 @@ func (m *MetricsCollector) ObserveBatchSave(operation string, duration time.Dura
 		"method": "batch",
 		"path":   operation,
 		"status": "200",
+		"tenant": "",
 	}
 	m.RequestDuration.With(labels).Observe(duration.Seconds())
 	m.RequestCounter.With(labels).Add(float64(batchSize))
@@ -207,18 +407,243 @@ func (m *MetricsCollector) ObserveQueueSize(queueType string, size float64) {
 	}).Set(size)
 }
 
+// ObserveShadowComparison records the outcome of a shadow comparison
+func (m *MetricsCollector) ObserveShadowComparison(result, reason string) {
+	m.ShadowCompare.With(prometheus.Labels{
+		"app":    m.AppName,
+		"result": result,
+		"reason": reason,
+	}).Inc()
+}
+
+// ObserveBreakerState records the state of a circuit breaker
+func (m *MetricsCollector) ObserveBreakerState(name string, state int) {
+	m.BreakerState.With(prometheus.Labels{
+		"app":     m.AppName,
+		"breaker": name,
+	}).Set(float64(state))
+}
+
+// IncDroppedLogs counts traffic logs lost for the given reason
+func (m *MetricsCollector) IncDroppedLogs(reason string, count int) {
+	m.DroppedLogs.With(prometheus.Labels{
+		"app":    m.AppName,
+		"reason": reason,
+	}).Add(float64(count))
+}
+
+// IncBackpressure counts a backpressure action taken on the log queue
+func (m *MetricsCollector) IncBackpressure(action string) {
+	m.Backpressure.With(prometheus.Labels{
+		"app":    m.AppName,
+		"action": action,
+	}).Inc()
+}
+
+// IncLoadShed counts a request of the given priority class that was shed
+func (m *MetricsCollector) IncLoadShed(class, reason string) {
+	m.LoadShed.With(prometheus.Labels{
+		"app":    m.AppName,
+		"class":  class,
+		"reason": reason,
+	}).Inc()
+}
+
+// IncSlowClientAborts counts a response aborted for a slow reading client
+func (m *MetricsCollector) IncSlowClientAborts() {
+	m.SlowClients.With(prometheus.Labels{"app": m.AppName}).Inc()
+}
+
+// ObserveAnomalyScore records how far a route signal deviates from its baseline
+func (m *MetricsCollector) ObserveAnomalyScore(route, signal string, score float64) {
+	m.Anomalies.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"signal": signal,
+	}).Set(score)
+}
+
+// IncAccessDecision counts an allow or deny decision of an access module
+func (m *MetricsCollector) IncAccessDecision(module, decision, rule string) {
+	m.AccessDecisions.With(prometheus.Labels{
+		"app":      m.AppName,
+		"module":   module,
+		"decision": decision,
+		"rule":     rule,
+	}).Inc()
+}
+
+// IncFlagEvaluation counts a feature flag resolved for a request
+func (m *MetricsCollector) IncFlagEvaluation(flag, variant, reason string) {
+	m.FlagEvaluations.With(prometheus.Labels{
+		"app":     m.AppName,
+		"flag":    flag,
+		"variant": variant,
+		"reason":  reason,
+	}).Inc()
+}
+
+// IncCredentialRotation counts a rotation of upstream credentials
+func (m *MetricsCollector) IncCredentialRotation(credential, result string) {
+	m.CredentialRotations.With(prometheus.Labels{
+		"app":        m.AppName,
+		"credential": credential,
+		"result":     result,
+	}).Inc()
+}
+
+// IncSplitRequest counts a request sent to a weighted target
+func (m *MetricsCollector) IncSplitRequest(route, target string) {
+	m.SplitRequests.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"target": target,
+	}).Inc()
+}
+
+// ObserveUpstreamHealth records the health check state of an upstream target
+func (m *MetricsCollector) ObserveUpstreamHealth(route, target string, healthy bool) {
+	v := 0.0
+	if healthy {
+		v = 1
+	}
+	m.UpstreamHealth.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"target": target,
+	}).Set(v)
+}
+
+// ForgetUpstreamHealth drops the health state of a target no longer
+// discovered
+func (m *MetricsCollector) ForgetUpstreamHealth(route, target string) {
+	m.UpstreamHealth.Delete(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"target": target,
+	})
+}
+
+// ObserveDiscoveredTargets records the number of targets discovered for a
+// route
+func (m *MetricsCollector) ObserveDiscoveredTargets(route string, n int) {
+	m.DiscoveredTargets.With(prometheus.Labels{
+		"app":   m.AppName,
+		"route": route,
+	}).Set(float64(n))
+}
+
+// AddUpstreamConnections moves the count of upstream connections of a target
+// in a state by delta
+func (m *MetricsCollector) AddUpstreamConnections(target, state string, delta float64) {
+	m.UpstreamConnections.With(prometheus.Labels{
+		"app":    m.AppName,
+		"target": target,
+		"state":  state,
+	}).Add(delta)
+}
+
+// IncOutlierEjection counts a target ejected from the pool of a route
+func (m *MetricsCollector) IncOutlierEjection(route, target string) {
+	m.OutlierEjections.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"target": target,
+	}).Inc()
+}
+
+// IncRetry counts an upstream request sent again
+func (m *MetricsCollector) IncRetry(route, reason string) {
+	m.Retries.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"reason": reason,
+	}).Inc()
+}
+
+// IncFailover counts a request failed over to a backup target
+func (m *MetricsCollector) IncFailover(route, target string) {
+	m.Failovers.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"target": target,
+	}).Inc()
+}
+
+// IncHedge counts a hedged request sent to another replica
+func (m *MetricsCollector) IncHedge(route string) {
+	m.Hedges.With(prometheus.Labels{
+		"app":   m.AppName,
+		"route": route,
+	}).Inc()
+}
+
+// IncBulkheadRejected counts a request rejected by the bulkhead of its route
+func (m *MetricsCollector) IncBulkheadRejected(route, reason string) {
+	m.BulkheadRejected.With(prometheus.Labels{
+		"app":    m.AppName,
+		"route":  route,
+		"reason": reason,
+	}).Inc()
+}
+
+// IncExperimentRequest counts a request assigned to an A/B test variant
+func (m *MetricsCollector) IncExperimentRequest(experiment, variant string) {
+	m.ExperimentRequests.With(prometheus.Labels{
+		"app":        m.AppName,
+		"experiment": experiment,
+		"variant":    variant,
+	}).Inc()
+}
+
+// ObserveCompression records a response body compressed from original to
+// compressed bytes
+func (m *MetricsCollector) ObserveCompression(encoding string, original, compressed int) {
+	labels := prometheus.Labels{
+		"app":      m.AppName,
+		"encoding": encoding,
+	}
+	m.Compressed.With(labels).Inc()
+	if saved := original - compressed; saved > 0 {
+		m.CompressionSaved.With(labels).Add(float64(saved))
+	}
+}
+
 // GetMetricsJSON returns metrics in JSON format
 func (m *MetricsCollector) GetMetricsJSON() ([]byte, error) {
 	metrics := MetricsResponse{
 		AppName:   m.AppName,
 		Timestamp: time.Now(),
 		Metrics: map[string]interface{}{
-			"request_duration": m.getHistogramMetrics(m.RequestDuration),
-			"requests_total":   m.getCounterMetrics(m.RequestCounter),
-			"response_size":    m.getHistogramMetrics(m.ResponseSize),
-			"errors_total":     m.getCounterMetrics(m.ErrorCounter),
-			"active_requests":  m.getGaugeValue(m.ActiveRequests),
-			"queue_size":       m.getGaugeVecMetrics(m.QueueSize),
+			"request_duration":     m.getHistogramMetrics(m.RequestDuration),
+			"requests_total":       m.getCounterMetrics(m.RequestCounter),
+			"response_size":        m.getHistogramMetrics(m.ResponseSize),
+			"errors_total":         m.getCounterMetrics(m.ErrorCounter),
+			"active_requests":      m.getGaugeValue(m.ActiveRequests),
+			"queue_size":           m.getGaugeVecMetrics(m.QueueSize),
+			"shadow_compare":       m.getCounterMetrics(m.ShadowCompare),
+			"breaker_state":        m.getGaugeVecMetrics(m.BreakerState),
+			"dropped_logs":         m.getCounterMetrics(m.DroppedLogs),
+			"log_backpressure":     m.getCounterMetrics(m.Backpressure),
+			"load_shed":            m.getCounterMetrics(m.LoadShed),
+			"slow_client":          m.getCounterMetrics(m.SlowClients),
+			"anomaly_score":        m.getGaugeVecMetrics(m.Anomalies),
+			"access_decisions":     m.getCounterMetrics(m.AccessDecisions),
+			"flag_evaluations":     m.getCounterMetrics(m.FlagEvaluations),
+			"credential_rotations": m.getCounterMetrics(m.CredentialRotations),
+			"split_requests":       m.getCounterMetrics(m.SplitRequests),
+			"upstream_healthy":     m.getGaugeVecMetrics(m.UpstreamHealth),
+			"upstream_discovered":  m.getGaugeVecMetrics(m.DiscoveredTargets),
+			"upstream_connections": m.getGaugeVecMetrics(m.UpstreamConnections),
+			"outlier_ejections":    m.getCounterMetrics(m.OutlierEjections),
+			"upstream_retries":     m.getCounterMetrics(m.Retries),
+			"upstream_failovers":   m.getCounterMetrics(m.Failovers),
+			"upstream_hedges":      m.getCounterMetrics(m.Hedges),
+			"bulkhead_rejected":    m.getCounterMetrics(m.BulkheadRejected),
+			"experiment_requests":  m.getCounterMetrics(m.ExperimentRequests),
+			"responses_compressed": m.getCounterMetrics(m.Compressed),
+			"compression_saved":    m.getCounterMetrics(m.CompressionSaved),
+			"summary":              m.Summary(),
 		},
 	}
 
@@ -301,22 +726,25 @@ func getMetricName(metric prometheus.Metric) string {
 	return strings.Join(labels, ",")
 }
 
-// IncRequestCounter increments the request counter with given labels
-func (m *MetricsCollector) IncRequestCounter(method, path, status string) {
+// IncRequestCounter increments the request counter with given labels. tenant
+// is empty when tenancy is disabled.
+func (m *MetricsCollector) IncRequestCounter(method, path, status, tenant string) {
 	m.RequestCounter.With(prometheus.Labels{
 		"app":    m.AppName,
 		"method": method,
 		"path":   path,
 		"status": status,
+		"tenant": tenant,
 	}).Inc()
 }
 
 // ObserveRequestDuration observes the request duration
-func (m *MetricsCollector) ObserveRequestDuration(method, path, status string, duration time.Duration) {
+func (m *MetricsCollector) ObserveRequestDuration(method, path, status, tenant string, duration time.Duration) {
 	m.RequestDuration.With(prometheus.Labels{
 		"app":    m.AppName,
 		"method": method,
 		"path":   path,
 		"status": status,
+		"tenant": tenant,
 	}).Observe(duration.Seconds())
 }
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Summary is the computed view of the request metrics
+type Summary struct {
+	Requests  float64             `json:"requests"`
+	Errors    float64             `json:"errors"`
+	ErrorRate float64             `json:"error_rate"`
+	Latency   LatencySummary      `json:"latency_ms"`
+	Paths     map[string]*Summary `json:"paths,omitempty"`
+
+	histogram *histogram
+}
+
+// LatencySummary holds request latency percentiles in milliseconds
+type LatencySummary struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+}
+
+// histogram merges the buckets of several label sets of a histogram vector
+type histogram struct {
+	bounds []float64
+	counts []float64 // Cumulative, aligned with bounds
+	sum    float64
+	count  float64
+}
+
+func (h *histogram) merge(hist *dto.Histogram) {
+	buckets := hist.GetBucket()
+	if h.bounds == nil {
+		h.bounds = make([]float64, len(buckets))
+		h.counts = make([]float64, len(buckets))
+		for i, b := range buckets {
+			h.bounds[i] = b.GetUpperBound()
+		}
+	}
+	for i, b := range buckets {
+		if i < len(h.counts) {
+			h.counts[i] += float64(b.GetCumulativeCount())
+		}
+	}
+	h.sum += hist.GetSampleSum()
+	h.count += float64(hist.GetSampleCount())
+}
+
+// quantile interpolates linearly inside the bucket holding the q-th
+// observation, as histogram_quantile does
+func (h *histogram) quantile(q float64) float64 {
+	if h == nil || h.count == 0 {
+		return 0
+	}
+	rank := q * h.count
+	i := sort.Search(len(h.counts), func(i int) bool { return h.counts[i] >= rank })
+	if i == len(h.counts) {
+		// Beyond the last bucket, the best estimate is its bound
+		return h.bounds[len(h.bounds)-1]
+	}
+	lower, below := 0.0, 0.0
+	if i > 0 {
+		lower, below = h.bounds[i-1], h.counts[i-1]
+	}
+	inBucket := h.counts[i] - below
+	if inBucket == 0 {
+		return h.bounds[i]
+	}
+	return lower + (h.bounds[i]-lower)*(rank-below)/inBucket
+}
+
+func (s *Summary) finish() {
+	if s.Requests > 0 {
+		s.ErrorRate = round(s.Errors / s.Requests)
+	}
+	if h := s.histogram; h != nil && h.count > 0 {
+		s.Latency = LatencySummary{
+			Mean: round(h.sum / h.count * 1000),
+			P50:  round(h.quantile(0.5) * 1000),
+			P90:  round(h.quantile(0.9) * 1000),
+			P99:  round(h.quantile(0.99) * 1000),
+		}
+	}
+	for _, p := range s.Paths {
+		p.finish()
+	}
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, l := range metric.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// Summary computes latency percentiles and error rates overall and per path
+func (m *MetricsCollector) Summary() *Summary {
+	total := &Summary{Paths: make(map[string]*Summary), histogram: &histogram{}}
+	path := func(name string) *Summary {
+		s, ok := total.Paths[name]
+		if !ok {
+			s = &Summary{histogram: &histogram{}}
+			total.Paths[name] = s
+		}
+		return s
+	}
+
+	ch := make(chan prometheus.Metric, 1000)
+	go func() {
+		m.RequestDuration.Collect(ch)
+		close(ch)
+	}()
+	for metric := range ch {
+		dtoMetric := &dto.Metric{}
+		if err := metric.Write(dtoMetric); err != nil {
+			continue
+		}
+		total.histogram.merge(dtoMetric.GetHistogram())
+		path(labelValue(dtoMetric, "path")).histogram.merge(dtoMetric.GetHistogram())
+	}
+
+	ch = make(chan prometheus.Metric, 1000)
+	go func() {
+		m.RequestCounter.Collect(ch)
+		close(ch)
+	}()
+	for metric := range ch {
+		dtoMetric := &dto.Metric{}
+		if err := metric.Write(dtoMetric); err != nil {
+			continue
+		}
+		value := dtoMetric.GetCounter().GetValue()
+		status, _ := strconv.Atoi(labelValue(dtoMetric, "status"))
+		p := path(labelValue(dtoMetric, "path"))
+		total.Requests += value
+		p.Requests += value
+		if status >= 500 {
+			total.Errors += value
+			p.Errors += value
+		}
+	}
+
+	total.finish()
+	return total
+}
+
+// RegisterAdminRoutes mounts the JSON metrics snapshot
+func (m *MetricsCollector) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/metrics", func(c *fiber.Ctx) error {
+		body, err := m.GetMetricsJSON()
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(body)
+	})
+}
+
+// round keeps JSON snapshots readable
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
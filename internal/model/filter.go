@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// LogFilter narrows down log queries. Zero values are ignored.
+type LogFilter struct {
+	TenantID    string
+	TraceID     string
+	ProcessType ProcessType
+	Method      string
+	PathPrefix  string
+	StatusCode  int
+	From        time.Time
+	To          time.Time
+	Limit       int
+	Offset      int
+}
+
+// DefaultLogLimit caps queries that do not set an explicit limit
+const DefaultLogLimit = 1000
+
+// EffectiveLimit returns the limit to apply to a query
+func (f LogFilter) EffectiveLimit() int {
+	if f.Limit <= 0 {
+		return DefaultLogLimit
+	}
+	return f.Limit
+}
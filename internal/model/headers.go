@@ -0,0 +1,86 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Headers holds every value of each header in the order received, e.g. one
+// per Set-Cookie
+type Headers map[string][]string
+
+// Get returns the first value of a header, matching its name in any case
+func (h Headers) Get(name string) string {
+	if v := h[name]; len(v) > 0 {
+		return v[0]
+	}
+	name = http.CanonicalHeaderKey(name)
+	for k, v := range h {
+		if http.CanonicalHeaderKey(k) == name && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// UnmarshalJSON reads values as lists, or as single strings as in logs
+// stored before headers kept all their values
+func (h *Headers) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*h = nil
+		return nil
+	}
+	headers := make(Headers, len(raw))
+	for k, v := range raw {
+		var single string
+		if err := json.Unmarshal(v, &single); err == nil {
+			headers[k] = []string{single}
+			continue
+		}
+		var values []string
+		if err := json.Unmarshal(v, &values); err != nil {
+			return fmt.Errorf("invalid values of header %s: %v", k, err)
+		}
+		headers[k] = values
+	}
+	*h = headers
+	return nil
+}
+
+// UnmarshalBSONValue reads documents stored either way, as UnmarshalJSON
+func (h *Headers) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		*h = nil
+		return nil
+	case bsontype.EmbeddedDocument:
+	default:
+		return fmt.Errorf("cannot decode %s into headers", t)
+	}
+	elements, err := bson.Raw(data).Elements()
+	if err != nil {
+		return err
+	}
+	headers := make(Headers, len(elements))
+	for _, e := range elements {
+		if single, ok := e.Value().StringValueOK(); ok {
+			headers[e.Key()] = []string{single}
+			continue
+		}
+		var values []string
+		if err := e.Value().Unmarshal(&values); err != nil {
+			return fmt.Errorf("invalid values of header %s: %v", e.Key(), err)
+		}
+		headers[e.Key()] = values
+	}
+	*h = headers
+	return nil
+}
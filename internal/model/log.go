@@ -7,6 +7,8 @@ type ProcessType string
 const (
 	ProcessTypeRequest  ProcessType = "request"
 	ProcessTypeResponse ProcessType = "response"
+	// Audit events, e.g. an upstream credential rotation
+	ProcessTypeAudit ProcessType = "audit"
 )
 
 type Log struct {
@@ -19,7 +21,7 @@ type Log struct {
 	Path          string                 `json:"path"`
 	PathParams    map[string]string      `json:"path_params,omitempty"`
 	QueryParams   map[string]string      `json:"query_params,omitempty"`
-	Headers       map[string]string      `json:"headers"`
+	Headers       Headers                `json:"headers"`
 	Body          []byte                 `json:"body,omitempty"`
 	ClientIP      string                 `json:"client_ip"`
 	UserAgent     string                 `json:"user_agent"`
@@ -28,4 +30,5 @@ type Log struct {
 	ContentLength int64                  `json:"content_length,omitempty"`
 	Error         string                 `json:"error,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	TenantID      string                 `json:"tenant_id,omitempty"`
 }
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// RateLimitEvent records one request rejected by the rate limiter
+type RateLimitEvent struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Rule      string    `json:"rule"` // Limit that rejected the request, e.g. ip, route:api_v1 or tenant_quota
+	Key       string    `json:"key"`  // Counter key of the limit
+	ClientIP  string    `json:"client_ip"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Count     int       `json:"count"` // Requests counted in the window when the request was rejected
+}
+
+// RateLimitEventFilter narrows down rate limit event queries. Zero values
+// are ignored.
+type RateLimitEventFilter struct {
+	Rule     string
+	Key      string
+	ClientIP string
+	TenantID string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// EffectiveLimit returns the limit to apply to a query
+func (f RateLimitEventFilter) EffectiveLimit() int {
+	if f.Limit <= 0 {
+		return DefaultLogLimit
+	}
+	return f.Limit
+}
+
+// Rate limit event aggregation dimensions
+const (
+	RateLimitByRule     = "rule"
+	RateLimitByKey      = "key"
+	RateLimitByClientIP = "client_ip"
+	RateLimitByTenant   = "tenant_id"
+	RateLimitByPath     = "path"
+)
+
+// RateLimitAggregate summarises the events sharing one value of the grouped
+// dimension
+type RateLimitAggregate struct {
+	Value    string    `json:"value"`
+	Events   int64     `json:"events"`
+	MaxCount int       `json:"max_count"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Rollup is the per-minute traffic summary of one route and status code as
+// seen by one proxy instance. Latencies are in milliseconds.
+type Rollup struct {
+	Minute     time.Time `json:"minute"`
+	Instance   string    `json:"instance"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code"`
+	Count      int64     `json:"count"`
+	ErrorCount int64     `json:"error_count"`
+	P50        float64   `json:"p50_ms"`
+	P95        float64   `json:"p95_ms"`
+	P99        float64   `json:"p99_ms"`
+}
+
+// RollupFilter narrows down rollup queries. Zero values are ignored.
+type RollupFilter struct {
+	Method     string
+	PathPrefix string
+	StatusCode int
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// EffectiveLimit returns the limit to apply to a query
+func (f RollupFilter) EffectiveLimit() int {
+	if f.Limit <= 0 {
+		return DefaultLogLimit
+	}
+	return f.Limit
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// TenantRecord is a tenant provisioned at runtime. Spec holds its settings as
+// JSON.
+type TenantRecord struct {
+	ID        string    `json:"id"`
+	Spec      []byte    `json:"spec"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// TenantLimits overrides the configured rate limit and quota of a tenant
+type TenantLimits struct {
+	Tenant     string        `json:"tenant"`
+	Requests   int           `json:"requests"`
+	Window     time.Duration `json:"window"`
+	Burst      int           `json:"burst"`
+	DailyQuota int           `json:"daily_quota"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
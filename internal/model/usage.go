@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Usage is the traffic of one tenant during one hour
+type Usage struct {
+	Hour     time.Time `json:"hour"`
+	Tenant   string    `json:"tenant"`
+	Requests int64     `json:"requests"`
+	Errors   int64     `json:"errors"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+}
+
+// ErrorRate returns the share of failed requests
+func (u *Usage) ErrorRate() float64 {
+	if u.Requests == 0 {
+		return 0
+	}
+	return float64(u.Errors) / float64(u.Requests)
+}
+
+// UsageFilter narrows down usage queries. Zero values are ignored.
+type UsageFilter struct {
+	Tenant string
+	From   time.Time
+	To     time.Time
+}
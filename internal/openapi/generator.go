@@ -0,0 +1,327 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tuncerburak97/muhtar/internal/model"
+)
+
+// Document is a draft OpenAPI 3 document inferred from traffic
+type Document struct {
+	OpenAPI string                           `json:"openapi"`
+	Info    Info                             `json:"info"`
+	Paths   map[string]map[string]*Operation `json:"paths"`
+}
+
+// Info holds the document metadata
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation describes a single method on a path
+type Operation struct {
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *Body                `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Samples     int                  `json:"x-observed-samples"`
+}
+
+// Parameter describes a path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// Body describes a request body
+type Body struct {
+	Content map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response for a status code
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body for a content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON schema inferred from observed bodies
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+}
+
+var (
+	uuidPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericPattern = regexp.MustCompile(`^[0-9]+$`)
+	hexIDPattern   = regexp.MustCompile(`^[0-9a-fA-F]{24,}$`)
+)
+
+// Generate builds a draft document from request/response log pairs
+func Generate(title string, logs []*model.Log) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       title,
+			Version:     "0.0.0-observed",
+			Description: "Draft generated from traffic observed by muhtar",
+		},
+		Paths: make(map[string]map[string]*Operation),
+	}
+
+	requests := make(map[string]*model.Log)
+	var responses []*model.Log
+	for _, entry := range logs {
+		switch entry.ProcessType {
+		case model.ProcessTypeRequest:
+			requests[entry.TraceID] = entry
+		case model.ProcessTypeResponse:
+			responses = append(responses, entry)
+		}
+	}
+
+	for _, req := range requests {
+		op, params := doc.operation(req.Method, req.Path)
+		op.Samples++
+		mergeParameters(op, params, req.URL)
+
+		if schema := inferBody(req.Body); schema != nil {
+			if op.RequestBody == nil {
+				op.RequestBody = &Body{Content: map[string]*MediaType{}}
+			}
+			addContent(op.RequestBody.Content, contentType(req.Headers), schema)
+		}
+	}
+
+	for _, resp := range responses {
+		op, _ := doc.operation(resp.Method, resp.Path)
+		status := strconv.Itoa(resp.StatusCode)
+		r, ok := op.Responses[status]
+		if !ok {
+			r = &Response{Description: "Observed " + status + " response"}
+			op.Responses[status] = r
+		}
+		if schema := inferBody(resp.Body); schema != nil {
+			if r.Content == nil {
+				r.Content = map[string]*MediaType{}
+			}
+			addContent(r.Content, contentType(resp.Headers), schema)
+		}
+	}
+
+	return doc
+}
+
+// operation returns the operation for the templated path, creating it on first use
+func (d *Document) operation(method, path string) (*Operation, []*Parameter) {
+	template, params := templatePath(path)
+	methods, ok := d.Paths[template]
+	if !ok {
+		methods = make(map[string]*Operation)
+		d.Paths[template] = methods
+	}
+
+	method = strings.ToLower(method)
+	op, ok := methods[method]
+	if !ok {
+		op = &Operation{Responses: make(map[string]*Response)}
+		methods[method] = op
+	}
+	return op, params
+}
+
+// TemplatePath returns the path with identifier-like segments replaced by
+// parameter placeholders, e.g. /users/42 becomes /users/{id}
+func TemplatePath(path string) string {
+	templated, _ := templatePath(path)
+	return templated
+}
+
+// templatePath replaces identifier-like segments with path parameters
+func templatePath(path string) (string, []*Parameter) {
+	segments := strings.Split(path, "/")
+	var params []*Parameter
+	for i, segment := range segments {
+		var format, typ string
+		switch {
+		case uuidPattern.MatchString(segment):
+			typ, format = "string", "uuid"
+		case numericPattern.MatchString(segment):
+			typ = "integer"
+		case hexIDPattern.MatchString(segment):
+			typ = "string"
+		default:
+			continue
+		}
+
+		name := "id"
+		if len(params) > 0 {
+			name = "id" + strconv.Itoa(len(params)+1)
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, &Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: typ, Format: format},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func mergeParameters(op *Operation, pathParams []*Parameter, rawURL string) {
+	existing := make(map[string]bool)
+	for _, p := range op.Parameters {
+		existing[p.In+":"+p.Name] = true
+	}
+
+	for _, p := range pathParams {
+		if !existing["path:"+p.Name] {
+			op.Parameters = append(op.Parameters, p)
+			existing["path:"+p.Name] = true
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	names := make([]string, 0)
+	for name := range u.Query() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if existing["query:"+name] {
+			continue
+		}
+		existing["query:"+name] = true
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:   name,
+			In:     "query",
+			Schema: inferScalar(u.Query().Get(name)),
+		})
+	}
+}
+
+func contentType(headers model.Headers) string {
+	if v := headers.Get("Content-Type"); v != "" {
+		mediaType, _, _ := strings.Cut(v, ";")
+		return strings.TrimSpace(mediaType)
+	}
+	return "application/json"
+}
+
+func addContent(content map[string]*MediaType, mediaType string, schema *Schema) {
+	if existing, ok := content[mediaType]; ok {
+		existing.Schema = merge(existing.Schema, schema)
+		return
+	}
+	content[mediaType] = &MediaType{Schema: schema}
+}
+
+func inferBody(body []byte) *Schema {
+	if len(body) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return &Schema{Type: "string"}
+	}
+	return infer(v)
+}
+
+func infer(v interface{}) *Schema {
+	switch val := v.(type) {
+	case nil:
+		return &Schema{Nullable: true}
+	case bool:
+		return &Schema{Type: "boolean"}
+	case float64:
+		if val == float64(int64(val)) {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	case string:
+		return inferScalar(val)
+	case []interface{}:
+		s := &Schema{Type: "array"}
+		for _, item := range val {
+			s.Items = merge(s.Items, infer(item))
+		}
+		return s
+	case map[string]interface{}:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema, len(val))}
+		for k, item := range val {
+			s.Properties[k] = infer(item)
+		}
+		return s
+	}
+	return &Schema{}
+}
+
+func inferScalar(v string) *Schema {
+	switch {
+	case uuidPattern.MatchString(v):
+		return &Schema{Type: "string", Format: "uuid"}
+	case numericPattern.MatchString(v):
+		return &Schema{Type: "integer"}
+	case v == "true" || v == "false":
+		return &Schema{Type: "boolean"}
+	}
+	return &Schema{Type: "string"}
+}
+
+// merge widens a schema so it accepts both observed samples
+func merge(a, b *Schema) *Schema {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	out := &Schema{Type: a.Type, Format: a.Format, Nullable: a.Nullable || b.Nullable}
+	switch {
+	case a.Type == "":
+		out.Type, out.Format = b.Type, b.Format
+	case b.Type == "" || a.Type == b.Type:
+	case (a.Type == "integer" && b.Type == "number") || (a.Type == "number" && b.Type == "integer"):
+		out.Type = "number"
+	default:
+		// Conflicting types cannot be expressed without oneOf, leave it open
+		out.Type = ""
+	}
+	if a.Format != b.Format && b.Type != "" {
+		out.Format = ""
+	}
+
+	if a.Items != nil || b.Items != nil {
+		out.Items = merge(a.Items, b.Items)
+	}
+	if a.Properties != nil || b.Properties != nil {
+		out.Properties = make(map[string]*Schema)
+		for k, v := range a.Properties {
+			out.Properties[k] = v
+		}
+		for k, v := range b.Properties {
+			out.Properties[k] = merge(out.Properties[k], v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package openapi
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+)
+
+// Handler serves OpenAPI drafts generated from the log repository
+type Handler struct {
+	repo repository.LogRepository
+}
+
+// NewHandler creates a new OpenAPI generation handler
+func NewHandler(repo repository.LogRepository) *Handler {
+	return &Handler{repo: repo}
+}
+
+// RegisterAdminRoutes mounts the OpenAPI generation endpoint
+func (h *Handler) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/openapi", h.handleGenerate)
+}
+
+func (h *Handler) handleGenerate(c *fiber.Ctx) error {
+	filter := model.LogFilter{
+		TenantID:   c.Query("tenant"),
+		PathPrefix: c.Query("path_prefix"),
+		Method:     c.Query("method"),
+		Limit:      c.QueryInt("limit", 5000),
+	}
+
+	since, err := time.ParseDuration(c.Query("since", "24h"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid since duration")
+	}
+	filter.From = time.Now().Add(-since)
+
+	logs, err := h.repo.FindLogs(c.Context(), filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+
+	title := c.Query("title", "Observed API")
+	return c.JSON(Generate(title, logs))
+}
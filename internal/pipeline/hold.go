@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+const holdsKey = "muhtar.pipeline.holds"
+
+// hold is a resource a stage keeps until the response is sent
+type hold struct {
+	release  func()
+	detached bool
+}
+
+// Hold keeps a resource of a stage, such as a concurrency slot, until the
+// response is sent. The stage defers the returned function, which releases
+// the resource unless a handler streaming the response took it over.
+func Hold(c *fiber.Ctx, release func()) func() {
+	h := &hold{release: release}
+	holds, _ := c.Locals(holdsKey).([]*hold)
+	c.Locals(holdsKey, append(holds, h))
+	return func() {
+		if !h.detached {
+			h.release()
+		}
+	}
+}
+
+// Detach hands the resources held by the stages over to a handler whose
+// response outlives it, such as a body stream. The returned function must
+// be called once the response is sent.
+func Detach(c *fiber.Ctx) func() {
+	holds, _ := c.Locals(holdsKey).([]*hold)
+	c.Locals(holdsKey, nil)
+	for _, h := range holds {
+		h.detached = true
+	}
+	return func() {
+		for i := len(holds) - 1; i >= 0; i-- {
+			holds[i].release()
+		}
+	}
+}
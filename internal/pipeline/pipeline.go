@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Names of the built in stages
+const (
+	StageCorrelation = "correlation"
+	StageAlerts      = "alerts"
+	StageAnomalies   = "anomalies"
+	StageStats       = "stats"
+	StageTenant      = "tenant"
+	StageRateLimit   = "ratelimit"
+	StageQoS         = "qos"
+)
+
+// Stage is one step of the request pipeline. Calling next runs the following
+// stages and the proxy, returning without calling it ends the request.
+type Stage func(c *fiber.Ctx, next func() error) error
+
+// Handler adapts a stage to a fiber middleware
+func Handler(s Stage) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return s(c, c.Next)
+	}
+}
+
+// RouteMatcher returns the index of the route matching a request in the
+// configured route list, -1 when none does
+type RouteMatcher func(c *fiber.Ctx) int
+
+// Pipeline runs the registered stages in the configured order before the
+// final handler. Routes may reorder or skip stages.
+type Pipeline struct {
+	config config.PipelineConfig
+	names  []string
+	stages map[string]Stage
+}
+
+// New creates an empty pipeline
+func New(cfg *config.PipelineConfig) *Pipeline {
+	return &Pipeline{
+		config: *cfg,
+		stages: make(map[string]Stage),
+	}
+}
+
+// Register adds a stage. Without a configured order stages run in
+// registration order.
+func (p *Pipeline) Register(name string, s Stage) error {
+	if name == "" || s == nil {
+		return fmt.Errorf("pipeline stage needs a name and a handler")
+	}
+	if _, ok := p.stages[name]; ok {
+		return fmt.Errorf("pipeline stage %s already registered", name)
+	}
+	p.names = append(p.names, name)
+	p.stages[name] = s
+	return nil
+}
+
+// Names returns the registered stages in registration order
+func (p *Pipeline) Names() []string {
+	return append([]string(nil), p.names...)
+}
+
+// Handler builds the chains of the routes and returns the handler running
+// them. Routes are matched on the path as received, before any stage
+// rewrites it.
+func (p *Pipeline) Handler(final fiber.Handler, routes []config.RouteConfig, match RouteMatcher) fiber.Handler {
+	base := p.config.Stages
+	if len(base) == 0 {
+		base = p.names
+	}
+	defaultChain := p.chain(base, p.config.Disable, "")
+
+	chains := make([][]Stage, len(routes))
+	for i, rc := range routes {
+		if len(rc.Stages) == 0 && len(rc.DisableStages) == 0 {
+			chains[i] = defaultChain
+			continue
+		}
+		name := rc.Name
+		if name == "" {
+			name = rc.Path
+		}
+		if len(rc.Stages) > 0 {
+			// An explicit route order also enables globally disabled stages
+			chains[i] = p.chain(rc.Stages, rc.DisableStages, name)
+		} else {
+			chains[i] = p.chain(base, append(append([]string(nil), p.config.Disable...), rc.DisableStages...), name)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		chain := defaultChain
+		if match != nil {
+			if i := match(c); i >= 0 && i < len(chains) {
+				chain = chains[i]
+			}
+		}
+		return run(c, chain, final)
+	}
+}
+
+// chain resolves stage names, skipping disabled and unregistered ones. A
+// stage configured but not registered belongs to a disabled module.
+func (p *Pipeline) chain(order, disable []string, route string) []Stage {
+	skip := make(map[string]bool, len(disable))
+	for _, name := range disable {
+		skip[name] = true
+	}
+
+	chain := make([]Stage, 0, len(order))
+	seen := make(map[string]bool, len(order))
+	for _, name := range order {
+		if skip[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+		s, ok := p.stages[name]
+		if !ok {
+			log.Warn().Str("stage", name).Str("route", route).Msg("Pipeline stage not registered, skipping")
+			continue
+		}
+		chain = append(chain, s)
+	}
+	return chain
+}
+
+func run(c *fiber.Ctx, chain []Stage, final fiber.Handler) error {
+	i := 0
+	var next func() error
+	next = func() error {
+		if i == len(chain) {
+			return final(c)
+		}
+		s := chain[i]
+		i++
+		return s(c, next)
+	}
+	return next()
+}
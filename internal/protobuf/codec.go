@@ -0,0 +1,152 @@
+package protobuf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Registry resolves message types from descriptor set files, as written by
+// protoc --descriptor_set_out --include_imports. Files are loaded once.
+type Registry struct {
+	files map[string]*protoregistry.Files
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{files: make(map[string]*protoregistry.Files)}
+}
+
+// Decoder returns the decoder of a fully qualified message, looked up in the
+// given descriptor set files
+func (r *Registry) Decoder(descriptors []string, message string) (*Decoder, error) {
+	for _, path := range descriptors {
+		files, err := r.load(path)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := files.FindDescriptorByName(protoreflect.FullName(message))
+		if err != nil {
+			continue
+		}
+		md, ok := desc.(protoreflect.MessageDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a message", message)
+		}
+		return &Decoder{desc: md}, nil
+	}
+	return nil, fmt.Errorf("message %s not found in descriptors", message)
+}
+
+func (r *Registry) load(path string) (*protoregistry.Files, error) {
+	if files, ok := r.files[path]; ok {
+		return files, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set %s: %v", path, err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %v", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %v", path, err)
+	}
+	r.files[path] = files
+	return files, nil
+}
+
+// Decoder turns binary bodies of one message type into JSON
+type Decoder struct {
+	desc protoreflect.MessageDescriptor
+}
+
+// Name returns the fully qualified message name
+func (d *Decoder) Name() string {
+	return string(d.desc.FullName())
+}
+
+// Applies reports whether a content type carries protobuf or gRPC messages
+func Applies(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf",
+		"application/grpc", "application/grpc+proto":
+		return true
+	}
+	return false
+}
+
+// ToJSON decodes a body of the given content type. gRPC bodies are length
+// prefixed frames, a single message decodes to an object and a stream to an
+// array.
+func (d *Decoder) ToJSON(contentType string, body []byte) ([]byte, error) {
+	if !strings.HasPrefix(contentType, "application/grpc") {
+		return d.message(body)
+	}
+
+	var messages []json.RawMessage
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, fmt.Errorf("truncated grpc frame")
+		}
+		if body[0] != 0 {
+			return nil, fmt.Errorf("compressed grpc messages are not decoded")
+		}
+		size := binary.BigEndian.Uint32(body[1:5])
+		if uint64(len(body)-5) < uint64(size) {
+			return nil, fmt.Errorf("truncated grpc frame")
+		}
+		js, err := d.message(body[5 : 5+size])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, js)
+		body = body[5+size:]
+	}
+	if len(messages) == 1 {
+		return messages[0], nil
+	}
+	return json.Marshal(messages)
+}
+
+// Decode returns the body as a JSON value for transform scripts, reporting
+// false when the content type is not protobuf or the body does not decode
+func (d *Decoder) Decode(contentType string, body []byte) (interface{}, bool) {
+	if !Applies(contentType) {
+		return nil, false
+	}
+	js, err := d.ToJSON(contentType, body)
+	if err != nil {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal(js, &v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func (d *Decoder) message(raw []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(d.desc)
+	if err := proto.Unmarshal(raw, msg); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %v", d.Name(), err)
+	}
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+}
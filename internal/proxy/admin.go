@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type splitWeight struct {
+	Name       string `json:"name"`
+	Target     string `json:"target"`
+	Weight     int64  `json:"weight"`
+	WeightFlag string `json:"weight_flag,omitempty"`
+}
+
+type targetStatus struct {
+	Target  string `json:"target"`
+	Healthy bool   `json:"healthy"`
+}
+
+type outlierStatus struct {
+	Target       string     `json:"target"`
+	Failures     int64      `json:"consecutive_failures"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+}
+
+type splitRequest struct {
+	Route   string         `json:"route"`
+	Weights map[string]int `json:"weights"`
+}
+
+// RegisterAdminRoutes mounts the endpoints controlling the routes at runtime
+func (h *ProxyHandler) RegisterAdminRoutes(r fiber.Router) {
+	g := r.Group("/routes")
+	g.Get("/splits", h.handleSplits)
+	g.Put("/splits", h.handleSetSplit)
+	g.Get("/health", h.handleHealth)
+	g.Get("/outliers", h.handleOutliers)
+	r.Get("/upstreams/breakers", h.handleBreakers)
+}
+
+func (h *ProxyHandler) handleSplits(c *fiber.Ctx) error {
+	splits := make(map[string][]splitWeight)
+	for _, rt := range h.routes {
+		if rt.split == nil {
+			continue
+		}
+		weights := make([]splitWeight, 0, len(rt.split.targets))
+		for _, t := range rt.split.targets {
+			weights = append(weights, splitWeight{Name: t.name, Target: t.target, Weight: t.weight.Load(), WeightFlag: t.flag})
+		}
+		splits[rt.config.Name] = weights
+	}
+	return c.JSON(splits)
+}
+
+// handleSetSplit changes the weights of a split route, e.g. to widen a canary
+func (h *ProxyHandler) handleSetSplit(c *fiber.Ctx) error {
+	var req splitRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	for _, rt := range h.routes {
+		if rt.config.Name != req.Route || rt.split == nil {
+			continue
+		}
+		if err := rt.split.setWeights(req.Weights); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		h.logger.Info().Str("route", req.Route).Interface("weights", req.Weights).Msg("Split weights changed")
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	return fiber.NewError(fiber.StatusNotFound, "unknown split route")
+}
+
+// handleHealth lists the health checked targets of each route
+func (h *ProxyHandler) handleHealth(c *fiber.Ctx) error {
+	health := make(map[string][]targetStatus)
+	for _, rt := range h.routes {
+		if rt.health == nil {
+			continue
+		}
+		checked := rt.health.list()
+		targets := make([]targetStatus, 0, len(checked))
+		for _, t := range checked {
+			targets = append(targets, targetStatus{Target: t.target, Healthy: t.up()})
+		}
+		health[rt.config.Name] = targets
+	}
+	return c.JSON(health)
+}
+
+// handleOutliers lists the failure streaks and ejections of each route
+func (h *ProxyHandler) handleOutliers(c *fiber.Ctx) error {
+	outliers := make(map[string][]outlierStatus)
+	for _, rt := range h.routes {
+		if rt.outliers == nil {
+			continue
+		}
+		tracked := rt.outliers.list()
+		targets := make([]outlierStatus, 0, len(tracked))
+		for _, o := range tracked {
+			status := outlierStatus{Target: o.target, Failures: o.failures.Load()}
+			if o.ejected() {
+				until := time.Unix(0, o.ejectedUntil.Load())
+				status.EjectedUntil = &until
+			}
+			targets = append(targets, status)
+		}
+		outliers[rt.config.Name] = targets
+	}
+	return c.JSON(outliers)
+}
+
+// handleBreakers lists the circuit breaker state of each upstream host
+func (h *ProxyHandler) handleBreakers(c *fiber.Ctx) error {
+	if h.breakers == nil {
+		return c.JSON(map[string]string{})
+	}
+	return c.JSON(h.breakers.states())
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Load balancing strategies
+const (
+	BalanceRoundRobin       = "round_robin"
+	BalanceLeastConnections = "least_connections"
+	BalanceConsistentHash   = "consistent_hash"
+)
+
+// Session affinity sources
+const (
+	StickyCookie = "cookie"
+	StickyHeader = "header"
+	StickyIP     = "ip"
+)
+
+// replica is one upstream of a balanced route
+type replica struct {
+	target  string
+	active  atomic.Int64   // Requests in flight
+	health  *targetHealth  // Nil without health checks
+	outlier *targetOutlier // Nil without outlier detection
+	added   int64          // Unix nanoseconds when discovered, 0 for configured targets
+}
+
+// acquire counts a request sent to the replica until release
+func (r *replica) acquire() {
+	r.active.Add(1)
+}
+
+func (r *replica) release() {
+	r.active.Add(-1)
+}
+
+// available reports whether the replica is in rotation
+func (r *replica) available() bool {
+	return r.health.up() && !r.outlier.ejected()
+}
+
+// balancer spreads the requests of a route over its replicas
+type balancer struct {
+	strategy  string
+	slowStart time.Duration // Ramp-up window of replicas back in rotation
+	next      atomic.Uint64
+
+	mu       sync.RWMutex
+	replicas []*replica // Replaced, never modified, when discovery updates it
+	ring     hashRing   // Of the replicas, consistent_hash only
+}
+
+func newBalancer(targets []string, strategy string) (*balancer, error) {
+	switch strategy {
+	case "":
+		strategy = BalanceRoundRobin
+	case BalanceRoundRobin, BalanceLeastConnections, BalanceConsistentHash:
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %s", strategy)
+	}
+
+	b := &balancer{strategy: strategy}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid target %s", target)
+		}
+		b.replicas = append(b.replicas, &replica{target: strings.TrimSuffix(target, "/")})
+	}
+	if strategy == BalanceConsistentHash {
+		b.ring = newHashRing(b.replicas)
+	}
+	return b, nil
+}
+
+// list returns the replicas in rotation
+func (b *balancer) list() []*replica {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.replicas
+}
+
+// update replaces the replicas with those of targets. Replicas of targets
+// kept keep their state, added and removed are called for the others.
+func (b *balancer) update(targets []string, added, removed func(*replica)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := make(map[string]*replica, len(b.replicas))
+	for _, r := range b.replicas {
+		current[r.target] = r
+	}
+	replicas := make([]*replica, 0, len(targets))
+	for _, target := range targets {
+		target = strings.TrimSuffix(target, "/")
+		r := current[target]
+		if r == nil {
+			r = &replica{target: target, added: time.Now().UnixNano()}
+			added(r)
+		}
+		delete(current, target)
+		replicas = append(replicas, r)
+	}
+	for _, r := range current {
+		removed(r)
+	}
+	b.replicas = replicas
+	if b.strategy == BalanceConsistentHash {
+		b.ring = newHashRing(replicas)
+	}
+}
+
+// pick returns the replica of the next request. Unhealthy and ejected
+// replicas are skipped unless none is left, an upstream answering errors
+// beats none. It returns nil when discovery found no replica yet.
+func (b *balancer) pick() *replica {
+	if r := b.pickFrom(func(r *replica) bool { return !r.available() }); r != nil {
+		return r
+	}
+	return b.pickFrom(func(*replica) bool { return false })
+}
+
+// pickOther returns an available replica not used yet, nil when none is
+func (b *balancer) pickOther(used map[*replica]bool) *replica {
+	return b.pickFrom(func(r *replica) bool { return used[r] || !r.available() })
+}
+
+func (b *balancer) pickFrom(skip func(*replica) bool) *replica {
+	replicas := b.list()
+	if len(replicas) == 0 {
+		return nil
+	}
+	n := b.next.Add(1) - 1
+	start := int(n % uint64(len(replicas)))
+
+	// Scanning from a rotating start spreads round robin over the healthy
+	// replicas, and least connections ties instead of piling on the first
+	var best, ramping *replica
+	bestLoad := 0.0
+	for i := 0; i < len(replicas); i++ {
+		r := replicas[(start+i)%len(replicas)]
+		if skip(r) {
+			continue
+		}
+		share := r.ramp(b.slowStart)
+		if b.strategy != BalanceLeastConnections {
+			// A replica ramping up takes its turn only for its share
+			if share < 1 && rand.Float64() >= share {
+				if ramping == nil {
+					ramping = r
+				}
+				continue
+			}
+			return r
+		}
+		// Least connections weighs the load of a ramping replica up
+		load := float64(r.active.Load()+1) / share
+		if best == nil || load < bestLoad {
+			best, bestLoad = r, load
+		}
+	}
+	if best == nil {
+		return ramping
+	}
+	return best
+}
+
+// pickKey returns the replica a session key is pinned to. Sessions of a
+// replica out of rotation move to the next available one, requests without
+// a key are balanced.
+func (b *balancer) pickKey(key string) *replica {
+	if key != "" && b.strategy == BalanceConsistentHash {
+		b.mu.RLock()
+		ring := b.ring
+		b.mu.RUnlock()
+		return ring.lookup(key)
+	}
+	replicas := b.list()
+	if key == "" || len(replicas) == 0 {
+		return b.pick()
+	}
+	start := int(hashKey(key) % uint32(len(replicas)))
+	for i := 0; i < len(replicas); i++ {
+		if r := replicas[(start+i)%len(replicas)]; r.available() {
+			return r
+		}
+	}
+	return replicas[start]
+}
+
+func validateSticky(cfg config.StickyConfig) error {
+	switch cfg.Source {
+	case "", StickyIP:
+		return nil
+	case StickyCookie, StickyHeader:
+		if cfg.Name == "" {
+			return fmt.Errorf("sticky %s needs a name", cfg.Source)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown sticky source %s", cfg.Source)
+}
+
+// stickyKey returns the session key of the request, empty without affinity
+// or when the request carries none
+func (r *route) stickyKey(c *fiber.Ctx) string {
+	switch r.config.Sticky.Source {
+	case StickyCookie:
+		return c.Cookies(r.config.Sticky.Name)
+	case StickyHeader:
+		return c.Get(r.config.Sticky.Name)
+	case StickyIP:
+		return c.IP()
+	}
+	return ""
+}
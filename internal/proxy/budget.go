@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Timeout budget header formats
+const (
+	BudgetFormatMillis = "ms"
+	BudgetFormatGRPC   = "grpc"
+)
+
+// DefaultBudgetHeader carries the remaining deadline when no header is configured
+const DefaultBudgetHeader = "X-Request-Timeout-Ms"
+
+// timeoutBudget tells the upstream how long the proxy will wait for it, so
+// work the client will never see can be abandoned
+type timeoutBudget struct {
+	header string
+	format string
+}
+
+func newTimeoutBudget(cfg config.TimeoutBudgetConfig) (*timeoutBudget, error) {
+	b := &timeoutBudget{header: cfg.Header, format: cfg.Format}
+	if b.header == "" {
+		b.header = DefaultBudgetHeader
+		if b.format == BudgetFormatGRPC {
+			b.header = "grpc-timeout"
+		}
+	}
+	switch b.format {
+	case "":
+		b.format = BudgetFormatMillis
+	case BudgetFormatMillis, BudgetFormatGRPC:
+	default:
+		return nil, fmt.Errorf("unknown timeout budget format %s", b.format)
+	}
+	return b, nil
+}
+
+// remaining returns the budget left of timeout since start. A smaller budget
+// sent by the client is honoured so deadlines shrink along a call chain.
+func (b *timeoutBudget) remaining(req *http.Request, start time.Time, timeout time.Duration) time.Duration {
+	left := timeout - time.Since(start)
+	if inbound, ok := b.parse(req.Header.Get(b.header)); ok && inbound-time.Since(start) < left {
+		left = inbound - time.Since(start)
+	}
+	return left
+}
+
+// apply sets the budget header on the upstream request
+func (b *timeoutBudget) apply(req *http.Request, left time.Duration) {
+	ms := left.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	if b.format == BudgetFormatGRPC {
+		req.Header.Set(b.header, strconv.FormatInt(ms, 10)+"m")
+		return
+	}
+	req.Header.Set(b.header, strconv.FormatInt(ms, 10))
+}
+
+// parse reads a budget header value in the configured format
+func (b *timeoutBudget) parse(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if b.format == BudgetFormatGRPC {
+		return parseGRPCTimeout(value)
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a grpc-timeout value such as 250m or 5S
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value[:len(value)-1]), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Bulkhead rejection reasons
+const (
+	bulkheadQueueFull = "queue_full"
+	bulkheadTimeout   = "timeout"
+)
+
+// bulkhead caps the requests of a route in flight upstream. Requests over
+// the cap wait in a bounded queue, in order, up to the queue timeout.
+type bulkhead struct {
+	limit    int
+	maxQueue int
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	inflight int
+	waiting  []chan struct{}
+}
+
+func newBulkhead(cfg config.BulkheadConfig) *bulkhead {
+	timeout := cfg.QueueTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &bulkhead{limit: cfg.MaxInFlight, maxQueue: cfg.MaxQueue, timeout: timeout}
+}
+
+// acquire takes a slot, waiting in the queue when none is free. It returns
+// the rejection reason when no slot was granted.
+func (b *bulkhead) acquire() (string, bool) {
+	b.mu.Lock()
+	if b.inflight < b.limit && len(b.waiting) == 0 {
+		b.inflight++
+		b.mu.Unlock()
+		return "", true
+	}
+	if len(b.waiting) >= b.maxQueue {
+		b.mu.Unlock()
+		return bulkheadQueueFull, false
+	}
+	ready := make(chan struct{})
+	b.waiting = append(b.waiting, ready)
+	b.mu.Unlock()
+
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return "", true
+	case <-timer.C:
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, w := range b.waiting {
+		if w == ready {
+			b.waiting = append(b.waiting[:i], b.waiting[i+1:]...)
+			return bulkheadTimeout, false
+		}
+	}
+	// Granted while the timer fired
+	return "", true
+}
+
+// release frees a slot and hands it to the longest waiting request
+func (b *bulkhead) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inflight--
+	for len(b.waiting) > 0 && b.inflight < b.limit {
+		ready := b.waiting[0]
+		b.waiting = b.waiting[1:]
+		b.inflight++
+		close(ready)
+	}
+}
+
+// bulkheadFull answers a request rejected by the bulkhead of its route
+func (h *ProxyHandler) bulkheadFull(c *fiber.Ctx, rt *route, reason, traceID string) error {
+	h.metrics.IncBulkheadRejected(rt.config.Name, reason)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(rt.bulkhead.timeout.Seconds()))))
+	if h.errorPages != nil {
+		return h.errorPages.Render(c, ErrorBulkheadFull, traceID)
+	}
+	return fiber.NewError(fiber.StatusServiceUnavailable, errorKinds[ErrorBulkheadFull].message)
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/breaker"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// breakerOpenError is returned instead of calling an upstream whose breaker
+// is open
+type breakerOpenError struct {
+	upstream   string
+	retryAfter time.Duration
+}
+
+func (e *breakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s", e.upstream)
+}
+
+// breakerTransport guards the upstream calls with a circuit breaker per host,
+// failing fast while a backend keeps failing
+type breakerTransport struct {
+	next     http.RoundTripper
+	settings breaker.Settings
+	metrics  *metrics.MetricsCollector
+
+	mu       sync.Mutex
+	breakers map[string]*breaker.Breaker
+}
+
+func newBreakerTransport(next http.RoundTripper, cfg config.BreakerConfig, metrics *metrics.MetricsCollector) *breakerTransport {
+	t := &breakerTransport{
+		next:     next,
+		metrics:  metrics,
+		breakers: make(map[string]*breaker.Breaker),
+	}
+	t.settings = breaker.Settings{
+		FailureThreshold: cfg.FailureThreshold,
+		RecoveryTimeout:  cfg.RecoveryTimeout,
+		HalfOpenRequests: cfg.HalfOpenRequests,
+		OnStateChange:    t.onStateChange,
+	}
+	return t
+}
+
+// get returns the breaker of an upstream host, creating it on first use
+func (t *breakerTransport) get(host string) *breaker.Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = breaker.New("upstream:"+host, t.settings)
+		t.breakers[host] = b
+		if t.metrics != nil {
+			t.metrics.ObserveBreakerState(b.Name(), int(breaker.StateClosed))
+		}
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.get(req.URL.Host)
+	if !b.Allow() {
+		return nil, &breakerOpenError{upstream: req.URL.Host, retryAfter: b.RetryAfter()}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		// The client went away, the upstream did not fail
+		b.Ignore()
+	case err != nil || resp.StatusCode >= 500:
+		b.Failure()
+	default:
+		b.Success()
+	}
+	return resp, err
+}
+
+// states returns the state of the breaker of each upstream host
+func (t *breakerTransport) states() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	states := make(map[string]string, len(t.breakers))
+	for host, b := range t.breakers {
+		states[host] = b.State().String()
+	}
+	return states
+}
+
+func (t *breakerTransport) onStateChange(name string, from, to breaker.State) {
+	if t.metrics != nil {
+		t.metrics.ObserveBreakerState(name, int(to))
+	}
+	event := log.Warn()
+	if to == breaker.StateClosed {
+		event = log.Info()
+	}
+	event.Str("breaker", name).Str("from", from.String()).Str("to", to.String()).Msg("Circuit breaker state changed")
+}
@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/rs/zerolog"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Merge strategies of composite routes
+const (
+	MergeKeyed    = "keyed"
+	MergeDeep     = "merge"
+	MergeTemplate = "template"
+)
+
+// HeaderComposeFailed lists the optional upstreams of a composite response
+// whose call failed
+const HeaderComposeFailed = "X-Compose-Failed"
+
+// composite is a compiled ComposeConfig
+type composite struct {
+	config   config.ComposeConfig
+	template *template.Template
+}
+
+func newComposite(cfg config.ComposeConfig) (*composite, error) {
+	if cfg.Merge == "" {
+		cfg.Merge = MergeKeyed
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+
+	names := make(map[string]bool, len(cfg.Upstreams))
+	for i, u := range cfg.Upstreams {
+		if u.Name == "" {
+			return nil, fmt.Errorf("compose upstream %d has no name", i)
+		}
+		if names[u.Name] {
+			return nil, fmt.Errorf("duplicate compose upstream %s", u.Name)
+		}
+		names[u.Name] = true
+		target, err := url.Parse(u.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("invalid url for compose upstream %s: %s", u.Name, u.URL)
+		}
+	}
+
+	cp := &composite{config: cfg}
+	switch cfg.Merge {
+	case MergeKeyed, MergeDeep:
+	case MergeTemplate:
+		tmpl, err := template.New("compose").Funcs(template.FuncMap{"json": toJSON}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compose template: %v", err)
+		}
+		cp.template = tmpl
+	default:
+		return nil, fmt.Errorf("unknown compose merge strategy %s", cfg.Merge)
+	}
+	return cp, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// composePart is the result of one upstream call. Templates read the
+// exported fields.
+type composePart struct {
+	Status int
+	Body   interface{}
+	Error  string
+	err    error
+}
+
+// compose calls the upstreams of a composite route in parallel and merges
+// their responses into one. A failed required call fails the request.
+func (h *ProxyHandler) compose(cp *composite, req *http.Request, body []byte) (*http.Response, error) {
+	upstreams := cp.config.Upstreams
+	parts := make([]composePart, len(upstreams))
+	var wg sync.WaitGroup
+	for i, u := range upstreams {
+		wg.Add(1)
+		go func(i int, u config.ComposeUpstream) {
+			defer wg.Done()
+			parts[i] = h.composeCall(cp, u, req, body)
+		}(i, u)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, u := range upstreams {
+		if parts[i].err == nil {
+			continue
+		}
+		if u.Required {
+			return nil, fmt.Errorf("compose upstream %s: %w", u.Name, parts[i].err)
+		}
+		zerolog.Ctx(req.Context()).Warn().Err(parts[i].err).Str("compose_upstream", u.Name).Msg("Optional compose upstream failed")
+		failed = append(failed, u.Name)
+	}
+
+	merged, err := cp.merge(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", cp.config.ContentType)
+	if len(failed) > 0 {
+		header.Set(HeaderComposeFailed, strings.Join(failed, ","))
+	}
+	return &http.Response{
+		Status:        "200 " + http.StatusText(http.StatusOK),
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(merged)),
+		ContentLength: int64(len(merged)),
+		Request:       req,
+	}, nil
+}
+
+// composeCall sends the request to one upstream. 5xx answers count as
+// failures, other statuses merge with their body.
+func (h *ProxyHandler) composeCall(cp *composite, u config.ComposeUpstream, req *http.Request, body []byte) composePart {
+	ctx := req.Context()
+	timeout := cp.config.Timeout
+	if timeout <= 0 {
+		timeout = h.config.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	path := u.Path
+	if path == "" {
+		path = req.URL.Path
+	}
+	target := strings.TrimSuffix(u.URL, "/") + path
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	method := u.Method
+	if method == "" {
+		method = req.Method
+	}
+	var reqBody io.Reader
+	if len(body) > 0 && method != http.MethodGet && method != http.MethodHead {
+		reqBody = bytes.NewReader(body)
+	}
+
+	sub, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return failedPart(err)
+	}
+	sub.Header = req.Header.Clone()
+	// Let the transport negotiate and decode compression, the bodies are
+	// parsed before merging
+	sub.Header.Del("Accept-Encoding")
+	sub.Header.Del("Content-Length")
+
+	resp, err := h.proxy.Transport.RoundTrip(sub)
+	if err != nil {
+		return failedPart(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return failedPart(err)
+	}
+
+	part := composePart{Status: resp.StatusCode, Body: string(data)}
+	// Numbers are kept as written, large IDs would lose precision as floats
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		part.Body = v
+	}
+	if resp.StatusCode >= 500 {
+		part.err = fmt.Errorf("upstream returned %d", resp.StatusCode)
+		part.Error = part.err.Error()
+	}
+	return part
+}
+
+func failedPart(err error) composePart {
+	return composePart{Error: err.Error(), err: err}
+}
+
+// merge renders the parts with the merge strategy. Failed parts merge as
+// null bodies.
+func (cp *composite) merge(parts []composePart) ([]byte, error) {
+	switch cp.config.Merge {
+	case MergeTemplate:
+		data := make(map[string]composePart, len(parts))
+		for i, u := range cp.config.Upstreams {
+			data[u.Name] = parts[i]
+		}
+		var buf bytes.Buffer
+		if err := cp.template.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render compose template: %v", err)
+		}
+		return buf.Bytes(), nil
+	case MergeDeep:
+		merged := map[string]interface{}{}
+		for _, p := range parts {
+			if obj, ok := p.Body.(map[string]interface{}); ok && p.err == nil {
+				deepMerge(merged, obj)
+			}
+		}
+		return json.Marshal(merged)
+	}
+
+	keyed := make(map[string]interface{}, len(parts))
+	for i, u := range cp.config.Upstreams {
+		if parts[i].err != nil {
+			keyed[u.Name] = nil
+		} else {
+			keyed[u.Name] = parts[i].Body
+		}
+	}
+	return json.Marshal(keyed)
+}
+
+// deepMerge merges src into dst, nested objects are merged and other values
+// of src win
+func deepMerge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if srcObj, ok := v.(map[string]interface{}); ok {
+			if dstObj, ok := dst[k].(map[string]interface{}); ok {
+				deepMerge(dstObj, srcObj)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// defaultCompressionTypes are the media types compressed unless configured
+var defaultCompressionTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+json",
+	"image/svg+xml",
+}
+
+// compressor compresses responses the upstream sent uncompressed
+type compressor struct {
+	minSize   int
+	types     []string
+	encodings []string
+}
+
+func newCompressor(cfg config.CompressionConfig) (*compressor, error) {
+	c := &compressor{
+		minSize: cfg.MinSize,
+		types:   cfg.ContentTypes,
+	}
+	if c.minSize <= 0 {
+		c.minSize = 1024
+	}
+	if len(c.types) == 0 {
+		c.types = defaultCompressionTypes
+	}
+	encodings := cfg.Encodings
+	if len(encodings) == 0 {
+		encodings = []string{EncodingBrotli, EncodingGzip}
+	}
+	for _, coding := range encodings {
+		coding = strings.ToLower(coding)
+		if !supportedEncoding(coding) {
+			return nil, fmt.Errorf("unsupported compression encoding %s", coding)
+		}
+		c.encodings = append(c.encodings, coding)
+	}
+	return c, nil
+}
+
+// compresses reports whether a response body is worth compressing. Bodies
+// already encoded, partial or marked no-transform are left alone.
+func (c *compressor) compresses(resp *http.Response, size int) bool {
+	if size < c.minSize || resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if major, _, _ := strings.Cut(mediaType, "/"); strings.EqualFold(major, prefix) {
+				return true
+			}
+		} else if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate picks the coding the client prefers, the configured order
+// breaking ties, empty for identity
+func (c *compressor) negotiate(acceptEncoding string) string {
+	quality := acceptedEncodings(acceptEncoding)
+	best, bestQ := "", 0.0
+	for _, coding := range c.encodings {
+		if q := quality(coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
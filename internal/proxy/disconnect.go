@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// disconnectWatcher cancels the upstream request when the client closes its
+// connection while the proxy is still waiting for the upstream
+type disconnectWatcher struct {
+	conn   net.Conn
+	done   chan struct{}
+	exited chan struct{}
+	gone   atomic.Bool
+}
+
+// watchDisconnect starts watching the client connection of the request and
+// calls cancel once it is closed. It returns nil when the connection cannot
+// be watched, e.g. behind TLS.
+func watchDisconnect(c *fiber.Ctx, cancel context.CancelFunc) *disconnectWatcher {
+	conn := c.Context().Conn()
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	w := &disconnectWatcher{
+		conn:   conn,
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.exited)
+		// Waits until the connection is readable, the deadline set by stop
+		// also wakes it up
+		_ = raw.Read(func(fd uintptr) bool {
+			select {
+			case <-w.done:
+				return true
+			default:
+			}
+			closed, ready := peekClosed(fd)
+			if closed {
+				w.gone.Store(true)
+				cancel()
+			}
+			return ready
+		})
+	}()
+	return w
+}
+
+// Disconnected reports whether the client went away
+func (w *disconnectWatcher) Disconnected() bool {
+	return w != nil && w.gone.Load()
+}
+
+// stop ends the watch before the connection is handed back to the server
+func (w *disconnectWatcher) stop() {
+	if w == nil {
+		return
+	}
+	close(w.done)
+	_ = w.conn.SetReadDeadline(time.Now())
+	<-w.exited
+	// The server sets its own deadline before reading the next request
+	_ = w.conn.SetReadDeadline(time.Time{})
+}
@@ -0,0 +1,20 @@
+package proxy
+
+import "syscall"
+
+// peekClosed checks the socket without consuming data. closed is true once
+// the peer has shut the connection down, ready is false while there is
+// nothing to read yet.
+func peekClosed(fd uintptr) (closed, ready bool) {
+	var buf [1]byte
+	n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+	switch {
+	case err == syscall.EAGAIN || err == syscall.EINTR:
+		return false, false
+	case err != nil:
+		return true, true
+	default:
+		// Pipelined data means the client is still there
+		return n == 0, true
+	}
+}
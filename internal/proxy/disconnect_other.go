@@ -0,0 +1,9 @@
+//go:build !linux
+
+package proxy
+
+// peekClosed is only implemented on Linux, elsewhere disconnects are noticed
+// when the response is written
+func peekClosed(fd uintptr) (closed, ready bool) {
+	return false, true
+}
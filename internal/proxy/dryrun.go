@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// HeaderDryRun marks responses produced by the dry-run stub
+const HeaderDryRun = "X-Muhtar-Dry-Run"
+
+// DryRun short-circuits upstream calls with a configured stub response while
+// the rest of the pipeline (rate limiting, transforms, logging) still runs
+type DryRun struct {
+	mu      sync.RWMutex
+	enabled bool
+	config  config.DryRunConfig
+}
+
+// NewDryRun creates a new dry-run controller
+func NewDryRun(cfg config.DryRunConfig) *DryRun {
+	if cfg.StatusCode == 0 {
+		cfg.StatusCode = http.StatusOK
+	}
+	return &DryRun{enabled: cfg.Enabled, config: cfg}
+}
+
+// Active reports whether the given path must be answered by the stub
+func (d *DryRun) Active(path string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.enabled {
+		return false
+	}
+	if len(d.config.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range d.config.Paths {
+		if pathMatch(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Response builds the stub response for the given upstream request
+func (d *DryRun) Response(req *http.Request) *http.Response {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	header := make(http.Header)
+	for k, v := range d.config.Headers {
+		header.Set(k, v)
+	}
+	header.Set(HeaderDryRun, "true")
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+
+	body := []byte(d.config.Body)
+	return &http.Response{
+		Status:        strconv.Itoa(d.config.StatusCode) + " " + http.StatusText(d.config.StatusCode),
+		StatusCode:    d.config.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// RegisterAdminRoutes mounts the dry-run control endpoints
+func (d *DryRun) RegisterAdminRoutes(r fiber.Router) {
+	g := r.Group("/dry-run")
+	g.Get("/", func(c *fiber.Ctx) error {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return c.JSON(fiber.Map{
+			"enabled":     d.enabled,
+			"paths":       d.config.Paths,
+			"status_code": d.config.StatusCode,
+		})
+	})
+	g.Post("/enable", d.handleToggle(true))
+	g.Post("/disable", d.handleToggle(false))
+}
+
+func (d *DryRun) handleToggle(enabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		d.mu.Lock()
+		d.enabled = enabled
+		d.mu.Unlock()
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings handled by the proxy
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+)
+
+// supportedEncoding reports whether a Content-Encoding value is a single
+// coding the proxy can decode. Stacked codings are passed through untouched.
+func supportedEncoding(encoding string) bool {
+	switch encoding {
+	case EncodingGzip, EncodingDeflate, EncodingBrotli:
+		return true
+	}
+	return false
+}
+
+// decodeBody returns a reader decompressing body. deflate is zlib wrapped per
+// RFC 9110, raw deflate streams sent by some servers are accepted too.
+func decodeBody(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return readCloser{r, body}, nil
+	case EncodingDeflate:
+		br := bufio.NewReader(body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		// A zlib header is a multiple of 31 with the deflate method
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			r, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, err
+			}
+			return readCloser{r, body}, nil
+		}
+		return readCloser{flate.NewReader(br), body}, nil
+	case EncodingBrotli:
+		return readCloser{brotli.NewReader(body), body}, nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+}
+
+// encodeBody compresses data with the given coding
+func encodeBody(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		w = gzip.NewWriter(&buf)
+	case EncodingDeflate:
+		w = zlib.NewWriter(&buf)
+	case EncodingBrotli:
+		w = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiateEncoding picks the coding of the response sent to a client with
+// the given Accept-Encoding header: the upstream coding when acceptable,
+// otherwise the first acceptable of br, gzip and deflate. An empty result
+// means identity.
+func negotiateEncoding(acceptEncoding, upstream string) string {
+	quality := acceptedEncodings(acceptEncoding)
+	if quality(upstream) > 0 {
+		return upstream
+	}
+	for _, coding := range []string{EncodingBrotli, EncodingGzip, EncodingDeflate} {
+		if quality(coding) > 0 {
+			return coding
+		}
+	}
+	return ""
+}
+
+// acceptedEncodings parses an Accept-Encoding header into the quality it
+// gives each coding, 0 when not acceptable
+func acceptedEncodings(acceptEncoding string) func(coding string) float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q
+	}
+	return func(coding string) float64 {
+		if q, ok := accepted[coding]; ok {
+			return q
+		}
+		return accepted["*"]
+	}
+}
+
+// readCloser closes the underlying body along with the decoder
+type readCloser struct {
+	io.Reader
+	body io.Closer
+}
+
+func (r readCloser) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return r.body.Close()
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// ErrorKind classifies why the upstream could not answer
+type ErrorKind string
+
+// Error kinds
+const (
+	ErrorUnavailable  ErrorKind = "upstream_unavailable"
+	ErrorTimeout      ErrorKind = "upstream_timeout"
+	ErrorBreakerOpen  ErrorKind = "circuit_open"
+	ErrorBulkheadFull ErrorKind = "bulkhead_full"
+)
+
+var errorKinds = map[ErrorKind]struct {
+	status  int
+	message string
+}{
+	ErrorUnavailable:  {http.StatusBadGateway, "The upstream service could not be reached."},
+	ErrorTimeout:      {http.StatusGatewayTimeout, "The upstream service did not respond in time."},
+	ErrorBreakerOpen:  {http.StatusServiceUnavailable, "The upstream service is temporarily unavailable."},
+	ErrorBulkheadFull: {http.StatusServiceUnavailable, "The upstream service is busy, please retry later."},
+}
+
+const defaultErrorJSON = `{"error":{"status":{{.Status}},"code":{{json .Code}},"message":{{json .Message}},"trace_id":{{json .TraceID}}}}`
+
+const defaultErrorHTML = `<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>{{.Message}}</p>
+<p><small>Trace ID: {{.TraceID}}</small></p>
+</body>
+</html>
+`
+
+// ErrorPage is the data passed to the error templates
+type ErrorPage struct {
+	Status    int
+	Code      ErrorKind
+	Title     string
+	Message   string
+	TraceID   string
+	Method    string
+	Path      string
+	Timestamp time.Time
+}
+
+// ErrorPages renders upstream failures as JSON or HTML, depending on what
+// the client accepts
+type ErrorPages struct {
+	json *template.Template
+	html *htmltemplate.Template
+}
+
+// jsonString quotes a value for JSON templates
+func jsonString(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// NewErrorPages parses the configured templates, falling back to the
+// built-in ones for those left empty
+func NewErrorPages(cfg config.ErrorPagesConfig) (*ErrorPages, error) {
+	jsonText := cfg.JSON
+	if jsonText == "" {
+		jsonText = defaultErrorJSON
+	}
+	jsonTmpl, err := template.New("error.json").Funcs(template.FuncMap{"json": jsonString}).Parse(jsonText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON error template: %v", err)
+	}
+
+	htmlText := cfg.HTML
+	if cfg.HTMLFile != "" {
+		b, err := os.ReadFile(cfg.HTMLFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTML error page: %v", err)
+		}
+		htmlText = string(b)
+	}
+	if htmlText == "" {
+		htmlText = defaultErrorHTML
+	}
+	htmlTmpl, err := htmltemplate.New("error.html").Parse(htmlText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTML error template: %v", err)
+	}
+
+	return &ErrorPages{json: jsonTmpl, html: htmlTmpl}, nil
+}
+
+// classifyError maps an upstream transport error to its kind
+func classifyError(err error) ErrorKind {
+	var open *breakerOpenError
+	if errors.As(err, &open) {
+		return ErrorBreakerOpen
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorTimeout
+	}
+	return ErrorUnavailable
+}
+
+// Render writes the error response of the given kind
+func (p *ErrorPages) Render(c *fiber.Ctx, kind ErrorKind, traceID string) error {
+	return p.render(c, kind, errorKinds[kind].status, traceID)
+}
+
+// render writes the error response of the given kind with a status
+// overriding the default of the kind
+func (p *ErrorPages) render(c *fiber.Ctx, kind ErrorKind, status int, traceID string) error {
+	k := errorKinds[kind]
+	page := ErrorPage{
+		Status:    status,
+		Code:      kind,
+		Title:     http.StatusText(status),
+		Message:   k.message,
+		TraceID:   traceID,
+		Method:    c.Method(),
+		Path:      c.Path(),
+		Timestamp: time.Now().UTC(),
+	}
+
+	var buf bytes.Buffer
+	contentType := fiber.MIMEApplicationJSONCharsetUTF8
+	if c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+		contentType = fiber.MIMETextHTMLCharsetUTF8
+		if err := p.html.Execute(&buf, page); err != nil {
+			return fmt.Errorf("failed to render HTML error page: %v", err)
+		}
+	} else if err := p.json.Execute(&buf, page); err != nil {
+		return fmt.Errorf("failed to render JSON error page: %v", err)
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Status(status).Send(buf.Bytes())
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// HeaderExperimentVariant tells the upstream the variant of the request
+const HeaderExperimentVariant = "X-Experiment-Variant"
+
+// variant is one arm of an experiment
+type variant struct {
+	name   string
+	target string // Empty keeps the route target
+	weight int
+}
+
+// experiment assigns the requests of a route to variants. The assignment is
+// kept in a cookie so a client stays in its variant.
+type experiment struct {
+	config   config.ExperimentConfig
+	variants []*variant
+	byName   map[string]*variant
+	total    int
+}
+
+func newExperiment(cfg config.ExperimentConfig) (*experiment, error) {
+	if cfg.Cookie == "" {
+		cfg.Cookie = "muhtar_exp_" + cfg.Name
+	}
+	if cfg.CookieTTL <= 0 {
+		cfg.CookieTTL = 30 * 24 * time.Hour
+	}
+	if cfg.Header == "" {
+		cfg.Header = HeaderExperimentVariant
+	}
+	if len(cfg.Variants) < 2 {
+		return nil, fmt.Errorf("experiment %s needs two variants or more", cfg.Name)
+	}
+
+	e := &experiment{config: cfg, byName: make(map[string]*variant, len(cfg.Variants))}
+	for _, vc := range cfg.Variants {
+		if vc.Name == "" || e.byName[vc.Name] != nil {
+			return nil, fmt.Errorf("invalid or duplicate variant %q", vc.Name)
+		}
+		if vc.Weight < 0 {
+			return nil, fmt.Errorf("negative weight for variant %s", vc.Name)
+		}
+		if vc.Target != "" {
+			u, err := url.Parse(vc.Target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid target for variant %s: %s", vc.Name, vc.Target)
+			}
+		}
+		v := &variant{name: vc.Name, target: strings.TrimSuffix(vc.Target, "/"), weight: vc.Weight}
+		e.variants = append(e.variants, v)
+		e.byName[v.name] = v
+		e.total += v.weight
+	}
+	if e.total == 0 {
+		return nil, fmt.Errorf("variant weights add up to 0")
+	}
+	return e, nil
+}
+
+// assign returns the variant of the request: the one forced by the override
+// header, the one of the cookie, or a weighted draw for new clients. The
+// second result reports whether the cookie must be (re)set.
+func (e *experiment) assign(c *fiber.Ctx) (*variant, bool) {
+	if e.config.OverrideHeader != "" {
+		if v := e.byName[c.Get(e.config.OverrideHeader)]; v != nil {
+			return v, false
+		}
+	}
+	// A variant removed from the configuration reassigns its clients
+	if v := e.byName[c.Cookies(e.config.Cookie)]; v != nil && v.weight > 0 {
+		return v, false
+	}
+	n := rand.Intn(e.total)
+	for _, v := range e.variants {
+		if n < v.weight {
+			return v, true
+		}
+		n -= v.weight
+	}
+	return e.variants[len(e.variants)-1], true
+}
+
+// cookie keeps the client in its variant
+func (e *experiment) cookie(c *fiber.Ctx, v *variant) {
+	c.Cookie(&fiber.Cookie{
+		Name:     e.config.Cookie,
+		Value:    v.name,
+		Path:     "/",
+		MaxAge:   int(e.config.CookieTTL.Seconds()),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
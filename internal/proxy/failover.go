@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// failoverTarget is the target of a route or one of its backups
+type failoverTarget struct {
+	target string
+	health *targetHealth // Nil without health checks
+}
+
+// failover sends the requests the target of a route fails to its backups
+type failover struct {
+	targets  []*failoverTarget // The route target first, then the backups in order
+	statuses map[int]bool
+}
+
+func newFailover(primary string, cfg config.FailoverConfig) (*failover, error) {
+	f := &failover{
+		targets:  []*failoverTarget{{target: primary}},
+		statuses: make(map[int]bool),
+	}
+	for _, backup := range cfg.Backups {
+		u, err := url.Parse(backup)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid backup target %s", backup)
+		}
+		f.targets = append(f.targets, &failoverTarget{target: strings.TrimSuffix(backup, "/")})
+	}
+	statuses := cfg.Status
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	for _, status := range statuses {
+		if !validStatus(status) {
+			return nil, fmt.Errorf("invalid failover status %d", status)
+		}
+		f.statuses[status] = true
+	}
+	return f, nil
+}
+
+// first returns the index of the first target in rotation, the route target
+// when none is
+func (f *failover) first() int {
+	for i, t := range f.targets {
+		if t.health.up() {
+			return i
+		}
+	}
+	return 0
+}
+
+// failed reports whether the answer of a target is failed over. A client
+// gone away is not.
+func (f *failover) failed(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return f.statuses[resp.StatusCode]
+}
+
+// failOver sends the request to the backups following the target at index
+// from, in order, while the previous one fails it. uri is appended to each
+// backup like to the route target.
+func (h *ProxyHandler) failOver(rt *route, req *http.Request, body []byte, uri string, from int, resp *http.Response, err error) (*http.Response, error) {
+	f := rt.failover
+	for i := from + 1; i < len(f.targets) && f.failed(req, resp, err); i++ {
+		backup := f.targets[i]
+		if !backup.health.up() {
+			continue
+		}
+		u, perr := url.Parse(backup.target + uri)
+		if perr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		event := zerolog.Ctx(req.Context()).Warn().Str("backup", backup.target)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status_code", resp.StatusCode)
+		}
+		event.Msg("Failing over to backup target")
+		h.metrics.IncFailover(rt.config.Name, backup.target)
+
+		next := req.Clone(req.Context())
+		next.URL = u
+		if !rt.config.PreserveHost {
+			next.Host = ""
+		}
+		if len(body) > 0 {
+			next.Body = io.NopCloser(bytes.NewReader(body))
+			next.ContentLength = int64(len(body))
+		}
+		resp, err = h.roundTrip(next, rt)
+	}
+	return resp, err
+}
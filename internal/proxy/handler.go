@@ -2,22 +2,46 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
+	"github.com/tuncerburak97/muhtar/internal/access"
+	"github.com/tuncerburak97/muhtar/internal/chaos"
 	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/credentials"
+	"github.com/tuncerburak97/muhtar/internal/discovery"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
+	"github.com/tuncerburak97/muhtar/internal/forwarded"
+	"github.com/tuncerburak97/muhtar/internal/inspector"
+	"github.com/tuncerburak97/muhtar/internal/logger"
 	"github.com/tuncerburak97/muhtar/internal/metrics"
 	"github.com/tuncerburak97/muhtar/internal/model"
-	"github.com/tuncerburak97/muhtar/internal/repository"
+	"github.com/tuncerburak97/muhtar/internal/pipeline"
+	"github.com/tuncerburak97/muhtar/internal/protobuf"
+	"github.com/tuncerburak97/muhtar/internal/rollup"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
 	"github.com/tuncerburak97/muhtar/internal/service"
+	"github.com/tuncerburak97/muhtar/internal/shadow"
+	"github.com/tuncerburak97/muhtar/internal/slo"
+	"github.com/tuncerburak97/muhtar/internal/tenant"
 	"github.com/tuncerburak97/muhtar/internal/transform"
+	"github.com/tuncerburak97/muhtar/internal/usage"
 )
 
 type ProxyHandler struct {
@@ -29,9 +53,134 @@ type ProxyHandler struct {
 	logSvc                         *service.LoggerService
 	transformer                    *transform.Engine
 	httpRequestResponseTransformer *HttpRequestResponseTransformer
+	chaos                          *chaos.Injector
+	dryRun                         *DryRun
+	maintenance                    *Maintenance
+	mirror                         *shadow.Mirror
+	inspector                      *inspector.Inspector
+	rollups                        *rollup.Aggregator
+	usage                          *usage.Meter
+	slo                            *slo.Monitor
+	routes                         routeTable
+	errorPages                     *ErrorPages
+	budget                         *timeoutBudget
+	slowClient                     *slowClientGuard
+	compression                    *compressor
+	forwarded                      *forwarded.Headers
+	router                         *transform.Router
+	flags                          *featureflag.Client
+	credentials                    *credentials.Manager
+	upstreams                      UpstreamReporter
+	health                         *healthChecker
+	discovery                      []*discovery.Watcher
+	breakers                       *breakerTransport
+	// Response header timeout enforced per request instead of by the
+	// transport, set when routes override it
+	headerTimeout time.Duration
+	// Media types of responses passed through as they arrive
+	streamTypes []string
 }
 
-func NewProxyHandler(cfg *config.ProxyConfig, logger *zerolog.Logger, repo repository.LogRepository, metrics *metrics.MetricsCollector, transformer *transform.Engine) (*ProxyHandler, error) {
+// Option configures optional ProxyHandler components
+type Option func(*ProxyHandler)
+
+// WithChaos enables fault injection for routes with an attached chaos profile
+func WithChaos(injector *chaos.Injector) Option {
+	return func(h *ProxyHandler) {
+		h.chaos = injector
+	}
+}
+
+// DryRun returns the dry-run controller of the handler
+func (h *ProxyHandler) DryRun() *DryRun {
+	return h.dryRun
+}
+
+// Maintenance returns the maintenance mode controller of the handler
+func (h *ProxyHandler) Maintenance() *Maintenance {
+	return h.maintenance
+}
+
+// MatchRoute returns the index of the route applying to a request in the
+// configured routes, -1 when none does
+func (h *ProxyHandler) MatchRoute(c *fiber.Ctx) int {
+	return h.routes.index(c, h.flags.ForRequest(c))
+}
+
+// WithMirror sends a copy of the traffic to a shadow upstream
+func WithMirror(mirror *shadow.Mirror) Option {
+	return func(h *ProxyHandler) {
+		h.mirror = mirror
+	}
+}
+
+// WithRollups feeds response logs to the traffic rollup job
+func WithRollups(a *rollup.Aggregator) Option {
+	return func(h *ProxyHandler) {
+		h.rollups = a
+	}
+}
+
+// WithUsage meters the traffic of identified tenants
+func WithUsage(m *usage.Meter) Option {
+	return func(h *ProxyHandler) {
+		h.usage = m
+	}
+}
+
+// WithSLO tracks the service level objectives of proxied traffic
+func WithSLO(m *slo.Monitor) Option {
+	return func(h *ProxyHandler) {
+		h.slo = m
+	}
+}
+
+// WithRouter lets a routing script choose the upstream of each request
+func WithRouter(r *transform.Router) Option {
+	return func(h *ProxyHandler) {
+		h.router = r
+	}
+}
+
+// WithFlags evaluates the feature flags gating routes and transforms, and
+// exposes them to scripts
+func WithFlags(f *featureflag.Client) Option {
+	return func(h *ProxyHandler) {
+		h.flags = f
+	}
+}
+
+// WithCredentials authenticates upstream requests with credentials rotated
+// from a secret manager
+func WithCredentials(m *credentials.Manager) Option {
+	return func(h *ProxyHandler) {
+		h.credentials = m
+	}
+}
+
+// WithUpstreamReporter notifies r when a health checked target goes down or
+// recovers
+func WithUpstreamReporter(r UpstreamReporter) Option {
+	return func(h *ProxyHandler) {
+		h.upstreams = r
+	}
+}
+
+// WithForwarded sets the forwarding headers of upstream requests
+func WithForwarded(f *forwarded.Headers) Option {
+	return func(h *ProxyHandler) {
+		h.forwarded = f
+	}
+}
+
+// WithInspector streams traffic snapshots to live inspector sessions
+func WithInspector(i *inspector.Inspector) Option {
+	return func(h *ProxyHandler) {
+		h.inspector = i
+	}
+}
+
+func NewProxyHandler(cfg *config.ProxyConfig, logger *zerolog.Logger, logSvc *service.LoggerService, metrics *metrics.MetricsCollector, transformer *transform.Engine, opts ...Option) (*ProxyHandler, error) {
 	target, err := url.Parse(cfg.Target)
 	if err != nil {
 		return nil, err
@@ -40,7 +189,7 @@ func NewProxyHandler(cfg *config.ProxyConfig, logger *zerolog.Logger, repo repos
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
 	// Configure transport
-	proxy.Transport = &http.Transport{
+	transport := &http.Transport{
 		MaxIdleConns:          cfg.MaxIdleConns,
 		IdleConnTimeout:       cfg.IdleConnTimeout,
 		TLSHandshakeTimeout:   cfg.TLSTimeout,
@@ -48,6 +197,9 @@ func NewProxyHandler(cfg *config.ProxyConfig, logger *zerolog.Logger, repo repos
 		ExpectContinueTimeout: cfg.ExpectContinueTimeout,
 		MaxConnsPerHost:       cfg.MaxConnsPerHost,
 	}
+	conns := newConnTracker(metrics)
+	transport.DialContext = conns.dialer(&net.Dialer{})
+	proxy.Transport = transport
 
 	// Configure proxy timeouts
 	proxy.ModifyResponse = func(r *http.Response) error {
@@ -55,9 +207,48 @@ func NewProxyHandler(cfg *config.ProxyConfig, logger *zerolog.Logger, repo repos
 		return nil
 	}
 
-	logSvc := service.NewLoggerService(repo, metrics, 5, 1000)
+	routes, err := newRouteTable(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+	// A transport wide header timeout would cut routes allowed to wait longer
+	var headerTimeout time.Duration
+	for _, rt := range routes {
+		if rt.config.Timeouts.ResponseHeader > 0 {
+			headerTimeout = cfg.ResponseHeaderTimeout
+			transport.ResponseHeaderTimeout = 0
+			break
+		}
+	}
+
+	var errorPages *ErrorPages
+	if cfg.ErrorPages.Enabled {
+		if errorPages, err = NewErrorPages(cfg.ErrorPages); err != nil {
+			return nil, err
+		}
+	}
+
+	var budget *timeoutBudget
+	if cfg.TimeoutBudget.Enabled {
+		if budget, err = newTimeoutBudget(cfg.TimeoutBudget); err != nil {
+			return nil, err
+		}
+	}
+
+	maintenance, err := NewMaintenance(cfg.Maintenance)
+	if err != nil {
+		return nil, err
+	}
+
+	var compression *compressor
+	if cfg.Compression.Enabled {
+		if compression, err = newCompressor(cfg.Compression); err != nil {
+			return nil, err
+		}
+	}
+
 	httpRequestResponseTransformer := NewTransformer(cfg)
-	return &ProxyHandler{
+	h := &ProxyHandler{
 		proxy:                          proxy,
 		logger:                         logger,
 		metrics:                        metrics,
@@ -66,20 +257,239 @@ func NewProxyHandler(cfg *config.ProxyConfig, logger *zerolog.Logger, repo repos
 		logSvc:                         logSvc,
 		transformer:                    transformer,
 		httpRequestResponseTransformer: httpRequestResponseTransformer,
-	}, nil
+		dryRun:                         NewDryRun(cfg.DryRun),
+		maintenance:                    maintenance,
+		routes:                         routes,
+		errorPages:                     errorPages,
+		budget:                         budget,
+		compression:                    compression,
+		headerTimeout:                  headerTimeout,
+		streamTypes:                    cfg.StreamContentTypes,
+	}
+	if len(h.streamTypes) == 0 {
+		h.streamTypes = []string{"text/event-stream"}
+	}
+	if cfg.SlowClient.Enabled {
+		h.slowClient = newSlowClientGuard(cfg.SlowClient, metrics)
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.credentials != nil {
+		h.credentials.ConfigureTransport(transport)
+	}
+	// HTTP/2 is announced through the final TLS configuration of each pool,
+	// and must be settled before cloning as a clone fixes the HTTP version
+	// of its origin
+	if err := configureHTTP2(transport, cfg.HTTP2); err != nil {
+		return nil, err
+	}
+	// Cloned after the credentials configured the shared transport, the
+	// hosts keep its settings but their own TLS and pools
+	if len(cfg.TargetTLS) > 0 || len(cfg.TargetPools) > 0 {
+		targets, err := newTargetTransport(transport, cfg.TargetTLS, cfg.TargetPools, conns)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range targets.hosts {
+			if err := configureHTTP2(t, cfg.HTTP2); err != nil {
+				return nil, err
+			}
+		}
+		proxy.Transport = targets
+	}
+	proxy.Transport = conns.RoundTripper(proxy.Transport)
+	if cfg.HTTP2.Mode == UpstreamH2C {
+		proxy.Transport = newH2CTransport(proxy.Transport, cfg.HTTP2)
+	}
+	if h.credentials != nil {
+		proxy.Transport = h.credentials.RoundTripper(proxy.Transport)
+	}
+
+	for _, rt := range routes {
+		if rt.discovery == nil {
+			continue
+		}
+		h.discovery = append(h.discovery, discovery.Watch(rt.config.Name, rt.discovery, rt.config.Discovery.Interval, func(targets []string) {
+			removed := rt.discovered(targets)
+			if metrics != nil {
+				metrics.ObserveDiscoveredTargets(rt.config.Name, len(targets))
+				for _, target := range removed {
+					metrics.ForgetUpstreamHealth(rt.config.Name, target)
+				}
+			}
+		}))
+	}
+
+	var checks []*healthCheck
+	for _, rt := range routes {
+		if rt.health != nil {
+			checks = append(checks, rt.health)
+		}
+		if rt.outliers != nil {
+			rt.outliers.metrics = metrics
+		}
+	}
+	if len(checks) > 0 {
+		// Probes carry the upstream credentials like proxied requests
+		h.health = newHealthChecker(checks, proxy.Transport, h.upstreams, metrics)
+	}
+	// Probes bypass the breakers, they are how a recovered target is noticed
+	if cfg.Breaker.Enabled {
+		h.breakers = newBreakerTransport(proxy.Transport, cfg.Breaker.BreakerConfig, metrics)
+		proxy.Transport = h.breakers
+	}
+	return h, nil
 }
 
-// convertHeaders converts map[string][]string to map[string]string
-func convertHeaders(headers map[string][]string) map[string]string {
-	result := make(map[string]string)
-	for k, v := range headers {
+// Close stops the upstream health checks and discovery
+func (h *ProxyHandler) Close() {
+	for _, w := range h.discovery {
+		w.Close()
+	}
+	if h.health != nil {
+		h.health.Close()
+	}
+}
+
+// breakerOpen answers a request whose upstream breaker is open
+func (h *ProxyHandler) breakerOpen(c *fiber.Ctx, err *breakerOpenError, traceID string) error {
+	status := h.config.Breaker.Status
+	if status == 0 {
+		status = fiber.StatusServiceUnavailable
+	}
+	if err.retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(err.retryAfter.Seconds()))))
+	}
+	if h.errorPages != nil {
+		return h.errorPages.render(c, ErrorBreakerOpen, status, traceID)
+	}
+	return fiber.NewError(status, errorKinds[ErrorBreakerOpen].message)
+}
+
+// noReplica answers a request of a route with no replica to send it to
+func (h *ProxyHandler) noReplica(c *fiber.Ctx) error {
+	if h.errorPages != nil {
+		return h.errorPages.render(c, ErrorUnavailable, fiber.StatusServiceUnavailable, logger.TraceID(c))
+	}
+	return fiber.NewError(fiber.StatusServiceUnavailable, errorKinds[ErrorUnavailable].message)
+}
+
+// applyTenantPolicy tags the log with its tenant and strips what the tenant
+// logging policy excludes
+func applyTenantPolicy(l *model.Log, t *tenant.Tenant) {
+	l.TenantID = t.ID
+	if t.Config.Log.ExcludeBodies {
+		l.Body = nil
+	}
+}
+
+// clientCertificate returns the certificate the client presented to the
+// listener, verified during the handshake, nil without one
+func clientCertificate(c *fiber.Ctx) *x509.Certificate {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// decodeProtoBody replaces a binary protobuf log body with its JSON form
+func decodeProtoBody(l *model.Log, d *protobuf.Decoder, contentType string) error {
+	if len(l.Body) == 0 || !protobuf.Applies(contentType) {
+		return nil
+	}
+	js, err := d.ToJSON(contentType, l.Body)
+	if err != nil {
+		return err
+	}
+	l.Body = js
+	if l.Metadata == nil {
+		l.Metadata = map[string]interface{}{}
+	}
+	l.Metadata["protobuf_message"] = d.Name()
+	return nil
+}
+
+// routingRequest exposes the request to the routing script. target is the
+// upstream resolved from the configuration.
+func routingRequest(c *fiber.Ctx, tenantID, target string) map[string]interface{} {
+	query := make(map[string]interface{})
+	c.Request().URI().QueryArgs().VisitAll(func(k, v []byte) {
+		query[string(k)] = string(v)
+	})
+	headers := make(map[string]interface{})
+	for k, v := range c.GetReqHeaders() {
 		if len(v) > 0 {
-			result[k] = v[0]
+			headers[k] = v[0]
+		}
+	}
+
+	req := map[string]interface{}{
+		"method":    c.Method(),
+		"path":      c.Path(),
+		"query":     query,
+		"headers":   headers,
+		"client_ip": c.IP(),
+		"tenant":    tenantID,
+		"target":    target,
+	}
+	if body := c.Body(); len(body) > 0 {
+		var jsonBody interface{}
+		if err := json.Unmarshal(body, &jsonBody); err == nil {
+			req["body"] = jsonBody
+		} else {
+			req["body"] = string(body)
+		}
+	}
+	return req
+}
+
+// cacheable reports whether a response may carry the tenant cache TTL
+func cacheable(method string, status int) bool {
+	return (method == fiber.MethodGet || method == fiber.MethodHead) && status == http.StatusOK
+}
+
+// cloneHeaders deep copies headers so they outlive the fiber request context
+func cloneHeaders(headers map[string][]string) model.Headers {
+	result := make(model.Headers, len(headers))
+	for k, v := range headers {
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = strings.Clone(v[i])
 		}
+		result[strings.Clone(k)] = values
 	}
 	return result
 }
 
+// setResponseHeader replaces the values of a response header, keeping them
+// all, e.g. one per Set-Cookie
+func setResponseHeader(c *fiber.Ctx, key string, values []string) {
+	c.Response().Header.Del(key)
+	for _, v := range values {
+		c.Response().Header.Add(key, v)
+	}
+}
+
+const upstreamErrorKey = "muhtar.upstream_error"
+
+// UpstreamFailed reports whether the upstream could not be reached for the
+// request
+func UpstreamFailed(c *fiber.Ctx) bool {
+	failed, _ := c.Locals(upstreamErrorKey).(bool)
+	return failed
+}
+
+// StatusClientClosedRequest records requests the client abandoned
+const StatusClientClosedRequest = 499
+
+// clientGone records a request cancelled because the client disconnected
+func (h *ProxyHandler) clientGone(reqLogger *zerolog.Logger, method, path, tenantID string) {
+	reqLogger.Info().Msg("Client disconnected, upstream request cancelled")
+	h.metrics.IncRequestCounter(method, path, strconv.Itoa(StatusClientClosedRequest), tenantID)
+}
+
 func (h *ProxyHandler) Handle(c *fiber.Ctx) error {
 	// Skip logging and proxying for metrics endpoint
 	if c.Path() == "/metrics" {
@@ -88,37 +498,233 @@ func (h *ProxyHandler) Handle(c *fiber.Ctx) error {
 
 	// Increment active requests counter
 	h.metrics.IncActiveRequests()
-	defer h.metrics.DecActiveRequests()
+	// Streamed responses outlive the handler, they take over the cleanups
+	cleanup := &cleanups{}
+	defer cleanup.run()
+	cleanup.add(h.metrics.DecActiveRequests)
 
 	startTime := time.Now()
-	traceID := uuid.New().String()
+
+	// Resolve tenant specific upstream, transforms and logging policy
+	target := h.target
+	transformer := h.transformer
+	logExchange := true
+	tenantID := ""
+	t := tenant.FromContext(c)
+	if t != nil {
+		tenantID = t.ID
+		target = t.Target(target)
+		if t.Transformer != nil {
+			transformer = t.Transformer
+		}
+		logExchange = t.ShouldLog()
+	}
 
 	// Log initial request metrics
 	method := string(c.Method())
 	path := c.Path()
-	h.logger.Info().
-		Str("method", method).
-		Str("path", path).
-		Str("trace_id", traceID).
-		Str("target_url", h.target).
-		Msg("Proxying request")
-
-	// Create target request
-	targetURL := h.config.Target + c.OriginalURL()
-	req, err := http.NewRequest(c.Method(), targetURL, bytes.NewReader(c.Body()))
+	flags := h.flags.ForRequest(c)
+	rt := h.routes.match(c, flags)
+	// The routing script and transforms read flags through the context
+	c.SetUserContext(featureflag.NewContext(c.UserContext(), flags))
+
+	// Correlate every log line of the request, including those of the
+	// transforms, through the request logger
+	if logger.FromCtx(c) == nil {
+		logger.New(c, *h.logger, uuid.New().String())
+		if t != nil {
+			logger.With(c, "tenant", t.ID)
+		}
+	}
+	if rt != nil && rt.config.Name != "" {
+		logger.With(c, "route", rt.config.Name)
+	}
+	if h.maintenance.Active(rt) {
+		return h.maintenance.Render(c, rt, logger.TraceID(c))
+	}
+	if rt != nil && rt.bulkhead != nil {
+		if reason, ok := rt.bulkhead.acquire(); !ok {
+			return h.bulkheadFull(c, rt, reason, logger.TraceID(c))
+		}
+		// Held until a streamed response ended, not just the handler
+		cleanup.add(rt.bulkhead.release)
+	}
+	if rt != nil && rt.config.Target != "" {
+		target = rt.config.Target
+	}
+	// Failover target serving the request, its backups follow
+	failoverFrom := -1
+	if rt != nil && rt.failover != nil {
+		failoverFrom = rt.failover.first()
+		target = rt.failover.targets[failoverFrom].target
+	}
+	// Tracker of the picked target, fed the outcome of the upstream call
+	var outlier *targetOutlier
+	// Replica picked for a balanced route, hedged requests go to the others
+	var picked *replica
+	if rt != nil && rt.balancer != nil {
+		picked = rt.balancer.pickKey(rt.stickyKey(c))
+		if picked == nil {
+			// Discovery found no replica yet
+			return h.noReplica(c)
+		}
+		picked.acquire()
+		cleanup.add(picked.release)
+		target = picked.target
+		outlier = picked.outlier
+	}
+	if rt != nil && rt.split != nil {
+		st := rt.split.pick(flags)
+		target = st.target
+		outlier = st.outlier
+		logger.With(c, "split", st.name)
+		h.metrics.IncSplitRequest(rt.config.Name, st.name)
+	}
+	// Variant of the A/B test of the route
+	var assigned *variant
+	if rt != nil && rt.experiment != nil {
+		var fresh bool
+		assigned, fresh = rt.experiment.assign(c)
+		if assigned.target != "" {
+			target = assigned.target
+		}
+		if fresh {
+			// Set once the upstream cookies were copied, they replace the
+			// response ones
+			defer rt.experiment.cookie(c, assigned)
+		}
+		logger.With(c, "experiment", rt.config.Experiment.Name)
+		logger.With(c, "variant", assigned.name)
+		h.metrics.IncExperimentRequest(rt.config.Experiment.Name, assigned.name)
+	}
+	if h.router != nil {
+		upstream, err := h.router.Route(c.UserContext(), routingRequest(c, tenantID, target))
+		if err != nil {
+			logger.FromCtx(c).Error().Err(err).Msg("Routing script failed")
+			sentry.CaptureRequest(c, err, map[string]string{"component": "routing", "trace_id": logger.TraceID(c), "tenant": tenantID})
+			return err
+		}
+		if upstream != "" {
+			target = upstream
+			outlier = nil
+			picked = nil
+			failoverFrom = -1
+		}
+	}
+	logger.With(c, "upstream", target)
+	reqLogger := logger.FromCtx(c)
+	traceID := logger.TraceID(c)
+	reqLogger.Info().Msg("Proxying request")
+
+	// Inject chaos faults
+	var fault *chaos.Fault
+	if h.chaos != nil {
+		if fault = h.chaos.Evaluate(method, path); fault != nil {
+			if handled, err := chaos.Inject(c, fault); handled {
+				reqLogger.Warn().
+					Str("profile", fault.Profile).
+					Int("status_code", fault.Status).
+					Bool("reset", fault.Reset).
+					Msg("Chaos fault injected")
+				return err
+			}
+		}
+	}
+
+	// Create target request, applying the route path and query rules
+	forwardURI := c.OriginalURL()
+	rewrittenPath := ""
+	if rt != nil && (rt.hasRewrite() || rt.hasQueryRules()) {
+		rawPath, query, _ := strings.Cut(forwardURI, "?")
+		if rt.hasRewrite() {
+			rewrittenPath = rt.rewritePath(rawPath)
+			rawPath = rewrittenPath
+		}
+		if rt.hasQueryRules() {
+			query = rt.rewriteQuery(query)
+		}
+		forwardURI = rawPath
+		if query != "" {
+			forwardURI += "?" + query
+		}
+	}
+	targetURL := target + forwardURI
+	ctx, cancel := context.WithCancel(c.UserContext())
+	cleanup.add(cancel)
+	// Upstreams taking PROXY protocol headers see the client address
+	ctx = withClientAddrs(ctx, c.Context().RemoteAddr(), c.Context().LocalAddr())
+	// Transform scripts see protobuf bodies of the route as JSON
+	if rt != nil && rt.requestProto != nil {
+		ctx = transform.WithRequestDecoder(ctx, rt.requestProto.Decode)
+	}
+	if rt != nil && rt.responseProto != nil {
+		ctx = transform.WithResponseDecoder(ctx, rt.responseProto.Decode)
+	}
+	// Identity-aware scripts see the verified client certificate
+	clientCert := clientCertificate(c)
+	if clientCert != nil {
+		ctx = transform.WithClientCert(ctx, transform.ClientCert{
+			Subject: clientCert.Subject.String(),
+			Issuer:  clientCert.Issuer.String(),
+			Serial:  clientCert.SerialNumber.String(),
+		})
+	}
+	// Large bodies are piped to the upstream as the client sends them
+	var reqBody []byte
+	var upload *uploadBody
+	var payload io.Reader
+	contentLength := c.Request().Header.ContentLength()
+	if h.streamsBody(rt, int64(contentLength)) && (rt == nil || (rt.compose == nil && rt.mock == nil)) {
+		upload = newUploadBody(c)
+		// The server reuses the request stream once the handler returned
+		cleanup.add(func() {
+			cancel()
+			upload.release()
+		})
+		payload = upload
+	} else {
+		var err error
+		if reqBody, err = readBody(c); err != nil {
+			reqLogger.Warn().Err(err).Msg("Failed to read request body")
+			return err
+		}
+		payload = bytes.NewReader(reqBody)
+	}
+	requestSize := func() int {
+		if upload != nil {
+			return int(upload.size())
+		}
+		return len(reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Method(), targetURL, payload)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to create target request")
+		reqLogger.Error().Err(err).Msg("Failed to create target request")
 		return err
 	}
+	if upload != nil && contentLength > 0 {
+		req.ContentLength = int64(contentLength)
+	}
 
 	// Copy headers
 	for k, v := range c.GetReqHeaders() {
-		req.Header.Set(k, v[0])
+		for _, value := range v {
+			req.Header.Add(k, value)
+		}
+	}
+	if h.forwarded != nil {
+		h.forwarded.Apply(c, req)
+	}
+	if rt != nil && rt.config.PreserveHost {
+		req.Host = string(c.Request().Host())
+	}
+	if assigned != nil {
+		req.Header.Set(rt.experiment.config.Header, assigned.name)
 	}
 
 	// Transform request
-	if err := h.transformer.TransformRequest(req); err != nil {
-		h.logger.Error().Err(err).Msg("Failed to transform request")
+	if err := transformer.TransformRequest(req); err != nil {
+		reqLogger.Error().Err(err).Msg("Failed to transform request")
+		sentry.CaptureRequest(c, err, map[string]string{"component": "transform", "trace_id": traceID, "tenant": tenantID})
 		return err
 	}
 
@@ -130,51 +736,266 @@ func (h *ProxyHandler) Handle(c *fiber.Ctx) error {
 		TraceID:     traceID,
 		ProcessType: model.ProcessTypeRequest,
 		Timestamp:   startTime,
-		Method:      c.Method(),
-		Path:        c.Path(),
-		Headers:     convertHeaders(c.GetReqHeaders()),
-		ClientIP:    c.IP(),
+		Method:      strings.Clone(c.Method()),
+		Path:        strings.Clone(c.Path()),
+		Headers:     cloneHeaders(c.GetReqHeaders()),
+		ClientIP:    strings.Clone(c.IP()),
 		URL:         targetURL,
-		UserAgent:   c.Get("User-Agent"),
-		Body:        c.Body(),
+		UserAgent:   strings.Clone(c.Get("User-Agent")),
+		Body:        append([]byte(nil), reqBody...),
+	}
+	if t != nil {
+		applyTenantPolicy(reqLog, t)
 	}
-	go func(log *model.Log) {
-		if err := h.logSvc.LogRequest(log); err != nil {
-			h.logger.Error().Err(err).Msg("Failed to log request")
+	decisions := access.FromContext(c)
+	if rewrittenPath != "" || len(decisions) > 0 || upload != nil || clientCert != nil || assigned != nil {
+		reqLog.Metadata = map[string]interface{}{}
+		if clientCert != nil {
+			reqLog.Metadata["client_cert_subject"] = clientCert.Subject.String()
+		}
+		if upload != nil {
+			// The body is logged nowhere, the response log has its size
+			reqLog.Metadata["streamed"] = true
+		}
+		if rewrittenPath != "" {
+			// Path keeps what the client sent, the URL what the upstream received
+			reqLog.Metadata["rewritten_path"] = rewrittenPath
 		}
-	}(reqLog)
+		if len(decisions) > 0 {
+			// Auth and access control verdicts, for security audits
+			reqLog.Metadata["access_decisions"] = decisions
+		}
+		if assigned != nil {
+			reqLog.Metadata["experiment"] = rt.config.Experiment.Name
+			reqLog.Metadata["variant"] = assigned.name
+		}
+	}
+	if rt != nil && rt.requestProto != nil {
+		if err := decodeProtoBody(reqLog, rt.requestProto, c.Get(fiber.HeaderContentType)); err != nil {
+			reqLogger.Debug().Err(err).Msg("Failed to decode protobuf request body")
+		}
+	}
+	if logExchange {
+		if err := h.logSvc.LogRequest(reqLog); err != nil {
+			reqLogger.Error().Err(err).Msg("Failed to log request")
+		}
+	}
 
-	// Send request
-	resp, err := h.proxy.Transport.RoundTrip(req)
+	// Forward the remaining deadline and stop waiting once it is spent
+	timeout := h.upstreamTimeout(rt)
+	if h.budget != nil && timeout > 0 {
+		left := h.budget.remaining(req, startTime, timeout)
+		if left <= 0 {
+			reqLogger.Warn().Msg("Timeout budget spent before forwarding")
+			if h.errorPages != nil {
+				return h.errorPages.Render(c, ErrorTimeout, traceID)
+			}
+			return fiber.ErrGatewayTimeout
+		}
+		h.budget.apply(req, left)
+		ctx, cancel := context.WithTimeout(req.Context(), left)
+		cleanup.add(cancel)
+		req = req.WithContext(ctx)
+	} else if rt != nil && rt.config.Timeouts.Upstream > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		cleanup.add(cancel)
+		req = req.WithContext(ctx)
+	}
+
+	// Abandon the upstream call once nobody waits for the answer. A piped
+	// request body fails the upload instead, the watcher cannot peek at a
+	// connection still read from.
+	var watcher *disconnectWatcher
+	if h.config.CancelOnDisconnect && upload == nil {
+		watcher = watchDisconnect(c, cancel)
+		defer watcher.stop()
+	}
+
+	// Send request, or answer with the stub in dry-run mode, the merged
+	// responses of a composite route or the canned one of a mock route
+	var resp *http.Response
+	if h.dryRun.Active(path) {
+		resp = h.dryRun.Response(req)
+	} else if rt != nil && rt.compose != nil {
+		resp, err = h.compose(rt.compose, req, reqBody)
+	} else if rt != nil && rt.mock != nil {
+		resp, err = rt.mock.response(req, reqBody)
+	} else if upload != nil {
+		// A piped body cannot be sent again
+		resp, err = h.attempt(req.Context(), req, nil, rt, 0)
+		if outlier != nil {
+			rt.outliers.observe(outlier, err != nil || resp.StatusCode >= 500)
+		}
+	} else {
+		if picked != nil && rt.hedges(req) {
+			// Retries give way to hedging, the answering replica is observed
+			var answered *replica
+			answered, resp, err = h.hedge(rt, req, forwardURI, picked)
+			outlier = answered.outlier
+		} else {
+			resp, err = h.roundTrip(req, rt)
+		}
+		if outlier != nil && !watcher.Disconnected() {
+			rt.outliers.observe(outlier, err != nil || resp.StatusCode >= 500)
+		}
+		if failoverFrom >= 0 {
+			resp, err = h.failOver(rt, req, reqBody, forwardURI, failoverFrom, resp, err)
+		}
+		if err == nil && rt != nil && rt.config.Redirect.Policy == RedirectFollow {
+			resp, err = h.followRedirects(rt, req, reqBody, resp)
+		}
+	}
+	if err != nil && watcher.Disconnected() {
+		h.clientGone(reqLogger, method, path, tenantID)
+		return nil
+	}
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to send request to target")
+		reqLogger.Error().Err(err).Msg("Failed to send request to target")
+		c.Locals(upstreamErrorKey, true)
+		if h.usage != nil && t != nil {
+			h.usage.Observe(t.ID, requestSize(), 0, true)
+		}
+		if h.slo != nil {
+			h.slo.Observe(tenantID, method, path, true, time.Since(startTime))
+		}
+		var open *breakerOpenError
+		if errors.As(err, &open) {
+			return h.breakerOpen(c, open, traceID)
+		}
+		if h.errorPages != nil {
+			return h.errorPages.Render(c, classifyError(err), traceID)
+		}
 		return err
 	}
-	defer resp.Body.Close()
+	cleanup.add(func() { resp.Body.Close() })
+
+	if rt != nil && rt.config.Redirect.Policy == RedirectRewrite && isRedirect(resp.StatusCode) {
+		rewriteLocation(rt, resp, req.URL, c)
+	}
+
+	// Event streams and large bodies are passed through as they arrive,
+	// buffering them would hold every event until the upstream closes the
+	// stream, or the whole download in memory
+	if h.streamsResponse(resp) || h.streamsBody(rt, resp.ContentLength) {
+		// Fiber strings point into buffers reused once the handler returns
+		method, path, traceID := strings.Clone(method), strings.Clone(path), strings.Clone(traceID)
+		respLog := &model.Log{
+			ID:          uuid.New().String(),
+			ProcessType: model.ProcessTypeResponse,
+			Method:      method,
+			Path:        path,
+			StatusCode:  resp.StatusCode,
+			ClientIP:    strings.Clone(c.IP()),
+			Timestamp:   startTime,
+			Headers:     cloneHeaders(resp.Header),
+			TraceID:     traceID,
+			URL:         targetURL,
+			UserAgent:   strings.Clone(c.Get("User-Agent")),
+		}
+		if t != nil {
+			applyTenantPolicy(respLog, t)
+		}
+		status := strconv.Itoa(resp.StatusCode)
+		// Pipeline stages also keep what they hold, such as concurrency
+		// slots, until the stream ended
+		held := pipeline.Detach(c)
+		release := cleanup.detach()
+		// Runs once the stream ended, after the handler returned
+		return h.streamResponse(c, resp, func(size int64, err error) {
+			defer held()
+			defer release()
+			duration := time.Since(startTime)
+			respLog.ResponseTime = duration
+			respLog.Metadata = map[string]interface{}{"streamed": true, "response_size": size}
+			if upload != nil {
+				respLog.Metadata["request_size"] = upload.size()
+			}
+			event := reqLogger.Info()
+			if err != nil {
+				event = reqLogger.Warn().Err(err)
+			}
+			event.Int("status_code", resp.StatusCode).Dur("duration", duration).Int64("response_size", size).Msg("Response stream completed")
+
+			if logExchange {
+				if err := h.logSvc.LogRequest(respLog); err != nil {
+					reqLogger.Error().Err(err).Msg("Failed to log response")
+				}
+			}
+			if h.rollups != nil {
+				h.rollups.Observe(respLog)
+			}
+			if h.usage != nil && t != nil {
+				h.usage.Observe(t.ID, requestSize(), int(size), resp.StatusCode >= 500)
+			}
+			if h.slo != nil {
+				h.slo.Observe(tenantID, method, path, resp.StatusCode >= 500, duration)
+			}
+			h.metrics.ObserveRequestDuration(method, path, status, tenantID, duration)
+			h.metrics.IncRequestCounter(method, path, status, tenantID)
+		})
+	}
+
+	// Decode compressed bodies so transforms and logs see the content
+	encoding := ""
+	if h.config.ContentEncoding.Enabled {
+		if ce := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); supportedEncoding(ce) {
+			decoded, err := decodeBody(ce, resp.Body)
+			if err != nil {
+				reqLogger.Warn().Err(err).Str("content_encoding", ce).Msg("Failed to decode response body, passing it through")
+			} else {
+				resp.Body = decoded
+				resp.Header.Del("Content-Encoding")
+				resp.Header.Del("Content-Length")
+				resp.ContentLength = -1
+				encoding = ce
+			}
+		}
+	}
 
 	// Transform response
-	if err := h.transformer.TransformResponse(resp); err != nil {
-		h.logger.Error().Err(err).Msg("Failed to transform response")
+	if err := transformer.TransformResponse(resp); err != nil {
+		reqLogger.Error().Err(err).Msg("Failed to transform response")
+		sentry.CaptureRequest(c, err, map[string]string{"component": "transform", "trace_id": traceID, "tenant": tenantID})
 		return err
 	}
 
+	// Map the upstream status to the code returned to the client
+	upstreamStatus := 0
+	if rt != nil {
+		if mapped, ok := rt.mapStatus(resp.StatusCode); ok {
+			upstreamStatus = resp.StatusCode
+			resp.StatusCode = mapped
+			resp.Status = fmt.Sprintf("%d %s", mapped, http.StatusText(mapped))
+			if rt.config.Status.Header != "" {
+				resp.Header.Set(rt.config.Status.Header, strconv.Itoa(upstreamStatus))
+			}
+		}
+	}
+
 	// Copy response headers
 	for k, v := range resp.Header {
-		c.Set(k, v[0])
+		setResponseHeader(c, k, v)
 	}
 
 	// Read response body
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil && watcher.Disconnected() {
+		h.clientGone(reqLogger, method, path, tenantID)
+		return nil
+	}
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to read response body")
+		reqLogger.Error().Err(err).Msg("Failed to read response body")
 		return err
 	}
 	duration := time.Since(startTime)
 
-	h.logger.Info().
-		Str("trace_id", traceID).
-		Str("method", method).
-		Str("path", path).
+	// Mirror the request to the shadow upstream
+	if h.mirror != nil && upload == nil && h.mirror.ShouldMirror() {
+		captured := &shadow.Captured{StatusCode: resp.StatusCode, Header: resp.Header.Clone(), Body: body}
+		go h.mirror.Send(traceID, req.Clone(context.Background()), append([]byte(nil), reqBody...), captured)
+	}
+
+	reqLogger.Info().
 		Int("status_code", resp.StatusCode).
 		Dur("duration", duration).
 		Int("response_size", len(body)).
@@ -183,38 +1004,126 @@ func (h *ProxyHandler) Handle(c *fiber.Ctx) error {
 		Msg("Response completed")
 
 	h.httpRequestResponseTransformer.TransformResponse(resp)
+	if t != nil && t.Config.CacheTTL > 0 && cacheable(method, resp.StatusCode) {
+		resp.Header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(t.Config.CacheTTL.Seconds())))
+		resp.Header.Del("Pragma")
+	}
 
 	respLog := &model.Log{
 		ID:           uuid.New().String(),
 		ProcessType:  model.ProcessTypeResponse,
-		Method:       c.Method(),
-		Path:         c.Path(),
+		Method:       strings.Clone(c.Method()),
+		Path:         strings.Clone(c.Path()),
 		StatusCode:   resp.StatusCode,
-		ClientIP:     c.IP(),
+		ClientIP:     strings.Clone(c.IP()),
 		Timestamp:    startTime,
-		Headers:      convertHeaders(resp.Header),
+		Headers:      cloneHeaders(resp.Header),
 		TraceID:      traceID,
 		URL:          targetURL,
-		UserAgent:    c.Get("User-Agent"),
+		UserAgent:    strings.Clone(c.Get("User-Agent")),
 		Body:         body,
 		ResponseTime: duration,
 	}
-	go func(log *model.Log) {
-		if err := h.logSvc.LogRequest(log); err != nil {
-			h.logger.Error().Err(err).Msg("Failed to log response")
+	if t != nil {
+		applyTenantPolicy(respLog, t)
+	}
+	if rewrittenPath != "" || upstreamStatus != 0 || upload != nil {
+		respLog.Metadata = map[string]interface{}{}
+		if upload != nil {
+			respLog.Metadata["request_size"] = upload.size()
+		}
+		if rewrittenPath != "" {
+			respLog.Metadata["rewritten_path"] = rewrittenPath
+		}
+		if upstreamStatus != 0 {
+			// StatusCode holds what the client received
+			respLog.Metadata["upstream_status"] = upstreamStatus
+		}
+	}
+	if rt != nil && rt.responseProto != nil {
+		if err := decodeProtoBody(respLog, rt.responseProto, resp.Header.Get("Content-Type")); err != nil {
+			reqLogger.Debug().Err(err).Msg("Failed to decode protobuf response body")
 		}
-	}(respLog)
+	}
+	if logExchange {
+		if err := h.logSvc.LogRequest(respLog); err != nil {
+			reqLogger.Error().Err(err).Msg("Failed to log response")
+		}
+	}
+	if h.rollups != nil {
+		h.rollups.Observe(respLog)
+	}
+	if h.usage != nil && t != nil {
+		h.usage.Observe(t.ID, requestSize(), len(body), resp.StatusCode >= 500)
+	}
+	if h.slo != nil {
+		h.slo.Observe(tenantID, method, path, resp.StatusCode >= 500, duration)
+	}
+
+	// Publish snapshot to live inspectors
+	if h.inspector != nil && h.inspector.Active() {
+		h.inspector.Publish(&inspector.Snapshot{
+			TraceID:         traceID,
+			Timestamp:       startTime,
+			Method:          strings.Clone(method),
+			Path:            strings.Clone(path),
+			URL:             targetURL,
+			ClientIP:        strings.Clone(c.IP()),
+			StatusCode:      resp.StatusCode,
+			DurationMs:      float64(duration) / float64(time.Millisecond),
+			RequestHeaders:  cloneHeaders(c.GetReqHeaders()),
+			ResponseHeaders: cloneHeaders(resp.Header),
+			RequestBody:     string(reqBody),
+			ResponseBody:    string(body),
+		})
+	}
 
 	// Update metrics
-	h.metrics.ObserveRequestDuration(method, path, strconv.Itoa(resp.StatusCode), duration)
-	h.metrics.IncRequestCounter(method, path, strconv.Itoa(resp.StatusCode))
+	h.metrics.ObserveRequestDuration(method, path, strconv.Itoa(resp.StatusCode), tenantID, duration)
+	h.metrics.IncRequestCounter(method, path, strconv.Itoa(resp.StatusCode), tenantID)
 
 	// Send response
 	c.Status(resp.StatusCode)
 	// copy all response headers
 	for k, v := range resp.Header {
-		c.Set(k, v[0])
+		setResponseHeader(c, k, v)
 	}
 
+	// Encode decoded bodies again as the client accepts
+	if encoding != "" {
+		c.Vary(fiber.HeaderAcceptEncoding)
+		if coding := negotiateEncoding(c.Get(fiber.HeaderAcceptEncoding), encoding); coding != "" {
+			encoded, err := encodeBody(coding, body)
+			if err != nil {
+				reqLogger.Error().Err(err).Str("content_encoding", coding).Msg("Failed to encode response body")
+				return err
+			}
+			h.metrics.ObserveCompression(coding, len(body), len(encoded))
+			body = encoded
+			c.Set(fiber.HeaderContentEncoding, coding)
+		}
+	} else if h.compression != nil && h.compression.compresses(resp, len(body)) {
+		// Compress uncompressed bodies, unless it does not pay off
+		c.Vary(fiber.HeaderAcceptEncoding)
+		if coding := h.compression.negotiate(c.Get(fiber.HeaderAcceptEncoding)); coding != "" {
+			encoded, err := encodeBody(coding, body)
+			if err != nil {
+				reqLogger.Error().Err(err).Str("content_encoding", coding).Msg("Failed to compress response body")
+				return err
+			}
+			if len(encoded) < len(body) {
+				h.metrics.ObserveCompression(coding, len(body), len(encoded))
+				body = encoded
+				c.Set(fiber.HeaderContentEncoding, coding)
+			}
+		}
+	}
+
+	if fault != nil && fault.Bandwidth > 0 {
+		return chaos.Throttle(c, body, fault.Bandwidth)
+	}
+	if h.slowClient != nil {
+		return h.slowClient.send(c, body)
+	}
 	return c.Send(body)
 }
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// ringPoints is the number of points each replica has on a hash ring,
+// enough for an even spread over a few replicas
+const ringPoints = 160
+
+// ringPoint is one position of a replica on a hash ring
+type ringPoint struct {
+	hash    uint32
+	replica *replica
+}
+
+// hashRing maps keys to replicas so that a change of the pool only moves
+// the keys of the replicas added or removed
+type hashRing []ringPoint
+
+func newHashRing(replicas []*replica) hashRing {
+	ring := make(hashRing, 0, len(replicas)*ringPoints)
+	for _, r := range replicas {
+		for i := 0; i < ringPoints; i++ {
+			ring = append(ring, ringPoint{hash: hashKey(r.target + "#" + strconv.Itoa(i)), replica: r})
+		}
+	}
+	slices.SortFunc(ring, func(a, b ringPoint) int { return cmp.Compare(a.hash, b.hash) })
+	return ring
+}
+
+// hashKey hashes a key the same way in every instance. FNV alone clusters
+// similar keys such as addresses, the murmur3 finalizer spreads them.
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+// lookup returns the replica owning the key, the next one clockwise when it
+// is out of rotation. It returns nil for an empty ring.
+func (ring hashRing) lookup(key string) *replica {
+	if len(ring) == 0 {
+		return nil
+	}
+	h := hashKey(key)
+	start, _ := slices.BinarySearchFunc(ring, h, func(p ringPoint, h uint32) int { return cmp.Compare(p.hash, h) })
+	for i := 0; i < len(ring); i++ {
+		if r := ring[(start+i)%len(ring)].replica; r.available() {
+			return r
+		}
+	}
+	return ring[start%len(ring)].replica
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// UpstreamReporter is notified when a checked target changes health, e.g. to
+// raise alerts
+type UpstreamReporter interface {
+	ReportUpstream(target string, healthy bool)
+}
+
+// targetHealth is the state of an actively checked target. A nil state is
+// never checked and always healthy.
+type targetHealth struct {
+	target      string
+	healthy     atomic.Bool
+	recoveredAt atomic.Int64 // Unix nanoseconds of the last recovery, for slow start
+
+	// Consecutive probe results, owned by the probe loop
+	successes, failures int
+}
+
+func newTargetHealth(target string) *targetHealth {
+	t := &targetHealth{target: target}
+	// Targets take traffic until probes prove otherwise
+	t.healthy.Store(true)
+	return t
+}
+
+// up reports whether the target is in rotation
+func (t *targetHealth) up() bool {
+	return t == nil || t.healthy.Load()
+}
+
+// healthCheck probes the targets of one route
+type healthCheck struct {
+	route  string
+	config config.HealthCheckConfig
+
+	mu      sync.Mutex
+	targets []*targetHealth
+}
+
+func newHealthCheck(route string, cfg config.HealthCheckConfig) *healthCheck {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.HealthyThreshold <= 0 {
+		cfg.HealthyThreshold = 2
+	}
+	if cfg.UnhealthyThreshold <= 0 {
+		cfg.UnhealthyThreshold = 3
+	}
+	return &healthCheck{route: route, config: cfg}
+}
+
+// track adds a target to the probes and returns its state
+func (hc *healthCheck) track(target string) *targetHealth {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	t := newTargetHealth(target)
+	hc.targets = append(hc.targets, t)
+	return t
+}
+
+// untrack stops probing a target removed by discovery
+func (hc *healthCheck) untrack(t *targetHealth) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.targets = slices.DeleteFunc(slices.Clone(hc.targets), func(o *targetHealth) bool { return o == t })
+}
+
+// list returns the probed targets
+func (hc *healthCheck) list() []*targetHealth {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.targets
+}
+
+// healthChecker runs the health checks of the routes
+type healthChecker struct {
+	checks   []*healthCheck
+	client   *http.Client
+	reporter UpstreamReporter
+	metrics  *metrics.MetricsCollector
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newHealthChecker(checks []*healthCheck, transport http.RoundTripper, reporter UpstreamReporter, metrics *metrics.MetricsCollector) *healthChecker {
+	hc := &healthChecker{
+		checks: checks,
+		client: &http.Client{
+			Transport: transport,
+			// A redirect answers the probe, it is not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		reporter: reporter,
+		metrics:  metrics,
+		done:     make(chan struct{}),
+	}
+	for _, check := range checks {
+		if metrics != nil {
+			for _, t := range check.list() {
+				metrics.ObserveUpstreamHealth(check.route, t.target, true)
+			}
+		}
+		hc.wg.Add(1)
+		go hc.run(check)
+	}
+	return hc
+}
+
+func (hc *healthChecker) run(check *healthCheck) {
+	defer hc.wg.Done()
+
+	ticker := time.NewTicker(check.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		hc.probeAll(check)
+		select {
+		case <-hc.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hc *healthChecker) probeAll(check *healthCheck) {
+	var wg sync.WaitGroup
+	for _, t := range check.list() {
+		wg.Add(1)
+		go func(t *targetHealth) {
+			defer wg.Done()
+			hc.record(check, t, hc.probe(check, t.target))
+		}(t)
+	}
+	wg.Wait()
+}
+
+// probe sends one health check request, 2xx and 3xx answers pass
+func (hc *healthChecker) probe(check *healthCheck, target string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), check.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target+check.config.Path, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+// record applies a probe result, moving the target in or out of rotation
+// once a threshold of consecutive results is reached
+func (hc *healthChecker) record(check *healthCheck, t *targetHealth, ok bool) {
+	if ok {
+		t.successes++
+		t.failures = 0
+	} else {
+		t.failures++
+		t.successes = 0
+	}
+
+	healthy := t.healthy.Load()
+	switch {
+	case !healthy && t.successes >= check.config.HealthyThreshold:
+		t.recoveredAt.Store(time.Now().UnixNano())
+		t.healthy.Store(true)
+		log.Info().Str("route", check.route).Str("target", t.target).Msg("Upstream target recovered, back in rotation")
+	case healthy && t.failures >= check.config.UnhealthyThreshold:
+		t.healthy.Store(false)
+		log.Warn().Str("route", check.route).Str("target", t.target).Msg("Upstream target unhealthy, removed from rotation")
+	default:
+		return
+	}
+
+	if hc.reporter != nil {
+		hc.reporter.ReportUpstream(t.target, t.healthy.Load())
+	}
+	if hc.metrics != nil {
+		hc.metrics.ObserveUpstreamHealth(check.route, t.target, t.healthy.Load())
+	}
+}
+
+// Close stops the probes
+func (hc *healthChecker) Close() {
+	close(hc.done)
+	hc.wg.Wait()
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// hedgeResult is the answer of one of the requests of a hedged request
+type hedgeResult struct {
+	replica *replica
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+	hedged  bool // Sent to another replica than the picked one
+}
+
+// hedges reports whether the request is hedged over the replicas of the
+// route. Only idempotent requests are, the upstream may see them twice.
+func (rt *route) hedges(req *http.Request) bool {
+	return rt != nil && rt.balancer != nil && rt.config.Hedge.Delay > 0 && idempotentMethods[req.Method]
+}
+
+// hedge sends req to the picked replica and, every delay without an answer,
+// to another available replica, up to the route maximum. The first answer
+// is returned with the replica that sent it, the other requests are
+// cancelled. A failed answer only wins once no request is left pending.
+func (h *ProxyHandler) hedge(rt *route, req *http.Request, uri string, picked *replica) (*replica, *http.Response, error) {
+	limit := rt.config.Hedge.Max
+	if limit <= 0 {
+		limit = 1
+	}
+	// Every request sends its own copy of the body
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return picked, nil, err
+		}
+		req.Body.Close()
+	}
+
+	results := make(chan hedgeResult, limit+1)
+	cancels := map[*replica]context.CancelFunc{}
+	launch := func(r *replica, hedged bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels[r] = cancel
+		try := req
+		if hedged {
+			// Released once the answer is dropped or its body closed
+			r.acquire()
+			u, err := url.Parse(r.target + uri)
+			if err != nil {
+				cancel()
+				results <- hedgeResult{replica: r, err: err, cancel: cancel, hedged: true}
+				return
+			}
+			try = req.Clone(ctx)
+			try.URL = u
+			if !rt.config.PreserveHost {
+				try.Host = ""
+			}
+		}
+		go func() {
+			resp, err := h.attempt(ctx, try, body, rt, 0)
+			results <- hedgeResult{replica: r, resp: resp, err: err, cancel: cancel, hedged: hedged}
+		}()
+	}
+
+	launch(picked, false)
+	pending, sent := 1, 0
+	timer := time.NewTimer(rt.config.Hedge.Delay)
+	defer timer.Stop()
+	// hedgeNext sends one more request, reporting false when none may be
+	hedgeNext := func() bool {
+		if sent >= limit {
+			return false
+		}
+		used := make(map[*replica]bool, len(cancels))
+		for r := range cancels {
+			used[r] = true
+		}
+		r := rt.balancer.pickOther(used)
+		if r == nil {
+			return false
+		}
+		zerolog.Ctx(req.Context()).Debug().Str("replica", r.target).Msg("Hedging upstream request")
+		h.metrics.IncHedge(rt.config.Name)
+		launch(r, true)
+		pending++
+		sent++
+		return true
+	}
+
+	var last hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			if hedgeNext() {
+				timer.Reset(rt.config.Hedge.Delay)
+			}
+			continue
+		case last = <-results:
+			pending--
+		}
+		if retryable(req, last.resp, last.err) != "" && (pending > 0 || hedgeNext()) {
+			// Another request may still answer
+			h.dropHedge(last)
+			continue
+		}
+		break
+	}
+
+	// The requests left are cancelled and their answers dropped
+	for r, cancel := range cancels {
+		if r != last.replica {
+			cancel()
+		}
+	}
+	go func(pending int) {
+		for i := 0; i < pending; i++ {
+			h.dropHedge(<-results)
+		}
+	}(pending)
+
+	if last.err != nil {
+		last.cancel()
+		if last.hedged {
+			last.replica.release()
+		}
+		return last.replica, nil, last.err
+	}
+	winner := last
+	last.resp.Body = &cancelBody{ReadCloser: last.resp.Body, cancel: func() {
+		winner.cancel()
+		if winner.hedged {
+			winner.replica.release()
+		}
+	}}
+	return last.replica, last.resp, nil
+}
+
+// dropHedge discards the answer of a hedged request not used
+func (h *ProxyHandler) dropHedge(r hedgeResult) {
+	r.cancel()
+	if r.resp != nil {
+		io.Copy(io.Discard, r.resp.Body)
+		r.resp.Body.Close()
+	}
+	if r.hedged {
+		r.replica.release()
+	}
+}
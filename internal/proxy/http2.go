@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"golang.org/x/net/http2"
+)
+
+// Upstream HTTP versions
+const (
+	UpstreamHTTP1 = "http1"
+	UpstreamHTTP2 = "http2"
+	UpstreamH2C   = "h2c"
+)
+
+// configureHTTP2 sets the HTTP version t speaks over TLS. It must run once
+// the TLS configuration of t is final, HTTP/2 is announced through it.
+func configureHTTP2(t *http.Transport, cfg config.UpstreamHTTP2Config) error {
+	switch cfg.Mode {
+	case "", UpstreamHTTP1:
+		// A non-nil map disables the implicit HTTP/2 of net/http
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return nil
+	case UpstreamHTTP2, UpstreamH2C:
+	default:
+		return fmt.Errorf("unknown upstream http2 mode %s", cfg.Mode)
+	}
+	t.ForceAttemptHTTP2 = true
+	t2, err := http2.ConfigureTransports(t)
+	if err != nil {
+		return fmt.Errorf("failed to configure upstream http2: %v", err)
+	}
+	applyHTTP2Settings(t2, cfg)
+	return nil
+}
+
+func applyHTTP2Settings(t2 *http2.Transport, cfg config.UpstreamHTTP2Config) {
+	t2.ReadIdleTimeout = cfg.ReadIdleTimeout
+	t2.PingTimeout = cfg.PingTimeout
+	t2.StrictMaxConcurrentStreams = cfg.StrictMaxConcurrentStreams
+	t2.MaxReadFrameSize = cfg.MaxReadFrameSize
+}
+
+// h2cTransport speaks HTTP/2 with prior knowledge to http:// upstreams and
+// leaves https:// ones to next
+type h2cTransport struct {
+	next http.RoundTripper
+	h2c  *http2.Transport
+}
+
+func newH2CTransport(next http.RoundTripper, cfg config.UpstreamHTTP2Config) *h2cTransport {
+	t2 := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	applyHTTP2Settings(t2, cfg)
+	return &h2cTransport{next: next, h2c: t2}
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// HeaderMaintenance marks responses produced by maintenance mode
+const HeaderMaintenance = "X-Muhtar-Maintenance"
+
+const defaultMaintenanceBody = `{"error":{"status":{{.Status}},"code":"maintenance","message":"The service is under maintenance, please retry later.","trace_id":{{json .TraceID}}}}`
+
+// MaintenancePage is the data passed to the maintenance body template
+type MaintenancePage struct {
+	Status  int
+	Route   string
+	Method  string
+	Path    string
+	TraceID string
+	Until   time.Time // Zero when the end is unknown
+}
+
+// Maintenance answers requests with a static response instead of proxying
+// them, for all routes or the selected ones, while enabled
+type Maintenance struct {
+	mu      sync.RWMutex
+	enabled bool
+	routes  map[string]bool // Empty for every request
+	until   time.Time
+	config  config.MaintenanceConfig
+	body    *template.Template
+}
+
+// NewMaintenance creates the maintenance mode controller
+func NewMaintenance(cfg config.MaintenanceConfig) (*Maintenance, error) {
+	if cfg.StatusCode == 0 {
+		cfg.StatusCode = http.StatusServiceUnavailable
+	}
+	if !validStatus(cfg.StatusCode) {
+		return nil, fmt.Errorf("invalid maintenance status %d", cfg.StatusCode)
+	}
+	text := cfg.Body
+	if text == "" {
+		text = defaultMaintenanceBody
+	}
+	body, err := template.New("maintenance").Funcs(template.FuncMap{"json": jsonString}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance body template: %v", err)
+	}
+	m := &Maintenance{config: cfg, body: body}
+	m.set(cfg.Enabled, cfg.Routes, 0)
+	return m, nil
+}
+
+func (m *Maintenance) set(enabled bool, routes []string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = enabled
+	m.routes = make(map[string]bool, len(routes))
+	for _, name := range routes {
+		m.routes[name] = true
+	}
+	m.until = time.Time{}
+	if enabled && duration > 0 {
+		m.until = time.Now().Add(duration)
+	}
+}
+
+// Active reports whether requests of the route are answered by maintenance
+// mode. A window given a duration ends by itself.
+func (m *Maintenance) Active(rt *route) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.enabled || (!m.until.IsZero() && time.Now().After(m.until)) {
+		return false
+	}
+	if len(m.routes) == 0 {
+		return true
+	}
+	return rt != nil && m.routes[rt.config.Name]
+}
+
+// Render answers the request with the maintenance response
+func (m *Maintenance) Render(c *fiber.Ctx, rt *route, traceID string) error {
+	m.mu.RLock()
+	until := m.until
+	m.mu.RUnlock()
+
+	page := MaintenancePage{
+		Status:  m.config.StatusCode,
+		Method:  c.Method(),
+		Path:    c.Path(),
+		TraceID: traceID,
+		Until:   until,
+	}
+	if rt != nil {
+		page.Route = rt.config.Name
+	}
+	var buf bytes.Buffer
+	if err := m.body.Execute(&buf, page); err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for k, v := range m.config.Headers {
+		c.Set(k, v)
+	}
+	c.Set(HeaderMaintenance, "true")
+	retryAfter := m.config.RetryAfter
+	if !until.IsZero() {
+		retryAfter = time.Until(until)
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	return c.Status(m.config.StatusCode).Send(buf.Bytes())
+}
+
+type maintenanceRequest struct {
+	Routes   []string `json:"routes"`   // Empty for every request
+	Duration string   `json:"duration"` // e.g. 30m, empty until disabled
+}
+
+// RegisterAdminRoutes mounts the maintenance mode control endpoints
+func (m *Maintenance) RegisterAdminRoutes(r fiber.Router) {
+	g := r.Group("/maintenance")
+	g.Get("/", func(c *fiber.Ctx) error {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		routes := make([]string, 0, len(m.routes))
+		for name := range m.routes {
+			routes = append(routes, name)
+		}
+		status := fiber.Map{
+			"enabled":     m.enabled,
+			"routes":      routes,
+			"status_code": m.config.StatusCode,
+		}
+		if !m.until.IsZero() {
+			status["until"] = m.until
+		}
+		return c.JSON(status)
+	})
+	g.Post("/enable", m.handleEnable)
+	g.Post("/disable", func(c *fiber.Ctx) error {
+		m.set(false, nil, 0)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+}
+
+// handleEnable starts maintenance for the routes of the body, all of them
+// without one
+func (m *Maintenance) handleEnable(c *fiber.Ctx) error {
+	var req maintenanceRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(req.Duration); err != nil || duration <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid duration")
+		}
+	}
+	m.set(true, req.Routes, duration)
+	return c.SendStatus(fiber.StatusNoContent)
+}
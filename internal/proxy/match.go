@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// pathMatch reports whether path matches pattern. A "*" segment matches any
+// single segment and a trailing "/*" matches any remaining suffix.
+func pathMatch(pattern, path string) bool {
+	if pattern == path || pattern == "*" || pattern == "/*" {
+		return true
+	}
+
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+
+	for i := range patternParts {
+		if i == len(patternParts)-1 && patternParts[i] == "*" && len(pathParts) >= len(patternParts) {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if patternParts[i] == "*" {
+			continue
+		}
+		if patternParts[i] != pathParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(pathParts)
+}
+
+// conditionsMatch reports whether the request carries the headers and query
+// parameters a route requires
+func conditionsMatch(c *fiber.Ctx, m config.RouteMatchConfig) bool {
+	for name, want := range m.Headers {
+		got := c.Request().Header.Peek(name)
+		if got == nil || (want != "" && string(got) != want) {
+			return false
+		}
+	}
+	args := c.Context().QueryArgs()
+	for name, want := range m.Query {
+		if !args.Has(name) || (want != "" && string(args.Peek(name)) != want) {
+			return false
+		}
+	}
+	return true
+}
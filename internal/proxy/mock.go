@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// HeaderMock marks responses produced by a mock route
+const HeaderMock = "X-Muhtar-Mock"
+
+// MockRequest is the data passed to mock body templates
+type MockRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// mock is a compiled MockConfig
+type mock struct {
+	config config.MockConfig
+	body   *template.Template
+}
+
+func newMock(cfg config.MockConfig) (*mock, error) {
+	if cfg.StatusCode == 0 {
+		cfg.StatusCode = http.StatusOK
+	}
+	if !validStatus(cfg.StatusCode) {
+		return nil, fmt.Errorf("invalid mock status %d", cfg.StatusCode)
+	}
+	text := cfg.Body
+	if cfg.BodyFile != "" {
+		b, err := os.ReadFile(cfg.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mock body: %v", err)
+		}
+		text = string(b)
+	}
+	body, err := template.New("mock").Funcs(template.FuncMap{"json": jsonString}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock body template: %v", err)
+	}
+	return &mock{config: cfg, body: body}, nil
+}
+
+// response renders the canned response of the route for req, after the
+// configured delay
+func (m *mock) response(req *http.Request, body []byte) (*http.Response, error) {
+	if m.config.Delay > 0 {
+		timer := time.NewTimer(m.config.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	var buf bytes.Buffer
+	err := m.body.Execute(&buf, MockRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header,
+		Body:   string(body),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render mock body: %v", err)
+	}
+
+	header := make(http.Header)
+	for k, v := range m.config.Headers {
+		header.Set(k, v)
+	}
+	header.Set(HeaderMock, "true")
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(m.config.StatusCode) + " " + http.StatusText(m.config.StatusCode),
+		StatusCode:    m.config.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(&buf),
+		ContentLength: int64(buf.Len()),
+		Request:       req,
+	}, nil
+}
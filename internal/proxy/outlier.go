@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// targetOutlier tracks the proxied requests of a target. A nil tracker
+// never ejects.
+type targetOutlier struct {
+	target       string
+	failures     atomic.Int64 // Consecutive 5xx answers and transport errors
+	ejectedUntil atomic.Int64 // Unix nanoseconds, 0 when in rotation
+}
+
+// ejected reports whether the target is out of rotation
+func (o *targetOutlier) ejected() bool {
+	return o != nil && time.Now().UnixNano() < o.ejectedUntil.Load()
+}
+
+// outlierDetector ejects the targets of a route failing consecutive
+// requests for a cooldown, without active probes
+type outlierDetector struct {
+	route   string
+	config  config.OutlierConfig
+	metrics *metrics.MetricsCollector
+
+	mu      sync.Mutex
+	targets []*targetOutlier
+}
+
+func newOutlierDetector(route string, cfg config.OutlierConfig) *outlierDetector {
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.MaxEjectedPercent <= 0 || cfg.MaxEjectedPercent > 100 {
+		cfg.MaxEjectedPercent = 50
+	}
+	return &outlierDetector{route: route, config: cfg}
+}
+
+// track adds a target to the detector and returns its tracker
+func (d *outlierDetector) track(target string) *targetOutlier {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	o := &targetOutlier{target: target}
+	d.targets = append(d.targets, o)
+	return o
+}
+
+// list returns the tracked targets
+func (d *outlierDetector) list() []*targetOutlier {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.targets
+}
+
+// untrack drops a target removed by discovery
+func (d *outlierDetector) untrack(o *targetOutlier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.targets = slices.DeleteFunc(slices.Clone(d.targets), func(t *targetOutlier) bool { return t == o })
+}
+
+// observe records the outcome of a request sent to a target
+func (d *outlierDetector) observe(o *targetOutlier, failed bool) {
+	if !failed {
+		o.failures.Store(0)
+		return
+	}
+	if o.failures.Add(1) < int64(d.config.ConsecutiveFailures) || o.ejected() {
+		return
+	}
+
+	// Keep part of the pool in rotation, ejecting every target of a route
+	// failing as a whole only moves the failure
+	targets := d.list()
+	ejected := 0
+	for _, t := range targets {
+		if t.ejected() {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(targets)*d.config.MaxEjectedPercent {
+		return
+	}
+
+	o.failures.Store(0)
+	o.ejectedUntil.Store(time.Now().Add(d.config.Cooldown).UnixNano())
+	log.Warn().Str("route", d.route).Str("target", o.target).Dur("cooldown", d.config.Cooldown).Msg("Upstream target ejected after consecutive failures")
+	if d.metrics != nil {
+		d.metrics.IncOutlierEjection(d.route, o.target)
+	}
+}
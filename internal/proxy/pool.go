@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// Upstream connection states
+const (
+	ConnOpen = "open"
+	ConnIdle = "idle"
+)
+
+// applyTargetPool replaces the pool settings of a host transport with the
+// configured ones
+func applyTargetPool(t *http.Transport, cfg config.TargetPoolConfig, conns *connTracker) {
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	t.DialContext = conns.dialer(&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive})
+	if cfg.ProxyProtocol > 0 {
+		// A header names the client of its connection, so none is shared
+		t.DisableKeepAlives = true
+		t.DialContext = proxyProtocolDialer(t.DialContext, byte(cfg.ProxyProtocol))
+	}
+}
+
+// clientAddrsKey holds the client and local addresses of a proxied request
+type clientAddrsKey struct{}
+
+// clientAddrs are the addresses a PROXY protocol header sends
+type clientAddrs struct {
+	remote net.Addr
+	local  net.Addr
+}
+
+// withClientAddrs stores the connection addresses of the client in ctx
+func withClientAddrs(ctx context.Context, remote, local net.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrsKey{}, clientAddrs{remote: remote, local: local})
+}
+
+// proxyProtocolDialer sends a PROXY protocol header with the client address
+// of the request first on each connection dialed. Requests of the proxy
+// itself, such as health probes, send a LOCAL header.
+func proxyProtocolDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), version byte) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		header := proxyproto.HeaderProxyFromAddrs(version, nil, nil)
+		if addrs, ok := ctx.Value(clientAddrsKey{}).(clientAddrs); ok {
+			header = proxyproto.HeaderProxyFromAddrs(version, addrs.remote, addrs.local)
+		}
+		if _, err := header.WriteTo(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to send proxy protocol header: %v", err)
+		}
+		return conn, nil
+	}
+}
+
+// connTracker reports the open and idle upstream connections of each
+// target. A nil tracker reports nothing.
+type connTracker struct {
+	metrics *metrics.MetricsCollector
+}
+
+func newConnTracker(m *metrics.MetricsCollector) *connTracker {
+	if m == nil {
+		return nil
+	}
+	return &connTracker{metrics: m}
+}
+
+// dialer dials with d, counting the connections opened
+func (t *connTracker) dialer(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if t == nil {
+		return d.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		t.metrics.AddUpstreamConnections(addr, ConnOpen, 1)
+		return &trackedConn{Conn: conn, target: addr, tracker: t}, nil
+	}
+}
+
+// RoundTripper follows the connections of the requests sent by next in and
+// out of the idle pools
+func (t *connTracker) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if t == nil {
+		return next
+	}
+	return &trackedTransport{next: next}
+}
+
+// trackedConn is an upstream connection counted until closed
+type trackedConn struct {
+	net.Conn
+	target  string
+	tracker *connTracker
+
+	mu     sync.Mutex
+	idle   bool
+	closed bool
+}
+
+// setIdle moves the connection in or out of the idle count
+func (c *trackedConn) setIdle(idle bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.idle == idle {
+		return
+	}
+	c.idle = idle
+	delta := -1.0
+	if idle {
+		delta = 1
+	}
+	c.tracker.metrics.AddUpstreamConnections(c.target, ConnIdle, delta)
+}
+
+func (c *trackedConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		c.tracker.metrics.AddUpstreamConnections(c.target, ConnOpen, -1)
+		if c.idle {
+			c.tracker.metrics.AddUpstreamConnections(c.target, ConnIdle, -1)
+		}
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// trackedTransport traces the connection of each request. Idle counts
+// cover HTTP/1 pools, HTTP/2 connections are shared and never idle.
+type trackedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *trackedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var conn *trackedConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if conn = unwrapConn(info.Conn); conn != nil {
+				conn.setIdle(false)
+			}
+		},
+		PutIdleConn: func(err error) {
+			if err == nil && conn != nil {
+				conn.setIdle(true)
+			}
+		},
+	}
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// unwrapConn returns the tracked connection under a TLS one
+func unwrapConn(conn net.Conn) *trackedConn {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	c, _ := conn.(*trackedConn)
+	return c
+}
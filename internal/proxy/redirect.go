@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// followRedirects resolves upstream redirects server side, up to the route's
+// hop limit. Only redirects staying on the upstream host are followed, the
+// others are returned to the client as they are.
+func (h *ProxyHandler) followRedirects(rt *route, req *http.Request, body []byte, resp *http.Response) (*http.Response, error) {
+	for hops := 0; hops < rt.config.Redirect.MaxHops && isRedirect(resp.StatusCode); hops++ {
+		loc, err := resp.Location()
+		if err != nil || loc.Host != req.URL.Host {
+			return resp, nil
+		}
+
+		next := req.Clone(req.Context())
+		next.URL = loc
+		if !rt.config.PreserveHost {
+			next.Host = ""
+		}
+		// Same semantics as net/http: 303, and 301/302 after a POST, become a GET
+		if resp.StatusCode == http.StatusSeeOther ||
+			(req.Method == http.MethodPost && (resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusFound)) {
+			next.Method = http.MethodGet
+			next.Body = nil
+			next.ContentLength = 0
+			next.Header.Del("Content-Type")
+			body = nil
+		} else if len(body) > 0 {
+			next.Body = io.NopCloser(bytes.NewReader(body))
+			next.ContentLength = int64(len(body))
+		}
+
+		resp.Body.Close()
+		if resp, err = h.proxy.Transport.RoundTrip(next); err != nil {
+			return nil, err
+		}
+		req = next
+	}
+	return resp, nil
+}
+
+// rewriteLocation replaces internal upstream hosts in the Location header with
+// the public address of the proxy, so clients never see internal URLs
+func rewriteLocation(rt *route, resp *http.Response, upstream *url.URL, c *fiber.Ctx) {
+	raw := resp.Header.Get("Location")
+	if raw == "" {
+		return
+	}
+	loc, err := url.Parse(raw)
+	if err != nil || !loc.IsAbs() {
+		return
+	}
+
+	internal := strings.EqualFold(loc.Host, upstream.Host)
+	for _, host := range rt.config.Redirect.InternalHosts {
+		if strings.EqualFold(loc.Host, host) || strings.EqualFold(loc.Hostname(), host) {
+			internal = true
+		}
+	}
+	if !internal {
+		return
+	}
+
+	public, err := url.Parse(rt.config.Redirect.PublicURL)
+	if err != nil || rt.config.Redirect.PublicURL == "" {
+		public = &url.URL{Scheme: c.Protocol(), Host: string(c.Request().Host())}
+	}
+	loc.Scheme = public.Scheme
+	loc.Host = public.Host
+	resp.Header.Set("Location", loc.String())
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// idempotentMethods may be sent again without changing the upstream state
+// twice
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodTrace:   true,
+}
+
+// retryable reports why a failed attempt may be retried, empty when it may
+// not. Transport errors and gateway statuses are transient, an open breaker
+// or a client gone away is not.
+func retryable(req *http.Request, resp *http.Response, err error) string {
+	if err != nil {
+		var open *breakerOpenError
+		if errors.As(err, &open) || errors.Is(req.Context().Err(), context.Canceled) {
+			return ""
+		}
+		return "error"
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return strconv.Itoa(resp.StatusCode)
+	}
+	return ""
+}
+
+// backoff returns the wait before a retry, doubling with every attempt.
+// Half of it is random so clients failing together do not retry together.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	wait := base << (attempt - 1)
+	if wait <= 0 || wait > 30*time.Second {
+		wait = 30 * time.Second
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// roundTrip sends the request to the upstream, retrying transient failures
+// of idempotent requests with exponential backoff
+func (h *ProxyHandler) roundTrip(req *http.Request, rt *route) (*http.Response, error) {
+	if h.config.RetryCount <= 0 || !idempotentMethods[req.Method] {
+		return h.attempt(req.Context(), req, nil, rt, 0)
+	}
+	routeName := ""
+	if rt != nil {
+		routeName = rt.config.Name
+	}
+
+	// Keep the body, transforms may have replaced it with a one-shot reader
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := h.attempt(ctx, req, body, rt, h.config.RetryAttemptTimeout)
+		reason := retryable(req, resp, err)
+		if reason == "" || attempt >= h.config.RetryCount {
+			return resp, err
+		}
+
+		wait := backoff(h.config.RetryWaitTime, attempt+1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			// Waiting would spend the time left for the answer
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		zerolog.Ctx(ctx).Debug().Err(err).Str("reason", reason).Int("attempt", attempt+1).Dur("wait", wait).Msg("Retrying upstream request")
+		h.metrics.IncRetry(routeName, reason)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/discovery"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
+	"github.com/tuncerburak97/muhtar/internal/protobuf"
+)
+
+// Redirect policies
+const (
+	RedirectPass    = "pass"
+	RedirectFollow  = "follow"
+	RedirectRewrite = "rewrite"
+)
+
+// route is a compiled RouteConfig
+type route struct {
+	config  config.RouteConfig
+	methods map[string]bool
+	rewrite *regexp.Regexp
+	// Decoders of binary protobuf bodies, nil when not configured
+	requestProto  *protobuf.Decoder
+	responseProto *protobuf.Decoder
+	// Fan-out of composite routes, nil for proxied routes
+	compose *composite
+	// Replicas of the route upstream, nil for a single target
+	balancer *balancer
+	// Source of the replicas, nil when they are listed in targets
+	discovery discovery.Resolver
+	// Weighted targets, nil without a split
+	split *split
+	// Active probes of the targets, nil without a health check
+	health *healthCheck
+	// Passive ejection of failing targets, nil when not configured
+	outliers *outlierDetector
+	// Backups of the target, nil without failover
+	failover *failover
+	// Cap of the requests in flight, nil when not configured
+	bulkhead *bulkhead
+	// Canned response, nil for proxied routes
+	mock *mock
+	// A/B test of the route, nil without one
+	experiment *experiment
+}
+
+// rewritePath applies the route rewrite rules to a raw request path
+func (r *route) rewritePath(path string) string {
+	rw := r.config.Rewrite
+	if rw.StripPrefix != "" && strings.HasPrefix(path, rw.StripPrefix) {
+		path = strings.TrimPrefix(path, rw.StripPrefix)
+	}
+	if r.rewrite != nil {
+		path = r.rewrite.ReplaceAllString(path, rw.Replacement)
+	}
+	if rw.AddPrefix != "" {
+		path = strings.TrimSuffix(rw.AddPrefix, "/") + path
+	}
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+	return path
+}
+
+// rewriteQuery applies the route query rules to a raw query string
+func (r *route) rewriteQuery(rawQuery string) string {
+	q := r.config.Query
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+
+	for _, pattern := range q.Remove {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			for name := range values {
+				if strings.HasPrefix(name, prefix) {
+					values.Del(name)
+				}
+			}
+			continue
+		}
+		values.Del(pattern)
+	}
+	for from, to := range q.Rename {
+		if v, ok := values[from]; ok {
+			values.Del(from)
+			values[to] = append(values[to], v...)
+		}
+	}
+	for name, v := range q.Set {
+		values.Set(name, v)
+	}
+	for name, v := range q.Add {
+		values.Add(name, v)
+	}
+	for name, v := range q.Defaults {
+		if !values.Has(name) {
+			values.Set(name, v)
+		}
+	}
+	return values.Encode()
+}
+
+// hasQueryRules reports whether the route changes the forwarded query
+func (r *route) hasQueryRules() bool {
+	q := r.config.Query
+	return len(q.Remove) > 0 || len(q.Rename) > 0 || len(q.Set) > 0 || len(q.Add) > 0 || len(q.Defaults) > 0
+}
+
+// mapStatus returns the client facing code of an upstream status code
+func (r *route) mapStatus(status int) (int, bool) {
+	mapped, ok := r.config.Status.Map[status]
+	return mapped, ok
+}
+
+// hasRewrite reports whether the route changes the forwarded path
+func (r *route) hasRewrite() bool {
+	rw := r.config.Rewrite
+	return rw.StripPrefix != "" || r.rewrite != nil || rw.AddPrefix != ""
+}
+
+func (r *route) matches(c *fiber.Ctx, flags *featureflag.Evaluator) bool {
+	if len(r.methods) > 0 && !r.methods[c.Method()] {
+		return false
+	}
+	if !pathMatch(r.config.Path, c.Path()) {
+		return false
+	}
+	if !conditionsMatch(c, r.config.Match) {
+		return false
+	}
+	// Flagged routes are off without a flag provider
+	return r.config.Flag == "" || flags.Boolean(r.config.Flag, false)
+}
+
+// routeTable holds the routes in configuration order
+type routeTable []*route
+
+func newRouteTable(cfgs []config.RouteConfig) (routeTable, error) {
+	table := make(routeTable, 0, len(cfgs))
+	descriptors := protobuf.NewRegistry()
+	for i, rc := range cfgs {
+		if rc.Path == "" {
+			return nil, fmt.Errorf("route %d has no path", i)
+		}
+		if rc.Name == "" {
+			rc.Name = rc.Path
+		}
+		if rc.Target != "" {
+			u, err := url.Parse(rc.Target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("route %s has an invalid target %s", rc.Name, rc.Target)
+			}
+			// The request URI is appended to the target
+			rc.Target = strings.TrimSuffix(rc.Target, "/")
+		}
+		if (rc.Target != "" && len(rc.Targets) > 0) || (len(rc.Split) > 0 && (rc.Target != "" || len(rc.Targets) > 0)) {
+			return nil, fmt.Errorf("route %s sets more than one of target, targets and split", rc.Name)
+		}
+		switch rc.Redirect.Policy {
+		case "":
+			rc.Redirect.Policy = RedirectPass
+		case RedirectPass, RedirectFollow, RedirectRewrite:
+		default:
+			return nil, fmt.Errorf("route %s: unknown redirect policy %s", rc.Name, rc.Redirect.Policy)
+		}
+		if rc.Redirect.MaxHops <= 0 {
+			rc.Redirect.MaxHops = 5
+		}
+
+		for from, to := range rc.Status.Map {
+			if !validStatus(from) || !validStatus(to) {
+				return nil, fmt.Errorf("route %s: invalid status mapping %d to %d", rc.Name, from, to)
+			}
+		}
+
+		r := &route{config: rc}
+		if rc.Rewrite.Regex != "" {
+			re, err := regexp.Compile(rc.Rewrite.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid rewrite regex: %v", rc.Name, err)
+			}
+			r.rewrite = re
+		}
+		if pb := rc.Protobuf; pb.Request != "" {
+			proto, err := descriptors.Decoder(pb.Descriptors, pb.Request)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.requestProto = proto
+		}
+		if pb := rc.Protobuf; pb.Response != "" {
+			proto, err := descriptors.Decoder(pb.Descriptors, pb.Response)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.responseProto = proto
+		}
+		if len(rc.Targets) > 0 {
+			b, err := newBalancer(rc.Targets, rc.Balancer)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.balancer = b
+		}
+		if rc.Discovery.Type != "" {
+			if rc.Target != "" || len(rc.Targets) > 0 || len(rc.Split) > 0 {
+				return nil, fmt.Errorf("route %s: discovery replaces target, targets and split", rc.Name)
+			}
+			res, err := discovery.New(rc.Discovery)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			b, err := newBalancer(nil, rc.Balancer)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.discovery = res
+			r.balancer = b
+		}
+		if rc.Balancer == BalanceConsistentHash && rc.Sticky.Source == "" {
+			// The ring is keyed on the client unless told otherwise
+			rc.Sticky.Source = StickyIP
+			r.config.Sticky.Source = StickyIP
+		}
+		if rc.Sticky.Source != "" {
+			if r.balancer == nil {
+				return nil, fmt.Errorf("route %s: sticky sessions need targets", rc.Name)
+			}
+			if err := validateSticky(rc.Sticky); err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+		}
+		if rc.Hedge.Delay > 0 && len(rc.Targets) < 2 && r.discovery == nil {
+			return nil, fmt.Errorf("route %s: hedging needs two targets or more", rc.Name)
+		}
+		if rc.Bulkhead.MaxInFlight > 0 {
+			r.bulkhead = newBulkhead(rc.Bulkhead)
+		}
+		if len(rc.Split) > 0 {
+			s, err := newSplit(rc.Split)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.split = s
+		}
+		if rc.SlowStart > 0 {
+			if r.balancer == nil && r.split == nil {
+				return nil, fmt.Errorf("route %s: slow start needs targets, discovery or split", rc.Name)
+			}
+			if r.balancer != nil {
+				r.balancer.slowStart = rc.SlowStart
+			}
+			if r.split != nil {
+				r.split.slowStart = rc.SlowStart
+			}
+		}
+		if len(rc.Failover.Backups) > 0 {
+			if rc.Target == "" {
+				return nil, fmt.Errorf("route %s: failover needs a target", rc.Name)
+			}
+			f, err := newFailover(rc.Target, rc.Failover)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.failover = f
+		}
+		if rc.HealthCheck.Path != "" {
+			if rc.Target == "" && r.balancer == nil && r.split == nil {
+				return nil, fmt.Errorf("route %s: health check needs target, targets or split", rc.Name)
+			}
+			r.health = newHealthCheck(rc.Name, rc.HealthCheck)
+			if r.failover != nil {
+				for _, t := range r.failover.targets {
+					t.health = r.health.track(t.target)
+				}
+			} else if rc.Target != "" {
+				// A single target has nowhere to fail over, it is only reported
+				r.health.track(rc.Target)
+			}
+			if r.balancer != nil {
+				for _, rep := range r.balancer.list() {
+					rep.health = r.health.track(rep.target)
+				}
+			}
+			if r.split != nil {
+				for _, t := range r.split.targets {
+					t.health = r.health.track(t.target)
+				}
+			}
+		}
+		if rc.OutlierDetection.ConsecutiveFailures > 0 {
+			if r.balancer == nil && r.split == nil {
+				return nil, fmt.Errorf("route %s: outlier detection needs targets or split", rc.Name)
+			}
+			r.outliers = newOutlierDetector(rc.Name, rc.OutlierDetection)
+			if r.balancer != nil {
+				for _, rep := range r.balancer.list() {
+					rep.outlier = r.outliers.track(rep.target)
+				}
+			}
+			if r.split != nil {
+				for _, t := range r.split.targets {
+					t.outlier = r.outliers.track(t.target)
+				}
+			}
+		}
+		if len(rc.Compose.Upstreams) > 0 {
+			cp, err := newComposite(rc.Compose)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.compose = cp
+		}
+		if rc.Mock.Enabled {
+			if r.compose != nil || r.balancer != nil || r.split != nil || r.failover != nil {
+				return nil, fmt.Errorf("route %s: a mock route has no upstream", rc.Name)
+			}
+			m, err := newMock(rc.Mock)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			r.mock = m
+		}
+		if rc.Experiment.Name != "" {
+			e, err := newExperiment(rc.Experiment)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %v", rc.Name, err)
+			}
+			for _, v := range e.variants {
+				if v.target != "" && (r.balancer != nil || r.split != nil || r.failover != nil) {
+					return nil, fmt.Errorf("route %s: variant targets replace targets, split and failover", rc.Name)
+				}
+			}
+			r.experiment = e
+		}
+		if len(rc.Methods) > 0 {
+			r.methods = make(map[string]bool, len(rc.Methods))
+			for _, m := range rc.Methods {
+				r.methods[strings.ToUpper(m)] = true
+			}
+		}
+		table = append(table, r)
+	}
+	return table, nil
+}
+
+// discovered replaces the replicas of the route with the discovered
+// targets, probing and tracking the new ones. It returns the targets
+// removed.
+func (r *route) discovered(targets []string) []string {
+	var removed []string
+	r.balancer.update(targets, func(rep *replica) {
+		if r.health != nil {
+			rep.health = r.health.track(rep.target)
+		}
+		if r.outliers != nil {
+			rep.outlier = r.outliers.track(rep.target)
+		}
+	}, func(rep *replica) {
+		removed = append(removed, rep.target)
+		if r.health != nil {
+			r.health.untrack(rep.health)
+		}
+		if r.outliers != nil {
+			r.outliers.untrack(rep.outlier)
+		}
+	})
+	return removed
+}
+
+// match returns the first route matching the request, nil when none does
+func (t routeTable) match(c *fiber.Ctx, flags *featureflag.Evaluator) *route {
+	if i := t.index(c, flags); i >= 0 {
+		return t[i]
+	}
+	return nil
+}
+
+// index returns the position of the first route matching the request in the
+// configuration, -1 when none does
+func (t routeTable) index(c *fiber.Ctx, flags *featureflag.Evaluator) int {
+	for i, r := range t {
+		if r.matches(c, flags) {
+			return i
+		}
+	}
+	return -1
+}
+
+func validStatus(code int) bool {
+	return code >= 100 && code <= 599
+}
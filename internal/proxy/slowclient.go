@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+// slowClientGuard sends responses in chunks, each with a write deadline
+// derived from the minimum transfer rate, so clients reading too slowly are
+// cut off instead of pinning a connection and its buffered body
+type slowClientGuard struct {
+	config  config.SlowClientConfig
+	metrics *metrics.MetricsCollector
+}
+
+func newSlowClientGuard(cfg config.SlowClientConfig, metrics *metrics.MetricsCollector) *slowClientGuard {
+	if cfg.Grace <= 0 {
+		cfg.Grace = time.Second
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 16 * 1024
+	}
+	return &slowClientGuard{config: cfg, metrics: metrics}
+}
+
+// send sets body as the response, written under the guard deadlines
+func (g *slowClientGuard) send(c *fiber.Ctx, body []byte) error {
+	conn := c.Context().Conn()
+	if conn == nil || len(body) == 0 {
+		return c.Send(body)
+	}
+
+	r := &deadlineReader{guard: g, conn: conn, body: body}
+	if g.config.WriteTimeout > 0 {
+		r.deadline = time.Now().Add(g.config.WriteTimeout)
+	}
+	c.Context().SetBodyStream(r, len(body))
+	return nil
+}
+
+// deadlineReader hands the body to the server chunk by chunk, moving the
+// connection write deadline forward before each one
+type deadlineReader struct {
+	guard    *slowClientGuard
+	conn     net.Conn
+	body     []byte
+	deadline time.Time
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if len(r.body) == 0 {
+		return 0, io.EOF
+	}
+	cfg := r.guard.config
+	n := cfg.ChunkSize
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.body) {
+		n = len(r.body)
+	}
+
+	var deadline time.Time
+	if cfg.MinRate > 0 {
+		deadline = time.Now().Add(cfg.Grace + time.Duration(n)*time.Second/time.Duration(cfg.MinRate))
+	}
+	if !r.deadline.IsZero() && (deadline.IsZero() || r.deadline.Before(deadline)) {
+		deadline = r.deadline
+	}
+	if !deadline.IsZero() {
+		_ = r.conn.SetWriteDeadline(deadline)
+	}
+
+	copy(p, r.body[:n])
+	r.body = r.body[n:]
+	return n, nil
+}
+
+// Close is called by the server once the response is written or aborted
+func (r *deadlineReader) Close() error {
+	if len(r.body) > 0 && r.guard.metrics != nil {
+		r.guard.metrics.IncSlowClientAborts()
+	}
+	return nil
+}
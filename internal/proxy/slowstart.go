@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"time"
+)
+
+// slowStartFloor is the traffic share a target takes right when it is back
+// in rotation, so the ramp starts from real requests
+const slowStartFloor = 0.1
+
+// rampFactor returns the share of its full traffic a target back in
+// rotation since the given time (Unix nanoseconds) takes. It grows linearly
+// from slowStartFloor to 1 over the window.
+func rampFactor(window time.Duration, since int64) float64 {
+	if window <= 0 || since == 0 {
+		return 1
+	}
+	elapsed := time.Duration(time.Now().UnixNano() - since)
+	if elapsed >= window || elapsed < 0 {
+		return 1
+	}
+	return slowStartFloor + (1-slowStartFloor)*float64(elapsed)/float64(window)
+}
+
+// recovered returns when probes put the target back in rotation, 0 when
+// they never took it out
+func (t *targetHealth) recovered() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.recoveredAt.Load()
+}
+
+// returned returns when the ejection of the target ended, 0 when it was
+// never ejected or still is
+func (o *targetOutlier) returned() int64 {
+	if o == nil {
+		return 0
+	}
+	until := o.ejectedUntil.Load()
+	if until > time.Now().UnixNano() {
+		return 0
+	}
+	return until
+}
+
+// backSince returns the latest time a target joined or came back to
+// rotation, 0 when it has been in since the start
+func backSince(health *targetHealth, outlier *targetOutlier, added int64) int64 {
+	return max(health.recovered(), outlier.returned(), added)
+}
+
+// ramp returns the traffic share of the replica under slow start
+func (r *replica) ramp(window time.Duration) float64 {
+	return rampFactor(window, backSince(r.health, r.outlier, r.added))
+}
+
+// ramp returns the weight share of the split target under slow start
+func (t *splitTarget) ramp(window time.Duration) float64 {
+	return rampFactor(window, backSince(t.health, t.outlier, 0))
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
+)
+
+// splitTarget is one weighted target of a split route
+type splitTarget struct {
+	name    string
+	target  string
+	flag    string
+	weight  atomic.Int64
+	health  *targetHealth  // Nil without health checks
+	outlier *targetOutlier // Nil without outlier detection
+}
+
+// available reports whether the target is in rotation
+func (t *splitTarget) available() bool {
+	return t.health.up() && !t.outlier.ejected()
+}
+
+// split sends the traffic of a route to weighted targets, e.g. 5% to a
+// canary. Weights can be changed at runtime.
+type split struct {
+	targets   []*splitTarget
+	slowStart time.Duration // Ramp-up window of targets back in rotation
+	mu        sync.Mutex    // Serializes weight updates
+}
+
+func newSplit(cfgs []config.SplitTarget) (*split, error) {
+	s := &split{}
+	names := make(map[string]bool, len(cfgs))
+	total := 0
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Target
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("duplicate split target %s", cfg.Name)
+		}
+		names[cfg.Name] = true
+		u, err := url.Parse(cfg.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid split target %d: %s", i, cfg.Target)
+		}
+		if cfg.Weight < 0 {
+			return nil, fmt.Errorf("negative weight for split target %s", cfg.Name)
+		}
+		total += cfg.Weight
+
+		t := &splitTarget{name: cfg.Name, target: strings.TrimSuffix(cfg.Target, "/"), flag: cfg.WeightFlag}
+		t.weight.Store(int64(cfg.Weight))
+		s.targets = append(s.targets, t)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("split weights add up to 0")
+	}
+	return s, nil
+}
+
+// pick draws the target of a request. Weight flags are evaluated per
+// request, so targeting rules can send e.g. beta tenants to the canary.
+// Unhealthy and ejected targets get no traffic unless none is left.
+func (s *split) pick(flags *featureflag.Evaluator) *splitTarget {
+	weights := make([]float64, len(s.targets))
+	total, healthy := 0.0, 0.0
+	for i, t := range s.targets {
+		w := float64(t.weight.Load())
+		if t.flag != "" {
+			w = flags.Float(t.flag, w)
+		}
+		if w > 0 {
+			w *= t.ramp(s.slowStart)
+			weights[i] = w
+			total += w
+			if t.available() {
+				healthy += w
+			}
+		}
+	}
+	if total == 0 {
+		return s.targets[0]
+	}
+	if healthy > 0 && healthy < total {
+		for i, t := range s.targets {
+			if !t.available() {
+				weights[i] = 0
+			}
+		}
+		total = healthy
+	}
+
+	n := rand.Float64() * total
+	for i, w := range weights {
+		if n < w {
+			return s.targets[i]
+		}
+		n -= w
+	}
+	return s.targets[len(s.targets)-1]
+}
+
+// setWeights replaces the weights of the named targets, the others keep
+// theirs
+func (s *split) setWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byName := make(map[string]*splitTarget, len(s.targets))
+	for _, t := range s.targets {
+		byName[t.name] = t
+	}
+	total := 0
+	for _, t := range s.targets {
+		w, ok := weights[t.name]
+		if !ok {
+			w = int(t.weight.Load())
+		}
+		if w < 0 {
+			return fmt.Errorf("negative weight for split target %s", t.name)
+		}
+		total += w
+	}
+	for name := range weights {
+		if byName[name] == nil {
+			return fmt.Errorf("unknown split target %s", name)
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("split weights add up to 0")
+	}
+
+	for name, w := range weights {
+		byName[name].weight.Store(int64(w))
+	}
+	return nil
+}
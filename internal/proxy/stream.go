@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// streamBufferSize is the most read from the upstream before a flush
+const streamBufferSize = 32 * 1024
+
+// cleanups runs the deferred work of a request when the handler returns,
+// unless a streamed response took it over
+type cleanups struct {
+	fns      []func()
+	detached bool
+}
+
+func (c *cleanups) add(fn func()) {
+	c.fns = append(c.fns, fn)
+}
+
+func (c *cleanups) run() {
+	if c.detached {
+		return
+	}
+	for i := len(c.fns) - 1; i >= 0; i-- {
+		c.fns[i]()
+	}
+}
+
+// detach hands the cleanups over to the caller, who must run the returned
+// function once done
+func (c *cleanups) detach() func() {
+	c.detached = true
+	fns := c.fns
+	return func() {
+		for i := len(fns) - 1; i >= 0; i-- {
+			fns[i]()
+		}
+	}
+}
+
+// StreamsRequests reports whether some request bodies are piped to the
+// upstream, the server must then hand them over unread
+func StreamsRequests(cfg *config.ProxyConfig) bool {
+	if cfg.StreamThreshold > 0 {
+		return true
+	}
+	for _, rt := range cfg.Routes {
+		if rt.Stream {
+			return true
+		}
+	}
+	return false
+}
+
+// streamsBody reports whether a body of the given length, -1 when unknown,
+// is piped end-to-end instead of buffered
+func (h *ProxyHandler) streamsBody(rt *route, length int64) bool {
+	if rt != nil && rt.config.Stream {
+		return true
+	}
+	return h.config.StreamThreshold > 0 && (length < 0 || length >= h.config.StreamThreshold)
+}
+
+// readBody returns the body of a buffered request. The server no longer
+// enforces its body limit once it streams request bodies, the proxy does
+// for the requests it buffers.
+func readBody(c *fiber.Ctx) ([]byte, error) {
+	stream := c.Context().RequestBodyStream()
+	if stream == nil {
+		return c.Body(), nil
+	}
+	if c.Request().Header.ContentLength() > fiber.DefaultBodyLimit {
+		return nil, fiber.ErrRequestEntityTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(stream, fiber.DefaultBodyLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > fiber.DefaultBodyLimit {
+		return nil, fiber.ErrRequestEntityTooLarge
+	}
+	c.Request().SetBody(body)
+	return c.Body(), nil
+}
+
+var errUploadReleased = errors.New("request body released")
+
+// uploadBody pipes the client request body to the upstream, counting its
+// bytes. The request stream belongs to the server once the handler returned,
+// release stops the transport from reading it any longer.
+type uploadBody struct {
+	r        io.Reader
+	read     atomic.Int64
+	mu       sync.Mutex
+	released bool
+}
+
+func newUploadBody(c *fiber.Ctx) *uploadBody {
+	r := c.Context().RequestBodyStream()
+	if r == nil {
+		// Already read, e.g. by a routing script
+		r = bytes.NewReader(c.Body())
+	}
+	return &uploadBody{r: r}
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.released {
+		return 0, errUploadReleased
+	}
+	n, err := b.r.Read(p)
+	b.read.Add(int64(n))
+	return n, err
+}
+
+// Close leaves the stream to the server, the transport may close the body
+// while the handler still runs
+func (b *uploadBody) Close() error {
+	return nil
+}
+
+// release waits for the read in progress and fails the next ones
+func (b *uploadBody) release() {
+	b.mu.Lock()
+	b.released = true
+	b.mu.Unlock()
+}
+
+// size returns the bytes sent to the upstream so far
+func (b *uploadBody) size() int64 {
+	return b.read.Load()
+}
+
+// streamsResponse reports whether the response is passed through as it
+// arrives instead of buffered
+func (h *ProxyHandler) streamsResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range h.streamTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamResponse sends the response to the client chunk by chunk, flushing
+// each as it is read. The body is written after the handler returned, done
+// is called with the bytes sent once the stream ends.
+func (h *ProxyHandler) streamResponse(c *fiber.Ctx, resp *http.Response, done func(size int64, err error)) error {
+	c.Status(resp.StatusCode)
+	for k, v := range resp.Header {
+		// The stream is sent chunked, whatever its upstream framing
+		if k == fiber.HeaderContentLength || k == fiber.HeaderTransferEncoding {
+			continue
+		}
+		setResponseHeader(c, k, v)
+	}
+
+	body := resp.Body
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		buf := make([]byte, streamBufferSize)
+		var size int64
+		var err error
+		for {
+			n, rerr := body.Read(buf)
+			if n > 0 {
+				if _, err = w.Write(buf[:n]); err != nil {
+					break
+				}
+				// A failed flush is the client gone away
+				if err = w.Flush(); err != nil {
+					break
+				}
+				size += int64(n)
+			}
+			if rerr != nil {
+				if rerr != io.EOF {
+					err = rerr
+				}
+				break
+			}
+		}
+		done(size, err)
+	})
+	return nil
+}
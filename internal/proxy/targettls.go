@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// targetTransport sends the requests of upstream hosts with their own TLS
+// and pool settings over dedicated connection pools
+type targetTransport struct {
+	next  http.RoundTripper
+	hosts map[string]*http.Transport
+}
+
+func newTargetTransport(base *http.Transport, tlsCfgs []config.TargetTLSConfig, poolCfgs []config.TargetPoolConfig, conns *connTracker) (*targetTransport, error) {
+	t := &targetTransport{next: base, hosts: make(map[string]*http.Transport, len(tlsCfgs)+len(poolCfgs))}
+	// A host listed in both gets one pool with the TLS and pool settings
+	host := func(name string) *http.Transport {
+		name = strings.ToLower(name)
+		tr, ok := t.hosts[name]
+		if !ok {
+			tr = base.Clone()
+			t.hosts[name] = tr
+		}
+		return tr
+	}
+	for _, cfg := range tlsCfgs {
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("target tls entry has no host")
+		}
+		tlsConfig, err := targetTLSConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("target tls %s: %v", cfg.Host, err)
+		}
+		host(cfg.Host).TLSClientConfig = tlsConfig
+	}
+	for _, cfg := range poolCfgs {
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("target pool entry has no host")
+		}
+		if cfg.ProxyProtocol < 0 || cfg.ProxyProtocol > 2 {
+			return nil, fmt.Errorf("target pool %s: unknown proxy protocol version %d", cfg.Host, cfg.ProxyProtocol)
+		}
+		applyTargetPool(host(cfg.Host), cfg, conns)
+	}
+	return t, nil
+}
+
+func targetTLSConfig(cfg config.TargetTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate found in %s", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (t *targetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Host)
+	tr, ok := t.hosts[host]
+	if !ok {
+		tr, ok = t.hosts[strings.ToLower(req.URL.Hostname())]
+	}
+	if ok {
+		return tr.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
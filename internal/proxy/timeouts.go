@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// timeoutError is a deadline enforced by the proxy. It reports itself as a
+// timeout so error pages and retries treat it like a transport timeout.
+type timeoutError struct {
+	msg string
+}
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+var errResponseHeaderTimeout = &timeoutError{msg: "timeout awaiting upstream response headers"}
+
+// upstreamTimeout returns the time the upstream has to answer a request of
+// the route, 0 for none
+func (h *ProxyHandler) upstreamTimeout(rt *route) time.Duration {
+	if rt != nil && rt.config.Timeouts.Upstream > 0 {
+		return rt.config.Timeouts.Upstream
+	}
+	return h.config.Timeout
+}
+
+// responseHeaderTimeout returns the time the upstream has to send response
+// headers, 0 when the transport enforces it
+func (h *ProxyHandler) responseHeaderTimeout(rt *route) time.Duration {
+	if rt != nil && rt.config.Timeouts.ResponseHeader > 0 {
+		return rt.config.Timeouts.ResponseHeader
+	}
+	return h.headerTimeout
+}
+
+// bodyReadTimeout returns the time allowed to read the response body once
+// headers arrived, 0 for none
+func (h *ProxyHandler) bodyReadTimeout(rt *route) time.Duration {
+	if rt != nil && rt.config.Timeouts.BodyRead > 0 {
+		return rt.config.Timeouts.BodyRead
+	}
+	return h.config.BodyReadTimeout
+}
+
+// cancelBody cancels the context of an attempt once its body is closed or
+// the body read timeout elapses
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	timer  *time.Timer
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.cancel()
+	return err
+}
+
+// attempt sends one try of the request, bounded by timeout and the header
+// and body read timeouts of the route. A nil body keeps the request body.
+func (h *ProxyHandler) attempt(ctx context.Context, req *http.Request, body []byte, rt *route, timeout time.Duration) (*http.Response, error) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	try := req.Clone(ctx)
+	if body != nil {
+		try.Body = io.NopCloser(bytes.NewReader(body))
+		try.ContentLength = int64(len(body))
+	}
+
+	var headerTimer *time.Timer
+	var headerTimedOut atomic.Bool
+	if d := h.responseHeaderTimeout(rt); d > 0 {
+		headerTimer = time.AfterFunc(d, func() {
+			headerTimedOut.Store(true)
+			cancel()
+		})
+	}
+	resp, err := h.proxy.Transport.RoundTrip(try)
+	if headerTimer != nil && !headerTimer.Stop() && headerTimedOut.Load() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cb := &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	if d := h.bodyReadTimeout(rt); d > 0 {
+		cb.timer = time.AfterFunc(d, cancel)
+	}
+	resp.Body = cb
+	return resp, nil
+}
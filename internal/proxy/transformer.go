@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/tuncerburak97/muhtar/internal/config"
 )
 
@@ -44,14 +43,11 @@ func (t *HttpRequestResponseTransformer) transformRequestHeaders(req *http.Reque
 		req.Header.Del(header)
 	}
 
-	// Add standard headers
-	requestID := uuid.New().String()
+	// Add standard headers, the correlation stage sets the request ID
 	standardHeaders := map[string]string{
-		"X-Request-ID":     requestID,
-		"X-Proxy-Version":  "1.0",
-		"X-Correlation-ID": requestID,
-		"Accept":           "application/json",
-		"Content-Type":     "application/json",
+		"X-Proxy-Version": "1.0",
+		"Accept":          "application/json",
+		"Content-Type":    "application/json",
 	}
 	for name, value := range standardHeaders {
 		req.Header.Set(name, value)
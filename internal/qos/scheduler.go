@@ -0,0 +1,243 @@
+package qos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+	"github.com/tuncerburak97/muhtar/internal/pipeline"
+	"github.com/tuncerburak97/muhtar/internal/tenant"
+)
+
+// Shed reasons
+const (
+	ReasonQueueFull = "queue_full"
+	ReasonTimeout   = "timeout"
+)
+
+type class struct {
+	name     string
+	rank     int
+	limit    int
+	maxQueue int
+	waiting  []chan struct{}
+	admitted uint64
+	shed     uint64
+}
+
+// Scheduler admits requests by priority class. Once the concurrency cap is
+// reached requests wait for a slot and freed slots go to the highest class
+// waiting, lower classes being shed first.
+type Scheduler struct {
+	config  *config.QoSConfig
+	metrics *metrics.MetricsCollector
+	classes []*class
+	byName  map[string]*class
+	rules   []config.PriorityRule
+	def     *class
+
+	mu       sync.Mutex
+	inflight int
+}
+
+// NewScheduler validates the classes and rules of the configuration
+func NewScheduler(cfg *config.QoSConfig, metrics *metrics.MetricsCollector) (*Scheduler, error) {
+	if cfg.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("qos max_concurrent must be positive")
+	}
+	if len(cfg.Classes) == 0 {
+		return nil, fmt.Errorf("qos needs at least one priority class")
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = time.Second
+	}
+
+	s := &Scheduler{
+		config:  cfg,
+		metrics: metrics,
+		byName:  make(map[string]*class, len(cfg.Classes)),
+		rules:   cfg.Rules,
+	}
+	for i, pc := range cfg.Classes {
+		if _, ok := s.byName[pc.Name]; ok || pc.Name == "" {
+			return nil, fmt.Errorf("invalid or duplicate priority class %q", pc.Name)
+		}
+		limit := cfg.MaxConcurrent
+		if pc.MaxShare > 0 && pc.MaxShare < 1 {
+			limit = int(float64(cfg.MaxConcurrent) * pc.MaxShare)
+			if limit < 1 {
+				limit = 1
+			}
+		}
+		c := &class{name: pc.Name, rank: i, limit: limit, maxQueue: pc.MaxQueue}
+		s.classes = append(s.classes, c)
+		s.byName[pc.Name] = c
+	}
+	for _, r := range cfg.Rules {
+		if s.byName[r.Class] == nil {
+			return nil, fmt.Errorf("priority rule uses undefined class %s", r.Class)
+		}
+	}
+
+	s.def = s.classes[len(s.classes)-1]
+	if cfg.Default != "" {
+		if s.def = s.byName[cfg.Default]; s.def == nil {
+			return nil, fmt.Errorf("default priority class %s is not defined", cfg.Default)
+		}
+	}
+	return s, nil
+}
+
+// classify returns the class of the first rule matching the request
+func (s *Scheduler) classify(c *fiber.Ctx) *class {
+	t := tenant.FromContext(c)
+	for _, r := range s.rules {
+		if r.Method != "" && r.Method != c.Method() {
+			continue
+		}
+		if !strings.HasPrefix(c.Path(), r.PathPrefix) {
+			continue
+		}
+		if r.Header != "" {
+			v := c.Get(r.Header)
+			if v == "" || (r.Value != "" && v != r.Value) {
+				continue
+			}
+		}
+		if r.Tenant != "" && (t == nil || t.ID != r.Tenant) {
+			continue
+		}
+		if r.Plan != "" && (t == nil || t.Config.Plan != r.Plan) {
+			continue
+		}
+		return s.byName[r.Class]
+	}
+	return s.def
+}
+
+// admissible reports whether the class may take a slot now. Callers must
+// hold the lock.
+func (s *Scheduler) admissible(c *class) bool {
+	if s.inflight >= c.limit {
+		return false
+	}
+	// Requests of the same or a higher class queued first go before
+	for _, other := range s.classes[:c.rank+1] {
+		if len(other.waiting) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire takes a slot for the class, waiting up to the queue timeout. It
+// returns the shed reason when no slot was granted.
+func (s *Scheduler) acquire(c *class) (string, bool) {
+	s.mu.Lock()
+	if s.admissible(c) {
+		s.inflight++
+		c.admitted++
+		s.mu.Unlock()
+		return "", true
+	}
+	if len(c.waiting) >= c.maxQueue {
+		c.shed++
+		s.mu.Unlock()
+		return ReasonQueueFull, false
+	}
+	ready := make(chan struct{})
+	c.waiting = append(c.waiting, ready)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return "", true
+	case <-timer.C:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range c.waiting {
+		if w == ready {
+			c.waiting = append(c.waiting[:i], c.waiting[i+1:]...)
+			c.shed++
+			return ReasonTimeout, false
+		}
+	}
+	// Granted while the timer fired
+	return "", true
+}
+
+// release frees a slot and hands it to the highest class waiting
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight--
+	for _, c := range s.classes {
+		for len(c.waiting) > 0 && s.inflight < c.limit {
+			ready := c.waiting[0]
+			c.waiting = c.waiting[1:]
+			s.inflight++
+			c.admitted++
+			close(ready)
+		}
+	}
+}
+
+// Middleware admits proxied requests by priority class. It must run after
+// the tenant middleware when rules select tenants or plans.
+func (s *Scheduler) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return s.Stage(c, c.Next)
+	}
+}
+
+// Stage is the pipeline form of Middleware
+func (s *Scheduler) Stage(c *fiber.Ctx, next func() error) error {
+	cls := s.classify(c)
+	reason, ok := s.acquire(cls)
+	if !ok {
+		if s.metrics != nil {
+			s.metrics.IncLoadShed(cls.name, reason)
+		}
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(s.config.QueueTimeout.Seconds())+1))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "server overloaded")
+	}
+	// Streamed responses keep the slot until their body is sent
+	defer pipeline.Hold(c, s.release)()
+	return next()
+}
+
+// RegisterAdminRoutes mounts the admission status endpoint
+func (s *Scheduler) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/qos", s.handleStatus)
+}
+
+func (s *Scheduler) handleStatus(c *fiber.Ctx) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	classes := make([]fiber.Map, 0, len(s.classes))
+	for _, cls := range s.classes {
+		classes = append(classes, fiber.Map{
+			"name":     cls.name,
+			"limit":    cls.limit,
+			"waiting":  len(cls.waiting),
+			"admitted": cls.admitted,
+			"shed":     cls.shed,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"max_concurrent": s.config.MaxConcurrent,
+		"inflight":       s.inflight,
+		"classes":        classes,
+	})
+}
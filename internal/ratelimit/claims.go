@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bearerClaims returns the claims of the bearer token of the request that
+// limits are keyed on, nil when there is no usable token. The signature is
+// checked only when a HS256 secret is given. A token failing it is not
+// rejected here, its requests only skip the claim limits.
+func bearerClaims(c *fiber.Ctx, secret []byte, names []string) map[string]string {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	if len(secret) > 0 && !validHS256(parts, secret) {
+		return nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var all map[string]interface{}
+	if err := dec.Decode(&all); err != nil {
+		return nil
+	}
+	claims := make(map[string]string, len(names))
+	for _, name := range names {
+		switch v := all[name].(type) {
+		case string:
+			if v != "" {
+				claims[name] = v
+			}
+		case json.Number:
+			claims[name] = v.String()
+		}
+	}
+	return claims
+}
+
+// validHS256 checks the signature of the token parts
+func validHS256(parts []string, secret []byte) bool {
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(raw, &header) != nil || header.Alg != "HS256" {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
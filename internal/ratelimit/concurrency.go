@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ConcurrencyLimiter caps the requests in flight at once, next to the
+// requests per window of a Limiter
+type ConcurrencyLimiter interface {
+	// Acquire takes an in-flight slot for the request. release frees it and
+	// is nil when the request is limited.
+	Acquire(c *fiber.Ctx) (result *Result, release func())
+}
+
+// inflight counts the requests in flight of each key. Counts are local to
+// the instance, a slot lives only as long as its request.
+type inflight struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newInflight() *inflight {
+	return &inflight{counts: make(map[string]int)}
+}
+
+// acquire takes a slot of key unless max are taken
+func (f *inflight) acquire(key string, max int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts[key] >= max {
+		return false
+	}
+	f.counts[key]++
+	return true
+}
+
+func (f *inflight) release(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts[key] <= 1 {
+		delete(f.counts, key)
+		return
+	}
+	f.counts[key]--
+}
+
+// concurrencySlot is one in-flight cap of a request
+type concurrencySlot struct {
+	rule string
+	key  string
+	max  int
+}
+
+// Acquire implements the ConcurrencyLimiter interface. Route, API key and IP
+// caps apply in that order, a request takes a slot of each.
+func (s *Service) Acquire(c *fiber.Ctx) (*Result, func()) {
+	cfg := &s.config.Concurrency
+	if !s.config.Enabled || !cfg.Enabled {
+		return &Result{Limited: false}, func() {}
+	}
+	ip := c.IP()
+	if s.config.PerIP.Enabled && s.isWhitelisted(ip) {
+		return &Result{Limited: false}, func() {}
+	}
+
+	var slots []concurrencySlot
+	for _, route := range cfg.Routes {
+		if route.MaxInFlight > 0 && (route.Method == "*" || route.Method == c.Method()) && s.pathMatch(route.Path, c.Path()) {
+			slots = append(slots, concurrencySlot{rule: "concurrency:route:" + route.Path, key: "concurrency:route:" + route.Method + ":" + route.Path, max: route.MaxInFlight})
+			break
+		}
+	}
+	if cfg.PerKey > 0 {
+		if apiKey := s.apiKey(c); apiKey != "" {
+			id := s.keyID(apiKey)
+			slots = append(slots, concurrencySlot{rule: "concurrency:api_key:" + id, key: "concurrency:apikey:" + id, max: cfg.PerKey})
+		}
+	}
+	if cfg.PerIP > 0 {
+		slots = append(slots, concurrencySlot{rule: "concurrency:ip", key: "concurrency:ip:" + ip, max: cfg.PerIP})
+	}
+
+	for i, slot := range slots {
+		if !s.inflight.acquire(slot.key, slot.max) {
+			for _, taken := range slots[:i] {
+				s.inflight.release(taken.key)
+			}
+			return &Result{
+				Limited: true,
+				Rule:    slot.rule,
+				Key:     slot.key,
+				Count:   slot.max,
+				LimitHeaders: map[string]string{
+					HeaderConcurrencyLimit: strconv.Itoa(slot.max),
+				},
+			}, nil
+		}
+	}
+	return &Result{Limited: false}, func() {
+		for _, slot := range slots {
+			s.inflight.release(slot.key)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+	"github.com/tuncerburak97/muhtar/internal/tenant"
+)
+
+// EventRecorder stores the requests rejected by the rate limiter in batches.
+// Events are dropped rather than delaying requests when the buffer is full.
+type EventRecorder struct {
+	config config.RateLimitEventsConfig
+	repo   repository.RateLimitEventRepository
+	reader repository.RateLimitEventRepository
+
+	events chan *model.RateLimitEvent
+
+	mu      sync.Mutex
+	dropped int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewEventRecorder starts the event flush job. reader is used by the query
+// endpoints and may be a read replica.
+func NewEventRecorder(cfg *config.RateLimitEventsConfig, repo, reader repository.RateLimitEventRepository) *EventRecorder {
+	c := *cfg
+	if c.BufferSize <= 0 {
+		c.BufferSize = 1000
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 5 * time.Second
+	}
+
+	r := &EventRecorder{
+		config: c,
+		repo:   repo,
+		reader: reader,
+		events: make(chan *model.RateLimitEvent, c.BufferSize),
+		done:   make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+// Record queues an event for a request rejected with result
+func (r *EventRecorder) Record(c *fiber.Ctx, result *Result) {
+	event := &model.RateLimitEvent{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+		Rule:      result.Rule,
+		Key:       result.Key,
+		ClientIP:  c.IP(),
+		Method:    c.Method(),
+		Path:      c.Path(),
+		Count:     result.Count,
+	}
+	if t := tenant.FromContext(c); t != nil {
+		event.TenantID = t.ID
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		r.mu.Lock()
+		r.dropped++
+		r.mu.Unlock()
+	}
+}
+
+func (r *EventRecorder) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*model.RateLimitEvent, 0, r.config.BatchSize)
+	add := func(event *model.RateLimitEvent) {
+		batch = append(batch, event)
+		if len(batch) >= r.config.BatchSize {
+			batch = r.flush(batch)
+		}
+	}
+	for {
+		select {
+		case <-r.done:
+			// Drain the events queued before Close
+			for {
+				select {
+				case event := <-r.events:
+					add(event)
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		case event := <-r.events:
+			add(event)
+		case <-ticker.C:
+			batch = r.flush(batch)
+		}
+	}
+}
+
+// flush writes the batch and returns it emptied. Failed batches are dropped,
+// the events are diagnostics and must not pile up while the repository is down.
+func (r *EventRecorder) flush(batch []*model.RateLimitEvent) []*model.RateLimitEvent {
+	r.mu.Lock()
+	dropped := r.dropped
+	r.dropped = 0
+	r.mu.Unlock()
+	if dropped > 0 {
+		log.Warn().Int("count", dropped).Msg("Dropped rate limit events, buffer full")
+	}
+
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.repo.SaveRateLimitEvents(ctx, batch); err != nil {
+		log.Error().Err(err).Int("count", len(batch)).Msg("Failed to save rate limit events")
+	}
+	return batch[:0]
+}
+
+// Close flushes pending events and stops the job
+func (r *EventRecorder) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// RegisterAdminRoutes mounts the violation query endpoints
+func (r *EventRecorder) RegisterAdminRoutes(router fiber.Router) {
+	router.Get("/ratelimit/violations", r.handleFind)
+	router.Get("/ratelimit/violations/summary", r.handleSummary)
+}
+
+// parseFilter reads the event filter from the query string. from and to are
+// RFC3339 timestamps.
+func parseFilter(c *fiber.Ctx) (model.RateLimitEventFilter, error) {
+	filter := model.RateLimitEventFilter{
+		Rule:     c.Query("rule"),
+		Key:      c.Query("key"),
+		ClientIP: c.Query("client_ip"),
+		TenantID: c.Query("tenant"),
+		Limit:    c.QueryInt("limit"),
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "invalid from timestamp")
+		}
+		filter.From = from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, "invalid to timestamp")
+		}
+		filter.To = to
+	}
+	return filter, nil
+}
+
+func (r *EventRecorder) handleFind(c *fiber.Ctx) error {
+	filter, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	events, err := r.reader.FindRateLimitEvents(c.Context(), filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	if events == nil {
+		events = []*model.RateLimitEvent{}
+	}
+	return c.JSON(fiber.Map{
+		"count":  len(events),
+		"events": events,
+	})
+}
+
+// handleSummary groups the matching events by rule, key, client_ip,
+// tenant_id or path, defaulting to client_ip
+func (r *EventRecorder) handleSummary(c *fiber.Ctx) error {
+	filter, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
+	by := c.Query("by", model.RateLimitByClientIP)
+	switch by {
+	case model.RateLimitByRule, model.RateLimitByKey, model.RateLimitByClientIP, model.RateLimitByTenant, model.RateLimitByPath:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "by must be rule, key, client_ip, tenant_id or path")
+	}
+	groups, err := r.reader.AggregateRateLimitEvents(c.Context(), filter, by)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	if groups == nil {
+		groups = []*model.RateLimitAggregate{}
+	}
+	return c.JSON(fiber.Map{
+		"by":     by,
+		"groups": groups,
+	})
+}
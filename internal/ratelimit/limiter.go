@@ -15,6 +15,9 @@ type Result struct {
 	ResetTime    time.Time         // When the current window resets
 	RetryAfter   time.Duration     // How long to wait before retrying
 	LimitHeaders map[string]string // Rate limit headers to include in response
+	Rule         string            // Limit that produced the result, e.g. ip or route:api_v1
+	Key          string            // Counter key of the limit
+	Count        int               // Requests counted in the current window
 }
 
 // Key represents a rate limit key
@@ -25,6 +28,8 @@ type Key struct {
 	Group    string
 	ClientID string // For API key based limiting
 	UserID   string // For user based limiting
+	// Bearer token claims keyed on by claim limits
+	Claims map[string]string
 }
 
 // Store defines the interface for rate limit storage
@@ -32,8 +37,20 @@ type Store interface {
 	// Get retrieves the current count and window for a key
 	Get(ctx context.Context, key string) (int, time.Time, error)
 
-	// Increment increments the counter for a key and returns the new count
-	Increment(ctx context.Context, key string, window time.Time) (int, error)
+	// Increment adds the cost of a request to the counter for a key and
+	// returns the new count
+	Increment(ctx context.Context, key string, window time.Time, cost int) (int, error)
+
+	// Leak adds a request of the given cost to the leaky bucket of a key,
+	// which holds capacity requests and drains one per interval. It returns
+	// the level after the request and whether the request fit.
+	Leak(ctx context.Context, key string, capacity int, interval time.Duration, cost int) (float64, bool, error)
+
+	// GCRA counts a request of the given cost in the theoretical arrival time
+	// of a key, one request per emission interval with tolerance of early
+	// arrivals. It returns whether the request conforms and the arrival time
+	// after it.
+	GCRA(ctx context.Context, key string, emission, tolerance time.Duration, cost int) (bool, time.Time, error)
 
 	// Reset resets the counter for a key
 	Reset(ctx context.Context, key string) error
@@ -60,12 +77,21 @@ type Config struct {
 	Store     Store
 }
 
+// Rate limit algorithms of a rule
+const (
+	AlgorithmFixedWindow = "fixed_window"
+	AlgorithmLeakyBucket = "leaky_bucket"
+	AlgorithmGCRA        = "gcra"
+)
+
 // Headers for rate limiting
 const (
 	HeaderRateLimit     = "X-RateLimit-Limit"
 	HeaderRateRemaining = "X-RateLimit-Remaining"
 	HeaderRateReset     = "X-RateLimit-Reset"
 	HeaderRetryAfter    = "Retry-After"
+	// Cap of the concurrency limit rejecting a request
+	HeaderConcurrencyLimit = "X-Concurrency-Limit"
 )
 
 // Error types
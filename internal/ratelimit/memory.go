@@ -8,9 +8,12 @@ import (
 
 // MemoryStore implements Store interface using in-memory storage
 type MemoryStore struct {
-	mu    sync.RWMutex
-	data  map[string]*window
-	clean *time.Ticker
+	mu      sync.RWMutex
+	data    map[string]*window
+	buckets map[string]*bucket
+	// Theoretical arrival times of GCRA keys
+	arrivals map[string]time.Time
+	clean    *time.Ticker
 }
 
 type window struct {
@@ -18,11 +21,20 @@ type window struct {
 	resetTime time.Time
 }
 
+// bucket is the state of a leaky bucket, emptyAt is when it drains fully
+type bucket struct {
+	level   float64
+	last    time.Time
+	emptyAt time.Time
+}
+
 // NewMemoryStore creates a new memory-based store
 func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
 	store := &MemoryStore{
-		data:  make(map[string]*window),
-		clean: time.NewTicker(cleanupInterval),
+		data:     make(map[string]*window),
+		buckets:  make(map[string]*bucket),
+		arrivals: make(map[string]time.Time),
+		clean:    time.NewTicker(cleanupInterval),
 	}
 
 	go store.cleanup()
@@ -38,6 +50,16 @@ func (s *MemoryStore) cleanup() {
 				delete(s.data, key)
 			}
 		}
+		for key, b := range s.buckets {
+			if now.After(b.emptyAt) {
+				delete(s.buckets, key)
+			}
+		}
+		for key, tat := range s.arrivals {
+			if now.After(tat) {
+				delete(s.arrivals, key)
+			}
+		}
 		s.mu.Unlock()
 	}
 }
@@ -55,32 +77,80 @@ func (s *MemoryStore) Get(ctx context.Context, key string) (int, time.Time, erro
 	return 0, time.Now(), nil
 }
 
-func (s *MemoryStore) Increment(ctx context.Context, key string, resetTime time.Time) (int, error) {
+func (s *MemoryStore) Increment(ctx context.Context, key string, resetTime time.Time, cost int) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now()
 	if w, exists := s.data[key]; exists {
 		if now.After(w.resetTime) {
-			w.count = 1
+			w.count = cost
 			w.resetTime = resetTime
 		} else {
-			w.count++
+			w.count += cost
 		}
 		return w.count, nil
 	}
 
 	s.data[key] = &window{
-		count:     1,
+		count:     cost,
 		resetTime: resetTime,
 	}
-	return 1, nil
+	return cost, nil
+}
+
+func (s *MemoryStore) Leak(ctx context.Context, key string, capacity int, interval time.Duration, cost int) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{last: now}
+		s.buckets[key] = b
+	}
+	b.level = drained(b.level, now.Sub(b.last), interval)
+	b.last = now
+	if b.level+float64(cost) > float64(capacity) {
+		return b.level, false, nil
+	}
+	b.level += float64(cost)
+	b.emptyAt = now.Add(time.Duration(b.level * float64(interval)))
+	return b.level, true, nil
+}
+
+// drained returns the level of a leaky bucket after elapsed
+func drained(level float64, elapsed, interval time.Duration) float64 {
+	if interval <= 0 {
+		return 0
+	}
+	return max(0, level-float64(elapsed)/float64(interval))
+}
+
+func (s *MemoryStore) GCRA(ctx context.Context, key string, emission, tolerance time.Duration, cost int) (bool, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	tat := s.arrivals[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	// The last of the cost units must arrive within the tolerance
+	if tat.Sub(now)+time.Duration(cost-1)*emission > tolerance {
+		return false, tat, nil
+	}
+	tat = tat.Add(time.Duration(cost) * emission)
+	s.arrivals[key] = tat
+	return true, tat, nil
 }
 
 func (s *MemoryStore) Reset(ctx context.Context, key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.data, key)
+	delete(s.buckets, key)
+	delete(s.arrivals, key)
 	return nil
 }
 
@@ -88,6 +158,8 @@ func (s *MemoryStore) Close() error {
 	s.clean.Stop()
 	s.mu.Lock()
 	s.data = nil
+	s.buckets = nil
+	s.arrivals = nil
 	s.mu.Unlock()
 	return nil
 }
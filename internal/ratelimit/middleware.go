@@ -2,17 +2,67 @@ package ratelimit
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/pipeline"
 )
 
+// MiddlewareOption configures the rate limit middleware
+type MiddlewareOption func(*middleware)
+
+type middleware struct {
+	events *EventRecorder
+}
+
+// WithEvents records every rejected request. A nil recorder is ignored.
+func WithEvents(r *EventRecorder) MiddlewareOption {
+	return func(m *middleware) {
+		m.events = r
+	}
+}
+
 // Middleware creates a new rate limit middleware
-func Middleware(limiter Limiter) fiber.Handler {
+func Middleware(limiter Limiter, opts ...MiddlewareOption) fiber.Handler {
+	stage := Stage(limiter, opts...)
 	return func(c *fiber.Ctx) error {
+		return stage(c, c.Next)
+	}
+}
+
+// Stage creates the pipeline form of Middleware
+func Stage(limiter Limiter, opts ...MiddlewareOption) func(c *fiber.Ctx, next func() error) error {
+	m := &middleware{}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	concurrency, _ := limiter.(ConcurrencyLimiter)
+
+	return func(c *fiber.Ctx, next func() error) error {
+		// Slots are taken first so a request rejected for them is not
+		// counted in the windows
+		if concurrency != nil {
+			result, release := concurrency.Acquire(c)
+			if result.Limited {
+				if m.events != nil {
+					m.events.Record(c, result)
+				}
+				for header, value := range result.LimitHeaders {
+					c.Set(header, value)
+				}
+				return fiber.NewError(fiber.StatusTooManyRequests, "too many concurrent requests")
+			}
+			// Streamed responses keep the slot until their body is sent
+			defer pipeline.Hold(c, release)()
+		}
+
 		result, err := limiter.Allow(c)
 		if err != nil {
 			return err
 		}
 
 		if result.Limited {
+			if m.events != nil {
+				m.events.Record(c, result)
+			}
 			// Add rate limit headers if configured
 			for header, value := range result.LimitHeaders {
 				c.Set(header, value)
@@ -25,6 +75,6 @@ func Middleware(limiter Limiter) fiber.Handler {
 			c.Set(header, value)
 		}
 
-		return c.Next()
+		return next()
 	}
 }
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Quota headers, sent with every response of a key with a quota
+const (
+	HeaderQuotaLimit     = "X-Quota-Limit"
+	HeaderQuotaRemaining = "X-Quota-Remaining"
+	HeaderQuotaReset     = "X-Quota-Reset"
+)
+
+// Quota periods
+const (
+	QuotaDaily   = "daily"
+	QuotaMonthly = "monthly"
+)
+
+// quotaPeriod returns the label of the period holding now and when it ends,
+// in the quota time zone
+func (s *Service) quotaPeriod(period string, now time.Time) (string, time.Time) {
+	now = now.In(s.quotaLocation)
+	y, m, d := now.Date()
+	if period == QuotaMonthly {
+		return now.Format("2006-01"), time.Date(y, m+1, 1, 0, 0, 0, 0, s.quotaLocation)
+	}
+	return now.Format("2006-01-02"), time.Date(y, m, d+1, 0, 0, 0, 0, s.quotaLocation)
+}
+
+// quotas returns the daily and monthly quota of an API key, 0 when it has
+// none for a period
+func (s *Service) quotas(apiKey string) (daily, monthly int) {
+	daily, monthly = s.config.Quota.Daily, s.config.Quota.Monthly
+	if k, ok := s.apiKeys[apiKey]; ok {
+		if k.DailyQuota > 0 {
+			daily = k.DailyQuota
+		}
+		if k.MonthlyQuota > 0 {
+			monthly = k.MonthlyQuota
+		}
+	}
+	return daily, monthly
+}
+
+// quotaCounter is the state of one quota of a request
+type quotaCounter struct {
+	period string
+	limit  int
+	key    string
+	count  int
+	reset  time.Time
+}
+
+// checkQuotas counts the request in the quotas of its API key. Every quota
+// is checked before any is counted, a request one of them rejects uses up
+// none. Counters are keyed on their period, so a new day or month starts
+// from zero. The headers report the quota closest to exhaustion.
+func (s *Service) checkQuotas(ctx context.Context, key *Key, cost int) (*Result, error) {
+	daily, monthly := s.quotas(key.ClientID)
+	id := s.keyID(key.ClientID)
+	now := time.Now()
+
+	var counters []*quotaCounter
+	for _, q := range []struct {
+		period string
+		limit  int
+	}{{QuotaDaily, daily}, {QuotaMonthly, monthly}} {
+		if q.limit <= 0 {
+			continue
+		}
+		label, end := s.quotaPeriod(q.period, now)
+		counter := &quotaCounter{period: q.period, limit: q.limit, key: "quota:" + id + ":" + label, reset: end}
+		count, _, err := s.store.Get(ctx, counter.key)
+		if err != nil {
+			return nil, err
+		}
+		counter.count = count
+		if count+cost > q.limit {
+			return quotaResult(counter, true, now), nil
+		}
+		counters = append(counters, counter)
+	}
+	if len(counters) == 0 {
+		return nil, nil
+	}
+
+	var tightest *quotaCounter
+	for _, counter := range counters {
+		count, err := s.store.Increment(ctx, counter.key, counter.reset, cost)
+		if err != nil {
+			return nil, err
+		}
+		counter.count = count
+		if tightest == nil || counter.limit-counter.count < tightest.limit-tightest.count {
+			tightest = counter
+		}
+	}
+	return quotaResult(tightest, false, now), nil
+}
+
+// quotaResult reports a quota in the quota headers
+func quotaResult(q *quotaCounter, limited bool, now time.Time) *Result {
+	remaining := max(0, q.limit-q.count)
+	result := &Result{
+		Limited:   limited,
+		Rule:      "quota:" + q.period,
+		Key:       q.key,
+		Count:     q.count,
+		Remaining: remaining,
+		ResetTime: q.reset,
+		LimitHeaders: map[string]string{
+			HeaderQuotaLimit:     strconv.Itoa(q.limit),
+			HeaderQuotaRemaining: strconv.Itoa(remaining),
+			HeaderQuotaReset:     strconv.FormatInt(q.reset.Unix(), 10),
+		},
+	}
+	if limited {
+		result.RetryAfter = q.reset.Sub(now)
+		result.LimitHeaders[HeaderRetryAfter] = strconv.FormatInt(int64(result.RetryAfter.Seconds()), 10)
+	}
+	return result
+}
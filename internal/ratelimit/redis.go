@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
@@ -51,7 +52,7 @@ func NewRedisStore(host string, port int, password string, db int, timeout time.
 }
 
 func (s *RedisStore) Get(ctx context.Context, key string) (int, time.Time, error) {
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Str("operation", "Get").
 		Msg("Fetching rate limit data from Redis")
@@ -62,7 +63,7 @@ func (s *RedisStore) Get(ctx context.Context, key string) (int, time.Time, error
 
 	_, err := pipe.Exec(ctx)
 	if err != nil && err != redis.Nil {
-		log.Error().
+		zerolog.Ctx(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Msg("Failed to get rate limit data from Redis")
@@ -77,7 +78,7 @@ func (s *RedisStore) Get(ctx context.Context, key string) (int, time.Time, error
 	ttl := ttlCmd.Val()
 	resetTime := time.Now().Add(ttl)
 
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Int("count", count).
 		Dur("ttl", ttl).
@@ -87,8 +88,8 @@ func (s *RedisStore) Get(ctx context.Context, key string) (int, time.Time, error
 	return count, resetTime, nil
 }
 
-func (s *RedisStore) Increment(ctx context.Context, key string, resetTime time.Time) (int, error) {
-	log.Debug().
+func (s *RedisStore) Increment(ctx context.Context, key string, resetTime time.Time, cost int) (int, error) {
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Time("resetTime", resetTime).
 		Str("operation", "Increment").
@@ -97,7 +98,7 @@ func (s *RedisStore) Increment(ctx context.Context, key string, resetTime time.T
 	pipe := s.client.Pipeline()
 
 	// Increment the counter
-	incr := pipe.Incr(ctx, key)
+	incr := pipe.IncrBy(ctx, key, int64(cost))
 
 	// Set expiration if key is new
 	ttl := time.Until(resetTime)
@@ -105,7 +106,7 @@ func (s *RedisStore) Increment(ctx context.Context, key string, resetTime time.T
 
 	_, err := pipe.Exec(ctx)
 	if err != nil {
-		log.Error().
+		zerolog.Ctx(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Msg("Failed to increment rate limit counter in Redis")
@@ -113,7 +114,7 @@ func (s *RedisStore) Increment(ctx context.Context, key string, resetTime time.T
 	}
 
 	newCount := int(incr.Val())
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Int("newCount", newCount).
 		Dur("ttl", ttl).
@@ -122,22 +123,125 @@ func (s *RedisStore) Increment(ctx context.Context, key string, resetTime time.T
 	return newCount, nil
 }
 
+// leakScript drains and fills a leaky bucket atomically. Levels are in
+// requests, times in microseconds so rates above one request per millisecond
+// keep a drain interval. Times are stored as sent, Lua would print them in
+// 14 significant digits.
+var leakScript = redis.NewScript(`
+	local key = KEYS[1]
+	local capacity = tonumber(ARGV[1])
+	local interval = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local cost = tonumber(ARGV[4])
+
+	local bucket = redis.call('HMGET', key, 'level', 'last')
+	local level = tonumber(bucket[1] or 0)
+	local last = tonumber(bucket[2] or now)
+	if interval > 0 then
+		level = math.max(0, level - (now - last) / interval)
+	else
+		level = 0
+	end
+
+	local allowed = 0
+	if level + cost <= capacity then
+		level = level + cost
+		allowed = 1
+	end
+	redis.call('HSET', key, 'level', tostring(level), 'last', ARGV[3])
+	redis.call('PEXPIRE', key, math.max(1, math.ceil(level * interval / 1000)))
+	return {allowed, tostring(level)}
+`)
+
+func (s *RedisStore) Leak(ctx context.Context, key string, capacity int, interval time.Duration, cost int) (float64, bool, error) {
+	zerolog.Ctx(ctx).Debug().
+		Str("key", key).
+		Int("capacity", capacity).
+		Dur("interval", interval).
+		Str("operation", "Leak").
+		Msg("Adding request to leaky bucket in Redis")
+
+	res, err := leakScript.Run(ctx, s.client, []string{key}, capacity, interval.Microseconds(), time.Now().UnixMicro(), cost).Slice()
+	if err != nil {
+		zerolog.Ctx(ctx).Error().
+			Err(err).
+			Str("key", key).
+			Msg("Failed to add request to leaky bucket in Redis")
+		return 0, false, err
+	}
+	if len(res) != 2 {
+		return 0, false, fmt.Errorf("unexpected leaky bucket reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	levelStr, _ := res[1].(string)
+	level, err := strconv.ParseFloat(levelStr, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid leaky bucket level %q", levelStr)
+	}
+	return level, allowed == 1, nil
+}
+
+// gcraScript advances the theoretical arrival time of a key atomically. The
+// key holds that time alone, in microseconds so rates above one request per
+// millisecond keep an emission interval, and expires with it.
+var gcraScript = redis.NewScript(`
+	local key = KEYS[1]
+	local emission = tonumber(ARGV[1])
+	local tolerance = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local cost = tonumber(ARGV[4])
+
+	local tat = tonumber(redis.call('GET', key) or now)
+	if tat < now then
+		tat = now
+	end
+	if tat - now + (cost - 1) * emission > tolerance then
+		return {0, tat}
+	end
+	tat = tat + cost * emission
+	-- Formatted in full, Lua would print 14 significant digits
+	redis.call('SET', key, string.format('%.0f', tat), 'PX', math.max(1, math.ceil((tat - now) / 1000)))
+	return {1, tat}
+`)
+
+func (s *RedisStore) GCRA(ctx context.Context, key string, emission, tolerance time.Duration, cost int) (bool, time.Time, error) {
+	zerolog.Ctx(ctx).Debug().
+		Str("key", key).
+		Dur("emission", emission).
+		Dur("tolerance", tolerance).
+		Str("operation", "GCRA").
+		Msg("Advancing GCRA arrival time in Redis")
+
+	res, err := gcraScript.Run(ctx, s.client, []string{key}, emission.Microseconds(), tolerance.Microseconds(), time.Now().UnixMicro(), cost).Int64Slice()
+	if err != nil {
+		zerolog.Ctx(ctx).Error().
+			Err(err).
+			Str("key", key).
+			Msg("Failed to advance GCRA arrival time in Redis")
+		return false, time.Time{}, err
+	}
+	if len(res) != 2 {
+		return false, time.Time{}, fmt.Errorf("unexpected gcra reply %v", res)
+	}
+	return res[0] == 1, time.UnixMicro(res[1]), nil
+}
+
 func (s *RedisStore) Reset(ctx context.Context, key string) error {
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Str("operation", "Reset").
 		Msg("Resetting rate limit counter in Redis")
 
 	err := s.client.Del(ctx, key).Err()
 	if err != nil {
-		log.Error().
+		zerolog.Ctx(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Msg("Failed to reset rate limit counter in Redis")
 		return err
 	}
 
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Msg("Successfully reset rate limit counter")
 
@@ -171,7 +275,7 @@ func (s *RedisStore) buildWindowKey(key string, windowStart time.Time) string {
 
 // Sliding window implementation
 func (s *RedisStore) slidingWindowIncrement(ctx context.Context, key string, window time.Duration, limit int) (int, error) {
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Dur("window", window).
 		Int("limit", limit).
@@ -202,7 +306,7 @@ func (s *RedisStore) slidingWindowIncrement(ctx context.Context, key string, win
 	// Execute transaction
 	_, err := pipe.Exec(ctx)
 	if err != nil {
-		log.Error().
+		zerolog.Ctx(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Msg("Failed to process sliding window increment")
@@ -210,7 +314,7 @@ func (s *RedisStore) slidingWindowIncrement(ctx context.Context, key string, win
 	}
 
 	result := int(count.Val())
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Int("count", result).
 		Time("windowStart", windowStart).
@@ -222,7 +326,7 @@ func (s *RedisStore) slidingWindowIncrement(ctx context.Context, key string, win
 
 // Token bucket implementation
 func (s *RedisStore) tokenBucketTake(ctx context.Context, key string, capacity int, fillRate float64, fillInterval time.Duration) (bool, error) {
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Int("capacity", capacity).
 		Float64("fillRate", fillRate).
@@ -267,7 +371,7 @@ func (s *RedisStore) tokenBucketTake(ctx context.Context, key string, capacity i
 	).Result()
 
 	if err != nil {
-		log.Error().
+		zerolog.Ctx(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Msg("Failed to process token bucket take")
@@ -275,7 +379,7 @@ func (s *RedisStore) tokenBucketTake(ctx context.Context, key string, capacity i
 	}
 
 	success := result.(int64) == 1
-	log.Debug().
+	zerolog.Ctx(ctx).Debug().
 		Str("key", key).
 		Bool("success", success).
 		Int64("now", now).
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// schedule is a compiled RateLimitSchedule. Its cron expression selects the
+// minutes during which it overrides the limit of its rule.
+type schedule struct {
+	config config.RateLimitSchedule
+	loc    *time.Location
+
+	minute, hour, dom, month, dow uint64
+	// Standard cron semantics: when both day fields are restricted a day
+	// matching either of them matches
+	domAny, dowAny bool
+}
+
+func newSchedules(cfgs []config.RateLimitSchedule) ([]*schedule, error) {
+	schedules := make([]*schedule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = strconv.Itoa(i)
+		}
+		s, err := newSchedule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit schedule %s: %v", cfg.Name, err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+func newSchedule(cfg config.RateLimitSchedule) (*schedule, error) {
+	fields := strings.Fields(cfg.Cron)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %q", cfg.Cron)
+	}
+
+	s := &schedule{config: cfg, loc: time.Local}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %v", err)
+		}
+		s.loc = loc
+	}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	// 7 is another name for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	// As in cron, a field starting with * such as */2 leaves the day
+	// unrestricted for the OR of the day fields
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of *, n, a-b, each optionally
+// followed by /step, into a bit set
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepExpr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepExpr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			a, b, _ := strings.Cut(expr, "-")
+			var errA, errB error
+			lo, errA = strconv.Atoi(a)
+			hi, errB = strconv.Atoi(b)
+			if errA != nil || errB != nil || lo > hi {
+				return 0, fmt.Errorf("invalid range %q", expr)
+			}
+		default:
+			n, err := strconv.Atoi(expr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", expr)
+			}
+			lo = n
+			if !hasStep {
+				hi = n
+			}
+		}
+		if lo < min || hi > max {
+			return 0, fmt.Errorf("%q out of range %d-%d", expr, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// active reports whether t falls in a minute selected by the schedule
+func (s *schedule) active(t time.Time) bool {
+	t = t.In(s.loc)
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// maxScheduleLookahead bounds the search for the end of a schedule
+const maxScheduleLookahead = 7 * 24 * time.Hour
+
+// until returns the start of the first minute after t the schedule no longer
+// selects, at most a week ahead
+func (s *schedule) until(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.Add(maxScheduleLookahead); next.Before(limit); next = next.Add(time.Minute) {
+		if !s.active(next) {
+			return next
+		}
+	}
+	return next
+}
+
+// activeSchedule returns the first schedule selecting t, nil when none does
+func activeSchedule(schedules []*schedule, t time.Time) *schedule {
+	for _, s := range schedules {
+		if s.active(t) {
+			return s
+		}
+	}
+	return nil
+}
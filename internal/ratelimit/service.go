@@ -2,7 +2,10 @@ package ratelimit
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math"
 	"net"
 	"strconv"
 	"strings"
@@ -10,65 +13,380 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/tenant"
 )
 
 // Service implements the Limiter interface
 type Service struct {
 	config *config.RateLimitConfig
 	store  Store
+
+	// Compiled schedules of the global, per IP and route rules, routes
+	// aligned with config.Routes
+	globalSchedules []*schedule
+	ipSchedules     []*schedule
+	routeSchedules  [][]*schedule
+
+	// Limits of the listed API keys
+	apiKeys map[string]*config.APIKeyLimit
+	// Claims read from bearer tokens for the claim limits
+	claimNames []string
+	// Requests in flight under the concurrency caps
+	inflight *inflight
+	// Time zone of the quota periods
+	quotaLocation *time.Location
 }
 
 // NewService creates a new rate limiter service
-func NewService(cfg *config.RateLimitConfig, store Store) *Service {
-	return &Service{
-		config: cfg,
-		store:  store,
+func NewService(cfg *config.RateLimitConfig, store Store) (*Service, error) {
+	s := &Service{
+		config:   cfg,
+		store:    store,
+		inflight: newInflight(),
+	}
+	if err := validAlgorithm(cfg.Global.Algorithm); err != nil {
+		return nil, fmt.Errorf("global limit: %v", err)
+	}
+	if err := validAlgorithm(cfg.PerIP.Algorithm); err != nil {
+		return nil, fmt.Errorf("per ip limit: %v", err)
+	}
+	for _, route := range cfg.Routes {
+		if err := validAlgorithm(route.Algorithm); err != nil {
+			return nil, fmt.Errorf("route limit %s: %v", route.Path, err)
+		}
+	}
+	var err error
+	if s.globalSchedules, err = newSchedules(cfg.Global.Schedules); err != nil {
+		return nil, fmt.Errorf("global limit: %v", err)
+	}
+	if s.ipSchedules, err = newSchedules(cfg.PerIP.Schedules); err != nil {
+		return nil, fmt.Errorf("per ip limit: %v", err)
+	}
+	s.apiKeys = make(map[string]*config.APIKeyLimit, len(cfg.PerKey.Keys))
+	for i := range cfg.PerKey.Keys {
+		k := &cfg.PerKey.Keys[i]
+		if k.Key == "" {
+			return nil, fmt.Errorf("per key limit %d has no key", i)
+		}
+		s.apiKeys[k.Key] = k
+	}
+	for _, cl := range cfg.PerClaim.Claims {
+		if cl.Claim == "" {
+			return nil, fmt.Errorf("per claim limit has no claim")
+		}
+		s.claimNames = append(s.claimNames, cl.Claim)
+	}
+	s.quotaLocation = time.UTC
+	if cfg.Quota.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Quota.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota timezone %s: %v", cfg.Quota.Timezone, err)
+		}
+		s.quotaLocation = loc
+	}
+	for _, route := range cfg.Concurrency.Routes {
+		if route.MaxInFlight <= 0 {
+			return nil, fmt.Errorf("concurrency limit %s needs max_in_flight", route.Path)
+		}
+	}
+	s.routeSchedules = make([][]*schedule, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		if s.routeSchedules[i], err = newSchedules(route.Schedules); err != nil {
+			return nil, fmt.Errorf("route limit %s: %v", route.Path, err)
+		}
+	}
+	return s, nil
+}
+
+// limit is the effective limit of a rule at the time of a request
+type limit struct {
+	rule     string
+	key      string
+	requests int
+	window   time.Duration
+	burst    int
+	// algorithm counts the requests, fixed window when empty
+	algorithm string
+	// cost is the share of the limit the request takes
+	cost int
+	// freeze rejects every request until the given time
+	freeze time.Time
+}
+
+// scheduled applies the first of the schedules active at now to l. Scheduled
+// limits count in their own keys, so they start fresh when they take over.
+func scheduled(l limit, schedules []*schedule, now time.Time) limit {
+	sc := activeSchedule(schedules, now)
+	if sc == nil {
+		return l
+	}
+	l.rule += "@" + sc.config.Name
+	l.key += ":schedule:" + sc.config.Name
+	if sc.config.Freeze {
+		l.freeze = sc.until(now)
+		return l
+	}
+	l.requests = sc.config.Requests
+	l.burst = sc.config.Burst
+	if sc.config.Window > 0 {
+		l.window = sc.config.Window
+	}
+	return l
+}
+
+// check counts the request against l
+func (s *Service) check(ctx context.Context, l limit) (*Result, error) {
+	if !l.freeze.IsZero() {
+		retryAfter := time.Until(l.freeze)
+		return &Result{
+			Limited:    true,
+			Rule:       l.rule,
+			Key:        l.key,
+			ResetTime:  l.freeze,
+			RetryAfter: retryAfter,
+			LimitHeaders: map[string]string{
+				HeaderRateLimit:     "0",
+				HeaderRateRemaining: "0",
+				HeaderRateReset:     strconv.FormatInt(l.freeze.Unix(), 10),
+				HeaderRetryAfter:    strconv.FormatInt(int64(retryAfter.Seconds()), 10),
+			},
+		}, nil
+	}
+	if l.requests > 0 {
+		switch l.algorithm {
+		case AlgorithmLeakyBucket:
+			return s.checkLeakyBucket(ctx, l)
+		case AlgorithmGCRA:
+			return s.checkGCRA(ctx, l)
+		}
+	}
+	return s.checkLimit(ctx, l.rule, l.key, l.requests, l.window, l.burst, l.cost)
+}
+
+// checkLeakyBucket counts the request in a bucket draining requests per
+// window at a constant rate. The bucket holds burst requests on top of the
+// one draining, so bursty clients are smoothed to the drain rate.
+func (s *Service) checkLeakyBucket(ctx context.Context, l limit) (*Result, error) {
+	interval := l.window / time.Duration(l.requests)
+	capacity := l.burst + 1
+	// Buckets do not share the counters of fixed windows
+	key := l.key + ":leaky"
+	level, ok, err := s.store.Leak(ctx, key, capacity, interval, l.cost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	resetTime := now.Add(time.Duration(level * float64(interval)))
+	remaining := max(0, capacity-int(math.Ceil(level)))
+	result := &Result{
+		Rule:      l.rule,
+		Key:       key,
+		Count:     int(math.Ceil(level)),
+		Remaining: remaining,
+		ResetTime: resetTime,
+		LimitHeaders: map[string]string{
+			HeaderRateLimit:     strconv.Itoa(l.requests),
+			HeaderRateRemaining: strconv.Itoa(remaining),
+			HeaderRateReset:     strconv.FormatInt(resetTime.Unix(), 10),
+		},
+	}
+	if !ok {
+		// The request fits once the bucket drained below capacity
+		result.Limited = true
+		result.RetryAfter = time.Duration((level + float64(l.cost) - float64(capacity)) * float64(interval))
+		result.LimitHeaders[HeaderRetryAfter] = strconv.FormatInt(int64(math.Ceil(result.RetryAfter.Seconds())), 10)
+	}
+	return result, nil
+}
+
+// checkGCRA counts the request with the generic cell rate algorithm: one
+// request per window/requests, burst of them early. It keeps one time per
+// key and has no window boundary where twice the limit gets through.
+func (s *Service) checkGCRA(ctx context.Context, l limit) (*Result, error) {
+	emission := l.window / time.Duration(l.requests)
+	tolerance := time.Duration(l.burst) * emission
+	key := l.key + ":gcra"
+	ok, tat, err := s.store.GCRA(ctx, key, emission, tolerance, l.cost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	remaining := 0
+	if emission > 0 {
+		remaining = max(0, int((now.Add(tolerance).Sub(tat)+emission)/emission))
+	}
+	result := &Result{
+		Rule:      l.rule,
+		Key:       key,
+		Count:     l.burst + 1 - remaining,
+		Remaining: remaining,
+		ResetTime: tat,
+		LimitHeaders: map[string]string{
+			HeaderRateLimit:     strconv.Itoa(l.requests),
+			HeaderRateRemaining: strconv.Itoa(remaining),
+			HeaderRateReset:     strconv.FormatInt(tat.Unix(), 10),
+		},
+	}
+	if !ok {
+		result.Limited = true
+		result.RetryAfter = tat.Sub(now) + time.Duration(l.cost-1)*emission - tolerance
+		result.LimitHeaders[HeaderRetryAfter] = strconv.FormatInt(int64(math.Ceil(result.RetryAfter.Seconds())), 10)
 	}
+	return result, nil
+}
+
+// validAlgorithm checks the algorithm of a rule
+func validAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", AlgorithmFixedWindow, AlgorithmLeakyBucket, AlgorithmGCRA:
+		return nil
+	}
+	return fmt.Errorf("unknown algorithm %s", algorithm)
 }
 
 // Allow implements the Limiter interface
 func (s *Service) Allow(c *fiber.Ctx) (*Result, error) {
+	// The user context carries the request logger to the store
+	return s.allow(c.UserContext(), s.buildKey(c), tenant.FromContext(c))
+}
+
+// AllowCall checks a request received outside of fiber, e.g. a gRPC call,
+// against the route, IP and global limits
+func (s *Service) AllowCall(ctx context.Context, ip, method, path string) (*Result, error) {
+	return s.allow(ctx, &Key{IP: ip, Path: path, Method: method}, nil)
+}
+
+func (s *Service) allow(ctx context.Context, key *Key, t *tenant.Tenant) (*Result, error) {
 	if !s.config.Enabled {
 		return &Result{Limited: false}, nil
 	}
 
-	// Build rate limit key
-	key := s.buildKey(c)
-
 	// Check IP whitelist
 	if s.config.PerIP.Enabled {
-		ip := c.IP()
-		if s.isWhitelisted(ip) {
+		if s.isWhitelisted(key.IP) {
 			return &Result{Limited: false}, nil
 		}
 	}
 
-	// Find matching route limit
-	routeLimit := s.findRouteLimit(c.Method(), c.Path())
+	// Find matching route limit, its cost counts in every limit
+	route := s.findRouteLimit(key.Method, key.Path)
+	now := time.Now()
+	cost := 1
+	if route >= 0 && s.config.Routes[route].Cost > 0 {
+		cost = s.config.Routes[route].Cost
+	}
 
-	// Apply rate limits in order: Route -> IP -> Global
+	// Apply rate limits in order: Tenant -> API key -> Claims -> Route -> IP -> Global,
+	// then the quotas of the API key
 	var result *Result
 	var err error
 
-	if routeLimit != nil {
-		result, err = s.checkLimit(c.Context(), key.withSuffix("route"), routeLimit.Requests, routeLimit.Window, routeLimit.Burst)
+	if t != nil {
+		key.Group = t.ID
+		limit := t.RateLimit()
+		if limit.DailyQuota > 0 {
+			result, err = s.checkLimit(ctx, "tenant_quota", "tenant:"+t.ID+":quota", limit.DailyQuota, 24*time.Hour, 0, cost)
+			if err != nil || result.Limited {
+				return result, err
+			}
+		}
+		if limit.Requests > 0 {
+			result, err = s.checkLimit(ctx, "tenant", "tenant:"+t.ID, limit.Requests, limit.Window, limit.Burst, cost)
+			if err != nil || result.Limited {
+				return result, err
+			}
+		}
+	}
+
+	if key.ClientID != "" {
+		if l, ok := s.keyLimit(key); ok {
+			l.cost = cost
+			result, err = s.check(ctx, l)
+			if err != nil || result.Limited {
+				return result, err
+			}
+		}
+	}
+
+	if len(key.Claims) > 0 {
+		for _, cl := range s.config.PerClaim.Claims {
+			value, ok := key.Claims[cl.Claim]
+			if !ok || cl.Requests <= 0 {
+				continue
+			}
+			result, err = s.check(ctx, limit{
+				rule:     "claim:" + cl.Claim,
+				key:      "claim:" + cl.Claim + ":" + value,
+				requests: cl.Requests,
+				window:   cl.Window,
+				burst:    cl.Burst,
+				cost:     cost,
+			})
+			if err != nil || result.Limited {
+				return result, err
+			}
+		}
+	}
+
+	if route >= 0 {
+		routeLimit := &s.config.Routes[route]
+		result, err = s.check(ctx, scheduled(limit{
+			rule:      routeRule(routeLimit),
+			key:       key.withSuffix("route"),
+			requests:  routeLimit.Requests,
+			window:    routeLimit.Window,
+			burst:     routeLimit.Burst,
+			algorithm: routeLimit.Algorithm,
+			cost:      cost,
+		}, s.routeSchedules[route], now))
 		if err != nil || result.Limited {
 			return result, err
 		}
 	}
 
 	if s.config.PerIP.Enabled {
-		result, err = s.checkLimit(c.Context(), key.withSuffix("ip"), s.config.PerIP.Requests, s.config.PerIP.Window, s.config.PerIP.Burst)
+		result, err = s.check(ctx, scheduled(limit{
+			rule:      "ip",
+			key:       key.withSuffix("ip"),
+			requests:  s.config.PerIP.Requests,
+			window:    s.config.PerIP.Window,
+			burst:     s.config.PerIP.Burst,
+			algorithm: s.config.PerIP.Algorithm,
+			cost:      cost,
+		}, s.ipSchedules, now))
 		if err != nil || result.Limited {
 			return result, err
 		}
 	}
 
-	result, err = s.checkLimit(c.Context(), key.withSuffix("global"), s.config.Global.Requests, s.config.Global.Window, s.config.Global.Burst)
+	result, err = s.check(ctx, scheduled(limit{
+		rule:      "global",
+		key:       key.withSuffix("global"),
+		requests:  s.config.Global.Requests,
+		window:    s.config.Global.Window,
+		burst:     s.config.Global.Burst,
+		algorithm: s.config.Global.Algorithm,
+		cost:      cost,
+	}, s.globalSchedules, now))
 	if err != nil || result.Limited {
 		return result, err
 	}
 
+	// Only requests passing the rate limits use up quota
+	if s.config.Quota.Enabled && key.ClientID != "" {
+		quota, err := s.checkQuotas(ctx, key, cost)
+		if err != nil || (quota != nil && quota.Limited) {
+			return quota, err
+		}
+		if quota != nil {
+			for header, value := range quota.LimitHeaders {
+				result.LimitHeaders[header] = value
+			}
+		}
+	}
+
 	return result, nil
 }
 
@@ -85,11 +403,64 @@ func (s *Service) Close() error {
 // Helper methods
 
 func (s *Service) buildKey(c *fiber.Ctx) *Key {
-	return &Key{
+	key := &Key{
 		IP:     c.IP(),
 		Path:   c.Path(),
 		Method: c.Method(),
 	}
+	if s.config.PerKey.Enabled || s.config.Quota.Enabled {
+		key.ClientID = s.apiKey(c)
+	}
+	if s.config.PerClaim.Enabled && len(s.claimNames) > 0 {
+		key.Claims = bearerClaims(c, []byte(s.config.PerClaim.Secret), s.claimNames)
+	}
+	return key
+}
+
+// apiKey returns the API key of the request, from the configured header
+// first, then the query parameter
+func (s *Service) apiKey(c *fiber.Ctx) string {
+	header := s.config.PerKey.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	if v := c.Get(header); v != "" {
+		return v
+	}
+	if s.config.PerKey.Query != "" {
+		return c.Query(s.config.PerKey.Query)
+	}
+	return ""
+}
+
+// keyLimit returns the limit of the API key of the request. Listed keys have
+// their own limit, the others share the per key default. Counters and
+// events name a key by keyID, never by the key.
+func (s *Service) keyLimit(key *Key) (limit, bool) {
+	cfg := &s.config.PerKey
+	l := limit{requests: cfg.Requests, window: cfg.Window, burst: cfg.Burst}
+	if k, ok := s.apiKeys[key.ClientID]; ok {
+		l.requests, l.burst = k.Requests, k.Burst
+		if k.Window > 0 {
+			l.window = k.Window
+		}
+	}
+	if l.requests <= 0 {
+		return l, false
+	}
+	id := s.keyID(key.ClientID)
+	l.rule = "api_key:" + id
+	l.key = "apikey:" + id
+	return l, true
+}
+
+// keyID names an API key by its configured name, or a hash when unnamed
+func (s *Service) keyID(apiKey string) string {
+	if k, ok := s.apiKeys[apiKey]; ok && k.Name != "" {
+		return k.Name
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
 }
 
 func (s *Service) isWhitelisted(ip string) bool {
@@ -113,12 +484,14 @@ func (s *Service) isWhitelisted(ip string) bool {
 	return false
 }
 
-func (s *Service) findRouteLimit(method, path string) *config.RouteLimit {
-	var bestMatch *config.RouteLimit
+// findRouteLimit returns the index of the route limit applying to the
+// request, -1 when none does
+func (s *Service) findRouteLimit(method, path string) int {
+	bestMatch := -1
 	var bestPriority int
 	var bestPattern string
 
-	for _, route := range s.config.Routes {
+	for i, route := range s.config.Routes {
 		if route.Method != "*" && route.Method != method {
 			continue
 		}
@@ -128,8 +501,8 @@ func (s *Service) findRouteLimit(method, path string) *config.RouteLimit {
 		}
 
 		// If this is our first match or has higher priority
-		if bestMatch == nil || route.Priority > bestPriority {
-			bestMatch = &route
+		if bestMatch < 0 || route.Priority > bestPriority {
+			bestMatch = i
 			bestPriority = route.Priority
 			bestPattern = route.Path
 			continue
@@ -137,7 +510,7 @@ func (s *Service) findRouteLimit(method, path string) *config.RouteLimit {
 
 		// If same priority, more specific path wins
 		if route.Priority == bestPriority && len(route.Path) > len(bestPattern) {
-			bestMatch = &route
+			bestMatch = i
 			bestPattern = route.Path
 		}
 	}
@@ -173,7 +546,7 @@ func (s *Service) pathMatch(pattern, path string) bool {
 	return true
 }
 
-func (s *Service) checkLimit(ctx context.Context, key string, limit int, window time.Duration, burst int) (*Result, error) {
+func (s *Service) checkLimit(ctx context.Context, rule, key string, limit int, window time.Duration, burst, cost int) (*Result, error) {
 	count, resetTime, err := s.store.Get(ctx, key)
 	if err != nil {
 		return nil, err
@@ -186,10 +559,13 @@ func (s *Service) checkLimit(ctx context.Context, key string, limit int, window
 	}
 
 	// Check if we're within limits
-	if count >= limit+burst {
+	if count+cost > limit+burst {
 		retryAfter := resetTime.Sub(time.Now())
 		return &Result{
 			Limited:    true,
+			Rule:       rule,
+			Key:        key,
+			Count:      count,
 			Remaining:  0,
 			ResetTime:  resetTime,
 			RetryAfter: retryAfter,
@@ -203,7 +579,7 @@ func (s *Service) checkLimit(ctx context.Context, key string, limit int, window
 	}
 
 	// Increment counter
-	newCount, err := s.store.Increment(ctx, key, resetTime)
+	newCount, err := s.store.Increment(ctx, key, resetTime, cost)
 	if err != nil {
 		return nil, err
 	}
@@ -215,6 +591,9 @@ func (s *Service) checkLimit(ctx context.Context, key string, limit int, window
 
 	return &Result{
 		Limited:    false,
+		Rule:       rule,
+		Key:        key,
+		Count:      newCount,
 		Remaining:  remaining,
 		ResetTime:  resetTime,
 		RetryAfter: 0,
@@ -226,8 +605,19 @@ func (s *Service) checkLimit(ctx context.Context, key string, limit int, window
 	}, nil
 }
 
+// routeRule names a route limit by its group, falling back to its path
+func routeRule(limit *config.RouteLimit) string {
+	if limit.Group != "" {
+		return "route:" + limit.Group
+	}
+	return "route:" + limit.Path
+}
+
 // Key helper methods
 
+// String returns the counter key of the IP, route and global limits. Client
+// and user limits count in their own keys, a client changing its API key
+// must not get fresh IP counters.
 func (k *Key) String() string {
 	parts := []string{k.Method, k.Path}
 	if k.IP != "" {
@@ -236,12 +626,6 @@ func (k *Key) String() string {
 	if k.Group != "" {
 		parts = append(parts, k.Group)
 	}
-	if k.ClientID != "" {
-		parts = append(parts, k.ClientID)
-	}
-	if k.UserID != "" {
-		parts = append(parts, k.UserID)
-	}
 	return strings.Join(parts, ":")
 }
 
@@ -2,6 +2,7 @@ package couchbase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -65,20 +66,180 @@ func (r *CouchbaseRepository) Close() error {
 	return r.Cluster.Close(nil)
 }
 
+// Migrate applies pending versioned index migrations
 func (r *CouchbaseRepository) Migrate(ctx context.Context) error {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Starting Couchbase migrations")
 
-	// Create required indexes for Couchbase
-	indexes := migrations.GetCouchbaseIndexes(r.Bucket.Name())
-	for _, indexQuery := range indexes {
-		_, err := r.Cluster.Query(indexQuery, nil)
+	exec := &migrationExecutor{cluster: r.Cluster, collection: r.Bucket.DefaultCollection()}
+	applied, err := migrations.Run(ctx, exec, migrations.CouchbaseMigrations(r.Bucket.Name()))
+	if err != nil {
+		log.Error().Err(err).Msg("Couchbase migrations failed")
+		return fmt.Errorf("migration error: %v", err)
+	}
+
+	log.Info().Int("applied", applied).Msg("Couchbase migrations completed successfully")
+	return nil
+}
+
+// schemaVersionKey is the document tracking applied migrations
+const schemaVersionKey = "schema_version"
+
+type schemaVersion struct {
+	Versions []int `json:"versions"`
+}
+
+type migrationExecutor struct {
+	cluster    *gocb.Cluster
+	collection *gocb.Collection
+}
+
+func (e *migrationExecutor) EnsureVersionTable(ctx context.Context) error {
+	return nil
+}
+
+func (e *migrationExecutor) AppliedVersions(ctx context.Context) (map[int]bool, error) {
+	applied := make(map[int]bool)
+	doc, err := e.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range doc.Versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+func (e *migrationExecutor) load() (*schemaVersion, error) {
+	result, err := e.collection.Get(schemaVersionKey, nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return &schemaVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc schemaVersion
+	if err := result.Content(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Apply creates the indexes, skipping those that already exist, and records
+// the version
+func (e *migrationExecutor) Apply(ctx context.Context, m migrations.Migration) error {
+	for _, stmt := range m.Statements {
+		_, err := e.cluster.Query(stmt, &gocb.QueryOptions{Context: ctx})
 		if err != nil && !strings.Contains(err.Error(), "already exists") {
-			log.Error().Err(err).Str("query", indexQuery).Msg("Failed to create Couchbase index")
-			return fmt.Errorf("index creation error: %v", err)
+			return err
+		}
+	}
+
+	doc, err := e.load()
+	if err != nil {
+		return err
+	}
+	doc.Versions = append(doc.Versions, m.Version)
+	_, err = e.collection.Upsert(schemaVersionKey, doc, nil)
+	return err
+}
+
+func (r *CouchbaseRepository) FindLogs(ctx context.Context, filter model.LogFilter) ([]*model.Log, error) {
+	var conditions []string
+	params := make(map[string]interface{})
+
+	if filter.TenantID != "" {
+		conditions = append(conditions, "l.tenant_id = $tenant_id")
+		params["tenant_id"] = filter.TenantID
+	}
+	if filter.TraceID != "" {
+		conditions = append(conditions, "l.trace_id = $trace_id")
+		params["trace_id"] = filter.TraceID
+	}
+	if filter.ProcessType != "" {
+		conditions = append(conditions, "l.process_type = $process_type")
+		params["process_type"] = string(filter.ProcessType)
+	}
+	if filter.Method != "" {
+		conditions = append(conditions, "l.method = $method")
+		params["method"] = filter.Method
+	}
+	if filter.PathPrefix != "" {
+		conditions = append(conditions, "l.path LIKE $path")
+		params["path"] = filter.PathPrefix + "%"
+	}
+	if filter.StatusCode != 0 {
+		conditions = append(conditions, "l.status_code = $status_code")
+		params["status_code"] = filter.StatusCode
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "l.timestamp >= $from")
+		params["from"] = filter.From.Format(time.RFC3339Nano)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "l.timestamp < $to")
+		params["to"] = filter.To.Format(time.RFC3339Nano)
+	}
+
+	query := fmt.Sprintf("SELECT l.* FROM `%s` l", r.Bucket.Name())
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY l.timestamp DESC LIMIT %d OFFSET %d", filter.EffectiveLimit(), filter.Offset)
+
+	result, err := r.Cluster.Query(query, &gocb.QueryOptions{
+		NamedParameters: params,
+		Context:         ctx,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logs: %v", err)
+	}
+	defer result.Close()
+
+	var logs []*model.Log
+	for result.Next() {
+		var entry model.Log
+		if err := result.Row(&entry); err != nil {
+			return nil, fmt.Errorf("failed to decode log: %v", err)
 		}
+		logs = append(logs, &entry)
 	}
+	return logs, result.Err()
+}
 
-	log.Info().Msg("Couchbase migrations completed successfully")
+func (r *CouchbaseRepository) Ping(ctx context.Context) error {
+	report, err := r.Bucket.Ping(&gocb.PingOptions{
+		ServiceTypes: []gocb.ServiceType{gocb.ServiceTypeKeyValue},
+		Context:      ctx,
+	})
+	if err != nil {
+		return err
+	}
+	for _, results := range report.Services {
+		for _, result := range results {
+			if result.State != gocb.PingStateOk {
+				return fmt.Errorf("couchbase endpoint %s is %v", result.Remote, result.State)
+			}
+		}
+	}
 	return nil
 }
+
+func (r *CouchbaseRepository) Stats() map[string]interface{} {
+	report, err := r.Bucket.Ping(&gocb.PingOptions{})
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	stats := make(map[string]interface{})
+	for service, results := range report.Services {
+		ok := 0
+		for _, result := range results {
+			if result.State == gocb.PingStateOk {
+				ok++
+			}
+		}
+		stats[fmt.Sprintf("service_%d_endpoints", service)] = len(results)
+		stats[fmt.Sprintf("service_%d_endpoints_ok", service)] = ok
+	}
+	return stats
+}
@@ -87,8 +87,9 @@ func (f *RepositoryFactory) createRepository(dbType string, pool interface{}) (L
 	case "postgres":
 		if pgPool, ok := pool.(*pgxpool.Pool); ok {
 			return &postgres.PostgresRepository{
-				Pool:      pgPool,
-				BatchSize: cfg.Pool.BatchSize,
+				Pool:          pgPool,
+				BatchSize:     cfg.Pool.BatchSize,
+				CopyThreshold: cfg.Pool.CopyThreshold,
 			}, nil
 		}
 		return nil, fmt.Errorf("invalid pool type for postgres")
@@ -167,7 +168,13 @@ func NewRepository(cfg config.DBConfig) (LogRepository, error) {
 			cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database,
 			cfg.Pool.MaxConns, cfg.Pool.MinConns,
 		)
-		return postgres.NewPostgresRepository(connStr)
+		repo, err := postgres.NewPostgresRepository(connStr)
+		if err != nil {
+			return nil, err
+		}
+		repo.BatchSize = cfg.Pool.BatchSize
+		repo.CopyThreshold = cfg.Pool.CopyThreshold
+		return repo, nil
 
 	case "oracle":
 		connStr := ora.BuildUrl(cfg.Host, cfg.Port, cfg.Database, cfg.User, cfg.Password, nil)
@@ -184,3 +191,31 @@ func NewRepository(cfg config.DBConfig) (LogRepository, error) {
 		return nil, fmt.Errorf("unsupported database type: %s", cfg.Type)
 	}
 }
+
+// NewReadRepository connects to the read replica described by cfg.Replica,
+// falling back to the primary settings for every field left empty
+func NewReadRepository(cfg config.DBConfig) (LogRepository, error) {
+	replica := cfg.Replica
+	if replica.Host != "" {
+		cfg.Host = replica.Host
+	}
+	if replica.Port != 0 {
+		cfg.Port = replica.Port
+	}
+	if replica.User != "" {
+		cfg.User = replica.User
+	}
+	if replica.Password != "" {
+		cfg.Password = replica.Password
+	}
+	if replica.Database != "" {
+		cfg.Database = replica.Database
+	}
+	if replica.MaxConns != 0 {
+		cfg.Pool.MaxConns = replica.MaxConns
+	}
+	if replica.MinConns != 0 {
+		cfg.Pool.MinConns = replica.MinConns
+	}
+	return NewRepository(cfg)
+}
@@ -3,15 +3,73 @@ package migrations
 import (
 	"context"
 	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog"
 )
 
 type Migrator interface {
 	Migrate(ctx context.Context) error
 }
 
+// Migration is a forward-only schema change. Statements are executed one by
+// one, in order, and the version is recorded once all of them succeeded.
+type Migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+// Executor applies migrations to a single backend and tracks the applied
+// versions in its schema_version table (or equivalent)
+type Executor interface {
+	// EnsureVersionTable creates the version bookkeeping if it is missing
+	EnsureVersionTable(ctx context.Context) error
+	// AppliedVersions returns the versions already applied
+	AppliedVersions(ctx context.Context) (map[int]bool, error)
+	// Apply runs the migration statements and records its version
+	Apply(ctx context.Context, m Migration) error
+}
+
+// Run applies all pending migrations in version order and returns how many
+// were applied
+func Run(ctx context.Context, exec Executor, migrations []Migration) (int, error) {
+	log := zerolog.Ctx(ctx)
+
+	if err := exec.EnsureVersionTable(ctx); err != nil {
+		return 0, fmt.Errorf("failed to create schema_version table: %v", err)
+	}
+	applied, err := exec.AppliedVersions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema versions: %v", err)
+	}
+
+	pending := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Version < pending[j].Version
+	})
+
+	for _, m := range pending {
+		log.Info().Int("version", m.Version).Str("description", m.Description).Msg("Applying migration")
+		if err := exec.Apply(ctx, m); err != nil {
+			return 0, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+	}
+	return len(pending), nil
+}
+
 // PostgreSQL migrations
-var PostgresSchema = `
-CREATE TABLE IF NOT EXISTS http_log (
+var PostgresMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "create http_log",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS http_log (
     id UUID PRIMARY KEY,
     trace_id UUID NOT NULL,
     process_type VARCHAR(10) NOT NULL, -- 'request' or 'response'
@@ -30,18 +88,117 @@ CREATE TABLE IF NOT EXISTS http_log (
     content_length BIGINT,
     error TEXT,
     metadata JSONB
-);
-
-CREATE INDEX IF NOT EXISTS idx_http_log_trace_id ON http_log(trace_id);
-CREATE INDEX IF NOT EXISTS idx_http_log_process_type ON http_log(process_type);
-CREATE INDEX IF NOT EXISTS idx_http_log_trace_process ON http_log(trace_id, process_type);
-CREATE INDEX IF NOT EXISTS idx_http_log_timestamp ON http_log(timestamp);
-`
+)`,
+			`CREATE INDEX IF NOT EXISTS idx_http_log_trace_id ON http_log(trace_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_http_log_process_type ON http_log(process_type)`,
+			`CREATE INDEX IF NOT EXISTS idx_http_log_trace_process ON http_log(trace_id, process_type)`,
+			`CREATE INDEX IF NOT EXISTS idx_http_log_timestamp ON http_log(timestamp)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "create traffic_rollup",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS traffic_rollup (
+    minute TIMESTAMP WITH TIME ZONE NOT NULL,
+    instance VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    request_count BIGINT NOT NULL,
+    error_count BIGINT NOT NULL,
+    p50_ms DOUBLE PRECISION NOT NULL,
+    p95_ms DOUBLE PRECISION NOT NULL,
+    p99_ms DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (minute, instance, method, path, status_code)
+)`,
+			`CREATE INDEX IF NOT EXISTS idx_traffic_rollup_minute ON traffic_rollup(minute)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "create tenant_usage",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS tenant_usage (
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    tenant VARCHAR(255) NOT NULL,
+    requests BIGINT NOT NULL,
+    errors BIGINT NOT NULL,
+    bytes_in BIGINT NOT NULL,
+    bytes_out BIGINT NOT NULL,
+    PRIMARY KEY (hour, tenant)
+)`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "create tenant_limits",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS tenant_limits (
+    tenant VARCHAR(255) PRIMARY KEY,
+    requests INTEGER NOT NULL,
+    window_ms BIGINT NOT NULL,
+    burst INTEGER NOT NULL,
+    daily_quota INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+)`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "add http_log tenant_id",
+		Statements: []string{
+			`ALTER TABLE http_log ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255)`,
+			`CREATE INDEX IF NOT EXISTS idx_http_log_tenant_timestamp ON http_log(tenant_id, timestamp)`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "create tenants",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(255) PRIMARY KEY,
+    spec JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+)`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "create ratelimit_event",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS ratelimit_event (
+    id UUID PRIMARY KEY,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    rule VARCHAR(255) NOT NULL,
+    limit_key TEXT NOT NULL,
+    client_ip VARCHAR(45),
+    tenant_id VARCHAR(255),
+    method VARCHAR(10),
+    path TEXT,
+    request_count INTEGER NOT NULL
+)`,
+			`CREATE INDEX IF NOT EXISTS idx_ratelimit_event_timestamp ON ratelimit_event(timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_ratelimit_event_client_ip ON ratelimit_event(client_ip, timestamp)`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "store http_log trace_id as text",
+		Statements: []string{
+			`ALTER TABLE http_log ALTER COLUMN trace_id TYPE VARCHAR(64) USING trace_id::text`,
+		},
+	},
+}
 
-// Oracle migrations
-var OracleSchema = `
-BEGIN
-    EXECUTE IMMEDIATE 'CREATE TABLE logs (
+// Oracle migrations. Oracle runs a single statement per call and commits DDL
+// implicitly, so every statement stands alone.
+var OracleMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "create http_log",
+		Statements: []string{
+			`CREATE TABLE http_log (
         id RAW(16) PRIMARY KEY,
         trace_id RAW(16) NOT NULL,
         process_type VARCHAR2(10) NOT NULL,
@@ -60,20 +217,134 @@ BEGIN
         content_length NUMBER,
         error CLOB,
         metadata CLOB
-    )';
-EXCEPTION
-    WHEN OTHERS THEN
-        IF SQLCODE != -955 THEN
-            RAISE;
-        END IF;
-END;
-/
+    )`,
+			`CREATE INDEX idx_http_log_trace_id ON http_log(trace_id)`,
+			`CREATE INDEX idx_http_log_process_type ON http_log(process_type)`,
+			`CREATE INDEX idx_http_log_trace_process ON http_log(trace_id, process_type)`,
+			`CREATE INDEX idx_http_log_timestamp ON http_log(timestamp)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "create traffic_rollup",
+		Statements: []string{
+			`CREATE TABLE traffic_rollup (
+        minute TIMESTAMP WITH TIME ZONE NOT NULL,
+        instance VARCHAR2(255) NOT NULL,
+        method VARCHAR2(10) NOT NULL,
+        path VARCHAR2(2000) NOT NULL,
+        status_code NUMBER NOT NULL,
+        request_count NUMBER NOT NULL,
+        error_count NUMBER NOT NULL,
+        p50_ms BINARY_DOUBLE NOT NULL,
+        p95_ms BINARY_DOUBLE NOT NULL,
+        p99_ms BINARY_DOUBLE NOT NULL,
+        PRIMARY KEY (minute, instance, method, path, status_code)
+    )`,
+			`CREATE INDEX idx_traffic_rollup_minute ON traffic_rollup(minute)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "create tenant_usage",
+		Statements: []string{
+			`CREATE TABLE tenant_usage (
+        hour TIMESTAMP WITH TIME ZONE NOT NULL,
+        tenant VARCHAR2(255) NOT NULL,
+        requests NUMBER NOT NULL,
+        errors NUMBER NOT NULL,
+        bytes_in NUMBER NOT NULL,
+        bytes_out NUMBER NOT NULL,
+        PRIMARY KEY (hour, tenant)
+    )`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "create tenant_limits",
+		Statements: []string{
+			`CREATE TABLE tenant_limits (
+        tenant VARCHAR2(255) PRIMARY KEY,
+        requests NUMBER NOT NULL,
+        window_ms NUMBER NOT NULL,
+        burst NUMBER NOT NULL,
+        daily_quota NUMBER NOT NULL,
+        updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+    )`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "add http_log tenant_id",
+		Statements: []string{
+			`ALTER TABLE http_log ADD (tenant_id VARCHAR2(255))`,
+			`CREATE INDEX idx_http_log_tenant_timestamp ON http_log(tenant_id, timestamp)`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "create tenants",
+		Statements: []string{
+			`CREATE TABLE tenants (
+        id VARCHAR2(255) PRIMARY KEY,
+        spec CLOB NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL
+    )`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "create ratelimit_event",
+		Statements: []string{
+			`CREATE TABLE ratelimit_event (
+        id VARCHAR2(36) PRIMARY KEY,
+        timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+        rule VARCHAR2(255) NOT NULL,
+        limit_key VARCHAR2(2000) NOT NULL,
+        client_ip VARCHAR2(45),
+        tenant_id VARCHAR2(255),
+        method VARCHAR2(10),
+        path VARCHAR2(2000),
+        request_count NUMBER NOT NULL
+    )`,
+			`CREATE INDEX idx_ratelimit_event_timestamp ON ratelimit_event(timestamp)`,
+			`CREATE INDEX idx_ratelimit_event_client_ip ON ratelimit_event(client_ip, timestamp)`,
+		},
+	},
+	{
+		// RAW columns cannot be converted in place once they hold data
+		Version:     8,
+		Description: "store http_log trace_id as text",
+		Statements: []string{
+			`ALTER TABLE http_log ADD (trace_id_text VARCHAR2(64))`,
+			`UPDATE http_log SET trace_id_text = LOWER(REGEXP_REPLACE(RAWTOHEX(trace_id),
+        '(.{8})(.{4})(.{4})(.{4})(.{12})', '\1-\2-\3-\4-\5'))`,
+			`ALTER TABLE http_log DROP COLUMN trace_id`,
+			`ALTER TABLE http_log RENAME COLUMN trace_id_text TO trace_id`,
+			`ALTER TABLE http_log MODIFY (trace_id NOT NULL)`,
+			`CREATE INDEX idx_http_log_trace_id ON http_log(trace_id)`,
+			`CREATE INDEX idx_http_log_trace_process ON http_log(trace_id, process_type)`,
+		},
+	},
+}
 
-CREATE INDEX idx_logs_trace_id ON logs(trace_id);
-CREATE INDEX idx_logs_process_type ON logs(process_type);
-CREATE INDEX idx_logs_trace_process ON logs(trace_id, process_type);
-CREATE INDEX idx_logs_timestamp ON logs(timestamp);
-`
+// CouchbaseMigrations returns the index migrations for the given bucket
+func CouchbaseMigrations(bucketName string) []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "create log indexes",
+			Statements:  GetCouchbaseIndexes(bucketName),
+		},
+		{
+			Version:     2,
+			Description: "create tenant index",
+			Statements: []string{
+				fmt.Sprintf("CREATE INDEX idx_logs_tenant_timestamp ON `%s`(tenant_id, timestamp)", bucketName),
+			},
+		},
+	}
+}
 
 // Couchbase indexes
 func GetCouchbaseIndexes(bucketName string) []string {
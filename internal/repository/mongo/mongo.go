@@ -2,8 +2,10 @@ package mongo
 
 import (
 	"context"
+	"regexp"
 
 	"github.com/tuncerburak97/muhtar/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -41,3 +43,62 @@ func (r *MongoRepository) Migrate(ctx context.Context) error {
 func (r *MongoRepository) SaveLogs(ctx context.Context, logs []*model.Log) error {
 	return nil
 }
+
+func (r *MongoRepository) FindLogs(ctx context.Context, filter model.LogFilter) ([]*model.Log, error) {
+	query := bson.M{}
+	if filter.TenantID != "" {
+		query["tenantid"] = filter.TenantID
+	}
+	if filter.TraceID != "" {
+		query["traceid"] = filter.TraceID
+	}
+	if filter.ProcessType != "" {
+		query["processtype"] = filter.ProcessType
+	}
+	if filter.Method != "" {
+		query["method"] = filter.Method
+	}
+	if filter.PathPrefix != "" {
+		query["path"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.PathPrefix)}
+	}
+	if filter.StatusCode != 0 {
+		query["statuscode"] = filter.StatusCode
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timestamp := bson.M{}
+		if !filter.From.IsZero() {
+			timestamp["$gte"] = filter.From
+		}
+		if !filter.To.IsZero() {
+			timestamp["$lt"] = filter.To
+		}
+		query["timestamp"] = timestamp
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetLimit(int64(filter.EffectiveLimit())).
+		SetSkip(int64(filter.Offset))
+
+	cursor, err := r.db.Collection("logs").Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var logs []*model.Log
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (r *MongoRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx, nil)
+}
+
+func (r *MongoRepository) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"sessions_in_progress": r.client.NumberSessionsInProgress(),
+	}
+}
@@ -0,0 +1,353 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
+)
+
+// Monitor wraps a LogRepository with periodic health checks. After the
+// configured number of consecutive failed pings it reconnects, backing off
+// exponentially between attempts, and atomically swaps in the new backend.
+type Monitor struct {
+	config  config.DBHealthConfig
+	connect func() (LogRepository, error)
+
+	mu      sync.RWMutex
+	repo    LogRepository
+	healthy bool
+	lastErr error
+	checked time.Time
+	fails   int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMonitor starts monitoring repo. connect is used to build a replacement
+// repository when reconnecting.
+func NewMonitor(cfg config.DBHealthConfig, repo LogRepository, connect func() (LogRepository, error)) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+	if cfg.Backoff.Initial <= 0 {
+		cfg.Backoff.Initial = time.Second
+	}
+	if cfg.Backoff.Max <= 0 {
+		cfg.Backoff.Max = time.Minute
+	}
+
+	m := &Monitor{
+		config:  cfg,
+		connect: connect,
+		repo:    repo,
+		healthy: true,
+		done:    make(chan struct{}),
+	}
+
+	m.wg.Add(1)
+	go m.run()
+	return m
+}
+
+func (m *Monitor) current() LogRepository {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.repo
+}
+
+func (m *Monitor) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	m.check()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			if !m.check() && m.failures() >= m.config.FailureThreshold {
+				m.reconnect()
+			}
+		}
+	}
+}
+
+func (m *Monitor) failures() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.fails
+}
+
+// check pings the current backend and records the outcome
+func (m *Monitor) check() bool {
+	checker, ok := m.current().(HealthChecker)
+	if !ok {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	defer cancel()
+	err := checker.Ping(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checked = time.Now()
+	m.lastErr = err
+	if err != nil {
+		m.fails++
+		if m.healthy {
+			log.Error().Err(err).Msg("Repository health check failed")
+			sentry.CaptureError(err, map[string]string{"component": "repository"})
+		}
+		m.healthy = false
+		return false
+	}
+	if !m.healthy {
+		log.Info().Msg("Repository connection recovered")
+	}
+	m.fails = 0
+	m.healthy = true
+	return true
+}
+
+// reconnect replaces the backend, retrying with exponential backoff until it
+// succeeds or the monitor is closed
+func (m *Monitor) reconnect() {
+	backoff := m.config.Backoff.Initial
+	for attempt := 1; ; attempt++ {
+		log.Warn().Int("attempt", attempt).Msg("Reconnecting to repository")
+
+		repo, err := m.connect()
+		if err == nil {
+			m.mu.Lock()
+			old := m.repo
+			m.repo = repo
+			m.mu.Unlock()
+
+			if err := old.Close(); err != nil {
+				log.Warn().Err(err).Msg("Failed to close previous repository connection")
+			}
+			if m.check() {
+				log.Info().Int("attempt", attempt).Msg("Repository reconnected")
+				return
+			}
+			err = m.lastError()
+		}
+		log.Error().Err(err).Dur("backoff", backoff).Msg("Repository reconnect failed")
+
+		select {
+		case <-m.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > m.config.Backoff.Max {
+			backoff = m.config.Backoff.Max
+		}
+	}
+}
+
+func (m *Monitor) lastError() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastErr
+}
+
+// Healthy reports the result of the latest health check
+func (m *Monitor) Healthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.healthy
+}
+
+// Check returns an error when the repository is currently unreachable. It is
+// suitable as a readiness check.
+func (m *Monitor) Check(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.healthy {
+		return fmt.Errorf("repository unreachable: %v", m.lastErr)
+	}
+	return nil
+}
+
+// Status returns the health state and pool statistics of the backend
+func (m *Monitor) Status() map[string]interface{} {
+	m.mu.RLock()
+	repo, healthy, lastErr, checked, fails := m.repo, m.healthy, m.lastErr, m.checked, m.fails
+	m.mu.RUnlock()
+
+	status := map[string]interface{}{
+		"healthy":              healthy,
+		"last_check":           checked,
+		"consecutive_failures": fails,
+	}
+	if lastErr != nil {
+		status["error"] = lastErr.Error()
+	}
+	if checker, ok := repo.(HealthChecker); ok {
+		status["pool"] = checker.Stats()
+	}
+	return status
+}
+
+func (m *Monitor) SaveLog(ctx context.Context, log *model.Log) error {
+	return m.current().SaveLog(ctx, log)
+}
+
+func (m *Monitor) SaveLogs(ctx context.Context, logs []*model.Log) error {
+	return m.current().SaveLogs(ctx, logs)
+}
+
+func (m *Monitor) FindLogs(ctx context.Context, filter model.LogFilter) ([]*model.Log, error) {
+	return m.current().FindLogs(ctx, filter)
+}
+
+// SaveRollups stores rollups when the current backend supports them
+func (m *Monitor) SaveRollups(ctx context.Context, rollups []*model.Rollup) error {
+	repo, ok := m.current().(RollupRepository)
+	if !ok {
+		return ErrRollupsUnsupported
+	}
+	return repo.SaveRollups(ctx, rollups)
+}
+
+// FindRollups queries rollups when the current backend supports them
+func (m *Monitor) FindRollups(ctx context.Context, filter model.RollupFilter) ([]*model.Rollup, error) {
+	repo, ok := m.current().(RollupRepository)
+	if !ok {
+		return nil, ErrRollupsUnsupported
+	}
+	return repo.FindRollups(ctx, filter)
+}
+
+// SaveUsage stores tenant usage when the current backend supports it
+func (m *Monitor) SaveUsage(ctx context.Context, usage []*model.Usage) error {
+	repo, ok := m.current().(UsageRepository)
+	if !ok {
+		return ErrUsageUnsupported
+	}
+	return repo.SaveUsage(ctx, usage)
+}
+
+// FindUsage queries tenant usage when the current backend supports it
+func (m *Monitor) FindUsage(ctx context.Context, filter model.UsageFilter) ([]*model.Usage, error) {
+	repo, ok := m.current().(UsageRepository)
+	if !ok {
+		return nil, ErrUsageUnsupported
+	}
+	return repo.FindUsage(ctx, filter)
+}
+
+// SaveTenantLimits stores a tenant limit override when the current backend
+// supports it
+func (m *Monitor) SaveTenantLimits(ctx context.Context, limits *model.TenantLimits) error {
+	repo, ok := m.current().(TenantLimitRepository)
+	if !ok {
+		return ErrTenantLimitsUnsupported
+	}
+	return repo.SaveTenantLimits(ctx, limits)
+}
+
+// DeleteTenantLimits removes a tenant limit override when the current backend
+// supports it
+func (m *Monitor) DeleteTenantLimits(ctx context.Context, tenant string) error {
+	repo, ok := m.current().(TenantLimitRepository)
+	if !ok {
+		return ErrTenantLimitsUnsupported
+	}
+	return repo.DeleteTenantLimits(ctx, tenant)
+}
+
+// FindTenantLimits returns all tenant limit overrides when the current backend
+// supports it
+func (m *Monitor) FindTenantLimits(ctx context.Context) ([]*model.TenantLimits, error) {
+	repo, ok := m.current().(TenantLimitRepository)
+	if !ok {
+		return nil, ErrTenantLimitsUnsupported
+	}
+	return repo.FindTenantLimits(ctx)
+}
+
+// SaveTenant stores a provisioned tenant when the current backend supports it
+func (m *Monitor) SaveTenant(ctx context.Context, tenant *model.TenantRecord) error {
+	repo, ok := m.current().(TenantRepository)
+	if !ok {
+		return ErrTenantsUnsupported
+	}
+	return repo.SaveTenant(ctx, tenant)
+}
+
+// FindTenants returns the provisioned tenants when the current backend
+// supports it
+func (m *Monitor) FindTenants(ctx context.Context) ([]*model.TenantRecord, error) {
+	repo, ok := m.current().(TenantRepository)
+	if !ok {
+		return nil, ErrTenantsUnsupported
+	}
+	return repo.FindTenants(ctx)
+}
+
+func (m *Monitor) Migrate(ctx context.Context) error {
+	return m.current().Migrate(ctx)
+}
+
+// Close stops the health checks and closes the underlying repository
+func (m *Monitor) Close() error {
+	close(m.done)
+	m.wg.Wait()
+	return m.current().Close()
+}
+
+// RegisterAdminRoutes mounts the repository status endpoint
+func (m *Monitor) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/db", func(c *fiber.Ctx) error {
+		return c.JSON(m.Status())
+	})
+}
+
+// SaveRateLimitEvents stores rate limit events when the current backend
+// supports them
+func (m *Monitor) SaveRateLimitEvents(ctx context.Context, events []*model.RateLimitEvent) error {
+	repo, ok := m.current().(RateLimitEventRepository)
+	if !ok {
+		return ErrRateLimitEventsUnsupported
+	}
+	return repo.SaveRateLimitEvents(ctx, events)
+}
+
+// FindRateLimitEvents queries rate limit events when the current backend
+// supports them
+func (m *Monitor) FindRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter) ([]*model.RateLimitEvent, error) {
+	repo, ok := m.current().(RateLimitEventRepository)
+	if !ok {
+		return nil, ErrRateLimitEventsUnsupported
+	}
+	return repo.FindRateLimitEvents(ctx, filter)
+}
+
+// AggregateRateLimitEvents groups rate limit events when the current backend
+// supports them
+func (m *Monitor) AggregateRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter, by string) ([]*model.RateLimitAggregate, error) {
+	repo, ok := m.current().(RateLimitEventRepository)
+	if !ok {
+		return nil, ErrRateLimitEventsUnsupported
+	}
+	return repo.AggregateRateLimitEvents(ctx, filter, by)
+}
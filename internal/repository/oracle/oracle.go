@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/tuncerburak97/muhtar/internal/model"
@@ -142,77 +144,664 @@ func (r *OracleRepository) Close() error {
 	return r.DB.Close()
 }
 
+// Migrate applies pending versioned schema migrations
 func (r *OracleRepository) Migrate(ctx context.Context) error {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Starting Oracle migrations")
 
-	_, err := r.DB.ExecContext(ctx, migrations.OracleSchema)
+	applied, err := migrations.Run(ctx, &migrationExecutor{db: r.DB}, migrations.OracleMigrations)
 	if err != nil {
 		log.Error().Err(err).Msg("Oracle migrations failed")
 		return fmt.Errorf("migration error: %v", err)
 	}
 
-	log.Info().Msg("Oracle migrations completed successfully")
+	log.Info().Int("applied", applied).Msg("Oracle migrations completed successfully")
 	return nil
 }
 
-func (r *OracleRepository) SaveLog(ctx context.Context, log *model.Log) error {
-	headers, err := json.Marshal(log.Headers)
+// Oracle errors tolerated when re-running a partially applied migration:
+// name already used by an existing object, column list already indexed,
+// unique constraint violated (version recorded concurrently) and column
+// already present in the table
+var ignoredMigrationErrors = []string{"ORA-00955", "ORA-01408", "ORA-00001", "ORA-01430"}
+
+type migrationExecutor struct {
+	db *sql.DB
+}
+
+func (e *migrationExecutor) exec(ctx context.Context, stmt string, args ...interface{}) error {
+	_, err := e.db.ExecContext(ctx, stmt, args...)
+	if err == nil {
+		return nil
+	}
+	for _, code := range ignoredMigrationErrors {
+		if strings.Contains(err.Error(), code) {
+			return nil
+		}
+	}
+	return err
+}
+
+func (e *migrationExecutor) EnsureVersionTable(ctx context.Context) error {
+	return e.exec(ctx, `CREATE TABLE schema_version (
+		version NUMBER PRIMARY KEY,
+		description VARCHAR2(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT SYSTIMESTAMP NOT NULL
+	)`)
+}
+
+func (e *migrationExecutor) AppliedVersions(ctx context.Context) (map[int]bool, error) {
+	rows, err := e.db.QueryContext(ctx, `SELECT version FROM schema_version`)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	_, err = r.DB.ExecContext(ctx,
-		`INSERT INTO http_log (
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Apply runs the statements one by one. Oracle commits DDL implicitly, so a
+// failed migration is resumed on the next run by skipping existing objects.
+func (e *migrationExecutor) Apply(ctx context.Context, m migrations.Migration) error {
+	for _, stmt := range m.Statements {
+		if err := e.exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return e.exec(ctx, `INSERT INTO schema_version (version, description) VALUES (:1, :2)`, m.Version, m.Description)
+}
+
+// SaveLog inserts a single log with the column encoding of SaveLogs
+func (r *OracleRepository) SaveLog(ctx context.Context, log *model.Log) error {
+	return r.SaveLogs(ctx, []*model.Log{log})
+}
+
+// SaveLogs inserts the whole batch in a single round trip using go-ora array
+// binding: every bind parameter is a slice holding one value per row
+func (r *OracleRepository) SaveLogs(ctx context.Context, logs []*model.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	n := len(logs)
+	ids := make([]string, n)
+	traceIDs := make([]string, n)
+	processTypes := make([]string, n)
+	timestamps := make([]time.Time, n)
+	methods := make([]string, n)
+	urls := make([]string, n)
+	paths := make([]string, n)
+	pathParams := make([]string, n)
+	queryParams := make([]string, n)
+	headers := make([]string, n)
+	bodies := make([]string, n)
+	clientIPs := make([]string, n)
+	userAgents := make([]string, n)
+	statusCodes := make([]int64, n)
+	responseTimes := make([]float64, n)
+	contentLengths := make([]int64, n)
+	errs := make([]string, n)
+	metadata := make([]string, n)
+	tenantIDs := make([]string, n)
+
+	for i, log := range logs {
+		var err error
+		if headers[i], err = marshalColumn(log.Headers); err != nil {
+			return err
+		}
+		if pathParams[i], err = marshalColumn(log.PathParams); err != nil {
+			return err
+		}
+		if queryParams[i], err = marshalColumn(log.QueryParams); err != nil {
+			return err
+		}
+		if metadata[i], err = marshalColumn(log.Metadata); err != nil {
+			return err
+		}
+
+		ids[i] = log.ID
+		traceIDs[i] = log.TraceID
+		processTypes[i] = string(log.ProcessType)
+		timestamps[i] = log.Timestamp
+		methods[i] = log.Method
+		urls[i] = log.URL
+		paths[i] = log.Path
+		bodies[i] = string(log.Body)
+		clientIPs[i] = log.ClientIP
+		userAgents[i] = log.UserAgent
+		statusCodes[i] = int64(log.StatusCode)
+		responseTimes[i] = log.ResponseTime.Seconds()
+		contentLengths[i] = log.ContentLength
+		errs[i] = log.Error
+		tenantIDs[i] = log.TenantID
+	}
+
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO http_log (
 			id, trace_id, process_type, timestamp, method, url, path,
 			path_params, query_params, headers, body, client_ip,
 			user_agent, status_code, response_time, content_length,
-			error, metadata
-		) VALUES (:1, :2, :3, :4, :5, :6, :7, :8, :9, :10, :11, :12, :13, :14, :15, :16, :17, :18)`,
-		log.ID, log.TraceID, log.ProcessType, log.Timestamp, log.Method,
-		log.URL, log.Path, log.PathParams, log.QueryParams, headers,
-		log.Body, log.ClientIP, log.UserAgent, log.StatusCode,
-		log.ResponseTime, log.ContentLength, log.Error, log.Metadata,
+			error, metadata, tenant_id
+		) VALUES (:1, :2, :3, :4, :5, :6, :7, :8, :9, :10, :11, :12, :13, :14,
+			NUMTODSINTERVAL(:15, 'SECOND'), :16, :17, :18, :19)`,
+		ids, traceIDs, processTypes, timestamps, methods,
+		urls, paths, pathParams, queryParams, headers,
+		bodies, clientIPs, userAgents, statusCodes,
+		responseTimes, contentLengths, errs, metadata, tenantIDs,
 	)
-	return err
+	if err != nil {
+		return fmt.Errorf("failed to insert %d logs: %v", n, err)
+	}
+	return nil
 }
 
-func (r *OracleRepository) SaveLogs(ctx context.Context, logs []*model.Log) error {
+// marshalColumn encodes a JSON column value, empty for nil maps
+func marshalColumn(v interface{}) (string, error) {
+	switch m := v.(type) {
+	case map[string]string:
+		if m == nil {
+			return "", nil
+		}
+	case model.Headers:
+		if m == nil {
+			return "", nil
+		}
+	case map[string]interface{}:
+		if m == nil {
+			return "", nil
+		}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func (r *OracleRepository) FindLogs(ctx context.Context, filter model.LogFilter) ([]*model.Log, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.TenantID != "" {
+		addCondition("tenant_id = :%d", filter.TenantID)
+	}
+	if filter.TraceID != "" {
+		addCondition("trace_id = :%d", filter.TraceID)
+	}
+	if filter.ProcessType != "" {
+		addCondition("process_type = :%d", string(filter.ProcessType))
+	}
+	if filter.Method != "" {
+		addCondition("method = :%d", filter.Method)
+	}
+	if filter.PathPrefix != "" {
+		addCondition("path LIKE :%d", filter.PathPrefix+"%")
+	}
+	if filter.StatusCode != 0 {
+		addCondition("status_code = :%d", filter.StatusCode)
+	}
+	if !filter.From.IsZero() {
+		addCondition("timestamp >= :%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("timestamp < :%d", filter.To)
+	}
+
+	query := `SELECT id, trace_id, process_type, timestamp, method, url, path,
+		path_params, query_params, headers, body, client_ip, user_agent,
+		status_code, content_length, error, metadata, tenant_id
+		FROM http_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY timestamp DESC OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", filter.Offset, filter.EffectiveLimit())
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logs: %v", err)
+	}
+	defer rows.Close()
+
+	var logs []*model.Log
+	for rows.Next() {
+		var (
+			entry                                            model.Log
+			processType                                      string
+			method, url, path, clientIP, userAgent, errText  sql.NullString
+			tenantID                                         sql.NullString
+			pathParams, queryParams, headers, body, metadata sql.NullString
+			statusCode, contentLength                        sql.NullInt64
+		)
+		if err := rows.Scan(
+			&entry.ID, &entry.TraceID, &processType, &entry.Timestamp, &method, &url, &path,
+			&pathParams, &queryParams, &headers, &body, &clientIP, &userAgent,
+			&statusCode, &contentLength, &errText, &metadata, &tenantID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan log: %v", err)
+		}
+
+		entry.ProcessType = model.ProcessType(processType)
+		entry.Method = method.String
+		entry.URL = url.String
+		entry.Path = path.String
+		entry.ClientIP = clientIP.String
+		entry.UserAgent = userAgent.String
+		entry.Error = errText.String
+		entry.TenantID = tenantID.String
+		entry.StatusCode = int(statusCode.Int64)
+		entry.ContentLength = contentLength.Int64
+		if body.Valid {
+			entry.Body = []byte(body.String)
+		}
+		for _, col := range []struct {
+			raw    sql.NullString
+			target interface{}
+		}{
+			{pathParams, &entry.PathParams},
+			{queryParams, &entry.QueryParams},
+			{headers, &entry.Headers},
+			{metadata, &entry.Metadata},
+		} {
+			if !col.raw.Valid || col.raw.String == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(col.raw.String), col.target); err != nil {
+				return nil, fmt.Errorf("failed to decode log column: %v", err)
+			}
+		}
+		logs = append(logs, &entry)
+	}
+	return logs, rows.Err()
+}
+
+func (r *OracleRepository) Ping(ctx context.Context) error {
+	return r.DB.PingContext(ctx)
+}
+
+func (r *OracleRepository) Stats() map[string]interface{} {
+	stat := r.DB.Stats()
+	return map[string]interface{}{
+		"open_conns":           stat.OpenConnections,
+		"in_use_conns":         stat.InUse,
+		"idle_conns":           stat.Idle,
+		"max_open_conns":       stat.MaxOpenConnections,
+		"wait_count":           stat.WaitCount,
+		"wait_duration_sec":    stat.WaitDuration.Seconds(),
+		"max_idle_closed":      stat.MaxIdleClosed,
+		"max_lifetime_closed":  stat.MaxLifetimeClosed,
+		"max_idle_time_closed": stat.MaxIdleTimeClosed,
+	}
+}
+
+// SaveRollups replaces the rows of the given rollups in one transaction
+func (r *OracleRepository) SaveRollups(ctx context.Context, rollups []*model.Rollup) error {
 	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO http_log (
-			id, trace_id, process_type, timestamp, method, url, path,
-			path_params, query_params, headers, body, client_ip,
-			user_agent, status_code, response_time, content_length,
-			error, metadata
-		) VALUES (:1, :2, :3, :4, :5, :6, :7, :8, :9, :10, :11, :12, :13, :14, :15, :16, :17, :18)
-	`)
+	for _, ru := range rollups {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM traffic_rollup
+			WHERE minute = :1 AND instance = :2 AND method = :3 AND path = :4 AND status_code = :5`,
+			ru.Minute, ru.Instance, ru.Method, ru.Path, ru.StatusCode,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO traffic_rollup (
+				minute, instance, method, path, status_code,
+				request_count, error_count, p50_ms, p95_ms, p99_ms
+			) VALUES (:1, :2, :3, :4, :5, :6, :7, :8, :9, :10)`,
+			ru.Minute, ru.Instance, ru.Method, ru.Path, ru.StatusCode,
+			ru.Count, ru.ErrorCount, ru.P50, ru.P95, ru.P99,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *OracleRepository) FindRollups(ctx context.Context, filter model.RollupFilter) ([]*model.Rollup, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Method != "" {
+		addCondition("method = :%d", filter.Method)
+	}
+	if filter.PathPrefix != "" {
+		addCondition("path LIKE :%d", filter.PathPrefix+"%")
+	}
+	if filter.StatusCode != 0 {
+		addCondition("status_code = :%d", filter.StatusCode)
+	}
+	if !filter.From.IsZero() {
+		addCondition("minute >= :%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("minute < :%d", filter.To)
+	}
+
+	query := `SELECT minute, instance, method, path, status_code,
+		request_count, error_count, p50_ms, p95_ms, p99_ms
+		FROM traffic_rollup`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY minute DESC FETCH FIRST %d ROWS ONLY", filter.EffectiveLimit())
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %v", err)
+	}
+	defer rows.Close()
+
+	var rollups []*model.Rollup
+	for rows.Next() {
+		var ru model.Rollup
+		if err := rows.Scan(
+			&ru.Minute, &ru.Instance, &ru.Method, &ru.Path, &ru.StatusCode,
+			&ru.Count, &ru.ErrorCount, &ru.P50, &ru.P95, &ru.P99,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup: %v", err)
+		}
+		rollups = append(rollups, &ru)
+	}
+	return rollups, rows.Err()
+}
+
+// SaveUsage adds the usage to the counters stored for the same tenant and
+// hour, inserting the row when it does not exist yet
+func (r *OracleRepository) SaveUsage(ctx context.Context, usage []*model.Usage) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	for _, log := range logs {
-		headers, err := json.Marshal(log.Headers)
+	for _, u := range usage {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE tenant_usage SET
+				requests = requests + :1, errors = errors + :2,
+				bytes_in = bytes_in + :3, bytes_out = bytes_out + :4
+			WHERE hour = :5 AND tenant = :6`,
+			u.Requests, u.Errors, u.BytesIn, u.BytesOut, u.Hour, u.Tenant,
+		)
 		if err != nil {
 			return err
 		}
-
-		_, err = stmt.ExecContext(ctx,
-			log.ID, log.TraceID, log.ProcessType, log.Timestamp, log.Method,
-			log.URL, log.Path, log.PathParams, log.QueryParams, headers,
-			log.Body, log.ClientIP, log.UserAgent, log.StatusCode,
-			log.ResponseTime, log.ContentLength, log.Error, log.Metadata,
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO tenant_usage (hour, tenant, requests, errors, bytes_in, bytes_out)
+			VALUES (:1, :2, :3, :4, :5, :6)`,
+			u.Hour, u.Tenant, u.Requests, u.Errors, u.BytesIn, u.BytesOut,
 		)
 		if err != nil {
 			return err
 		}
 	}
+	return tx.Commit()
+}
+
+func (r *OracleRepository) FindUsage(ctx context.Context, filter model.UsageFilter) ([]*model.Usage, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Tenant != "" {
+		addCondition("tenant = :%d", filter.Tenant)
+	}
+	if !filter.From.IsZero() {
+		addCondition("hour >= :%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("hour < :%d", filter.To)
+	}
+
+	query := `SELECT hour, tenant, requests, errors, bytes_in, bytes_out FROM tenant_usage`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY hour, tenant"
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %v", err)
+	}
+	defer rows.Close()
+
+	var usage []*model.Usage
+	for rows.Next() {
+		var u model.Usage
+		if err := rows.Scan(&u.Hour, &u.Tenant, &u.Requests, &u.Errors, &u.BytesIn, &u.BytesOut); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %v", err)
+		}
+		usage = append(usage, &u)
+	}
+	return usage, rows.Err()
+}
+
+// SaveTenantLimits creates or replaces the override of a tenant
+func (r *OracleRepository) SaveTenantLimits(ctx context.Context, limits *model.TenantLimits) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenant_limits WHERE tenant = :1`, limits.Tenant); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO tenant_limits (tenant, requests, window_ms, burst, daily_quota, updated_at)
+		VALUES (:1, :2, :3, :4, :5, :6)`,
+		limits.Tenant, limits.Requests, limits.Window.Milliseconds(), limits.Burst, limits.DailyQuota, limits.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *OracleRepository) DeleteTenantLimits(ctx context.Context, tenant string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM tenant_limits WHERE tenant = :1`, tenant)
+	return err
+}
+
+func (r *OracleRepository) FindTenantLimits(ctx context.Context) ([]*model.TenantLimits, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT tenant, requests, window_ms, burst, daily_quota, updated_at FROM tenant_limits`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tenant limits: %v", err)
+	}
+	defer rows.Close()
+
+	var result []*model.TenantLimits
+	for rows.Next() {
+		var l model.TenantLimits
+		var windowMs int64
+		if err := rows.Scan(&l.Tenant, &l.Requests, &windowMs, &l.Burst, &l.DailyQuota, &l.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant limits: %v", err)
+		}
+		l.Window = time.Duration(windowMs) * time.Millisecond
+		result = append(result, &l)
+	}
+	return result, rows.Err()
+}
+
+// SaveTenant inserts a provisioned tenant, failing when the ID is taken
+func (r *OracleRepository) SaveTenant(ctx context.Context, tenant *model.TenantRecord) error {
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO tenants (id, spec, created_at) VALUES (:1, :2, :3)`,
+		tenant.ID, string(tenant.Spec), tenant.CreatedAt,
+	)
+	return err
+}
+
+func (r *OracleRepository) FindTenants(ctx context.Context) ([]*model.TenantRecord, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, spec, created_at FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tenants: %v", err)
+	}
+	defer rows.Close()
+
+	var tenants []*model.TenantRecord
+	for rows.Next() {
+		var t model.TenantRecord
+		var spec string
+		if err := rows.Scan(&t.ID, &spec, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %v", err)
+		}
+		t.Spec = []byte(spec)
+		tenants = append(tenants, &t)
+	}
+	return tenants, rows.Err()
+}
+
+// rateLimitColumns maps the aggregation dimensions to their columns
+var rateLimitColumns = map[string]string{
+	model.RateLimitByRule:     "rule",
+	model.RateLimitByKey:      "limit_key",
+	model.RateLimitByClientIP: "client_ip",
+	model.RateLimitByTenant:   "tenant_id",
+	model.RateLimitByPath:     "path",
+}
+
+func (r *OracleRepository) SaveRateLimitEvents(ctx context.Context, events []*model.RateLimitEvent) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
+	for _, e := range events {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO ratelimit_event (id, timestamp, rule, limit_key, client_ip, tenant_id, method, path, request_count)
+			VALUES (:1, :2, :3, :4, :5, :6, :7, :8, :9)`,
+			e.ID, e.Timestamp, e.Rule, e.Key, e.ClientIP, e.TenantID, e.Method, e.Path, e.Count,
+		)
+		if err != nil {
+			return err
+		}
+	}
 	return tx.Commit()
 }
+
+func rateLimitConditions(filter model.RateLimitEventFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Rule != "" {
+		addCondition("rule = :%d", filter.Rule)
+	}
+	if filter.Key != "" {
+		addCondition("limit_key = :%d", filter.Key)
+	}
+	if filter.ClientIP != "" {
+		addCondition("client_ip = :%d", filter.ClientIP)
+	}
+	if filter.TenantID != "" {
+		addCondition("tenant_id = :%d", filter.TenantID)
+	}
+	if !filter.From.IsZero() {
+		addCondition("timestamp >= :%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("timestamp < :%d", filter.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (r *OracleRepository) FindRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter) ([]*model.RateLimitEvent, error) {
+	where, args := rateLimitConditions(filter)
+	query := `SELECT id, timestamp, rule, limit_key, client_ip, tenant_id, method, path, request_count
+		FROM ratelimit_event` + where +
+		fmt.Sprintf(" ORDER BY timestamp DESC FETCH FIRST %d ROWS ONLY", filter.EffectiveLimit())
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rate limit events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []*model.RateLimitEvent
+	for rows.Next() {
+		var e model.RateLimitEvent
+		var clientIP, tenantID, method, path sql.NullString
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Rule, &e.Key, &clientIP, &tenantID, &method, &path, &e.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan rate limit event: %v", err)
+		}
+		e.ClientIP = clientIP.String
+		e.TenantID = tenantID.String
+		e.Method = method.String
+		e.Path = path.String
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// AggregateRateLimitEvents counts the matching events per value of the by
+// dimension, most frequent first
+func (r *OracleRepository) AggregateRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter, by string) ([]*model.RateLimitAggregate, error) {
+	column, ok := rateLimitColumns[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown rate limit dimension %s", by)
+	}
+	where, args := rateLimitConditions(filter)
+	query := fmt.Sprintf(`SELECT %[1]s, COUNT(*), MAX(request_count), MIN(timestamp), MAX(timestamp)
+		FROM ratelimit_event%[2]s GROUP BY %[1]s ORDER BY COUNT(*) DESC FETCH FIRST %[3]d ROWS ONLY`,
+		column, where, filter.EffectiveLimit())
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate rate limit events: %v", err)
+	}
+	defer rows.Close()
+
+	var result []*model.RateLimitAggregate
+	for rows.Next() {
+		var a model.RateLimitAggregate
+		var value sql.NullString
+		if err := rows.Scan(&value, &a.Events, &a.MaxCount, &a.First, &a.Last); err != nil {
+			return nil, fmt.Errorf("failed to scan rate limit aggregate: %v", err)
+		}
+		a.Value = value.String
+		result = append(result, &a)
+	}
+	return result, rows.Err()
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -12,9 +14,22 @@ import (
 	"github.com/tuncerburak97/muhtar/internal/repository/migrations"
 )
 
+// defaultCopyThreshold is the batch size from which SaveLogs uses COPY FROM
+const defaultCopyThreshold = 50
+
+var logColumns = []string{
+	"id", "trace_id", "process_type", "timestamp", "method", "url", "path",
+	"path_params", "query_params", "headers", "body", "client_ip",
+	"user_agent", "status_code", "response_time", "content_length",
+	"error", "metadata", "tenant_id",
+}
+
 type PostgresRepository struct {
 	Pool      *pgxpool.Pool
 	BatchSize int
+	// CopyThreshold is the minimum number of logs written with COPY FROM,
+	// smaller flushes use a pipelined batch of INSERTs
+	CopyThreshold int
 }
 
 func NewPostgresRepository(connStr string) (*PostgresRepository, error) {
@@ -37,17 +52,76 @@ func (r *PostgresRepository) SaveLog(ctx context.Context, log *model.Log) error
 			id, trace_id, process_type, timestamp, method, url, path,
 			path_params, query_params, headers, body, client_ip,
 			user_agent, status_code, response_time, content_length,
-			error, metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+			error, metadata, tenant_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
 		log.ID, log.TraceID, log.ProcessType, log.Timestamp, log.Method,
 		log.URL, log.Path, log.PathParams, log.QueryParams, headers,
 		log.Body, log.ClientIP, log.UserAgent, log.StatusCode,
-		log.ResponseTime, log.ContentLength, log.Error, log.Metadata,
+		log.ResponseTime, log.ContentLength, log.Error, log.Metadata, nullString(log.TenantID),
 	)
 	return err
 }
 
 func (r *PostgresRepository) SaveLogs(ctx context.Context, logs []*model.Log) error {
+	threshold := r.CopyThreshold
+	if threshold <= 0 {
+		threshold = defaultCopyThreshold
+	}
+	if len(logs) >= threshold {
+		return r.copyLogs(ctx, logs)
+	}
+	return r.batchLogs(ctx, logs)
+}
+
+// copyLogs streams the logs with the COPY protocol
+func (r *PostgresRepository) copyLogs(ctx context.Context, logs []*model.Log) error {
+	logger := zerolog.Ctx(ctx)
+
+	rows := make([][]interface{}, 0, len(logs))
+	for _, logEntry := range logs {
+		headers, err := json.Marshal(logEntry.Headers)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to marshal headers")
+			return err
+		}
+		rows = append(rows, []interface{}{
+			logEntry.ID, logEntry.TraceID, string(logEntry.ProcessType), logEntry.Timestamp, logEntry.Method,
+			logEntry.URL, logEntry.Path, logEntry.PathParams, logEntry.QueryParams, headers,
+			jsonbBody(logEntry.Body), logEntry.ClientIP, logEntry.UserAgent, logEntry.StatusCode,
+			logEntry.ResponseTime, logEntry.ContentLength, logEntry.Error, logEntry.Metadata,
+			nullString(logEntry.TenantID),
+		})
+	}
+
+	copied, err := r.Pool.CopyFrom(ctx, pgx.Identifier{"http_log"}, logColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		logger.Error().Err(err).Int("count", len(logs)).Msg("Failed to copy logs")
+		return err
+	}
+
+	logger.Debug().Int64("count", copied).Msg("Successfully copied logs")
+	return nil
+}
+
+// jsonbBody returns the body in a form accepted by a JSONB column, NULL when
+// it is empty
+func jsonbBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	return body
+}
+
+// nullString maps an empty string to NULL
+func nullString(v string) interface{} {
+	if v == "" {
+		return nil
+	}
+	return v
+}
+
+// batchLogs writes the logs with a pipelined batch of INSERT statements
+func (r *PostgresRepository) batchLogs(ctx context.Context, logs []*model.Log) error {
 	batch := &pgx.Batch{}
 
 	logger := zerolog.Ctx(ctx)
@@ -67,12 +141,13 @@ func (r *PostgresRepository) SaveLogs(ctx context.Context, logs []*model.Log) er
 				id, trace_id, process_type, timestamp, method, url, path,
 				path_params, query_params, headers, body, client_ip,
 					user_agent, status_code, response_time, content_length,
-					error, metadata
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+					error, metadata, tenant_id
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
 			logEntry.ID, logEntry.TraceID, logEntry.ProcessType, logEntry.Timestamp, logEntry.Method,
 			logEntry.URL, logEntry.Path, logEntry.PathParams, logEntry.QueryParams, headers,
 			logEntry.Body, logEntry.ClientIP, logEntry.UserAgent, logEntry.StatusCode,
 			logEntry.ResponseTime, logEntry.ContentLength, logEntry.Error, logEntry.Metadata,
+			nullString(logEntry.TenantID),
 		)
 	}
 
@@ -94,16 +169,509 @@ func (r *PostgresRepository) Close() error {
 	return nil
 }
 
+// Migrate applies pending versioned schema migrations
 func (r *PostgresRepository) Migrate(ctx context.Context) error {
 	log := zerolog.Ctx(ctx)
 	log.Info().Msg("Starting PostgreSQL migrations")
 
-	_, err := r.Pool.Exec(ctx, migrations.PostgresSchema)
+	applied, err := migrations.Run(ctx, &migrationExecutor{pool: r.Pool}, migrations.PostgresMigrations)
 	if err != nil {
 		log.Error().Err(err).Msg("PostgreSQL migrations failed")
 		return fmt.Errorf("migration error: %v", err)
 	}
 
-	log.Info().Msg("PostgreSQL migrations completed successfully")
+	log.Info().Int("applied", applied).Msg("PostgreSQL migrations completed successfully")
 	return nil
 }
+
+// migrationLockID is the advisory lock key serializing migrations across
+// instances starting at the same time
+const migrationLockID = 7436298341
+
+type migrationExecutor struct {
+	pool *pgxpool.Pool
+}
+
+func (e *migrationExecutor) EnsureVersionTable(ctx context.Context) error {
+	_, err := e.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+func (e *migrationExecutor) AppliedVersions(ctx context.Context) (map[int]bool, error) {
+	rows, err := e.pool.Query(ctx, `SELECT version FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Apply runs the migration in a single transaction, so a failed migration
+// leaves no partial schema change behind
+func (e *migrationExecutor) Apply(ctx context.Context, m migrations.Migration) error {
+	tx, err := e.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_version WHERE version = $1)`, m.Version).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		// Applied by another instance while we waited for the lock
+		return nil
+	}
+
+	for _, stmt := range m.Statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_version (version, description) VALUES ($1, $2)`, m.Version, m.Description); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const selectLogColumns = `SELECT id, trace_id, process_type, timestamp, COALESCE(method, ''),
+	COALESCE(url, ''), COALESCE(path, ''), path_params, query_params, headers, body,
+	COALESCE(client_ip, ''), COALESCE(user_agent, ''), COALESCE(status_code, 0),
+	COALESCE(response_time, '0'::interval), COALESCE(content_length, 0),
+	COALESCE(error, ''), metadata, COALESCE(tenant_id, '')
+	FROM http_log`
+
+func (r *PostgresRepository) FindLogs(ctx context.Context, filter model.LogFilter) ([]*model.Log, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.TenantID != "" {
+		addCondition("tenant_id = $%d", filter.TenantID)
+	}
+	if filter.TraceID != "" {
+		addCondition("trace_id = $%d", filter.TraceID)
+	}
+	if filter.ProcessType != "" {
+		addCondition("process_type = $%d", string(filter.ProcessType))
+	}
+	if filter.Method != "" {
+		addCondition("method = $%d", filter.Method)
+	}
+	if filter.PathPrefix != "" {
+		addCondition("path LIKE $%d", filter.PathPrefix+"%")
+	}
+	if filter.StatusCode != 0 {
+		addCondition("status_code = $%d", filter.StatusCode)
+	}
+	if !filter.From.IsZero() {
+		addCondition("timestamp >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("timestamp < $%d", filter.To)
+	}
+
+	query := selectLogColumns
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY timestamp DESC LIMIT %d OFFSET %d", filter.EffectiveLimit(), filter.Offset)
+
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logs: %v", err)
+	}
+	defer rows.Close()
+
+	var logs []*model.Log
+	for rows.Next() {
+		var (
+			entry                                model.Log
+			processType                          string
+			pathParams, queryParams, headers, md []byte
+		)
+		if err := rows.Scan(
+			&entry.ID, &entry.TraceID, &processType, &entry.Timestamp, &entry.Method,
+			&entry.URL, &entry.Path, &pathParams, &queryParams, &headers, &entry.Body,
+			&entry.ClientIP, &entry.UserAgent, &entry.StatusCode,
+			&entry.ResponseTime, &entry.ContentLength, &entry.Error, &md, &entry.TenantID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan log: %v", err)
+		}
+		entry.ProcessType = model.ProcessType(processType)
+		if err := unmarshalColumns(
+			pathParams, &entry.PathParams,
+			queryParams, &entry.QueryParams,
+			headers, &entry.Headers,
+			md, &entry.Metadata,
+		); err != nil {
+			return nil, err
+		}
+		logs = append(logs, &entry)
+	}
+	return logs, rows.Err()
+}
+
+// unmarshalColumns decodes pairs of raw JSON columns into their targets,
+// skipping NULL columns
+func unmarshalColumns(pairs ...interface{}) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		raw, _ := pairs[i].([]byte)
+		if len(raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(raw, pairs[i+1]); err != nil {
+			return fmt.Errorf("failed to decode log column: %v", err)
+		}
+	}
+	return nil
+}
+
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	return r.Pool.Ping(ctx)
+}
+
+func (r *PostgresRepository) Stats() map[string]interface{} {
+	stat := r.Pool.Stat()
+	return map[string]interface{}{
+		"total_conns":          stat.TotalConns(),
+		"idle_conns":           stat.IdleConns(),
+		"acquired_conns":       stat.AcquiredConns(),
+		"constructing_conns":   stat.ConstructingConns(),
+		"max_conns":            stat.MaxConns(),
+		"acquire_count":        stat.AcquireCount(),
+		"empty_acquire_count":  stat.EmptyAcquireCount(),
+		"canceled_acquire":     stat.CanceledAcquireCount(),
+		"acquire_duration_sec": stat.AcquireDuration().Seconds(),
+	}
+}
+
+// SaveRollups upserts per-minute rollups, replacing rows written for the same
+// minute by a previous flush
+func (r *PostgresRepository) SaveRollups(ctx context.Context, rollups []*model.Rollup) error {
+	batch := &pgx.Batch{}
+	for _, ru := range rollups {
+		batch.Queue(
+			`INSERT INTO traffic_rollup (
+				minute, instance, method, path, status_code,
+				request_count, error_count, p50_ms, p95_ms, p99_ms
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (minute, instance, method, path, status_code) DO UPDATE SET
+				request_count = EXCLUDED.request_count,
+				error_count = EXCLUDED.error_count,
+				p50_ms = EXCLUDED.p50_ms,
+				p95_ms = EXCLUDED.p95_ms,
+				p99_ms = EXCLUDED.p99_ms`,
+			ru.Minute, ru.Instance, ru.Method, ru.Path, ru.StatusCode,
+			ru.Count, ru.ErrorCount, ru.P50, ru.P95, ru.P99,
+		)
+	}
+	return r.Pool.SendBatch(ctx, batch).Close()
+}
+
+func (r *PostgresRepository) FindRollups(ctx context.Context, filter model.RollupFilter) ([]*model.Rollup, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Method != "" {
+		addCondition("method = $%d", filter.Method)
+	}
+	if filter.PathPrefix != "" {
+		addCondition("path LIKE $%d", filter.PathPrefix+"%")
+	}
+	if filter.StatusCode != 0 {
+		addCondition("status_code = $%d", filter.StatusCode)
+	}
+	if !filter.From.IsZero() {
+		addCondition("minute >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("minute < $%d", filter.To)
+	}
+
+	query := `SELECT minute, instance, method, path, status_code,
+		request_count, error_count, p50_ms, p95_ms, p99_ms
+		FROM traffic_rollup`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY minute DESC LIMIT %d", filter.EffectiveLimit())
+
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %v", err)
+	}
+	defer rows.Close()
+
+	var rollups []*model.Rollup
+	for rows.Next() {
+		var ru model.Rollup
+		if err := rows.Scan(
+			&ru.Minute, &ru.Instance, &ru.Method, &ru.Path, &ru.StatusCode,
+			&ru.Count, &ru.ErrorCount, &ru.P50, &ru.P95, &ru.P99,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup: %v", err)
+		}
+		rollups = append(rollups, &ru)
+	}
+	return rollups, rows.Err()
+}
+
+// SaveUsage adds the usage to the counters stored for the same tenant and hour
+func (r *PostgresRepository) SaveUsage(ctx context.Context, usage []*model.Usage) error {
+	batch := &pgx.Batch{}
+	for _, u := range usage {
+		batch.Queue(
+			`INSERT INTO tenant_usage (hour, tenant, requests, errors, bytes_in, bytes_out)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (hour, tenant) DO UPDATE SET
+				requests = tenant_usage.requests + EXCLUDED.requests,
+				errors = tenant_usage.errors + EXCLUDED.errors,
+				bytes_in = tenant_usage.bytes_in + EXCLUDED.bytes_in,
+				bytes_out = tenant_usage.bytes_out + EXCLUDED.bytes_out`,
+			u.Hour, u.Tenant, u.Requests, u.Errors, u.BytesIn, u.BytesOut,
+		)
+	}
+	return r.Pool.SendBatch(ctx, batch).Close()
+}
+
+func (r *PostgresRepository) FindUsage(ctx context.Context, filter model.UsageFilter) ([]*model.Usage, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Tenant != "" {
+		addCondition("tenant = $%d", filter.Tenant)
+	}
+	if !filter.From.IsZero() {
+		addCondition("hour >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("hour < $%d", filter.To)
+	}
+
+	query := `SELECT hour, tenant, requests, errors, bytes_in, bytes_out FROM tenant_usage`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY hour, tenant"
+
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %v", err)
+	}
+	defer rows.Close()
+
+	var usage []*model.Usage
+	for rows.Next() {
+		var u model.Usage
+		if err := rows.Scan(&u.Hour, &u.Tenant, &u.Requests, &u.Errors, &u.BytesIn, &u.BytesOut); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %v", err)
+		}
+		usage = append(usage, &u)
+	}
+	return usage, rows.Err()
+}
+
+// SaveTenantLimits creates or replaces the override of a tenant
+func (r *PostgresRepository) SaveTenantLimits(ctx context.Context, limits *model.TenantLimits) error {
+	_, err := r.Pool.Exec(ctx,
+		`INSERT INTO tenant_limits (tenant, requests, window_ms, burst, daily_quota, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant) DO UPDATE SET
+			requests = EXCLUDED.requests,
+			window_ms = EXCLUDED.window_ms,
+			burst = EXCLUDED.burst,
+			daily_quota = EXCLUDED.daily_quota,
+			updated_at = EXCLUDED.updated_at`,
+		limits.Tenant, limits.Requests, limits.Window.Milliseconds(), limits.Burst, limits.DailyQuota, limits.UpdatedAt,
+	)
+	return err
+}
+
+func (r *PostgresRepository) DeleteTenantLimits(ctx context.Context, tenant string) error {
+	_, err := r.Pool.Exec(ctx, `DELETE FROM tenant_limits WHERE tenant = $1`, tenant)
+	return err
+}
+
+func (r *PostgresRepository) FindTenantLimits(ctx context.Context) ([]*model.TenantLimits, error) {
+	rows, err := r.Pool.Query(ctx,
+		`SELECT tenant, requests, window_ms, burst, daily_quota, updated_at FROM tenant_limits`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tenant limits: %v", err)
+	}
+	defer rows.Close()
+
+	var result []*model.TenantLimits
+	for rows.Next() {
+		var l model.TenantLimits
+		var windowMs int64
+		if err := rows.Scan(&l.Tenant, &l.Requests, &windowMs, &l.Burst, &l.DailyQuota, &l.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant limits: %v", err)
+		}
+		l.Window = time.Duration(windowMs) * time.Millisecond
+		result = append(result, &l)
+	}
+	return result, rows.Err()
+}
+
+// SaveTenant inserts a provisioned tenant, failing when the ID is taken
+func (r *PostgresRepository) SaveTenant(ctx context.Context, tenant *model.TenantRecord) error {
+	_, err := r.Pool.Exec(ctx,
+		`INSERT INTO tenants (id, spec, created_at) VALUES ($1, $2, $3)`,
+		tenant.ID, tenant.Spec, tenant.CreatedAt,
+	)
+	return err
+}
+
+func (r *PostgresRepository) FindTenants(ctx context.Context) ([]*model.TenantRecord, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT id, spec, created_at FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tenants: %v", err)
+	}
+	defer rows.Close()
+
+	var tenants []*model.TenantRecord
+	for rows.Next() {
+		var t model.TenantRecord
+		if err := rows.Scan(&t.ID, &t.Spec, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %v", err)
+		}
+		tenants = append(tenants, &t)
+	}
+	return tenants, rows.Err()
+}
+
+// rateLimitColumns maps the aggregation dimensions to their columns
+var rateLimitColumns = map[string]string{
+	model.RateLimitByRule:     "rule",
+	model.RateLimitByKey:      "limit_key",
+	model.RateLimitByClientIP: "client_ip",
+	model.RateLimitByTenant:   "tenant_id",
+	model.RateLimitByPath:     "path",
+}
+
+func (r *PostgresRepository) SaveRateLimitEvents(ctx context.Context, events []*model.RateLimitEvent) error {
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		batch.Queue(
+			`INSERT INTO ratelimit_event (id, timestamp, rule, limit_key, client_ip, tenant_id, method, path, request_count)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			e.ID, e.Timestamp, e.Rule, e.Key, e.ClientIP, nullString(e.TenantID), e.Method, e.Path, e.Count,
+		)
+	}
+	return r.Pool.SendBatch(ctx, batch).Close()
+}
+
+func rateLimitConditions(filter model.RateLimitEventFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Rule != "" {
+		addCondition("rule = $%d", filter.Rule)
+	}
+	if filter.Key != "" {
+		addCondition("limit_key = $%d", filter.Key)
+	}
+	if filter.ClientIP != "" {
+		addCondition("client_ip = $%d", filter.ClientIP)
+	}
+	if filter.TenantID != "" {
+		addCondition("tenant_id = $%d", filter.TenantID)
+	}
+	if !filter.From.IsZero() {
+		addCondition("timestamp >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("timestamp < $%d", filter.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (r *PostgresRepository) FindRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter) ([]*model.RateLimitEvent, error) {
+	where, args := rateLimitConditions(filter)
+	query := `SELECT id, timestamp, rule, limit_key, COALESCE(client_ip, ''), COALESCE(tenant_id, ''),
+		COALESCE(method, ''), COALESCE(path, ''), request_count
+		FROM ratelimit_event` + where +
+		fmt.Sprintf(" ORDER BY timestamp DESC LIMIT %d", filter.EffectiveLimit())
+
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rate limit events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []*model.RateLimitEvent
+	for rows.Next() {
+		var e model.RateLimitEvent
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Rule, &e.Key, &e.ClientIP, &e.TenantID, &e.Method, &e.Path, &e.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan rate limit event: %v", err)
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// AggregateRateLimitEvents counts the matching events per value of the by
+// dimension, most frequent first
+func (r *PostgresRepository) AggregateRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter, by string) ([]*model.RateLimitAggregate, error) {
+	column, ok := rateLimitColumns[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown rate limit dimension %s", by)
+	}
+	where, args := rateLimitConditions(filter)
+	query := fmt.Sprintf(`SELECT COALESCE(%[1]s, ''), COUNT(*), MAX(request_count), MIN(timestamp), MAX(timestamp)
+		FROM ratelimit_event%[2]s GROUP BY %[1]s ORDER BY COUNT(*) DESC LIMIT %[3]d`,
+		column, where, filter.EffectiveLimit())
+
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate rate limit events: %v", err)
+	}
+	defer rows.Close()
+
+	var result []*model.RateLimitAggregate
+	for rows.Next() {
+		var a model.RateLimitAggregate
+		if err := rows.Scan(&a.Value, &a.Events, &a.MaxCount, &a.First, &a.Last); err != nil {
+			return nil, fmt.Errorf("failed to scan rate limit aggregate: %v", err)
+		}
+		result = append(result, &a)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tuncerburak97/muhtar/internal/model"
+)
+
+// benchDSNEnv names the database the benchmarks write to, they are skipped
+// when it is not set
+const benchDSNEnv = "MUHTAR_BENCH_POSTGRES_DSN"
+
+// BenchmarkSaveLogs compares the COPY FROM path with the pipelined batch of
+// INSERTs at batch sizes around the default CopyThreshold
+func BenchmarkSaveLogs(b *testing.B) {
+	dsn := os.Getenv(benchDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s is not set", benchDSNEnv)
+	}
+	ctx := context.Background()
+	repo, err := NewPostgresRepository(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer repo.Close()
+	if err := repo.Migrate(ctx); err != nil {
+		b.Fatalf("failed to migrate: %v", err)
+	}
+
+	paths := []struct {
+		name string
+		save func(context.Context, []*model.Log) error
+	}{
+		{"copy", repo.copyLogs},
+		{"batch", repo.batchLogs},
+	}
+	sizes := []int{10, 25, defaultCopyThreshold - 1, defaultCopyThreshold, 100, 250, 1000}
+	for _, size := range sizes {
+		for _, path := range paths {
+			b.Run(fmt.Sprintf("%s/%d", path.name, size), func(b *testing.B) {
+				batches := make([][]*model.Log, b.N)
+				for i := range batches {
+					batches[i] = benchLogs(size)
+				}
+				b.ResetTimer()
+				for _, logs := range batches {
+					if err := path.save(ctx, logs); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(b.N*size)/b.Elapsed().Seconds(), "logs/s")
+			})
+		}
+	}
+}
+
+// benchLogs builds request logs shaped like the ones the proxy writes
+func benchLogs(n int) []*model.Log {
+	logs := make([]*model.Log, n)
+	for i := range logs {
+		logs[i] = &model.Log{
+			ID:          uuid.New().String(),
+			TraceID:     uuid.New().String(),
+			ProcessType: model.ProcessTypeRequest,
+			Timestamp:   time.Now(),
+			Method:      "POST",
+			URL:         "http://localhost:8080/api/orders?page=1",
+			Path:        "/api/orders",
+			QueryParams: map[string]string{"page": "1"},
+			Headers: model.Headers{
+				"Content-Type": []string{"application/json"},
+			},
+			Body:      []byte(`{"item":"book","quantity":1}`),
+			ClientIP:  "127.0.0.1",
+			UserAgent: "muhtar-bench",
+		}
+	}
+	return logs
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 
 	"github.com/tuncerburak97/muhtar/internal/model"
 )
@@ -9,6 +10,70 @@ import (
 type LogRepository interface {
 	SaveLog(ctx context.Context, log *model.Log) error
 	SaveLogs(ctx context.Context, logs []*model.Log) error
+	FindLogs(ctx context.Context, filter model.LogFilter) ([]*model.Log, error)
 	Migrate(ctx context.Context) error
 	Close() error
 }
+
+// HealthChecker is implemented by repositories able to report connectivity
+// and connection pool statistics
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+	Stats() map[string]interface{}
+}
+
+// ErrRollupsUnsupported is returned when the backend cannot store rollups
+var ErrRollupsUnsupported = errors.New("repository does not support rollups")
+
+// ErrUsageUnsupported is returned when the backend cannot store tenant usage
+var ErrUsageUnsupported = errors.New("repository does not support tenant usage")
+
+// ErrTenantLimitsUnsupported is returned when the backend cannot store tenant
+// limit overrides
+var ErrTenantLimitsUnsupported = errors.New("repository does not support tenant limits")
+
+// ErrTenantsUnsupported is returned when the backend cannot store provisioned
+// tenants
+var ErrTenantsUnsupported = errors.New("repository does not support tenant provisioning")
+
+// ErrRateLimitEventsUnsupported is returned when the backend cannot store
+// rate limit events
+var ErrRateLimitEventsUnsupported = errors.New("repository does not support rate limit events")
+
+// RollupRepository is implemented by repositories able to store per-minute
+// traffic rollups
+type RollupRepository interface {
+	SaveRollups(ctx context.Context, rollups []*model.Rollup) error
+	FindRollups(ctx context.Context, filter model.RollupFilter) ([]*model.Rollup, error)
+}
+
+// UsageRepository is implemented by repositories able to store hourly tenant
+// usage. SaveUsage adds to the counters already stored for the same hour.
+type UsageRepository interface {
+	SaveUsage(ctx context.Context, usage []*model.Usage) error
+	FindUsage(ctx context.Context, filter model.UsageFilter) ([]*model.Usage, error)
+}
+
+// TenantLimitRepository is implemented by repositories able to store runtime
+// tenant limit overrides
+type TenantLimitRepository interface {
+	SaveTenantLimits(ctx context.Context, limits *model.TenantLimits) error
+	DeleteTenantLimits(ctx context.Context, tenant string) error
+	FindTenantLimits(ctx context.Context) ([]*model.TenantLimits, error)
+}
+
+// TenantRepository is implemented by repositories able to store tenants
+// provisioned at runtime
+type TenantRepository interface {
+	SaveTenant(ctx context.Context, tenant *model.TenantRecord) error
+	FindTenants(ctx context.Context) ([]*model.TenantRecord, error)
+}
+
+// RateLimitEventRepository is implemented by repositories able to store the
+// requests rejected by the rate limiter. by is one of the model.RateLimitBy
+// dimensions.
+type RateLimitEventRepository interface {
+	SaveRateLimitEvents(ctx context.Context, events []*model.RateLimitEvent) error
+	FindRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter) ([]*model.RateLimitEvent, error)
+	AggregateRateLimitEvents(ctx context.Context, filter model.RateLimitEventFilter, by string) ([]*model.RateLimitAggregate, error)
+}
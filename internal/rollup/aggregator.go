@@ -0,0 +1,213 @@
+package rollup
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/openapi"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+)
+
+const defaultMaxSamples = 1024
+
+type key struct {
+	minute time.Time
+	method string
+	path   string
+	status int
+}
+
+type bucket struct {
+	count   int64
+	errors  int64
+	samples []float64
+}
+
+// Aggregator builds per-minute traffic rollups from response logs and writes
+// completed minutes to the repository
+type Aggregator struct {
+	config   *config.RollupConfig
+	repo     repository.RollupRepository
+	reader   repository.RollupRepository
+	instance string
+
+	mu      sync.Mutex
+	buckets map[key]*bucket
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewAggregator starts the rollup flush job. reader is used by the query
+// endpoint and may be a read replica.
+func NewAggregator(cfg *config.RollupConfig, repo, reader repository.RollupRepository) *Aggregator {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	a := &Aggregator{
+		config:   cfg,
+		repo:     repo,
+		reader:   reader,
+		instance: instance,
+		buckets:  make(map[key]*bucket),
+		done:     make(chan struct{}),
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// Observe records a response log in the rollup of its minute
+func (a *Aggregator) Observe(l *model.Log) {
+	if l.ProcessType != model.ProcessTypeResponse {
+		return
+	}
+	k := key{
+		minute: l.Timestamp.UTC().Truncate(time.Minute),
+		method: l.Method,
+		path:   openapi.TemplatePath(l.Path),
+		status: l.StatusCode,
+	}
+	latency := float64(l.ResponseTime) / float64(time.Millisecond)
+
+	maxSamples := a.config.MaxSamples
+	if maxSamples <= 0 {
+		maxSamples = defaultMaxSamples
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.buckets[k]
+	if !ok {
+		b = &bucket{}
+		a.buckets[k] = b
+	}
+	b.count++
+	if l.StatusCode >= 500 || l.Error != "" {
+		b.errors++
+	}
+	// Reservoir sampling keeps memory bounded on hot routes
+	if len(b.samples) < maxSamples {
+		b.samples = append(b.samples, latency)
+	} else if i := rand.Int63n(b.count); i < int64(maxSamples) {
+		b.samples[i] = latency
+	}
+}
+
+func (a *Aggregator) run() {
+	defer a.wg.Done()
+
+	interval := a.config.FlushInterval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			a.flush(time.Time{})
+			return
+		case <-ticker.C:
+			// Leave a minute of grace for slow requests finishing late
+			a.flush(time.Now().UTC().Add(-time.Minute).Truncate(time.Minute))
+		}
+	}
+}
+
+// flush writes every minute before the given one. A zero time flushes all,
+// including the minute in progress.
+func (a *Aggregator) flush(before time.Time) {
+	a.mu.Lock()
+	var rollups []*model.Rollup
+	for k, b := range a.buckets {
+		if !before.IsZero() && !k.minute.Before(before) {
+			continue
+		}
+		delete(a.buckets, k)
+		rollups = append(rollups, a.summarize(k, b))
+	}
+	a.mu.Unlock()
+
+	if len(rollups) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.repo.SaveRollups(ctx, rollups); err != nil {
+		log.Error().Err(err).Int("count", len(rollups)).Msg("Failed to save traffic rollups")
+	}
+}
+
+func (a *Aggregator) summarize(k key, b *bucket) *model.Rollup {
+	sort.Float64s(b.samples)
+	return &model.Rollup{
+		Minute:     k.minute,
+		Instance:   a.instance,
+		Method:     k.method,
+		Path:       k.path,
+		StatusCode: k.status,
+		Count:      b.count,
+		ErrorCount: b.errors,
+		P50:        percentile(b.samples, 0.50),
+		P95:        percentile(b.samples, 0.95),
+		P99:        percentile(b.samples, 0.99),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// Close flushes pending rollups and stops the job
+func (a *Aggregator) Close() {
+	close(a.done)
+	a.wg.Wait()
+}
+
+// RegisterAdminRoutes mounts the rollup query endpoint
+func (a *Aggregator) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/rollups", a.handleQuery)
+}
+
+func (a *Aggregator) handleQuery(c *fiber.Ctx) error {
+	filter := model.RollupFilter{
+		Method:     c.Query("method"),
+		PathPrefix: c.Query("path_prefix"),
+		StatusCode: c.QueryInt("status_code"),
+		Limit:      c.QueryInt("limit"),
+	}
+	since, err := time.ParseDuration(c.Query("since", "1h"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid since duration")
+	}
+	filter.From = time.Now().Add(-since)
+
+	rollups, err := a.reader.FindRollups(c.Context(), filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"count":   len(rollups),
+		"rollups": rollups,
+	})
+}
@@ -0,0 +1,312 @@
+package sentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// maxFrames bounds the stack trace attached to an event
+const maxFrames = 50
+
+// redactedHeaders are never sent to the error tracker
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// client sends events to one Sentry project through the envelope endpoint
+type client struct {
+	config   config.SentryConfig
+	endpoint string
+	auth     string
+	server   string
+	http     *http.Client
+
+	events chan *event
+	wg     sync.WaitGroup
+}
+
+var (
+	mu      sync.RWMutex
+	current *client
+)
+
+// Init starts reporting to the configured DSN. Until Init succeeds, captures
+// are dropped.
+func Init(cfg *config.SentryConfig) error {
+	dsn, err := url.Parse(cfg.DSN)
+	if err != nil || dsn.User == nil || dsn.Host == "" {
+		return fmt.Errorf("invalid sentry dsn")
+	}
+	path := strings.TrimSuffix(dsn.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 || path[i+1:] == "" {
+		return fmt.Errorf("sentry dsn has no project id")
+	}
+	project := path[i+1:]
+
+	c := &client{
+		config:   *cfg,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", dsn.Scheme, dsn.Host, path[:i], project),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=muhtar/1.0, sentry_key=%s", dsn.User.Username()),
+		events:   make(chan *event, 100),
+	}
+	if c.config.SampleRate <= 0 || c.config.SampleRate > 1 {
+		c.config.SampleRate = 1
+	}
+	timeout := c.config.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	c.http = &http.Client{Timeout: timeout}
+	c.server, _ = os.Hostname()
+
+	c.wg.Add(1)
+	go c.run()
+
+	mu.Lock()
+	previous := current
+	current = c
+	mu.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+	return nil
+}
+
+// Close sends the pending events and stops reporting
+func Close() {
+	mu.Lock()
+	c := current
+	current = nil
+	mu.Unlock()
+	if c != nil {
+		c.close()
+	}
+}
+
+// CaptureError reports an internal failure. tags are indexed by Sentry, e.g.
+// component or tenant.
+func CaptureError(err error, tags map[string]string) {
+	capture(err, nil, tags)
+}
+
+// CaptureRequest reports a failure while serving c, attaching the request
+func CaptureRequest(c *fiber.Ctx, err error, tags map[string]string) {
+	capture(err, c, tags)
+}
+
+// CapturePanic reports a recovered panic while serving c. It must be called
+// from the recovering goroutine so the stack still holds the panic.
+func CapturePanic(c *fiber.Ctx, v interface{}) {
+	err, ok := v.(error)
+	if !ok {
+		err = fmt.Errorf("%v", v)
+	}
+	capture(err, c, map[string]string{"panic": "true"})
+}
+
+// capture queues an event. It must be called directly by the exported
+// Capture functions, the stack trace starts at their caller.
+func capture(err error, c *fiber.Ctx, tags map[string]string) {
+	// The lock is held until the event is queued, Close must not close the
+	// queue in between
+	mu.RLock()
+	defer mu.RUnlock()
+	cl := current
+	if cl == nil || err == nil {
+		return
+	}
+	if cl.config.SampleRate < 1 && rand.Float64() >= cl.config.SampleRate {
+		return
+	}
+
+	e := cl.newEvent(err, tags, callers(2))
+	if c != nil {
+		e.Request = newRequest(c)
+	}
+	select {
+	case cl.events <- e:
+	default:
+		log.Warn().Str("event_id", e.EventID).Msg("Sentry queue full, dropping event")
+	}
+}
+
+func (c *client) run() {
+	defer c.wg.Done()
+	for e := range c.events {
+		c.send(e)
+	}
+}
+
+func (c *client) close() {
+	close(c.events)
+	c.wg.Wait()
+}
+
+func (c *client) send(e *event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	header, _ := json.Marshal(map[string]string{"event_id": e.EventID, "sent_at": time.Now().UTC().Format(time.RFC3339)})
+	item, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(payload)})
+
+	var body bytes.Buffer
+	for _, line := range [][]byte{header, item, payload} {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create sentry request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to send event to sentry")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Warn().Int("status_code", resp.StatusCode).Msg("Sentry rejected event")
+	}
+}
+
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   []exception       `json:"exception"`
+	Request     *request          `json:"request,omitempty"`
+}
+
+type exception struct {
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Stacktrace stacktrace `json:"stacktrace"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type request struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+func (c *client) newEvent(err error, tags map[string]string, frames []frame) *event {
+	return &event{
+		EventID:     strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Timestamp:   time.Now().UTC(),
+		Platform:    "go",
+		Level:       "error",
+		Logger:      "muhtar",
+		ServerName:  c.server,
+		Environment: c.config.Environment,
+		Release:     c.config.Release,
+		Tags:        tags,
+		Exception: []exception{{
+			Type:       fmt.Sprintf("%T", err),
+			Value:      err.Error(),
+			Stacktrace: stacktrace{Frames: frames},
+		}},
+	}
+}
+
+// callers returns the stack above the skip frames calling it, oldest frame
+// first as Sentry expects
+func callers(skip int) []frame {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var result []frame
+	for {
+		f, more := frames.Next()
+		module, function := splitFunction(f.Function)
+		result = append(result, frame{
+			Function: function,
+			Module:   module,
+			Filename: f.File[strings.LastIndex(f.File, "/")+1:],
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(module, "github.com/tuncerburak97/muhtar"),
+		})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// splitFunction splits a qualified function name into its package path and
+// the function name
+func splitFunction(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	dot += slash + 1
+	return name[:dot], name[dot+1:]
+}
+
+func newRequest(c *fiber.Ctx) *request {
+	r := &request{
+		URL:         c.BaseURL() + c.Path(),
+		Method:      c.Method(),
+		QueryString: string(c.Request().URI().QueryString()),
+		Headers:     make(map[string]string),
+		Env:         map[string]string{"REMOTE_ADDR": c.IP()},
+	}
+	for k, v := range c.GetReqHeaders() {
+		if redactedHeaders[k] || len(v) == 0 {
+			continue
+		}
+		r.Headers[k] = v[0]
+	}
+	return r
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+)
+
+// Backpressure policies applied when the log queue is full
+const (
+	// BackpressureFallback diverts logs to the fallback buffer (and disk spool)
+	BackpressureFallback = "fallback"
+	// BackpressureBlock waits up to max_wait for queue space, then drops the log
+	BackpressureBlock = "block"
+	// BackpressureDropOldest evicts the oldest queued log to make room
+	BackpressureDropOldest = "drop_oldest"
+	// BackpressureDropNewest discards the incoming log
+	BackpressureDropNewest = "drop_newest"
+	// BackpressureSample keeps only a share of logs once the queue passes the
+	// high watermark and drops the incoming log when it is full
+	BackpressureSample = "sample"
+)
+
+func validateBackpressure(cfg *config.BackpressureConfig) error {
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = BackpressureFallback
+	case BackpressureFallback, BackpressureBlock, BackpressureDropOldest, BackpressureDropNewest, BackpressureSample:
+	default:
+		return fmt.Errorf("unknown log backpressure policy: %s", cfg.Policy)
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = 100 * time.Millisecond
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 0.1
+	}
+	if cfg.HighWatermark <= 0 || cfg.HighWatermark > 1 {
+		cfg.HighWatermark = 0.8
+	}
+	return nil
+}
+
+// enqueue places the log on the queue according to the backpressure policy.
+// Every action other than a plain enqueue is counted, so data loss is visible.
+func (s *LoggerService) enqueue(entry *model.Log) {
+	bp := s.config.Backpressure
+
+	if bp.Policy == BackpressureSample && float64(len(s.logChan)) >= bp.HighWatermark*float64(cap(s.logChan)) {
+		if rand.Float64() >= bp.SampleRate {
+			s.drop("sampled_out")
+			return
+		}
+		s.metrics.IncBackpressure("sampled_in")
+	}
+
+	select {
+	case s.logChan <- entry:
+		return
+	default:
+	}
+
+	switch bp.Policy {
+	case BackpressureBlock:
+		s.metrics.IncBackpressure("blocked")
+		timer := time.NewTimer(bp.MaxWait)
+		defer timer.Stop()
+		select {
+		case s.logChan <- entry:
+		case <-timer.C:
+			s.drop("block_timeout")
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case s.logChan <- entry:
+				return
+			default:
+			}
+			select {
+			case <-s.logChan:
+				s.drop("dropped_oldest")
+			default:
+			}
+		}
+	case BackpressureDropNewest, BackpressureSample:
+		s.drop("dropped_newest")
+	default:
+		s.metrics.IncBackpressure("diverted")
+		s.spill(entry)
+	}
+}
+
+func (s *LoggerService) drop(action string) {
+	s.metrics.IncBackpressure(action)
+	s.metrics.IncDroppedLogs(action, 1)
+}
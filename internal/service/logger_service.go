@@ -5,64 +5,369 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/breaker"
+	"github.com/tuncerburak97/muhtar/internal/config"
 	"github.com/tuncerburak97/muhtar/internal/metrics"
 	"github.com/tuncerburak97/muhtar/internal/model"
 	"github.com/tuncerburak97/muhtar/internal/repository"
-	"go.uber.org/zap"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
+	"github.com/tuncerburak97/muhtar/internal/spool"
 )
 
+const replayBatchSize = 100
+
+// LoggerService persists traffic logs asynchronously. Logs are queued and
+// written by a fixed pool of workers so a slow or unavailable repository
+// never blocks the proxy path. Repository failures trip a circuit breaker;
+// while it is open logs are kept in a bounded fallback buffer and replayed
+// once the repository recovers. When spilling is enabled, logs that overflow
+// the fallback buffer are written to disk segments and replayed the same way
+// (at-least-once).
 type LoggerService struct {
-	repo         repository.LogRepository
-	requestChan  chan *model.RequestLog
-	responseChan chan *model.ResponseLog
-	workerCount  int
-	wg           sync.WaitGroup
-	done         chan struct{}
-	bufferSize   int
-	mu           sync.RWMutex
-	metrics      *metrics.MetricsCollector
-	logger       *zap.Logger
-}
-
-func NewLoggerService(repo repository.LogRepository, metrics *metrics.MetricsCollector, workerCount, bufferSize int) *LoggerService {
+	repo    repository.LogRepository
+	config  config.LogPersistenceConfig
+	metrics *metrics.MetricsCollector
+	breaker *breaker.Breaker
+	spool   *spool.Spool
+
+	logChan chan *model.Log
+	wg      sync.WaitGroup
+	done    chan struct{}
+
+	mu       sync.Mutex
+	fallback []*model.Log
+}
+
+// NewLoggerService creates a logger service and starts its workers
+func NewLoggerService(repo repository.LogRepository, metrics *metrics.MetricsCollector, cfg config.LogPersistenceConfig) (*LoggerService, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 5
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 5 * time.Second
+	}
+	if cfg.FallbackSize <= 0 {
+		cfg.FallbackSize = 10000
+	}
+	if err := validateBackpressure(&cfg.Backpressure); err != nil {
+		return nil, err
+	}
+
 	s := &LoggerService{
-		repo:         repo,
-		requestChan:  make(chan *model.RequestLog, bufferSize),
-		responseChan: make(chan *model.ResponseLog, bufferSize),
-		workerCount:  workerCount,
-		done:         make(chan struct{}),
-		bufferSize:   bufferSize,
-		metrics:      metrics,
-		logger:       zap.NewExample(),
+		repo:    repo,
+		config:  cfg,
+		metrics: metrics,
+		logChan: make(chan *model.Log, cfg.BufferSize),
+		done:    make(chan struct{}),
+	}
+	if cfg.Breaker.Enabled {
+		s.breaker = breaker.New("repository", breaker.Settings{
+			FailureThreshold: cfg.Breaker.FailureThreshold,
+			RecoveryTimeout:  cfg.Breaker.RecoveryTimeout,
+			HalfOpenRequests: cfg.Breaker.HalfOpenRequests,
+			OnStateChange:    s.onStateChange,
+		})
+		metrics.ObserveBreakerState("repository", int(breaker.StateClosed))
+	}
+	if cfg.Spill.Enabled {
+		sp, err := spool.Open(cfg.Spill)
+		if err != nil {
+			return nil, err
+		}
+		s.spool = sp
 	}
 
 	s.startWorkers()
-	return s
+	return s, nil
 }
 
 func (s *LoggerService) startWorkers() {
-	// Request workers
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	s.wg.Add(1)
+	go s.replay()
 	go s.monitorBuffers()
 }
 
+// LogRequest queues a log for persistence. When the queue is full the
+// configured backpressure policy decides what happens; only the block policy
+// may delay the caller, and never longer than its max wait.
 func (s *LoggerService) LogRequest(log *model.Log) error {
-	return s.repo.SaveLog(context.Background(), log)
-}
-
-func (s *LoggerService) LogResponse(log *model.ResponseLog) {
 	if log.ID == "" {
 		log.ID = uuid.New().String()
 	}
-	s.responseChan <- log
+	s.enqueue(log)
+	return nil
+}
+
+func (s *LoggerService) worker() {
+	defer s.wg.Done()
+	for log := range s.logChan {
+		s.save(log)
+	}
 }
 
+// save writes a single log, diverting it to the fallback buffer when the
+// breaker is open or the write fails
+func (s *LoggerService) save(entry *model.Log) {
+	if s.breaker != nil && !s.breaker.Allow() {
+		s.spill(entry)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.WriteTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.repo.SaveLog(ctx, entry)
+	s.metrics.ObserveBatchSave("single", time.Since(start), 1)
+	if err != nil {
+		s.metrics.LogError("log_persistence", err)
+		if s.breaker != nil {
+			s.breaker.Failure()
+			s.spill(entry)
+			return
+		}
+		log.Error().Err(err).Str("trace_id", entry.TraceID).Msg("Failed to save log")
+		sentry.CaptureError(err, map[string]string{"component": "log_persistence", "trace_id": entry.TraceID})
+		s.metrics.IncDroppedLogs("write_error", 1)
+		return
+	}
+	if s.breaker != nil {
+		s.breaker.Success()
+	}
+}
+
+// spill keeps the log in the fallback buffer. When the buffer is full its
+// contents move to the disk spool, or the oldest entry is dropped if spilling
+// is disabled or fails.
+func (s *LoggerService) spill(entry *model.Log) {
+	s.mu.Lock()
+	s.fallback = append(s.fallback, entry)
+	if len(s.fallback) <= s.config.FallbackSize {
+		s.mu.Unlock()
+		return
+	}
+	if s.spool == nil {
+		s.fallback = s.fallback[1:]
+		s.mu.Unlock()
+		s.metrics.IncDroppedLogs("fallback_full", 1)
+		return
+	}
+	batch := s.fallback
+	s.fallback = nil
+	s.mu.Unlock()
+
+	if err := s.spool.Write(batch); err != nil {
+		log.Warn().Err(err).Int("count", len(batch)).Msg("Failed to spill logs to disk")
+		s.requeue(batch)
+	}
+}
+
+// replay periodically flushes the fallback buffer while the repository is
+// available
+func (s *LoggerService) replay() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			for s.flushFallback() {
+			}
+			for s.flushSpool() {
+			}
+		}
+	}
+}
+
+// flushFallback writes one batch from the fallback buffer and reports whether
+// more batches may be written
+func (s *LoggerService) flushFallback() bool {
+	if s.breaker != nil && s.breaker.State() == breaker.StateOpen {
+		return false
+	}
+
+	s.mu.Lock()
+	n := len(s.fallback)
+	if n > replayBatchSize {
+		n = replayBatchSize
+	}
+	batch := make([]*model.Log, n)
+	copy(batch, s.fallback)
+	s.fallback = s.fallback[n:]
+	s.mu.Unlock()
+	if n == 0 {
+		return false
+	}
+
+	if s.breaker != nil && !s.breaker.Allow() {
+		s.requeue(batch)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.WriteTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.repo.SaveLogs(ctx, batch)
+	s.metrics.ObserveBatchSave("replay", time.Since(start), len(batch))
+	if err != nil {
+		log.Warn().Err(err).Int("count", len(batch)).Msg("Failed to replay buffered logs")
+		if s.breaker != nil {
+			s.breaker.Failure()
+		}
+		s.requeue(batch)
+		return false
+	}
+	if s.breaker != nil {
+		s.breaker.Success()
+	}
+	return true
+}
+
+// requeue puts a batch back in front of the fallback buffer, dropping the
+// oldest entries that no longer fit
+func (s *LoggerService) requeue(batch []*model.Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = append(batch, s.fallback...)
+	if over := len(s.fallback) - s.config.FallbackSize; over > 0 {
+		s.fallback = s.fallback[over:]
+		s.metrics.IncDroppedLogs("fallback_full", over)
+	}
+}
+
+// flushSpool replays the oldest disk segment and reports whether more
+// segments may be replayed. A segment is removed only once all of its logs
+// are written, so a failed replay may write some logs twice.
+func (s *LoggerService) flushSpool() bool {
+	if s.spool == nil || (s.breaker != nil && s.breaker.State() == breaker.StateOpen) {
+		return false
+	}
+
+	name, logs, err := s.spool.Next()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read spooled logs")
+		return false
+	}
+	if name == "" {
+		return false
+	}
+
+	for start := 0; start < len(logs); start += replayBatchSize {
+		end := start + replayBatchSize
+		if end > len(logs) {
+			end = len(logs)
+		}
+		if s.breaker != nil && !s.breaker.Allow() {
+			return false
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.WriteTimeout)
+		began := time.Now()
+		err := s.repo.SaveLogs(ctx, logs[start:end])
+		cancel()
+		s.metrics.ObserveBatchSave("spool_replay", time.Since(began), end-start)
+		if err != nil {
+			log.Warn().Err(err).Str("segment", name).Msg("Failed to replay spooled logs")
+			if s.breaker != nil {
+				s.breaker.Failure()
+			}
+			return false
+		}
+		if s.breaker != nil {
+			s.breaker.Success()
+		}
+	}
+
+	if err := s.spool.Remove(name); err != nil {
+		log.Error().Err(err).Msg("Failed to remove replayed segment")
+		return false
+	}
+	return true
+}
+
+func (s *LoggerService) onStateChange(name string, from, to breaker.State) {
+	s.metrics.ObserveBreakerState(name, int(to))
+	event := log.Warn()
+	if to == breaker.StateClosed {
+		event = log.Info()
+	}
+	event.Str("breaker", name).Str("from", from.String()).Str("to", to.String()).Msg("Circuit breaker state changed")
+}
+
+// Status returns the persistence queue and breaker state
+func (s *LoggerService) Status() map[string]interface{} {
+	s.mu.Lock()
+	fallback := len(s.fallback)
+	s.mu.Unlock()
+
+	status := map[string]interface{}{
+		"queued":   len(s.logChan),
+		"fallback": fallback,
+	}
+	if s.spool != nil {
+		status["spooled_bytes"] = s.spool.Size()
+	}
+	if s.breaker != nil {
+		status["breaker"] = s.breaker.State().String()
+		status["retry_after"] = s.breaker.RetryAfter().String()
+	}
+	return status
+}
+
+// RegisterAdminRoutes mounts the log persistence status endpoint
+func (s *LoggerService) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/persistence", func(c *fiber.Ctx) error {
+		return c.JSON(s.Status())
+	})
+}
+
+// Shutdown stops accepting logs, waits for queued logs to be written and
+// makes a final attempt to flush the fallback buffer. Logs that could not be
+// written are kept in the disk spool for the next run when spilling is
+// enabled. The repository itself is owned and closed by the caller.
 func (s *LoggerService) Shutdown() {
+	close(s.logChan)
 	close(s.done)
-	close(s.requestChan)
-	close(s.responseChan)
 	s.wg.Wait()
-	s.repo.Close()
+	for s.flushFallback() {
+	}
+
+	s.mu.Lock()
+	remaining := s.fallback
+	s.fallback = nil
+	s.mu.Unlock()
+
+	if s.spool != nil {
+		if len(remaining) > 0 {
+			if err := s.spool.Write(remaining); err != nil {
+				log.Error().Err(err).Msg("Failed to spill logs on shutdown")
+			} else {
+				remaining = nil
+			}
+		}
+		if err := s.spool.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close log spool")
+		}
+	}
+	if len(remaining) > 0 {
+		log.Warn().Int("count", len(remaining)).Msg("Dropping buffered logs on shutdown")
+		s.metrics.IncDroppedLogs("shutdown", len(remaining))
+	}
 }
 
 func (s *LoggerService) monitorBuffers() {
@@ -74,8 +379,14 @@ func (s *LoggerService) monitorBuffers() {
 		case <-s.done:
 			return
 		case <-ticker.C:
-			s.metrics.ObserveQueueSize("request", float64(len(s.requestChan)))
-			s.metrics.ObserveQueueSize("response", float64(len(s.responseChan)))
+			s.mu.Lock()
+			fallback := len(s.fallback)
+			s.mu.Unlock()
+			s.metrics.ObserveQueueSize("log", float64(len(s.logChan)))
+			s.metrics.ObserveQueueSize("fallback", float64(fallback))
+			if s.spool != nil {
+				s.metrics.ObserveQueueSize("spool_bytes", float64(s.spool.Size()))
+			}
 		}
 	}
 }
@@ -0,0 +1,172 @@
+package shadow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// compare diffs the primary and shadow responses. It returns the list of
+// differences and the reason used as metric label for the first one.
+func (m *Mirror) compare(primary, shadow *Captured) ([]string, string) {
+	var diffs []string
+	reason := ""
+
+	if primary.StatusCode != shadow.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status: primary %d, shadow %d", primary.StatusCode, shadow.StatusCode))
+		reason = "status"
+	}
+
+	if headerDiffs := m.compareHeaders(primary.Header, shadow.Header); len(headerDiffs) > 0 {
+		diffs = append(diffs, headerDiffs...)
+		if reason == "" {
+			reason = "headers"
+		}
+	}
+
+	if bodyDiffs := m.compareBodies(primary.Body, shadow.Body); len(bodyDiffs) > 0 {
+		diffs = append(diffs, bodyDiffs...)
+		if reason == "" {
+			reason = "body"
+		}
+	}
+
+	return diffs, reason
+}
+
+func (m *Mirror) compareHeaders(primary, shadow http.Header) []string {
+	keys := make(map[string]struct{})
+	for k := range primary {
+		keys[k] = struct{}{}
+	}
+	for k := range shadow {
+		keys[k] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if !m.ignoreHeaders[http.CanonicalHeaderKey(k)] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, k := range sorted {
+		p, s := strings.Join(primary.Values(k), ","), strings.Join(shadow.Values(k), ",")
+		if p != s {
+			diffs = append(diffs, fmt.Sprintf("header %s: primary %q, shadow %q", k, p, s))
+		}
+	}
+	return diffs
+}
+
+func (m *Mirror) compareBodies(primary, shadow []byte) []string {
+	var p, s interface{}
+	if json.Unmarshal(primary, &p) != nil || json.Unmarshal(shadow, &s) != nil {
+		if !bytes.Equal(primary, shadow) {
+			return []string{fmt.Sprintf("body: primary %d bytes, shadow %d bytes differ", len(primary), len(shadow))}
+		}
+		return nil
+	}
+
+	for _, field := range m.config.Compare.IgnoreFields {
+		path := strings.Split(field, ".")
+		p = removeField(p, path)
+		s = removeField(s, path)
+	}
+	return diffValues("body", p, s)
+}
+
+// removeField deletes the value at path, where "*" matches any object key or
+// array element
+func removeField(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+			if len(path) == 1 {
+				delete(val, k)
+			} else {
+				val[k] = removeField(child, path[1:])
+			}
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			for i := range val {
+				val[i] = removeField(val[i], path[1:])
+			}
+		}
+	}
+	return v
+}
+
+func diffValues(path string, primary, shadow interface{}) []string {
+	pm, pIsMap := primary.(map[string]interface{})
+	sm, sIsMap := shadow.(map[string]interface{})
+	if pIsMap && sIsMap {
+		keys := make(map[string]struct{})
+		for k := range pm {
+			keys[k] = struct{}{}
+		}
+		for k := range sm {
+			keys[k] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diffs []string
+		for _, k := range sorted {
+			diffs = append(diffs, diffValues(path+"."+k, pm[k], sm[k])...)
+		}
+		return diffs
+	}
+
+	pa, pIsArray := primary.([]interface{})
+	sa, sIsArray := shadow.([]interface{})
+	if pIsArray && sIsArray && len(pa) == len(sa) {
+		var diffs []string
+		for i := range pa {
+			diffs = append(diffs, diffValues(fmt.Sprintf("%s[%d]", path, i), pa[i], sa[i])...)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(primary, shadow) {
+		return []string{fmt.Sprintf("%s: primary %s, shadow %s", path, encode(primary), encode(shadow))}
+	}
+	return nil
+}
+
+func encode(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(raw) > 200 {
+		return string(raw[:200]) + "..."
+	}
+	return string(raw)
+}
+
+// RegisterAdminRoutes mounts the shadow comparison endpoints
+func (m *Mirror) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/shadow/samples", func(c *fiber.Ctx) error {
+		return c.JSON(m.Samples())
+	})
+}
@@ -0,0 +1,166 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/metrics"
+)
+
+const defaultSampleSize = 50
+
+// Captured is the primary response a shadow response is compared against
+type Captured struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Sample is a recorded mismatch between primary and shadow responses
+type Sample struct {
+	TraceID   string    `json:"trace_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Timestamp time.Time `json:"timestamp"`
+	Diffs     []string  `json:"diffs"`
+}
+
+// Mirror sends a copy of proxied requests to a shadow upstream and
+// optionally compares its responses with the primary ones
+type Mirror struct {
+	config        *config.MirrorConfig
+	target        *url.URL
+	client        *http.Client
+	metrics       *metrics.MetricsCollector
+	ignoreHeaders map[string]bool
+
+	mu      sync.Mutex
+	samples []Sample
+}
+
+// NewMirror creates a new traffic mirror
+func NewMirror(cfg *config.MirrorConfig, metrics *metrics.MetricsCollector) (*Mirror, error) {
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	ignore := make(map[string]bool, len(cfg.Compare.IgnoreHeaders))
+	for _, h := range cfg.Compare.IgnoreHeaders {
+		ignore[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return &Mirror{
+		config:        cfg,
+		target:        target,
+		client:        &http.Client{Timeout: timeout},
+		metrics:       metrics,
+		ignoreHeaders: ignore,
+	}, nil
+}
+
+// ShouldMirror decides whether the current request is mirrored
+func (m *Mirror) ShouldMirror() bool {
+	ratio := m.config.Ratio
+	if ratio == 0 {
+		ratio = 1
+	}
+	return ratio >= 1 || rand.Float64() < ratio
+}
+
+// Send replays the request against the shadow upstream and, when comparison
+// is enabled, diffs the result with the primary response. It is meant to be
+// called in its own goroutine and never affects the client response.
+func (m *Mirror) Send(traceID string, primary *http.Request, body []byte, captured *Captured) {
+	shadowURL := *primary.URL
+	shadowURL.Scheme = m.target.Scheme
+	shadowURL.Host = m.target.Host
+	if m.target.Path != "" && m.target.Path != "/" {
+		shadowURL.Path = strings.TrimRight(m.target.Path, "/") + shadowURL.Path
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), primary.Method, shadowURL.String(), bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Str("trace_id", traceID).Msg("Failed to create shadow request")
+		return
+	}
+	req.Header = primary.Header.Clone()
+	req.Header.Set("X-Muhtar-Shadow", "true")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Str("trace_id", traceID).Msg("Shadow request failed")
+		if m.config.Compare.Enabled {
+			m.metrics.ObserveShadowComparison("error", "transport")
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	shadowBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Warn().Err(err).Str("trace_id", traceID).Msg("Failed to read shadow response")
+		return
+	}
+
+	if !m.config.Compare.Enabled || captured == nil {
+		return
+	}
+
+	diffs, reason := m.compare(captured, &Captured{StatusCode: resp.StatusCode, Header: resp.Header, Body: shadowBody})
+	if len(diffs) == 0 {
+		m.metrics.ObserveShadowComparison("match", "")
+		return
+	}
+
+	m.metrics.ObserveShadowComparison("mismatch", reason)
+	m.record(Sample{
+		TraceID:   traceID,
+		Method:    primary.Method,
+		Path:      primary.URL.Path,
+		Timestamp: time.Now(),
+		Diffs:     diffs,
+	})
+	log.Info().
+		Str("trace_id", traceID).
+		Str("reason", reason).
+		Strs("diffs", diffs).
+		Msg("Shadow response mismatch")
+}
+
+func (m *Mirror) record(sample Sample) {
+	size := m.config.Compare.SampleSize
+	if size <= 0 {
+		size = defaultSampleSize
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, sample)
+	if len(m.samples) > size {
+		m.samples = m.samples[len(m.samples)-size:]
+	}
+}
+
+// Samples returns the retained mismatch samples, newest last
+func (m *Mirror) Samples() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Sample, len(m.samples))
+	copy(out, m.samples)
+	return out
+}
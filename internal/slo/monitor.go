@@ -0,0 +1,299 @@
+package slo
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+var defaultAlerts = []config.BurnRateAlert{
+	{Severity: "page", LongWindow: time.Hour, ShortWindow: 5 * time.Minute, Factor: 14.4},
+	{Severity: "ticket", LongWindow: 6 * time.Hour, ShortWindow: 30 * time.Minute, Factor: 6},
+}
+
+// Alert is the webhook payload sent when a burn rate alert fires or resolves
+type Alert struct {
+	Objective string    `json:"objective"`
+	SLI       string    `json:"sli"`
+	Severity  string    `json:"severity"`
+	Status    string    `json:"status"`
+	BurnRate  float64   `json:"burn_rate"`
+	Factor    float64   `json:"factor"`
+	Window    string    `json:"window"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type objective struct {
+	config config.SLOObjective
+	window *window
+	total  counts
+	// firing holds the alerts currently firing, keyed by SLI and severity
+	firing map[string]bool
+}
+
+func (o *objective) matches(tenant, method, path string) bool {
+	c := o.config
+	return (c.Tenant == "" || c.Tenant == tenant) &&
+		(c.Method == "" || c.Method == method) &&
+		strings.HasPrefix(path, c.PathPrefix)
+}
+
+// Monitor tracks availability and latency objectives and sends webhook
+// alerts when their error budget burns too fast
+type Monitor struct {
+	config     *config.SLOConfig
+	alerts     []config.BurnRateAlert
+	objectives []*objective
+	client     *http.Client
+
+	mu sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMonitor starts evaluating the configured objectives
+func NewMonitor(cfg *config.SLOConfig) *Monitor {
+	m := &Monitor{
+		config: cfg,
+		alerts: cfg.Alerts,
+		done:   make(chan struct{}),
+	}
+	if len(m.alerts) == 0 {
+		m.alerts = defaultAlerts
+	}
+
+	var longest time.Duration
+	for _, a := range m.alerts {
+		if a.LongWindow > longest {
+			longest = a.LongWindow
+		}
+	}
+	for _, oc := range cfg.Objectives {
+		m.objectives = append(m.objectives, &objective{
+			config: oc,
+			window: newWindow(longest),
+			firing: make(map[string]bool),
+		})
+	}
+
+	timeout := cfg.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	m.client = &http.Client{Timeout: timeout}
+
+	m.wg.Add(1)
+	go m.run()
+	return m
+}
+
+// Observe records one exchange against the matching objectives. failed marks
+// 5xx responses and upstream errors.
+func (m *Monitor) Observe(tenant, method, path string, failed bool, duration time.Duration) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.objectives {
+		if !o.matches(tenant, method, path) {
+			continue
+		}
+		b := o.window.bucket(now)
+		b.total++
+		o.total.total++
+		if failed {
+			b.failed++
+			o.total.failed++
+		}
+		if o.config.Latency > 0 && duration > o.config.Latency {
+			b.slow++
+			o.total.slow++
+		}
+	}
+}
+
+func (m *Monitor) run() {
+	defer m.wg.Done()
+
+	interval := m.config.EvaluationInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.evaluate()
+		}
+	}
+}
+
+// burnRate is the observed error ratio divided by the ratio the objective
+// allows. A rate of 1 consumes the budget exactly over the SLO period.
+func burnRate(bad, total int64, target float64) float64 {
+	if total == 0 || target <= 0 || target >= 1 {
+		return 0
+	}
+	return (float64(bad) / float64(total)) / (1 - target)
+}
+
+type sli struct {
+	name   string
+	target float64
+	bad    func(counts) int64
+}
+
+func (o *objective) slis() []sli {
+	var list []sli
+	if o.config.Availability > 0 {
+		list = append(list, sli{"availability", o.config.Availability, func(c counts) int64 { return c.failed }})
+	}
+	if o.config.Latency > 0 && o.config.LatencyRatio > 0 {
+		list = append(list, sli{"latency", o.config.LatencyRatio, func(c counts) int64 { return c.slow }})
+	}
+	return list
+}
+
+func (m *Monitor) evaluate() {
+	now := time.Now()
+	var notifications []Alert
+
+	m.mu.Lock()
+	for _, o := range m.objectives {
+		for _, s := range o.slis() {
+			for _, a := range m.alerts {
+				long := o.window.sum(now, a.LongWindow)
+				short := o.window.sum(now, a.ShortWindow)
+				longRate := burnRate(s.bad(long), long.total, s.target)
+				shortRate := burnRate(s.bad(short), short.total, s.target)
+				firing := longRate >= a.Factor && shortRate >= a.Factor
+
+				key := s.name + "/" + a.Severity
+				if firing == o.firing[key] {
+					continue
+				}
+				o.firing[key] = firing
+				status := "resolved"
+				if firing {
+					status = "firing"
+				}
+				notifications = append(notifications, Alert{
+					Objective: o.config.Name,
+					SLI:       s.name,
+					Severity:  a.Severity,
+					Status:    status,
+					BurnRate:  longRate,
+					Factor:    a.Factor,
+					Window:    a.LongWindow.String(),
+					Timestamp: now,
+				})
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for _, alert := range notifications {
+		log.Warn().
+			Str("objective", alert.Objective).
+			Str("sli", alert.SLI).
+			Str("severity", alert.Severity).
+			Str("status", alert.Status).
+			Float64("burn_rate", alert.BurnRate).
+			Msg("SLO burn rate alert")
+		m.notify(alert)
+	}
+}
+
+func (m *Monitor) notify(alert Alert) {
+	if m.config.Webhook.URL == "" {
+		return
+	}
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, m.config.Webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create SLO webhook request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range m.config.Webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to send SLO webhook")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Error().Int("status_code", resp.StatusCode).Msg("SLO webhook rejected alert")
+	}
+}
+
+// Close stops the evaluation job
+func (m *Monitor) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
+
+// RegisterAdminRoutes mounts the SLO status endpoint
+func (m *Monitor) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/slo", m.handleStatus)
+}
+
+func (m *Monitor) handleStatus(c *fiber.Ctx) error {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objectives := make([]fiber.Map, 0, len(m.objectives))
+	for _, o := range m.objectives {
+		slis := fiber.Map{}
+		for _, s := range o.slis() {
+			burn := fiber.Map{}
+			for _, a := range m.alerts {
+				for _, d := range []time.Duration{a.ShortWindow, a.LongWindow} {
+					w := o.window.sum(now, d)
+					burn[d.String()] = burnRate(s.bad(w), w.total, s.target)
+				}
+			}
+			var compliance float64 = 1
+			if o.total.total > 0 {
+				compliance = 1 - float64(s.bad(o.total))/float64(o.total.total)
+			}
+			slis[s.name] = fiber.Map{
+				"objective":  s.target,
+				"compliance": compliance,
+				"burn_rates": burn,
+			}
+		}
+		firing := make([]string, 0)
+		for key, on := range o.firing {
+			if on {
+				firing = append(firing, key)
+			}
+		}
+		objectives = append(objectives, fiber.Map{
+			"name":     o.config.Name,
+			"requests": o.total.total,
+			"slis":     slis,
+			"firing":   firing,
+		})
+	}
+	return c.JSON(fiber.Map{"objectives": objectives})
+}
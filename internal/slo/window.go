@@ -0,0 +1,47 @@
+package slo
+
+import "time"
+
+// counts is the traffic of one minute
+type counts struct {
+	minute time.Time
+	total  int64
+	failed int64
+	slow   int64
+}
+
+// window is a ring of per-minute counts covering the longest alert window
+type window struct {
+	buckets []counts
+}
+
+func newWindow(size time.Duration) *window {
+	n := int(size / time.Minute)
+	if n < 1 {
+		n = 1
+	}
+	return &window{buckets: make([]counts, n)}
+}
+
+func (w *window) bucket(now time.Time) *counts {
+	minute := now.Truncate(time.Minute)
+	b := &w.buckets[int(minute.Unix()/60)%len(w.buckets)]
+	if !b.minute.Equal(minute) {
+		*b = counts{minute: minute}
+	}
+	return b
+}
+
+// sum adds up the minutes of the last d
+func (w *window) sum(now time.Time, d time.Duration) counts {
+	var total counts
+	from := now.Truncate(time.Minute).Add(-d)
+	for _, b := range w.buckets {
+		if b.minute.After(from) && !b.minute.After(now) {
+			total.total += b.total
+			total.failed += b.failed
+			total.slow += b.slow
+		}
+	}
+	return total
+}
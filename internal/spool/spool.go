@@ -0,0 +1,229 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+)
+
+const (
+	segmentExt         = ".seg"
+	defaultSegmentSize = 16 << 20
+	defaultMaxSize     = 1 << 30
+)
+
+// ErrFull is returned when writing would exceed the configured disk budget
+var ErrFull = errors.New("spool is full")
+
+// Spool stores logs on local disk as append-only segment files of JSON lines.
+// Segments are replayed oldest first and removed once persisted.
+type Spool struct {
+	dir         string
+	segmentSize int64
+	maxSize     int64
+
+	mu          sync.Mutex
+	seq         uint64
+	current     *os.File
+	currentSize int64
+	total       int64
+}
+
+// Open creates the spool directory if needed and picks up segments left by a
+// previous run
+func Open(cfg config.SpillConfig) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("spool directory is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %v", err)
+	}
+
+	s := &Spool{
+		dir:         cfg.Dir,
+		segmentSize: cfg.SegmentSize,
+		maxSize:     cfg.MaxSize,
+	}
+	if s.segmentSize <= 0 {
+		s.segmentSize = defaultSegmentSize
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = defaultMaxSize
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range segments {
+		info, err := os.Stat(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat segment %s: %v", name, err)
+		}
+		s.total += info.Size()
+		if seq := segmentSeq(name); seq > s.seq {
+			s.seq = seq
+		}
+	}
+	return s, nil
+}
+
+// Write appends logs to the current segment, starting a new one once the
+// segment size is reached
+func (s *Spool) Write(logs []*model.Log) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			return fmt.Errorf("failed to encode log: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.total+int64(buf.Len()) > s.maxSize {
+		return ErrFull
+	}
+	if s.current == nil {
+		s.seq++
+		f, err := os.OpenFile(filepath.Join(s.dir, segmentName(s.seq)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to create segment: %v", err)
+		}
+		s.current = f
+		s.currentSize = 0
+	}
+
+	n, err := s.current.Write(buf.Bytes())
+	s.currentSize += int64(n)
+	s.total += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write segment: %v", err)
+	}
+	if s.currentSize >= s.segmentSize {
+		return s.seal()
+	}
+	return nil
+}
+
+// Next returns the oldest segment and its logs. The current segment is
+// sealed when it is the only one left. An empty name means the spool is
+// empty.
+func (s *Spool) Next() (string, []*model.Log, error) {
+	s.mu.Lock()
+	segments, err := s.segments()
+	if err == nil && len(segments) == 1 && s.current != nil {
+		err = s.seal()
+	}
+	s.mu.Unlock()
+	if err != nil || len(segments) == 0 {
+		return "", nil, err
+	}
+
+	name := segments[0]
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open segment %s: %v", name, err)
+	}
+	defer f.Close()
+
+	var logs []*model.Log
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), int(s.segmentSize)+1<<20)
+	for scanner.Scan() {
+		var l model.Log
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			// A partially written line from a crash, skip it
+			continue
+		}
+		logs = append(logs, &l)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, fmt.Errorf("failed to read segment %s: %v", name, err)
+	}
+	return name, logs, nil
+}
+
+// Remove deletes a replayed segment
+func (s *Spool) Remove(name string) error {
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat segment %s: %v", name, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove segment %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	s.total -= info.Size()
+	s.mu.Unlock()
+	return nil
+}
+
+// Size returns the number of bytes currently spooled
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Close syncs and closes the current segment
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil
+	}
+	return s.seal()
+}
+
+func (s *Spool) seal() error {
+	f := s.current
+	s.current = nil
+	s.currentSize = 0
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync segment: %v", err)
+	}
+	return f.Close()
+}
+
+// segments lists segment files ordered oldest first
+func (s *Spool) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool directory: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), segmentExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return segmentSeq(names[i]) < segmentSeq(names[j])
+	})
+	return names, nil
+}
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%020d%s", seq, segmentExt)
+}
+
+func segmentSeq(name string) uint64 {
+	seq, _ := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	return seq
+}
@@ -0,0 +1,243 @@
+package stats
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+const (
+	// maxSamples bounds the latency samples kept per path and minute
+	maxSamples = 128
+	// otherPath collects the traffic of paths beyond the tracking limit
+	otherPath = "other"
+)
+
+// Rankings of the top endpoints
+const (
+	ByRequests = "requests"
+	ByErrors   = "errors"
+	ByP95      = "p95"
+)
+
+type pathStats struct {
+	requests int64
+	errors   int64
+	seen     int64
+	samples  []time.Duration
+}
+
+func (p *pathStats) add(d time.Duration) {
+	p.seen++
+	if len(p.samples) < maxSamples {
+		p.samples = append(p.samples, d)
+		return
+	}
+	if i := rand.Int63n(p.seen); i < maxSamples {
+		p.samples[i] = d
+	}
+}
+
+type minute struct {
+	start time.Time
+	paths map[string]*pathStats
+}
+
+// Endpoint is the traffic of one path over the selected window
+type Endpoint struct {
+	Path      string  `json:"path"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P95Ms     float64 `json:"p95_ms"`
+}
+
+// Tracker keeps per-minute request, error and latency aggregates per path
+type Tracker struct {
+	config config.StatsConfig
+
+	mu      sync.Mutex
+	minutes []minute
+}
+
+// NewTracker creates a tracker retaining the configured window
+func NewTracker(cfg *config.StatsConfig) *Tracker {
+	c := *cfg
+	if c.Retention < time.Minute {
+		c.Retention = time.Hour
+	}
+	if c.MaxPaths <= 0 {
+		c.MaxPaths = 1000
+	}
+	return &Tracker{config: c, minutes: make([]minute, int(c.Retention/time.Minute))}
+}
+
+// Observe records one exchange of path
+func (t *Tracker) Observe(path string, failed bool, duration time.Duration) {
+	start := time.Now().Truncate(time.Minute)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := &t.minutes[int(start.Unix()/60)%len(t.minutes)]
+	if !m.start.Equal(start) {
+		*m = minute{start: start, paths: make(map[string]*pathStats)}
+	}
+	p, ok := m.paths[path]
+	if !ok {
+		if len(m.paths) >= t.config.MaxPaths {
+			path = otherPath
+		}
+		if p = m.paths[path]; p == nil {
+			p = &pathStats{}
+			m.paths[path] = p
+		}
+	}
+	p.requests++
+	if failed {
+		p.errors++
+	}
+	p.add(duration)
+}
+
+// Top returns the endpoints of the last window ranked by the given order
+func (t *Tracker) Top(window time.Duration, by string, limit int) []Endpoint {
+	from := time.Now().Truncate(time.Minute).Add(-window)
+
+	merged := make(map[string]*pathStats)
+	t.mu.Lock()
+	for _, m := range t.minutes {
+		if !m.start.After(from) {
+			continue
+		}
+		for path, p := range m.paths {
+			total, ok := merged[path]
+			if !ok {
+				total = &pathStats{}
+				merged[path] = total
+			}
+			total.requests += p.requests
+			total.errors += p.errors
+			total.samples = append(total.samples, p.samples...)
+		}
+	}
+	t.mu.Unlock()
+
+	endpoints := make([]Endpoint, 0, len(merged))
+	for path, p := range merged {
+		endpoints = append(endpoints, Endpoint{
+			Path:      path,
+			Requests:  p.requests,
+			Errors:    p.errors,
+			ErrorRate: float64(p.errors) / float64(p.requests),
+			P95Ms:     float64(percentile(p.samples, 0.95)) / float64(time.Millisecond),
+		})
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		switch by {
+		case ByErrors:
+			if a.Errors != b.Errors {
+				return a.Errors > b.Errors
+			}
+		case ByP95:
+			if a.P95Ms != b.P95Ms {
+				return a.P95Ms > b.P95Ms
+			}
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Path < b.Path
+	})
+	if limit > 0 && len(endpoints) > limit {
+		endpoints = endpoints[:limit]
+	}
+	return endpoints
+}
+
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(float64(len(samples))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i]
+}
+
+// Middleware observes every proxied exchange
+func (t *Tracker) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return t.Stage(c, c.Next)
+	}
+}
+
+// Stage is the pipeline form of Middleware
+func (t *Tracker) Stage(c *fiber.Ctx, next func() error) error {
+	start := time.Now()
+	path := c.Path()
+	err := next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+	}
+	t.Observe(path, status >= 500, time.Since(start))
+	return err
+}
+
+// RegisterAdminRoutes mounts the top endpoints statistics
+func (t *Tracker) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/stats/top", t.handleTop)
+}
+
+func (t *Tracker) handleTop(c *fiber.Ctx) error {
+	window := 15 * time.Minute
+	if v := c.Query("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid window, expected a duration of at least 1m")
+		}
+		window = d
+	}
+	if window > t.config.Retention {
+		window = t.config.Retention
+	}
+	limit := 10
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid limit")
+		}
+		limit = n
+	}
+
+	resp := fiber.Map{"window": window.String()}
+	switch by := c.Query("by"); by {
+	case "":
+		resp[ByRequests] = t.Top(window, ByRequests, limit)
+		resp[ByErrors] = t.Top(window, ByErrors, limit)
+		resp[ByP95] = t.Top(window, ByP95, limit)
+	case ByRequests, ByErrors, ByP95:
+		resp[by] = t.Top(window, by, limit)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "by must be requests, errors or p95")
+	}
+	return c.JSON(resp)
+}
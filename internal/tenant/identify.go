@@ -0,0 +1,235 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tuncerburak97/muhtar/internal/access"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Identification strategies
+const (
+	StrategyHeader     = "header"
+	StrategySubdomain  = "subdomain"
+	StrategyHost       = "host"
+	StrategyPathPrefix = "path_prefix"
+	StrategyJWTClaim   = "jwt_claim"
+	StrategyAPIKey     = "api_key"
+)
+
+// DefaultAPIKeyHeader carries the API key when no header is configured
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// Identifier extracts a tenant ID candidate from a request. An empty result
+// means the strategy does not apply.
+type Identifier interface {
+	Identify(c *fiber.Ctx) string
+}
+
+// rewriter is implemented by identifiers that adjust the request once their
+// candidate was accepted
+type rewriter interface {
+	rewrite(c *fiber.Ctx, id string)
+}
+
+func newIdentifier(cfg config.TenantIdentifier, apiKeys, hosts func(string) string) (Identifier, error) {
+	switch cfg.Type {
+	case StrategyHeader:
+		header := cfg.Header
+		if header == "" {
+			header = DefaultHeader
+		}
+		return headerIdentifier(header), nil
+	case StrategySubdomain:
+		return &subdomainIdentifier{domain: strings.ToLower(cfg.Domain)}, nil
+	case StrategyHost:
+		return hostIdentifier(hosts), nil
+	case StrategyPathPrefix:
+		return &pathPrefixIdentifier{strip: cfg.Strip}, nil
+	case StrategyJWTClaim:
+		if cfg.Claim == "" {
+			return nil, fmt.Errorf("jwt_claim strategy requires a claim")
+		}
+		return &jwtClaimIdentifier{claim: cfg.Claim, secret: []byte(cfg.Secret)}, nil
+	case StrategyAPIKey:
+		header := cfg.Header
+		if header == "" {
+			header = DefaultAPIKeyHeader
+		}
+		return &apiKeyIdentifier{header: header, lookup: apiKeys}, nil
+	}
+	return nil, fmt.Errorf("unknown tenant identification strategy: %s", cfg.Type)
+}
+
+type headerIdentifier string
+
+func (h headerIdentifier) Identify(c *fiber.Ctx) string {
+	return c.Get(string(h))
+}
+
+// subdomainIdentifier reads the tenant from the leftmost host label, e.g.
+// acme.api.example.com with domain api.example.com
+type subdomainIdentifier struct {
+	domain string
+}
+
+func (s *subdomainIdentifier) Identify(c *fiber.Ctx) string {
+	host := c.Hostname()
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.ToLower(host)
+	if s.domain != "" {
+		if !strings.HasSuffix(host, "."+s.domain) {
+			return ""
+		}
+		sub := strings.TrimSuffix(host, "."+s.domain)
+		if strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return ""
+	}
+	return labels[0]
+}
+
+// hostIdentifier maps the full host name to the tenant serving it, e.g.
+// api.example.com and admin.example.com routed to different upstreams
+type hostIdentifier func(host string) string
+
+func (h hostIdentifier) Identify(c *fiber.Ctx) string {
+	host := c.Hostname()
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return h(strings.ToLower(host))
+}
+
+// pathPrefixIdentifier reads the tenant from the first path segment, e.g.
+// /acme/orders
+type pathPrefixIdentifier struct {
+	strip bool
+}
+
+func (p *pathPrefixIdentifier) Identify(c *fiber.Ctx) string {
+	segment := strings.TrimPrefix(c.Path(), "/")
+	if i := strings.IndexByte(segment, '/'); i >= 0 {
+		segment = segment[:i]
+	}
+	return segment
+}
+
+func (p *pathPrefixIdentifier) rewrite(c *fiber.Ctx, id string) {
+	if !p.strip {
+		return
+	}
+	uri := strings.TrimPrefix(c.OriginalURL(), "/"+id)
+	if uri == "" || uri[0] != '/' {
+		uri = "/" + uri
+	}
+	path := strings.TrimPrefix(c.Path(), "/"+id)
+	if path == "" {
+		path = "/"
+	}
+	c.Request().SetRequestURI(uri)
+	c.Path(path)
+}
+
+// jwtClaimIdentifier reads the tenant from a claim of the bearer token. The
+// signature is verified only when a HS256 secret is configured, so without
+// one the token must be validated before it reaches muhtar. Every bearer
+// token gets an access decision.
+type jwtClaimIdentifier struct {
+	claim  string
+	secret []byte
+}
+
+func (j *jwtClaimIdentifier) Identify(c *fiber.Ctx) string {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		access.Denied(c, access.ModuleJWT, "format", "token is not a JWT")
+		return ""
+	}
+
+	if len(j.secret) > 0 {
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil || json.Unmarshal(raw, &header) != nil {
+			access.Denied(c, access.ModuleJWT, "format", "malformed header")
+			return ""
+		}
+		if header.Alg != "HS256" {
+			access.Denied(c, access.ModuleJWT, "signature", "unsupported algorithm "+header.Alg)
+			return ""
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			access.Denied(c, access.ModuleJWT, "signature", "malformed signature")
+			return ""
+		}
+		mac := hmac.New(sha256.New, j.secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			access.Denied(c, access.ModuleJWT, "signature", "signature mismatch")
+			return ""
+		}
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		access.Denied(c, access.ModuleJWT, "format", "malformed claims")
+		return ""
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		access.Denied(c, access.ModuleJWT, "format", "malformed claims")
+		return ""
+	}
+	id, ok := claims[j.claim].(string)
+	if !ok || id == "" {
+		access.Denied(c, access.ModuleJWT, "claim", "missing claim "+j.claim)
+		return ""
+	}
+	if len(j.secret) > 0 {
+		access.Allowed(c, access.ModuleJWT, "signature", "signature verified")
+	} else {
+		access.Allowed(c, access.ModuleJWT, "claim", "signature not verified")
+	}
+	return id
+}
+
+// apiKeyIdentifier maps an API key to the tenant owning it
+type apiKeyIdentifier struct {
+	header string
+	lookup func(key string) string
+}
+
+func (a *apiKeyIdentifier) Identify(c *fiber.Ctx) string {
+	key := c.Get(a.header)
+	if key == "" {
+		return ""
+	}
+	id := a.lookup(key)
+	if id == "" {
+		access.Denied(c, access.ModuleAPIKey, "lookup", "unknown api key")
+		return ""
+	}
+	access.Allowed(c, access.ModuleAPIKey, "lookup", "")
+	return id
+}
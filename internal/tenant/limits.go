@@ -0,0 +1,225 @@
+package tenant
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
+)
+
+// LimitManager applies tenant limit overrides stored in the repository on top
+// of the configured limits. Overrides are cached on the tenants and reloaded
+// periodically, so changes made on one instance reach the others.
+type LimitManager struct {
+	registry *Registry
+	repo     repository.TenantLimitRepository
+	interval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewLimitManager loads the stored overrides and starts the refresh job
+func NewLimitManager(registry *Registry, repo repository.TenantLimitRepository, interval time.Duration) *LimitManager {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	m := &LimitManager{
+		registry: registry,
+		repo:     repo,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	if err := m.reload(); err != nil {
+		log.Warn().Err(err).Msg("Failed to load tenant limit overrides")
+	}
+	m.wg.Add(1)
+	go m.run()
+	return m
+}
+
+func (m *LimitManager) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			if err := m.reload(); err != nil {
+				log.Error().Err(err).Msg("Failed to reload tenant limit overrides")
+				sentry.CaptureError(err, map[string]string{"component": "reload", "reload": "tenant_limits"})
+			}
+		}
+	}
+}
+
+// reload replaces the cached overrides with the stored ones. Tenants without
+// a stored override fall back to their configuration.
+func (m *LimitManager) reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stored, err := m.repo.FindTenantLimits(ctx)
+	if err != nil {
+		return err
+	}
+
+	overrides := make(map[string]*model.TenantLimits, len(stored))
+	for _, l := range stored {
+		overrides[l.Tenant] = l
+	}
+	for _, t := range m.registry.List() {
+		if l, ok := overrides[t.ID]; ok {
+			t.limits.Store(toRateLimit(l))
+		} else {
+			t.limits.Store(nil)
+		}
+	}
+	return nil
+}
+
+func toRateLimit(l *model.TenantLimits) *config.TenantRateLimit {
+	return &config.TenantRateLimit{
+		Requests:   l.Requests,
+		Window:     l.Window,
+		Burst:      l.Burst,
+		DailyQuota: l.DailyQuota,
+	}
+}
+
+// Close stops the refresh job
+func (m *LimitManager) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
+
+// RegisterAdminRoutes mounts the tenant limit endpoints
+func (m *LimitManager) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/tenants/limits", m.handleList)
+	r.Get("/tenants/:id/limits", m.handleGet)
+	r.Put("/tenants/:id/limits", m.handlePut)
+	r.Delete("/tenants/:id/limits", m.handleDelete)
+}
+
+type limitsView struct {
+	Tenant     string `json:"tenant"`
+	Plan       string `json:"plan,omitempty"`
+	Requests   int    `json:"requests"`
+	Window     string `json:"window"`
+	Burst      int    `json:"burst"`
+	DailyQuota int    `json:"daily_quota"`
+	Overridden bool   `json:"overridden"`
+}
+
+func viewOf(t *Tenant) limitsView {
+	l := t.RateLimit()
+	return limitsView{
+		Tenant:     t.ID,
+		Plan:       t.Config.Plan,
+		Requests:   l.Requests,
+		Window:     l.Window.String(),
+		Burst:      l.Burst,
+		DailyQuota: l.DailyQuota,
+		Overridden: t.limits.Load() != nil,
+	}
+}
+
+func (m *LimitManager) handleList(c *fiber.Ctx) error {
+	tenants := m.registry.List()
+	views := make([]limitsView, 0, len(tenants))
+	for _, t := range tenants {
+		views = append(views, viewOf(t))
+	}
+	return c.JSON(fiber.Map{"tenants": views})
+}
+
+func (m *LimitManager) handleGet(c *fiber.Ctx) error {
+	t := m.registry.Get(c.Params("id"))
+	if t == nil {
+		return fiber.NewError(fiber.StatusNotFound, "unknown tenant")
+	}
+	return c.JSON(viewOf(t))
+}
+
+// handlePut overrides the limits of a tenant. Omitted fields keep their
+// current effective value.
+func (m *LimitManager) handlePut(c *fiber.Ctx) error {
+	t := m.registry.Get(c.Params("id"))
+	if t == nil {
+		return fiber.NewError(fiber.StatusNotFound, "unknown tenant")
+	}
+
+	current := t.RateLimit()
+	var req struct {
+		Requests   *int    `json:"requests"`
+		Window     *string `json:"window"`
+		Burst      *int    `json:"burst"`
+		DailyQuota *int    `json:"daily_quota"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	limits := &model.TenantLimits{
+		Tenant:     t.ID,
+		Requests:   current.Requests,
+		Window:     current.Window,
+		Burst:      current.Burst,
+		DailyQuota: current.DailyQuota,
+		UpdatedAt:  time.Now().UTC(),
+	}
+	if req.Requests != nil {
+		limits.Requests = *req.Requests
+	}
+	if req.Window != nil {
+		window, err := time.ParseDuration(*req.Window)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid window duration")
+		}
+		limits.Window = window
+	}
+	if req.Burst != nil {
+		limits.Burst = *req.Burst
+	}
+	if req.DailyQuota != nil {
+		limits.DailyQuota = *req.DailyQuota
+	}
+	if limits.Requests < 0 || limits.Burst < 0 || limits.DailyQuota < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "limits must not be negative")
+	}
+	if limits.Requests > 0 && limits.Window <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "window is required when requests is set")
+	}
+
+	if err := m.repo.SaveTenantLimits(c.Context(), limits); err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	t.limits.Store(toRateLimit(limits))
+
+	log.Info().Str("tenant", t.ID).Msg("Tenant limits overridden")
+	return c.JSON(viewOf(t))
+}
+
+// handleDelete drops the override, reverting the tenant to its configuration
+func (m *LimitManager) handleDelete(c *fiber.Ctx) error {
+	t := m.registry.Get(c.Params("id"))
+	if t == nil {
+		return fiber.NewError(fiber.StatusNotFound, "unknown tenant")
+	}
+	if err := m.repo.DeleteTenantLimits(c.Context(), t.ID); err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	t.limits.Store(nil)
+
+	log.Info().Str("tenant", t.ID).Msg("Tenant limits reset to configuration")
+	return c.JSON(viewOf(t))
+}
@@ -0,0 +1,260 @@
+package tenant
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+	"github.com/tuncerburak97/muhtar/internal/sentry"
+)
+
+const apiKeyPrefix = "mk_"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// spec is the stored form of a provisioned tenant. Only hashes of its API
+// keys are kept.
+type spec struct {
+	Target       string            `json:"target"`
+	Plan         string            `json:"plan,omitempty"`
+	Requests     int               `json:"requests,omitempty"`
+	Window       time.Duration     `json:"window,omitempty"`
+	Burst        int               `json:"burst,omitempty"`
+	DailyQuota   int               `json:"daily_quota,omitempty"`
+	APIKeyHashes []string          `json:"api_key_hashes"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+func (s *spec) tenantConfig() config.TenantConfig {
+	return config.TenantConfig{
+		Target: s.Target,
+		Plan:   s.Plan,
+		RateLimit: config.TenantRateLimit{
+			Requests:   s.Requests,
+			Window:     s.Window,
+			Burst:      s.Burst,
+			DailyQuota: s.DailyQuota,
+		},
+		Metadata: s.Metadata,
+	}
+}
+
+// Provisioner onboards tenants at runtime. Provisioned tenants are stored in
+// the repository and picked up by the other instances on their next reload.
+type Provisioner struct {
+	registry *Registry
+	repo     repository.TenantRepository
+	interval time.Duration
+
+	// mu serializes onboarding so two calls cannot claim the same ID
+	mu sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewProvisioner loads the provisioned tenants and starts the reload job
+func NewProvisioner(registry *Registry, repo repository.TenantRepository, interval time.Duration) *Provisioner {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	p := &Provisioner{
+		registry: registry,
+		repo:     repo,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	if err := p.reload(); err != nil {
+		log.Warn().Err(err).Msg("Failed to load provisioned tenants")
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+func (p *Provisioner) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			if err := p.reload(); err != nil {
+				log.Error().Err(err).Msg("Failed to reload provisioned tenants")
+				sentry.CaptureError(err, map[string]string{"component": "reload", "reload": "tenants"})
+			}
+		}
+	}
+}
+
+// reload adds stored tenants the registry does not know yet
+func (p *Provisioner) reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	records, err := p.repo.FindTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		if p.registry.Get(rec.ID) != nil {
+			continue
+		}
+		var s spec
+		if err := json.Unmarshal(rec.Spec, &s); err != nil {
+			log.Error().Err(err).Str("tenant", rec.ID).Msg("Invalid provisioned tenant")
+			continue
+		}
+		if _, err := p.registry.add(rec.ID, s.tenantConfig(), s.APIKeyHashes); err != nil {
+			log.Error().Err(err).Str("tenant", rec.ID).Msg("Failed to add provisioned tenant")
+		}
+	}
+	return nil
+}
+
+// Close stops the reload job
+func (p *Provisioner) Close() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+// RegisterAdminRoutes mounts the onboarding endpoint
+func (p *Provisioner) RegisterAdminRoutes(r fiber.Router) {
+	r.Post("/tenants", p.handleOnboard)
+}
+
+type onboardRequest struct {
+	ID        string `json:"id"`
+	Target    string `json:"target"`
+	Plan      string `json:"plan"`
+	RateLimit struct {
+		Requests   int    `json:"requests"`
+		Window     string `json:"window"`
+		Burst      int    `json:"burst"`
+		DailyQuota int    `json:"daily_quota"`
+	} `json:"rate_limit"`
+	APIKeys  int               `json:"api_keys"` // Number of keys to issue, defaults to 1
+	Metadata map[string]string `json:"metadata"`
+}
+
+// handleOnboard provisions a tenant and returns its configuration, including
+// the generated API keys, which are not retrievable afterwards
+func (p *Provisioner) handleOnboard(c *fiber.Ctx) error {
+	var req onboardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	if !tenantIDPattern.MatchString(req.ID) {
+		return fiber.NewError(fiber.StatusBadRequest, "id must be lowercase letters, digits and dashes")
+	}
+	target, err := url.Parse(req.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "target must be an http or https URL")
+	}
+	if req.Plan != "" {
+		if _, ok := p.registry.config.Plans[req.Plan]; !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "unknown plan "+req.Plan)
+		}
+	}
+	s := spec{
+		Target:     req.Target,
+		Plan:       req.Plan,
+		Requests:   req.RateLimit.Requests,
+		Burst:      req.RateLimit.Burst,
+		DailyQuota: req.RateLimit.DailyQuota,
+		Metadata:   req.Metadata,
+	}
+	if req.RateLimit.Window != "" {
+		if s.Window, err = time.ParseDuration(req.RateLimit.Window); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid window duration")
+		}
+	}
+	if s.Requests < 0 || s.Burst < 0 || s.DailyQuota < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "limits must not be negative")
+	}
+	if s.Requests > 0 && s.Window <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "window is required when requests is set")
+	}
+
+	count := req.APIKeys
+	if count <= 0 {
+		count = 1
+	}
+	if count > 10 {
+		return fiber.NewError(fiber.StatusBadRequest, "at most 10 api keys can be issued")
+	}
+	keys := make([]string, count)
+	for i := range keys {
+		if keys[i], err = generateAPIKey(); err != nil {
+			return err
+		}
+		s.APIKeyHashes = append(s.APIKeyHashes, hashKey(keys[i]))
+	}
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.registry.Get(req.ID) != nil {
+		return fiber.NewError(fiber.StatusConflict, "tenant "+req.ID+" already exists")
+	}
+	record := &model.TenantRecord{ID: req.ID, Spec: raw, CreatedAt: time.Now().UTC()}
+	if err := p.repo.SaveTenant(c.Context(), record); err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	t, err := p.registry.add(req.ID, s.tenantConfig(), s.APIKeyHashes)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	log.Info().Str("tenant", t.ID).Str("plan", t.Config.Plan).Msg("Tenant provisioned")
+
+	limits := t.RateLimit()
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"tenant":   t.ID,
+		"target":   t.Config.Target,
+		"plan":     t.Config.Plan,
+		"api_keys": keys,
+		"rate_limit": fiber.Map{
+			"requests":    limits.Requests,
+			"window":      limits.Window.String(),
+			"burst":       limits.Burst,
+			"daily_quota": limits.DailyQuota,
+		},
+		"max_body_size": t.Config.MaxBodySize,
+		"cache_ttl":     t.Config.CacheTTL.String(),
+		"metadata":      t.Config.Metadata,
+		// Logs are partitioned by the tenant_id column
+		"logs": fiber.Map{
+			"tenant_id": t.ID,
+		},
+		"created_at": record.CreatedAt,
+	})
+}
+
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %v", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
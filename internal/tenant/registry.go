@@ -0,0 +1,284 @@
+package tenant
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/access"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/logger"
+	"github.com/tuncerburak97/muhtar/internal/transform"
+)
+
+const (
+	// DefaultHeader carries the tenant ID when no header is configured
+	DefaultHeader = "X-Tenant-ID"
+
+	localsKey = "muhtar.tenant"
+)
+
+// Tenant is a resolved tenant with its runtime components
+type Tenant struct {
+	ID     string
+	Config config.TenantConfig
+	// Transformer is nil when the tenant uses the global transforms
+	Transformer *transform.Engine
+
+	// limits overrides Config.RateLimit when set through the admin API
+	limits atomic.Pointer[config.TenantRateLimit]
+}
+
+// RateLimit returns the effective rate limit and quota of the tenant
+func (t *Tenant) RateLimit() config.TenantRateLimit {
+	if l := t.limits.Load(); l != nil {
+		return *l
+	}
+	return t.Config.RateLimit
+}
+
+// Target returns the tenant upstream, or fallback when none is configured
+func (t *Tenant) Target(fallback string) string {
+	if t.Config.Target != "" {
+		return t.Config.Target
+	}
+	return fallback
+}
+
+// ShouldLog applies the tenant logging policy to one exchange
+func (t *Tenant) ShouldLog() bool {
+	if t.Config.Log.Disabled {
+		return false
+	}
+	rate := t.Config.Log.SampleRate
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// Registry resolves requests to configured and provisioned tenants
+type Registry struct {
+	config      *config.TenancyConfig
+	identifiers []Identifier
+
+	mu      sync.RWMutex
+	tenants map[string]*Tenant
+	// apiKeys maps SHA-256 hashes of API keys to the owning tenant
+	apiKeys map[string]string
+	// hosts maps lower-cased host names to the tenant serving them
+	hosts map[string]string
+}
+
+// NewRegistry validates the tenant definitions and loads their transforms
+func NewRegistry(cfg *config.TenancyConfig) (*Registry, error) {
+	r := &Registry{
+		config:  cfg,
+		tenants: make(map[string]*Tenant, len(cfg.Tenants)),
+		apiKeys: make(map[string]string),
+		hosts:   make(map[string]string),
+	}
+
+	strategies := cfg.Identify
+	if len(strategies) == 0 {
+		strategies = []config.TenantIdentifier{{Type: StrategyHeader, Header: cfg.Header}}
+	}
+	for _, sc := range strategies {
+		ident, err := newIdentifier(sc, r.tenantForKey, r.tenantForHost)
+		if err != nil {
+			return nil, err
+		}
+		r.identifiers = append(r.identifiers, ident)
+	}
+
+	for id, tc := range cfg.Tenants {
+		hashes := make([]string, 0, len(tc.APIKeys))
+		for _, key := range tc.APIKeys {
+			hashes = append(hashes, hashKey(key))
+		}
+		if _, err := r.add(id, tc, hashes); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Default != "" && r.tenants[cfg.Default] == nil {
+		return nil, fmt.Errorf("default tenant %s is not defined", cfg.Default)
+	}
+	return r, nil
+}
+
+// add builds a tenant from its configuration and makes it resolvable.
+// keyHashes are the SHA-256 hashes of the tenant's API keys.
+func (r *Registry) add(id string, tc config.TenantConfig, keyHashes []string) (*Tenant, error) {
+	if tc.Plan != "" {
+		plan, ok := r.config.Plans[tc.Plan]
+		if !ok {
+			return nil, fmt.Errorf("tenant %s uses undefined plan %s", id, tc.Plan)
+		}
+		tc = applyPlan(tc, plan)
+	}
+	t := &Tenant{ID: id, Config: tc}
+	if tc.Target != "" {
+		if _, err := url.Parse(tc.Target); err != nil {
+			return nil, fmt.Errorf("invalid target for tenant %s: %v", id, err)
+		}
+	}
+	if len(tc.Transform.Services) > 0 {
+		// Tenant scripts always run in their own sandbox
+		tc.Transform.Sandbox.Enabled = true
+		engine, err := transform.NewEngine(tc.Transform,
+			transform.WithLogger(log.With().Str("tenant", id).Logger()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load transforms for tenant %s: %v", id, err)
+		}
+		t.Transformer = engine
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tenants[id]; ok {
+		return nil, fmt.Errorf("tenant %s already exists", id)
+	}
+	for _, h := range keyHashes {
+		if owner, ok := r.apiKeys[h]; ok && owner != id {
+			return nil, fmt.Errorf("api key shared by tenants %s and %s", owner, id)
+		}
+	}
+	for _, host := range tc.Hosts {
+		if owner, ok := r.hosts[strings.ToLower(host)]; ok && owner != id {
+			return nil, fmt.Errorf("host %s served by tenants %s and %s", host, owner, id)
+		}
+	}
+	for _, h := range keyHashes {
+		r.apiKeys[h] = id
+	}
+	for _, host := range tc.Hosts {
+		r.hosts[strings.ToLower(host)] = id
+	}
+	r.tenants[id] = t
+	return t, nil
+}
+
+// tenantForKey returns the tenant owning the API key
+func (r *Registry) tenantForKey(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.apiKeys[hashKey(key)]
+}
+
+// tenantForHost returns the tenant serving the host name
+func (r *Registry) tenantForHost(host string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hosts[host]
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// applyPlan fills the limits the tenant leaves empty from its plan
+func applyPlan(tc config.TenantConfig, plan config.PlanConfig) config.TenantConfig {
+	rl := &tc.RateLimit
+	if rl.Requests == 0 {
+		rl.Requests = plan.RateLimit.Requests
+		rl.Window = plan.RateLimit.Window
+		rl.Burst = plan.RateLimit.Burst
+	}
+	if rl.DailyQuota == 0 {
+		rl.DailyQuota = plan.RateLimit.DailyQuota
+	}
+	if tc.MaxBodySize == 0 {
+		tc.MaxBodySize = plan.MaxBodySize
+	}
+	if tc.CacheTTL == 0 {
+		tc.CacheTTL = plan.CacheTTL
+	}
+	return tc
+}
+
+// Get returns the tenant with the given ID
+func (r *Registry) Get(id string) *Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tenants[id]
+}
+
+// List returns all tenants ordered by ID
+func (r *Registry) List() []*Tenant {
+	r.mu.RLock()
+	list := make([]*Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		list = append(list, t)
+	}
+	r.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Resolve identifies the tenant of the request. Strategies are tried in
+// order and the first candidate naming a known tenant wins.
+func (r *Registry) Resolve(c *fiber.Ctx) (*Tenant, error) {
+	candidate := false
+	for _, ident := range r.identifiers {
+		id := ident.Identify(c)
+		if id == "" {
+			continue
+		}
+		candidate = true
+		if t := r.Get(id); t != nil {
+			if rw, ok := ident.(rewriter); ok {
+				rw.rewrite(c, id)
+			}
+			return t, nil
+		}
+	}
+
+	if r.config.Default != "" {
+		return r.Get(r.config.Default), nil
+	}
+	if candidate {
+		access.Denied(c, access.ModuleTenant, "registry", "unknown tenant")
+		return nil, fiber.NewError(fiber.StatusForbidden, "unknown tenant")
+	}
+	access.Denied(c, access.ModuleTenant, "identification", "tenant not identified")
+	return nil, fiber.NewError(fiber.StatusBadRequest, "tenant not identified")
+}
+
+// Middleware resolves the tenant and stores it in the request context. It
+// must run before the rate limiter and the proxy handler.
+func (r *Registry) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return r.Stage(c, c.Next)
+	}
+}
+
+// Stage is the pipeline form of Middleware
+func (r *Registry) Stage(c *fiber.Ctx, next func() error) error {
+	t, err := r.Resolve(c)
+	if err != nil {
+		return err
+	}
+	if limit := t.Config.MaxBodySize; limit > 0 &&
+		(c.Request().Header.ContentLength() > limit || len(c.Body()) > limit) {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "request body exceeds the plan limit")
+	}
+	c.Locals(localsKey, t)
+	logger.With(c, "tenant", t.ID)
+	return next()
+}
+
+// FromContext returns the tenant resolved for the request, or nil when
+// tenancy is disabled
+func FromContext(c *fiber.Ctx) *Tenant {
+	t, _ := c.Locals(localsKey).(*Tenant)
+	return t
+}
@@ -0,0 +1,39 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// BodyDecoder turns a binary body into a value scripts can read, e.g. a
+// protobuf message, reporting false when it does not apply
+type BodyDecoder func(contentType string, body []byte) (interface{}, bool)
+
+type decoderKey struct{ request bool }
+
+// WithRequestDecoder returns a context whose request bodies scripts see
+// through d
+func WithRequestDecoder(ctx context.Context, d BodyDecoder) context.Context {
+	return context.WithValue(ctx, decoderKey{request: true}, d)
+}
+
+// WithResponseDecoder returns a context whose response bodies scripts see
+// through d. Responses carry the context of their request.
+func WithResponseDecoder(ctx context.Context, d BodyDecoder) context.Context {
+	return context.WithValue(ctx, decoderKey{request: false}, d)
+}
+
+// scriptBody converts a body for scripts: through the decoder of ctx when one
+// applies, as JSON when it parses, as a string otherwise
+func scriptBody(ctx context.Context, request bool, contentType string, body []byte) interface{} {
+	if d, ok := ctx.Value(decoderKey{request: request}).(BodyDecoder); ok {
+		if v, ok := d(contentType, body); ok {
+			return v
+		}
+	}
+	var jsonBody interface{}
+	if err := json.Unmarshal(body, &jsonBody); err == nil {
+		return jsonBody
+	}
+	return string(body)
+}
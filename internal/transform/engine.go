@@ -1,16 +1,19 @@
 package transform
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
 	"sync"
 
 	"github.com/dop251/goja"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
 )
 
 // Engine handles request/response transformations
@@ -19,14 +22,59 @@ type Engine struct {
 	vm         *goja.Runtime
 	scripts    map[string]*goja.Program
 	scriptLock sync.RWMutex
+	logger     zerolog.Logger
+	// sandbox is nil when scripts run on a fresh VM without limits
+	sandbox *sandbox
+	// requestHooks and responseHooks replace the stream scripts of services
+	requestHooks  map[string]StreamHook
+	responseHooks map[string]StreamHook
+}
+
+// Option configures optional Engine behavior
+type Option func(*Engine)
+
+// WithLogger sets the logger exposed to scripts as the log global
+func WithLogger(logger zerolog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithRequestStreamHook transforms the streamed request bodies of a service
+// in Go instead of with its request_stream.js script
+func WithRequestStreamHook(service string, hook StreamHook) Option {
+	return func(e *Engine) {
+		if e.requestHooks == nil {
+			e.requestHooks = make(map[string]StreamHook)
+		}
+		e.requestHooks[service] = hook
+	}
+}
+
+// WithResponseStreamHook transforms the streamed response bodies of a service
+// in Go instead of with its response_stream.js script
+func WithResponseStreamHook(service string, hook StreamHook) Option {
+	return func(e *Engine) {
+		if e.responseHooks == nil {
+			e.responseHooks = make(map[string]StreamHook)
+		}
+		e.responseHooks[service] = hook
+	}
 }
 
 // NewEngine creates a new transformation engine
-func NewEngine(cfg config.TransformConfig) (*Engine, error) {
+func NewEngine(cfg config.TransformConfig, opts ...Option) (*Engine, error) {
 	engine := &Engine{
 		config:  cfg,
 		vm:      goja.New(),
 		scripts: make(map[string]*goja.Program),
+		logger:  log.Logger,
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	if cfg.Sandbox.Enabled {
+		engine.sandbox = newSandbox(cfg.Sandbox)
 	}
 
 	// Load all scripts
@@ -45,24 +93,67 @@ func (e *Engine) loadScripts() error {
 		responseScriptPath := filepath.Join(e.config.ScriptsDir, service.ServiceName, "response.js")
 
 		// Load request script
-		requestScript, err := e.compileScript(requestScriptPath)
+		requestScript, err := compileScript(requestScriptPath)
 		if err != nil {
 			return fmt.Errorf("failed to compile request script for service %s: %v", service.ServiceName, err)
 		}
 		e.scripts[requestScriptPath] = requestScript
 
 		// Load response script
-		responseScript, err := e.compileScript(responseScriptPath)
+		responseScript, err := compileScript(responseScriptPath)
 		if err != nil {
 			return fmt.Errorf("failed to compile response script for service %s: %v", service.ServiceName, err)
 		}
 		e.scripts[responseScriptPath] = responseScript
+
+		// Load the stream scripts unless Go hooks replace them
+		if err := e.loadStreamScript(service.ServiceName, service.StreamRequest, "request", e.requestHooks); err != nil {
+			return err
+		}
+		if err := e.loadStreamScript(service.ServiceName, service.StreamResponse, "response", e.responseHooks); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func (e *Engine) loadStreamScript(service string, stream config.StreamConfig, direction string, hooks map[string]StreamHook) error {
+	if !stream.Enabled {
+		return nil
+	}
+	if stream.Mode != "" && stream.Mode != StreamChunk && stream.Mode != StreamNDJSON {
+		return fmt.Errorf("unknown %s stream mode %s for service %s", direction, stream.Mode, service)
+	}
+	if hooks[service] != nil {
+		return nil
+	}
+	path := filepath.Join(e.config.ScriptsDir, service, direction+"_stream.js")
+	script, err := compileScript(path)
+	if err != nil {
+		return fmt.Errorf("failed to compile %s stream script for service %s: %v", direction, service, err)
+	}
+	e.scripts[path] = script
+	return nil
+}
+
+// streams reports whether a body of the given length is transformed as a
+// stream, -1 meaning unknown
+func streams(stream config.StreamConfig, body io.ReadCloser, length int64) bool {
+	return stream.Enabled && body != nil && body != http.NoBody && (length < 0 || length >= stream.Threshold)
+}
+
+// streamBody wraps body with the Go hook or stream script of the service
+func (e *Engine) streamBody(ctx context.Context, body io.ReadCloser, service, direction string, stream config.StreamConfig, hooks map[string]StreamHook) io.ReadCloser {
+	hook := hooks[service]
+	if hook == nil {
+		path := filepath.Join(e.config.ScriptsDir, service, direction+"_stream.js")
+		hook = e.scriptHook(ctx, e.scripts[path], stream.Mode)
+	}
+	return NewStreamReader(body, hook, stream.Mode, stream.ChunkSize)
+}
+
 // compileScript compiles a JavaScript file into a program
-func (e *Engine) compileScript(path string) (*goja.Program, error) {
+func compileScript(path string) (*goja.Program, error) {
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -77,6 +168,10 @@ func (e *Engine) TransformRequest(req *http.Request) error {
 	if service == nil {
 		return nil
 	}
+	// Transforms gated by a flag that is off leave the request untouched
+	if service.Flag != "" && !featureflag.FromContext(req.Context()).Boolean(service.Flag, false) {
+		return nil
+	}
 
 	scriptPath := e.getScriptPath(service, true)
 	script := e.scripts[scriptPath]
@@ -90,40 +185,44 @@ func (e *Engine) TransformRequest(req *http.Request) error {
 		"path":    req.URL.Path,
 		"headers": headerToMap(req.Header),
 	}
+	if cert := scriptClientCert(req.Context()); cert != nil {
+		reqObj["clientCert"] = cert
+	}
+
+	// Large bodies are streamed, the request script only sees the headers
+	streamed := streams(service.StreamRequest, req.Body, req.ContentLength)
 
 	// Read body if present
-	if req.Body != nil {
+	if req.Body != nil && !streamed {
 		body, err := ioutil.ReadAll(req.Body)
 		if err != nil {
 			return err
 		}
-		var jsonBody interface{}
-		if err := json.Unmarshal(body, &jsonBody); err == nil {
-			reqObj["body"] = jsonBody
-		} else {
-			reqObj["body"] = string(body)
-		}
+		reqObj["body"] = scriptBody(req.Context(), true, req.Header.Get("Content-Type"), body)
 	}
 
 	// Execute transformation
-	vm := goja.New()
-	vm.Set("request", reqObj)
-	vm.Set("log", log.Logger)
-
-	_, err := vm.RunProgram(script)
+	result, err := e.execute(req.Context(), script, "request", reqObj)
 	if err != nil {
 		return err
 	}
 
 	// Apply transformations back to request
-	result := vm.Get("request").ToObject(vm)
-	if headers := result.Get("headers"); headers != nil {
-		headerMap := headers.Export().(map[string]interface{})
+	if headerMap, ok := result["headers"].(map[string]interface{}); ok {
 		for k, v := range headerMap {
 			req.Header.Set(k, fmt.Sprint(v))
 		}
 	}
 
+	if streamed {
+		// The transformed length is unknown, the body is sent chunked and
+		// cannot be replayed
+		req.Body = e.streamBody(req.Context(), req.Body, service.ServiceName, "request", service.StreamRequest, e.requestHooks)
+		req.ContentLength = -1
+		req.Header.Del("Content-Length")
+		req.GetBody = nil
+	}
+
 	return nil
 }
 
@@ -133,6 +232,9 @@ func (e *Engine) TransformResponse(resp *http.Response) error {
 	if service == nil {
 		return nil
 	}
+	if service.Flag != "" && !featureflag.FromContext(resp.Request.Context()).Boolean(service.Flag, false) {
+		return nil
+	}
 
 	scriptPath := e.getScriptPath(service, false)
 	script := e.scripts[scriptPath]
@@ -145,43 +247,115 @@ func (e *Engine) TransformResponse(resp *http.Response) error {
 		"statusCode": resp.StatusCode,
 		"headers":    headerToMap(resp.Header),
 	}
+	if cert := scriptClientCert(resp.Request.Context()); cert != nil {
+		respObj["clientCert"] = cert
+	}
+
+	// Large bodies are streamed, the response script only sees the headers
+	streamed := streams(service.StreamResponse, resp.Body, resp.ContentLength)
 
 	// Read body if present
-	if resp.Body != nil {
+	if resp.Body != nil && !streamed {
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return err
 		}
-		var jsonBody interface{}
-		if err := json.Unmarshal(body, &jsonBody); err == nil {
-			respObj["body"] = jsonBody
-		} else {
-			respObj["body"] = string(body)
-		}
+		respObj["body"] = scriptBody(resp.Request.Context(), false, resp.Header.Get("Content-Type"), body)
 	}
 
 	// Execute transformation
-	vm := goja.New()
-	vm.Set("response", respObj)
-	vm.Set("log", log.Logger)
-
-	_, err := vm.RunProgram(script)
+	result, err := e.execute(resp.Request.Context(), script, "response", respObj)
 	if err != nil {
 		return err
 	}
 
 	// Apply transformations back to response
-	result := vm.Get("response").ToObject(vm)
-	if headers := result.Get("headers"); headers != nil {
-		headerMap := headers.Export().(map[string]interface{})
+	if headerMap, ok := result["headers"].(map[string]interface{}); ok {
 		for k, v := range headerMap {
 			resp.Header.Set(k, fmt.Sprint(v))
 		}
 	}
 
+	if streamed {
+		resp.Body = e.streamBody(resp.Request.Context(), resp.Body, service.ServiceName, "response", service.StreamResponse, e.responseHooks)
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	}
+
 	return nil
 }
 
+// execute runs a compiled script with obj bound to the given global name and
+// returns the exported value of that global after the script completed
+func (e *Engine) execute(ctx context.Context, script *goja.Program, name string, obj map[string]interface{}) (map[string]interface{}, error) {
+	logger := loggerFor(ctx, e.logger)
+	flags := featureflag.FromContext(ctx)
+	if e.sandbox == nil {
+		return run(goja.New(), logger, flags, script, name, obj)
+	}
+
+	var result map[string]interface{}
+	err := e.sandbox.run(func(vm *goja.Runtime) error {
+		var err error
+		result, err = run(vm, logger, flags, script, name, obj)
+		return err
+	})
+	return result, err
+}
+
+// setGlobals exposes the logger as log and the feature flags of the request
+// as flag(name, default), the default giving the type of the flag
+func setGlobals(vm *goja.Runtime, logger zerolog.Logger, flags *featureflag.Evaluator) {
+	vm.Set("log", logger)
+	vm.Set("flag", func(name string, def goja.Value) interface{} {
+		if def == nil {
+			return flags.Value(name, nil)
+		}
+		return flags.Value(name, def.Export())
+	})
+}
+
+// loggerFor returns the request logger carried by ctx, falling back to the
+// given logger
+func loggerFor(ctx context.Context, fallback zerolog.Logger) zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l != zerolog.DefaultContextLogger && l.GetLevel() != zerolog.Disabled {
+		return *l
+	}
+	return fallback
+}
+
+func run(vm *goja.Runtime, logger zerolog.Logger, flags *featureflag.Evaluator, script *goja.Program, name string, obj map[string]interface{}) (map[string]interface{}, error) {
+	vm.Set(name, obj)
+	setGlobals(vm, logger, flags)
+
+	if _, err := vm.RunProgram(script); err != nil {
+		return nil, err
+	}
+
+	result, ok := vm.Get(name).Export().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("script replaced %s with a non-object value", name)
+	}
+	return result, nil
+}
+
+// RunScript executes the request or response script of a service against the
+// given object, exactly as the proxy pipeline would
+func (e *Engine) RunScript(serviceName string, isRequest bool, obj map[string]interface{}) (map[string]interface{}, error) {
+	service := &config.ServiceTransform{ServiceName: serviceName}
+	scriptPath := e.getScriptPath(service, isRequest)
+	script := e.scripts[scriptPath]
+	if script == nil {
+		return nil, fmt.Errorf("script not found: %s", scriptPath)
+	}
+
+	name := "response"
+	if isRequest {
+		name = "request"
+	}
+	return e.execute(context.Background(), script, name, obj)
+}
+
 // findMatchingService finds a service configuration matching the given path
 func (e *Engine) findMatchingService(path string) *config.ServiceTransform {
 	for _, service := range e.config.Services {
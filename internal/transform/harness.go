@@ -0,0 +1,240 @@
+package transform
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+// Wildcard matches any value in an expected fixture, for volatile fields such
+// as generated IDs and timestamps
+const Wildcard = "<any>"
+
+// Fixture is a single input/expected output pair for a transform script
+type Fixture struct {
+	Service   string
+	Direction string // request or response
+	Name      string
+	Input     map[string]interface{}
+	Expected  map[string]interface{}
+}
+
+// FixtureResult holds the outcome of running a fixture
+type FixtureResult struct {
+	Fixture *Fixture
+	Diffs   []string
+	Err     error
+}
+
+// Passed reports whether the script produced the expected output
+func (r *FixtureResult) Passed() bool {
+	return r.Err == nil && len(r.Diffs) == 0
+}
+
+// RunTestTransforms parses the test-transforms sub-command arguments, runs
+// every fixture found in the scripts directory and returns the exit code
+func RunTestTransforms(args []string) int {
+	fs := flag.NewFlagSet("test-transforms", flag.ContinueOnError)
+	configPath := fs.String("config", "config/config.yaml", "path to config file")
+	service := fs.String("service", "", "only run fixtures of this service")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	engine, err := NewEngine(cfg.Proxy.Transform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize transform engine: %v\n", err)
+		return 1
+	}
+
+	results, err := engine.RunFixtures(*service)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to run fixtures: %v\n", err)
+		return 1
+	}
+
+	if failed := PrintResults(os.Stdout, results); failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// RunFixtures executes all fixtures of the configured services. Fixtures live
+// in <scripts_dir>/<service>/fixtures/{request,response}/<case>.input.json
+// next to a matching <case>.expected.json file.
+func (e *Engine) RunFixtures(onlyService string) ([]*FixtureResult, error) {
+	var results []*FixtureResult
+	seen := make(map[string]bool)
+
+	for _, service := range e.config.Services {
+		if seen[service.ServiceName] || (onlyService != "" && service.ServiceName != onlyService) {
+			continue
+		}
+		seen[service.ServiceName] = true
+
+		fixtures, err := e.loadFixtures(service.ServiceName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fixture := range fixtures {
+			result := &FixtureResult{Fixture: fixture}
+			output, err := e.RunScript(fixture.Service, fixture.Direction == "request", fixture.Input)
+			if err != nil {
+				result.Err = err
+			} else {
+				result.Diffs = diff("", normalize(fixture.Expected), normalize(output))
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (e *Engine) loadFixtures(serviceName string) ([]*Fixture, error) {
+	var fixtures []*Fixture
+	for _, direction := range []string{"request", "response"} {
+		dir := filepath.Join(e.config.ScriptsDir, serviceName, "fixtures", direction)
+		inputs, err := filepath.Glob(filepath.Join(dir, "*.input.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(inputs)
+
+		for _, inputPath := range inputs {
+			name := strings.TrimSuffix(filepath.Base(inputPath), ".input.json")
+			fixture := &Fixture{Service: serviceName, Direction: direction, Name: name}
+
+			if err := readJSON(inputPath, &fixture.Input); err != nil {
+				return nil, fmt.Errorf("failed to read fixture %s: %v", inputPath, err)
+			}
+			expectedPath := filepath.Join(dir, name+".expected.json")
+			if err := readJSON(expectedPath, &fixture.Expected); err != nil {
+				return nil, fmt.Errorf("failed to read fixture %s: %v", expectedPath, err)
+			}
+			fixtures = append(fixtures, fixture)
+		}
+	}
+	return fixtures, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// normalize round-trips a value through JSON so script output and fixtures
+// share the same representation
+func normalize(v interface{}) interface{} {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func diff(path string, expected, actual interface{}) []string {
+	if expected == Wildcard {
+		if actual == nil {
+			return []string{fmt.Sprintf("%s: expected a value, got nothing", displayPath(path))}
+		}
+		return nil
+	}
+
+	expectedMap, expectedIsMap := expected.(map[string]interface{})
+	actualMap, actualIsMap := actual.(map[string]interface{})
+	if expectedIsMap && actualIsMap {
+		keys := make(map[string]struct{})
+		for k := range expectedMap {
+			keys[k] = struct{}{}
+		}
+		for k := range actualMap {
+			keys[k] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diffs []string
+		for _, k := range sorted {
+			ev, inExpected := expectedMap[k]
+			av, inActual := actualMap[k]
+			switch {
+			case !inExpected:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected value %s", displayPath(path+"."+k), encode(av)))
+			case !inActual:
+				diffs = append(diffs, fmt.Sprintf("%s: expected %s, got nothing", displayPath(path+"."+k), encode(ev)))
+			default:
+				diffs = append(diffs, diff(path+"."+k, ev, av)...)
+			}
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", displayPath(path), encode(expected), encode(actual))}
+	}
+	return nil
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "<root>"
+	}
+	return strings.TrimPrefix(path, ".")
+}
+
+func encode(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
+
+// PrintResults writes a report of the fixture run and returns the number of
+// failed fixtures
+func PrintResults(w io.Writer, results []*FixtureResult) int {
+	failed := 0
+	for _, r := range results {
+		name := fmt.Sprintf("%s/%s/%s", r.Fixture.Service, r.Fixture.Direction, r.Fixture.Name)
+		if r.Passed() {
+			fmt.Fprintf(w, "PASS %s\n", name)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(w, "FAIL %s\n", name)
+		if r.Err != nil {
+			fmt.Fprintf(w, "    error: %v\n", r.Err)
+		}
+		for _, d := range r.Diffs {
+			fmt.Fprintf(w, "    %s\n", d)
+		}
+	}
+	fmt.Fprintf(w, "\n%d fixtures, %d failed\n", len(results), failed)
+	return failed
+}
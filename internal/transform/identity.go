@@ -0,0 +1,32 @@
+package transform
+
+import "context"
+
+type clientCertKey struct{}
+
+// ClientCert is the verified certificate a client presented to the listener
+type ClientCert struct {
+	Subject string
+	Issuer  string
+	Serial  string
+}
+
+// WithClientCert returns a context whose scripts see the client certificate
+// of the request. Responses carry the context of their request.
+func WithClientCert(ctx context.Context, cert ClientCert) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, cert)
+}
+
+// scriptClientCert returns the client certificate of ctx for scripts, nil
+// when the client presented none
+func scriptClientCert(ctx context.Context) map[string]interface{} {
+	cert, ok := ctx.Value(clientCertKey{}).(ClientCert)
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{
+		"subject": cert.Subject,
+		"issuer":  cert.Issuer,
+		"serial":  cert.Serial,
+	}
+}
@@ -0,0 +1,89 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
+)
+
+// Router runs the routing script choosing the upstream of a request. The
+// script reads the request global and sets request.upstream to the name of a
+// configured upstream or to a base URL. Leaving it empty keeps the target
+// resolved from the configuration.
+type Router struct {
+	upstreams map[string]string
+	script    *goja.Program
+	sandbox   *sandbox
+	logger    zerolog.Logger
+}
+
+// NewRouter compiles the routing script. Routing scripts always run
+// sandboxed, they are evaluated for every request.
+func NewRouter(cfg *config.RoutingConfig) (*Router, error) {
+	upstreams := make(map[string]string, len(cfg.Upstreams))
+	for name, target := range cfg.Upstreams {
+		base, err := baseURL(target)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %v", name, err)
+		}
+		upstreams[name] = base
+	}
+
+	r := &Router{
+		upstreams: upstreams,
+		sandbox:   newSandbox(cfg.Sandbox),
+		logger:    log.Logger,
+	}
+	var err error
+	if r.script, err = compileScript(cfg.Script); err != nil {
+		return nil, fmt.Errorf("failed to compile routing script: %v", err)
+	}
+	return r, nil
+}
+
+// Route returns the base URL of the upstream chosen for req, empty when the
+// script kept the default target
+func (r *Router) Route(ctx context.Context, req map[string]interface{}) (string, error) {
+	logger := loggerFor(ctx, r.logger)
+	req["upstream"] = ""
+
+	var result map[string]interface{}
+	err := r.sandbox.run(func(vm *goja.Runtime) error {
+		var err error
+		result, err = run(vm, logger, featureflag.FromContext(ctx), r.script, "request", req)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	upstream, _ := result["upstream"].(string)
+	if upstream == "" {
+		return "", nil
+	}
+	if base, ok := r.upstreams[upstream]; ok {
+		return base, nil
+	}
+	base, err := baseURL(upstream)
+	if err != nil {
+		return "", fmt.Errorf("routing script returned unknown upstream %q", upstream)
+	}
+	return base, nil
+}
+
+// baseURL validates an absolute http(s) URL and strips its trailing slash,
+// the request URI is appended to it
+func baseURL(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid upstream url %s", target)
+	}
+	return strings.TrimSuffix(target, "/"), nil
+}
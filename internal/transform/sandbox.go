@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/tuncerburak97/muhtar/internal/config"
+)
+
+const (
+	defaultPoolSize     = 4
+	defaultTimeout      = 100 * time.Millisecond
+	defaultMaxCallStack = 256
+)
+
+// sandbox is a bounded pool of VMs owned by a single engine. Engines never
+// share VMs, so a tenant's scripts cannot see another tenant's globals, and a
+// runaway script only exhausts its own pool.
+type sandbox struct {
+	config   config.SandboxConfig
+	runtimes chan *goja.Runtime
+}
+
+func newSandbox(cfg config.SandboxConfig) *sandbox {
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = defaultPoolSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxCallStack <= 0 {
+		cfg.MaxCallStack = defaultMaxCallStack
+	}
+	s := &sandbox{
+		config:   cfg,
+		runtimes: make(chan *goja.Runtime, cfg.PoolSize),
+	}
+	for i := 0; i < cfg.PoolSize; i++ {
+		s.runtimes <- s.newRuntime()
+	}
+	return s
+}
+
+func (s *sandbox) newRuntime() *goja.Runtime {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(s.config.MaxCallStack)
+	return vm
+}
+
+// run executes fn on a pooled VM, interrupting it once the timeout expires.
+// Waiting for a free VM counts against the same timeout.
+func (s *sandbox) run(fn func(vm *goja.Runtime) error) error {
+	timer := time.NewTimer(s.config.Timeout)
+	defer timer.Stop()
+
+	var vm *goja.Runtime
+	select {
+	case vm = <-s.runtimes:
+	case <-timer.C:
+		return fmt.Errorf("transform sandbox busy")
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-timer.C:
+			vm.Interrupt("script timeout")
+		case <-done:
+		}
+	}()
+
+	err := fn(vm)
+	close(done)
+	<-exited
+
+	// An interrupted VM may be left in any state, replace it
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		vm = s.newRuntime()
+		err = fmt.Errorf("script exceeded %s", s.config.Timeout)
+	} else {
+		// The timer may have fired after the script completed
+		vm.ClearInterrupt()
+	}
+	s.runtimes <- vm
+	return err
+}
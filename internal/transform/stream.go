@@ -0,0 +1,209 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dop251/goja"
+	"github.com/tuncerburak97/muhtar/internal/featureflag"
+)
+
+// Stream modes
+const (
+	StreamChunk  = "chunk"
+	StreamNDJSON = "ndjson"
+)
+
+const defaultChunkSize = 32 << 10
+
+// StreamHook transforms a body piece by piece. In chunk mode a piece ends at
+// the last newline within the chunk size when there is one, so line oriented
+// content is not split mid-line. In ndjson mode a piece is one line without
+// its newline. Returning an empty piece drops it. Registered hooks are shared
+// by concurrent requests.
+type StreamHook func(piece []byte) ([]byte, error)
+
+// streamReader applies a hook to the body read from src as it is consumed
+type streamReader struct {
+	src    *bufio.Reader
+	closer io.Closer
+	hook   StreamHook
+	ndjson bool
+	size   int
+
+	out   []byte // Transformed bytes not read yet
+	carry []byte // Chunk mode, bytes after the last newline of the previous chunk
+	buf   []byte
+	err   error
+}
+
+// NewStreamReader returns a reader transforming r with hook, in chunks of
+// chunkSize bytes or per NDJSON line. Closing it closes r.
+func NewStreamReader(r io.Reader, hook StreamHook, mode string, chunkSize int) io.ReadCloser {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	s := &streamReader{
+		src:    bufio.NewReaderSize(r, chunkSize),
+		hook:   hook,
+		ndjson: mode == StreamNDJSON,
+		size:   chunkSize,
+	}
+	if c, ok := r.(io.Closer); ok {
+		s.closer = c
+	}
+	return s
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 && s.err == nil {
+		if s.ndjson {
+			s.nextLine()
+		} else {
+			s.nextChunk()
+		}
+	}
+	if len(s.out) > 0 {
+		n := copy(p, s.out)
+		s.out = s.out[n:]
+		return n, nil
+	}
+	return 0, s.err
+}
+
+func (s *streamReader) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+func (s *streamReader) nextLine() {
+	line, err := s.src.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		s.err = err
+		return
+	}
+	if err == io.EOF {
+		s.err = io.EOF
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return
+	}
+	out, herr := s.hook(line)
+	if herr != nil {
+		s.err = herr
+		return
+	}
+	if len(out) > 0 {
+		s.out = append(out, '\n')
+	}
+}
+
+func (s *streamReader) nextChunk() {
+	if s.buf == nil {
+		s.buf = make([]byte, s.size)
+	}
+	n, err := io.ReadFull(s.src, s.buf)
+	chunk := append(s.carry, s.buf[:n]...)
+	s.carry = nil
+	switch {
+	case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+		s.err = io.EOF
+	case err != nil:
+		s.err = err
+		return
+	default:
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 && i < len(chunk)-1 {
+			s.carry = append([]byte(nil), chunk[i+1:]...)
+			chunk = chunk[:i+1]
+		}
+	}
+	if len(chunk) == 0 {
+		return
+	}
+	out, herr := s.hook(chunk)
+	if herr != nil {
+		s.err = herr
+		return
+	}
+	s.out = out
+}
+
+// scriptHook calls the stream function of a script for every piece: onChunk
+// receives and returns a string, onLine a parsed NDJSON record. Returning
+// null or undefined drops the piece.
+func (e *Engine) scriptHook(ctx context.Context, script *goja.Program, mode string) StreamHook {
+	logger := loggerFor(ctx, e.logger)
+	flags := featureflag.FromContext(ctx)
+	if e.sandbox == nil {
+		// A VM dedicated to the stream, the script runs once
+		var vm *goja.Runtime
+		return func(piece []byte) ([]byte, error) {
+			if vm == nil {
+				vm = goja.New()
+				setGlobals(vm, logger, flags)
+				if _, err := vm.RunProgram(script); err != nil {
+					return nil, err
+				}
+			}
+			return callStream(vm, mode, piece)
+		}
+	}
+
+	// Pooled VMs are shared, the script defines its functions again on each
+	// piece and each piece gets the full sandbox timeout
+	return func(piece []byte) ([]byte, error) {
+		var out []byte
+		err := e.sandbox.run(func(vm *goja.Runtime) error {
+			setGlobals(vm, logger, flags)
+			if _, err := vm.RunProgram(script); err != nil {
+				return err
+			}
+			var err error
+			out, err = callStream(vm, mode, piece)
+			return err
+		})
+		return out, err
+	}
+}
+
+func callStream(vm *goja.Runtime, mode string, piece []byte) ([]byte, error) {
+	name := "onChunk"
+	if mode == StreamNDJSON {
+		name = "onLine"
+	}
+	fn, ok := goja.AssertFunction(vm.Get(name))
+	if !ok {
+		return nil, fmt.Errorf("stream script does not define %s", name)
+	}
+
+	var arg goja.Value
+	if mode == StreamNDJSON {
+		var record interface{}
+		if err := json.Unmarshal(piece, &record); err != nil {
+			return nil, fmt.Errorf("invalid ndjson line: %v", err)
+		}
+		arg = vm.ToValue(record)
+	} else {
+		arg = vm.ToValue(string(piece))
+	}
+
+	result, err := fn(goja.Undefined(), arg)
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, nil
+	}
+	if mode == StreamNDJSON {
+		return json.Marshal(result.Export())
+	}
+	return []byte(result.String()), nil
+}
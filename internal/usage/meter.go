@@ -0,0 +1,206 @@
+package usage
+
+import (
+	"context"
+	"encoding/csv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/tuncerburak97/muhtar/internal/config"
+	"github.com/tuncerburak97/muhtar/internal/model"
+	"github.com/tuncerburak97/muhtar/internal/repository"
+)
+
+type key struct {
+	hour   time.Time
+	tenant string
+}
+
+// Meter counts requests, errors and bandwidth per tenant and hour and adds
+// them to the stored usage on every flush
+type Meter struct {
+	config *config.UsageConfig
+	repo   repository.UsageRepository
+	reader repository.UsageRepository
+
+	mu      sync.Mutex
+	buckets map[key]*model.Usage
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMeter starts the usage flush job. reader is used by the export endpoint
+// and may be a read replica.
+func NewMeter(cfg *config.UsageConfig, repo, reader repository.UsageRepository) *Meter {
+	m := &Meter{
+		config:  cfg,
+		repo:    repo,
+		reader:  reader,
+		buckets: make(map[key]*model.Usage),
+		done:    make(chan struct{}),
+	}
+	m.wg.Add(1)
+	go m.run()
+	return m
+}
+
+// Observe records one proxied exchange of the tenant
+func (m *Meter) Observe(tenant string, bytesIn, bytesOut int, failed bool) {
+	k := key{hour: time.Now().UTC().Truncate(time.Hour), tenant: tenant}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.buckets[k]
+	if !ok {
+		u = &model.Usage{Hour: k.hour, Tenant: tenant}
+		m.buckets[k] = u
+	}
+	u.Requests++
+	if failed {
+		u.Errors++
+	}
+	u.BytesIn += int64(bytesIn)
+	u.BytesOut += int64(bytesOut)
+}
+
+func (m *Meter) run() {
+	defer m.wg.Done()
+
+	interval := m.config.FlushInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			m.flush()
+			return
+		case <-ticker.C:
+			m.flush()
+		}
+	}
+}
+
+// flush hands the counters over to the repository. Stored rows are added to,
+// so the hour in progress is flushed as well. Failed writes are merged back
+// and retried on the next flush.
+func (m *Meter) flush() {
+	m.mu.Lock()
+	usage := make([]*model.Usage, 0, len(m.buckets))
+	for _, u := range m.buckets {
+		usage = append(usage, u)
+	}
+	m.buckets = make(map[key]*model.Usage)
+	m.mu.Unlock()
+
+	if len(usage) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.repo.SaveUsage(ctx, usage); err != nil {
+		log.Error().Err(err).Int("count", len(usage)).Msg("Failed to save tenant usage")
+		m.restore(usage)
+	}
+}
+
+func (m *Meter) restore(usage []*model.Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range usage {
+		k := key{hour: u.Hour, tenant: u.Tenant}
+		if cur, ok := m.buckets[k]; ok {
+			cur.Requests += u.Requests
+			cur.Errors += u.Errors
+			cur.BytesIn += u.BytesIn
+			cur.BytesOut += u.BytesOut
+			continue
+		}
+		m.buckets[k] = u
+	}
+}
+
+// Close flushes pending usage and stops the job
+func (m *Meter) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
+
+// RegisterAdminRoutes mounts the usage export endpoint
+func (m *Meter) RegisterAdminRoutes(r fiber.Router) {
+	r.Get("/usage/export", m.handleExport)
+}
+
+// handleExport returns hourly usage as JSON or CSV. The range defaults to the
+// last 24 hours; from and to are RFC3339 timestamps.
+func (m *Meter) handleExport(c *fiber.Ctx) error {
+	filter := model.UsageFilter{
+		Tenant: c.Query("tenant"),
+		From:   time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Hour),
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid from timestamp")
+		}
+		filter.From = from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid to timestamp")
+		}
+		filter.To = to
+	}
+
+	usage, err := m.reader.FindUsage(c.Context(), filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		rows := make([]fiber.Map, 0, len(usage))
+		for _, u := range usage {
+			rows = append(rows, fiber.Map{
+				"hour":       u.Hour,
+				"tenant":     u.Tenant,
+				"requests":   u.Requests,
+				"errors":     u.Errors,
+				"error_rate": u.ErrorRate(),
+				"bytes_in":   u.BytesIn,
+				"bytes_out":  u.BytesOut,
+			})
+		}
+		return c.JSON(fiber.Map{
+			"count": len(rows),
+			"usage": rows,
+		})
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="usage.csv"`)
+		w := csv.NewWriter(c)
+		w.Write([]string{"hour", "tenant", "requests", "errors", "error_rate", "bytes_in", "bytes_out"})
+		for _, u := range usage {
+			w.Write([]string{
+				u.Hour.UTC().Format(time.RFC3339),
+				u.Tenant,
+				strconv.FormatInt(u.Requests, 10),
+				strconv.FormatInt(u.Errors, 10),
+				strconv.FormatFloat(u.ErrorRate(), 'f', 4, 64),
+				strconv.FormatInt(u.BytesIn, 10),
+				strconv.FormatInt(u.BytesOut, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fiber.NewError(fiber.StatusBadRequest, "format must be json or csv")
+}
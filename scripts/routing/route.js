@@ -0,0 +1,21 @@
+// Routing script, evaluated for every proxied request.
+//
+// request holds method, path, query, headers, body (parsed when JSON),
+// client_ip, tenant and target, the upstream chosen by the configuration.
+// Set request.upstream to a configured upstream name or a base URL, or leave
+// it empty to keep the target.
+
+// Customers of the EU segment are served by the EU deployment
+if (request.headers["X-Customer-Segment"] === "eu") {
+  request.upstream = "eu";
+}
+
+// Orders above the threshold go to the upstream handling large orders
+if (request.path === "/api/v1/orders" && request.body && request.body.total > 10000) {
+  request.upstream = "http://orders-large.internal:8080";
+}
+
+// Send five percent of the remaining traffic to the canary
+if (!request.upstream && Math.random() < 0.05) {
+  request.upstream = "canary";
+}
@@ -0,0 +1,16 @@
+// User service streamed request transformation, used for bodies above the
+// stream_request threshold. Top level code only defines functions, it may
+// run again for every piece.
+
+// chunk mode: receives a piece of the body ending at a newline when possible
+function onChunk(chunk) {
+  return chunk.replace(/"password"\s*:\s*"[^"]*"/g, '"password":"********"');
+}
+
+// ndjson mode: receives one parsed record, returning null drops it
+function onLine(record) {
+  if (record.password) {
+    record.password = "********";
+  }
+  return record;
+}
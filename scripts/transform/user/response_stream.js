@@ -0,0 +1,14 @@
+// User service streamed response transformation, used for bodies above the
+// stream_response threshold. Top level code only defines functions, it may
+// run again for every piece.
+
+// chunk mode: points links at the public host instead of the internal one
+function onChunk(chunk) {
+  return chunk.replace(/http:\/\/user-service\.internal:8080/g, "https://api.example.com/users");
+}
+
+// ndjson mode: receives one parsed record, returning null drops it
+function onLine(record) {
+  delete record.internal_id;
+  return record;
+}